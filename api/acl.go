@@ -13,182 +13,327 @@ import (
 	"github.com/pearsonappeng/tensor/rbac"
 	"github.com/pearsonappeng/tensor/util"
 	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
-// AccessList is a Gin handler function, returns access list
-// for specified credential object
-func (ctrl CredentialController) AccessList(c *gin.Context) {
-	credential := c.MustGet(cCredential).(common.Credential)
+// Reasons reported in access list entries, explaining
+// why a user has access to the object
+const (
+	accessSuperUser     = "superuser"
+	accessSystemAuditor = "system_auditor"
+	accessOrgAdmin      = "organization_admin"
+	accessTeamRole      = "team_role"
+	accessDirectRole    = "direct_role"
+)
 
-	var organization common.Organization
-	if err := db.Organizations().FindId(credential.OrganizationID).One(&organization); err != nil {
-		logrus.Errorln("Error while retriving Organization:", err)
-		c.JSON(http.StatusInternalServerError, common.Error{
-			Code:   http.StatusInternalServerError,
-			Errors: []string{"Error while getting Access List"},
-		})
-		return
+// accessList collects direct and indirect access of users to an object
+type accessList map[bson.ObjectId]*common.AccessType
+
+// accessRole describes the object a role is granted on
+type accessRole struct {
+	resourceType string
+	resourceName string
+	url          string
+}
+
+func (a accessList) get(userID bson.ObjectId) *common.AccessType {
+	access, ok := a[userID]
+	if !ok {
+		access = &common.AccessType{DirectAccess: []gin.H{}, IndirectAccess: []gin.H{}}
+		a[userID] = access
 	}
+	return access
+}
 
-	var allaccess map[bson.ObjectId]*common.AccessType
+// entry builds an access list entry for the given role
+func (r accessRole) entry(reason, role, description string, descendants ...string) gin.H {
+	return gin.H{
+		"reason":           reason,
+		"descendant_roles": descendants,
+		"role": gin.H{
+			"resource_name": r.resourceName,
+			"description":   description,
+			"related": gin.H{
+				r.resourceType: r.url,
+			},
+			"resource_type": r.resourceType,
+			"name":          role,
+		},
+	}
+}
 
-	// indirect access from organization
-	for _, v := range organization.Roles {
-		if v.Type == "user" {
-			// if an organization admin
-			switch v.Role {
-			case rbac.OrganizationAdmin:
-				{
-					access := gin.H{
-						"descendant_roles": []string{
-							"admin",
-							"use",
-							"read",
-						},
-						"role": gin.H{
-							"resource_name": organization.Name,
-							"description":   "Can manage all aspects of the organization",
-							"related": gin.H{
-								"organization": "/v1/organizations/" + organization.ID.Hex() + "/",
-							},
-							"resource_type": "organization",
-							"name":          rbac.OrganizationAdmin,
-						},
-					}
+func (a accessList) direct(userID bson.ObjectId, entry gin.H) {
+	access := a.get(userID)
+	access.DirectAccess = append(access.DirectAccess, entry)
+}
 
-					allaccess[v.GranteeID].IndirectAccess = append(allaccess[v.GranteeID].IndirectAccess, access)
-				}
-			// if an organization auditor or member
-			case rbac.OrganizationMember:
-				{
-					access := gin.H{
-						"descendant_roles": []string{
-							"read",
-							"use",
-						},
-						"role": gin.H{
-							"resource_name": organization.Name,
-							"description":   "User is a member of the Organization",
-							"related": gin.H{
-								"organization": "/v1/organizations/" + organization.ID.Hex() + "/",
-							},
-							"resource_type": "organization",
-							"name":          rbac.OrganizationMember,
-						},
-					}
+func (a accessList) indirect(userID bson.ObjectId, entry gin.H) {
+	access := a.get(userID)
+	access.IndirectAccess = append(access.IndirectAccess, entry)
+}
 
-					allaccess[v.GranteeID].IndirectAccess = append(allaccess[v.GranteeID].IndirectAccess, access)
-				}
-			// if an organization auditor
-			case rbac.OrganizationAuditor:
-				{
-					access := gin.H{
-						"descendant_roles": []string{
-							"read",
-						},
-						"role": gin.H{
-							"resource_name": organization.Name,
-							"description":   "Can view all aspects of the organization",
-							"related": gin.H{
-								"organization": "/v1/organizations/" + organization.ID.Hex() + "/",
-							},
-							"resource_type": "organization",
-							"name":          rbac.OrganizationAuditor,
-						},
-					}
-					allaccess[v.GranteeID].IndirectAccess = append(allaccess[v.GranteeID].IndirectAccess, access)
-				}
-			}
+// addGlobal adds superusers and system auditors, who have access to every object
+func (a accessList) addGlobal(r accessRole, writeRoles []string, readRoles []string) error {
+	var users []common.User
+	query := bson.M{"$or": []bson.M{{"is_superuser": true}, {"is_system_auditor": true}}}
+	if err := db.Users().Find(query).Select(bson.M{"_id": 1, "is_superuser": 1}).All(&users); err != nil {
+		return err
+	}
+
+	for _, v := range users {
+		if v.IsSuperUser {
+			a.indirect(v.ID, r.entry(accessSuperUser, "system_administrator",
+				"Can manage all aspects of the system", writeRoles...))
+			continue
 		}
+		a.indirect(v.ID, r.entry(accessSystemAuditor, "system_auditor",
+			"Can view all aspects of the system", readRoles...))
 	}
+	return nil
+}
 
-	// direct access
+// addOrganizationAdmins adds admins of the organization that owns the object
+func (a accessList) addOrganizationAdmins(r accessRole, orgID bson.ObjectId, roles ...string) error {
+	var organization common.Organization
+	if err := db.Organizations().FindId(orgID).One(&organization); err != nil {
+		return err
+	}
 
-	for _, v := range credential.Roles {
-		if v.Type == "user" {
-			// if an inventory admin
-			switch v.Role {
-			case rbac.CredentialAdmin:
-				{
-					access := gin.H{
-						"descendant_roles": []string{
-							"admin",
-							"use",
-							"read",
-						},
-						"role": gin.H{
-							"resource_name": credential.Name,
-							"description":   "Can manage all aspects of the credential",
-							"related": gin.H{
-								"inventory": "/v1/credentials/" + credential.ID.Hex() + "/",
-							},
-							"resource_type": "credential",
-							"name":          rbac.InventoryAdmin,
-						},
-					}
+	for _, v := range organization.Roles {
+		if v.Type == rbac.RoleTypeUser && v.Role == rbac.OrganizationAdmin {
+			a.indirect(v.GranteeID, accessRole{
+				resourceType: "organization",
+				resourceName: organization.Name,
+				url:          "/v1/organizations/" + organization.ID.Hex() + "/",
+			}.entry(accessOrgAdmin, rbac.OrganizationAdmin,
+				"Can manage all aspects of the organization", roles...))
+		}
+	}
+	return nil
+}
 
-					allaccess[v.GranteeID].DirectAccess = append(allaccess[v.GranteeID].DirectAccess, access)
+// addRoles adds users granted a role on the object, either directly or through
+// membership of a granted team. descriptions maps each built-in role to its description
+// and descendants maps each role to the roles it implies. Custom roles are described
+// by their stored description, grants of unknown roles are skipped
+func (a accessList) addRoles(r accessRole, roles []common.AccessControl,
+	descriptions map[string]string, descendants map[string][]string) error {
+	custom := map[string]*common.Role{}
+	for _, v := range roles {
+		description, ok := descriptions[v.Role]
+		if !ok {
+			role, found := custom[v.Role]
+			if !found {
+				var tmpRole common.Role
+				err := db.Roles().Find(bson.M{"name": v.Role}).One(&tmpRole)
+				if err != nil && err != mgo.ErrNotFound {
+					return err
 				}
-			// if an inventory
-			case rbac.InventoryUse:
-				{
-					access := gin.H{
-						"descendant_roles": []string{
-							"use",
-							"read",
-						},
-						"role": gin.H{
-							"resource_name": credential.Name,
-							"description":   "Can use the credential in a job template",
-							"related": gin.H{
-								"inventory": "/v1/credentials/" + credential.ID.Hex() + "/",
-							},
-							"resource_type": "credential",
-							"name":          rbac.InventoryUse,
-						},
-					}
-					allaccess[v.GranteeID].DirectAccess = append(allaccess[v.GranteeID].DirectAccess, access)
+				if err == nil {
+					role = &tmpRole
+				}
+				custom[v.Role] = role
+			}
+			if role == nil {
+				continue
+			}
+			description = role.Description
+		}
+
+		switch v.Type {
+		case rbac.RoleTypeUser:
+			a.direct(v.GranteeID, r.entry(accessDirectRole, v.Role, description, descendants[v.Role]...))
+		case rbac.RoleTypeTeam:
+			var team common.Team
+			if err := db.Teams().FindId(v.GranteeID).One(&team); err != nil {
+				return err
+			}
+			for _, member := range team.Roles {
+				if member.Type != rbac.RoleTypeUser {
+					continue
+				}
+				entry := r.entry(accessTeamRole, v.Role, description, descendants[v.Role]...)
+				entry["team"] = gin.H{
+					"id":   team.ID,
+					"name": team.Name,
+					"url":  "/v1/teams/" + team.ID.Hex() + "/",
 				}
+				a.indirect(member.GranteeID, entry)
 			}
 		}
+	}
+	return nil
+}
 
+// users returns the users in the access list, ordered by username
+func (a accessList) users() ([]common.AccessUser, error) {
+	var ids []bson.ObjectId
+	for k := range a {
+		ids = append(ids, k)
 	}
 
-	var usrs []common.AccessUser
+	usrs := []common.AccessUser{}
+	if len(ids) == 0 {
+		return usrs, nil
+	}
 
-	for k, v := range allaccess {
-		var user common.AccessUser
-		err := db.Users().FindId(k).One(&user)
-		if err != nil {
-			logrus.Errorln("Error while retriving user data:", err)
-			c.JSON(http.StatusInternalServerError, common.Error{
-				Code:   http.StatusInternalServerError,
-				Errors: []string{"Error while getting Access List"},
-			})
-			return
-		}
+	if err := db.Users().Find(bson.M{"_id": bson.M{"$in": ids}}).Sort("username").All(&usrs); err != nil {
+		return nil, err
+	}
 
-		metadata.AccessUserMetadata(&user)
-		user.Summary = v
-		usrs = append(usrs, user)
+	for i := range usrs {
+		metadata.AccessUserMetadata(&usrs[i])
+		usrs[i].Summary = a[usrs[i].ID]
+	}
+	return usrs, nil
+}
+
+// respond renders the access list as a paginated response
+func (a accessList) respond(c *gin.Context) {
+	usrs, err := a.users()
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Access List",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
 	}
 
 	count := len(usrs)
 	pgi := util.NewPagination(c, count)
-	//if page is incorrect return 404
 	if pgi.HasPage() {
-		c.JSON(http.StatusNotFound, gin.H{"detail": "Invalid page " + strconv.Itoa(pgi.Page()) + ": That page contains no results."})
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
 		return
 	}
-	// send response with JSON rendered data
+
 	c.JSON(http.StatusOK, common.Response{
 		Count:    count,
 		Next:     pgi.NextPage(),
 		Previous: pgi.PreviousPage(),
 		Data:     usrs[pgi.Skip():pgi.End()],
 	})
+}
+
+// AccessList is a Gin handler function, returns access list
+// for specified organization object
+func (ctrl OrganizationController) AccessList(c *gin.Context) {
+	organization := c.MustGet(cOrganization).(common.Organization)
+
+	r := accessRole{
+		resourceType: "organization",
+		resourceName: organization.Name,
+		url:          "/v1/organizations/" + organization.ID.Hex() + "/",
+	}
+
+	allaccess := accessList{}
+	if err := allaccess.addGlobal(r, []string{"admin", "member", "read"}, []string{"read"}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Access List",
+			Log:     logrus.Fields{"Organization ID": organization.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if err := allaccess.addRoles(r, organization.Roles,
+		map[string]string{
+			rbac.OrganizationAdmin:   "Can manage all aspects of the organization",
+			rbac.OrganizationMember:  "User is a member of the organization",
+			rbac.OrganizationAuditor: "Can view all aspects of the organization",
+		},
+		map[string][]string{
+			rbac.OrganizationAdmin:   {"admin", "member", "read"},
+			rbac.OrganizationMember:  {"member", "read"},
+			rbac.OrganizationAuditor: {"read"},
+		}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Access List",
+			Log:     logrus.Fields{"Organization ID": organization.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	allaccess.respond(c)
+}
+
+// AccessList is a Gin handler function, returns access list
+// for specified user object
+func (ctrl UserController) AccessList(c *gin.Context) {
+	user := c.MustGet(cUserA).(common.User)
+
+	r := accessRole{
+		resourceType: "user",
+		resourceName: user.Username,
+		url:          "/v1/users/" + user.ID.Hex() + "/",
+	}
+
+	// system auditors can manage every user as rbac.User grants them write access
+	allaccess := accessList{}
+	if err := allaccess.addGlobal(r, []string{"admin", "read"}, []string{"admin", "read"}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Access List",
+			Log:     logrus.Fields{"User ID": user.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	// users can always manage their own account
+	allaccess.direct(user.ID, r.entry(accessDirectRole, "admin",
+		"Can manage all aspects of the user", "admin", "read"))
+
+	allaccess.respond(c)
+}
+
+// AccessList is a Gin handler function, returns access list
+// for specified credential object
+func (ctrl CredentialController) AccessList(c *gin.Context) {
+	credential := c.MustGet(cCredential).(common.Credential)
+
+	r := accessRole{
+		resourceType: "credential",
+		resourceName: credential.Name,
+		url:          "/v1/credentials/" + credential.ID.Hex() + "/",
+	}
+
+	allaccess := accessList{}
+	if err := allaccess.addGlobal(r, []string{"admin", "use", "read"}, []string{"read"}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Access List",
+			Log:     logrus.Fields{"Credential ID": credential.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	// organization can be empty in credential objects
+	if credential.OrganizationID != nil {
+		if err := allaccess.addOrganizationAdmins(r, *credential.OrganizationID, "admin", "use", "read"); err != nil {
+			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+				Message: "Error while getting Access List",
+				Log:     logrus.Fields{"Credential ID": credential.ID.Hex(), "Error": err.Error()},
+			})
+			return
+		}
+	}
+
+	if err := allaccess.addRoles(r, credential.Roles,
+		map[string]string{
+			rbac.CredentialAdmin: "Can manage all aspects of the credential",
+			rbac.CredentialUse:   "Can use the credential in job templates, projects and launches",
+		},
+		map[string][]string{
+			rbac.CredentialAdmin: {"admin", "use", "read"},
+			rbac.CredentialUse:   {"use"},
+		}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Access List",
+			Log:     logrus.Fields{"Credential ID": credential.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
 
+	allaccess.respond(c)
 }
 
 // AccessList returns the list of teams and users that is able to access
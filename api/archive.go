@@ -0,0 +1,167 @@
+package api
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/exec/sync"
+	"github.com/pearsonappeng/tensor/log/activity"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/rbac"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/gin-gonic/gin.v1"
+)
+
+// Archives returns the archive revisions of a manual project which are available for rollback
+func (ctrl ProjectController) Archives(c *gin.Context) {
+	project := c.MustGet(cProject).(common.Project)
+
+	archives := project.Archives
+	if archives == nil {
+		archives = []common.ProjectArchive{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"revision": project.ScmRevision,
+		"archives": archives,
+	})
+}
+
+// UploadArchive replaces the content of a manual project with a .tar.gz or .zip archive.
+// The archive is sent as the `file` field of a multipart form or as the request body
+func (ctrl ProjectController) UploadArchive(c *gin.Context) {
+	project := c.MustGet(cProject).(common.Project)
+	tmpProject := project
+	user := c.MustGet(cUser).(common.User)
+
+	if !new(rbac.Project).Write(user, project) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	if project.ScmType != "manual" {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Archives can be uploaded to manual projects only.",
+		})
+		return
+	}
+
+	limit := int64(util.Config.ProjectArchive.MaxSize) << 20
+	// leave room for the multipart envelope
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+(1<<20))
+
+	var body io.Reader = c.Request.Body
+	name := ""
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Archive file required.",
+			})
+			return
+		}
+		defer file.Close()
+		body = file
+		name = header.Filename
+	}
+
+	tmp, err := ioutil.TempFile("", "tensor_archive")
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
+			Message: "Error while receiving archive",
+			Log:     logrus.Fields{"Project ID": project.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, io.LimitReader(body, limit+1))
+	if err != nil || size > limit {
+		AbortWithError(LogFields{Context: c, Status: http.StatusRequestEntityTooLarge,
+			Message: "Archive exceeds the size limit.",
+		})
+		return
+	}
+	if size == 0 {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Archive file required.",
+		})
+		return
+	}
+
+	project, err = sync.UploadArchive(project, tmp.Name(), common.ProjectArchive{
+		Name:         name,
+		Size:         size,
+		UploadedByID: user.ID,
+		Uploaded:     time.Now(),
+	})
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Invalid archive, " + err.Error(),
+			Log:     logrus.Fields{"Project ID": project.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	// install roles and collections of the new content
+	if _, err := sync.UpdateProject(project); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Project ID": project.ID.Hex(),
+			"Error":      err.Error(),
+		}).Errorln("Error while scm update")
+	}
+
+	activity.AddActivity(activity.Update, user.ID, tmpProject, project)
+	metadata.ProjectMetadata(&project)
+	c.JSON(http.StatusCreated, project)
+}
+
+// RollbackArchive restores a previous archive revision of a manual project
+func (ctrl ProjectController) RollbackArchive(c *gin.Context) {
+	project := c.MustGet(cProject).(common.Project)
+	tmpProject := project
+	user := c.MustGet(cUser).(common.User)
+
+	if !new(rbac.Project).Write(user, project) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	if project.ScmType != "manual" {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Rollback is only available for manual projects.",
+		})
+		return
+	}
+
+	project, err := sync.RollbackArchive(project, c.Params.ByName("revision"))
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: err.Error(),
+			Log:     logrus.Fields{"Project ID": project.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	// install roles and collections of the new content
+	if _, err := sync.UpdateProject(project); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Project ID": project.ID.Hex(),
+			"Error":      err.Error(),
+		}).Errorln("Error while scm update")
+	}
+
+	activity.AddActivity(activity.Update, user.ID, tmpProject, project)
+	metadata.ProjectMetadata(&project)
+	c.JSON(http.StatusOK, project)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -90,38 +91,31 @@ func (ctrl CredentialController) One(c *gin.Context) {
 // GetCredentials is a Gin handler function which returns list of credentials
 // This takes lookup parameters and order parameters to filter and sort output data
 func (ctrl CredentialController) All(c *gin.Context) {
-	user := c.MustGet(cUser).(common.User)
-
 	parser := util.NewQueryParser(c)
 	match := bson.M{}
 	match = parser.Match([]string{"kind"}, match)
 	match = parser.Lookups([]string{"name", "username"}, match)
-	query := db.Credentials().Find(match)
-	if order := parser.OrderBy(); order != "" {
-		query.Sort(order)
-	}
 
-	roles := new(rbac.Credential)
-	var credentials []common.Credential
-	iter := query.Iter()
-	var credential common.Credential
-	for iter.Next(&credential) {
-		if !roles.Read(user, credential) {
-			continue
-		}
-		hideEncrypted(&credential)
-		metadata.CredentialMetadata(&credential)
-		credentials = append(credentials, credential)
+	// restrict the query to objects the user can read
+	access, err := accessFilter(c, rbac.ResourceCredential, "_id")
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting credential",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
 	}
-	if err := iter.Close(); err != nil {
+
+	query := db.Credentials().Find(restrict(match, access))
+	count, err := query.Count()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while getting credential", Log: logrus.Fields{
-				"Error": err.Error(),
-			},
+			Message: "Error while getting credential",
+			Log:     logrus.Fields{"Error": err.Error()},
 		})
 		return
 	}
-	count := len(credentials)
+
 	pgi := util.NewPagination(c, count)
 	if pgi.HasPage() {
 		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
@@ -130,12 +124,28 @@ func (ctrl CredentialController) All(c *gin.Context) {
 		return
 	}
 
-	// send response with JSON rendered data
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var credentials []common.Credential
+	if err := query.Skip(pgi.Skip()).Limit(pgi.Limit()).All(&credentials); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting credential",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range credentials {
+		hideEncrypted(&credentials[i])
+		metadata.CredentialMetadata(&credentials[i])
+	}
+
 	c.JSON(http.StatusOK, common.Response{
 		Count:    count,
 		Next:     pgi.NextPage(),
 		Previous: pgi.PreviousPage(),
-		Data:     credentials[pgi.Skip():pgi.End()],
+		Data:     credentials,
 	})
 }
 
@@ -175,6 +185,14 @@ func (ctrl CredentialController) Create(c *gin.Context) {
 		return
 	}
 
+	if !lookupsAllowed(c, user, req, nil) {
+		return
+	}
+
+	if !checkCredentialInputs(c, &req, nil) {
+		return
+	}
+
 	req.ID = bson.NewObjectId()
 	req.Name = strings.Trim(req.Name, " ")
 	req.Description = strings.Trim(req.Description, " ")
@@ -185,6 +203,8 @@ func (ctrl CredentialController) Create(c *gin.Context) {
 	req.VaultPassword = util.Cipher(req.VaultPassword)
 	req.AuthorizePassword = util.Cipher(req.AuthorizePassword)
 	req.Secret = util.Cipher(req.Secret)
+	req.SecurityToken = util.Cipher(req.SecurityToken)
+	clearLookedUp(&req)
 	req.CreatedByID = user.ID
 	req.ModifiedByID = user.ID
 	req.Created = time.Now()
@@ -252,6 +272,10 @@ func (ctrl CredentialController) Update(c *gin.Context) {
 		return
 	}
 
+	if !lookupsAllowed(c, user, req, &credential) {
+		return
+	}
+
 	// system generated
 	credential.Name = strings.Trim(req.Name, " ")
 	credential.Description = strings.Trim(req.Description, " ")
@@ -259,7 +283,6 @@ func (ctrl CredentialController) Update(c *gin.Context) {
 	credential.Cloud = req.Cloud
 	credential.Host = req.Host
 	credential.Username = req.Username
-	credential.SecurityToken = req.SecurityToken
 	credential.Project = req.Project
 	credential.Domain = req.Domain
 	credential.BecomeMethod = req.BecomeMethod
@@ -268,6 +291,8 @@ func (ctrl CredentialController) Update(c *gin.Context) {
 	credential.Tenant = req.Tenant
 	credential.Client = req.Client
 	credential.Authorize = req.Authorize
+	credential.Principals = req.Principals
+	credential.CertificateTTL = req.CertificateTTL
 	credential.OrganizationID = req.OrganizationID
 	credential.ModifiedByID = user.ID
 	credential.Modified = time.Now()
@@ -293,6 +318,18 @@ func (ctrl CredentialController) Update(c *gin.Context) {
 	if req.Secret != "$encrypted$" {
 		credential.Secret = util.Cipher(req.Secret)
 	}
+	if req.SecurityToken != "$encrypted$" {
+		credential.SecurityToken = util.Cipher(req.SecurityToken)
+	}
+	credential.Lookups = req.Lookups
+	clearLookedUp(&credential)
+
+	if !checkCredentialInputs(c, &req, credential.SecretInputs) {
+		return
+	}
+	credential.CredentialTypeID = req.CredentialTypeID
+	credential.Inputs = req.Inputs
+	credential.SecretInputs = req.SecretInputs
 
 	if err := db.Credentials().UpdateId(credential.ID, credential); err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
@@ -503,3 +540,107 @@ func (ctrl CredentialController) ObjectRoles(c *gin.Context) {
 		Data:     roles[pgi.Skip():pgi.End()],
 	})
 }
+
+// lookupsAllowed reports whether the user may configure the lookups of the credential.
+// Lookups read anything the server can reach in the external stores, only super users
+// can add or change them or move a credential with lookups to another organization.
+// current is nil for new credentials. A failure aborts the request and returns false
+func lookupsAllowed(c *gin.Context, user common.User, req common.Credential, current *common.Credential) bool {
+	if rbac.HasGlobalWrite(user) {
+		return true
+	}
+
+	var changed bool
+	if current == nil {
+		changed = len(req.Lookups) > 0
+	} else {
+		changed = (len(req.Lookups) > 0 || len(current.Lookups) > 0) &&
+			(!reflect.DeepEqual(req.Lookups, current.Lookups) || !sameOrganization(req.OrganizationID, current.OrganizationID))
+	}
+	if changed {
+		AbortWithError(LogFields{Context: c, Status: http.StatusForbidden,
+			Message: "Only super users can configure secret lookups.",
+		})
+		return false
+	}
+	return true
+}
+
+// sameOrganization reports whether both organization IDs refer to the same organization or none
+func sameOrganization(a, b *bson.ObjectId) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// clearLookedUp removes stored values of fields that reference an
+// external secret store, those are resolved when a job starts
+func clearLookedUp(credential *common.Credential) {
+	for name := range credential.Lookups {
+		if field := credential.SecretField(name); field != nil {
+			*field = ""
+		}
+	}
+}
+
+// checkCredentialInputs validates inputs of a custom credential against its credential type
+// and moves secret inputs to SecretInputs encrypted. A secret input with value "$encrypted$"
+// keeps the value in current. Inputs are cleared for other kinds of credentials
+func checkCredentialInputs(c *gin.Context, req *common.Credential, current map[string]string) bool {
+	if req.Kind != common.CredentialKindCUSTOM {
+		req.CredentialTypeID = nil
+		req.Inputs = nil
+		req.SecretInputs = nil
+		return true
+	}
+
+	var credentialType common.CredentialType
+	if err := db.CredentialTypes().FindId(*req.CredentialTypeID).One(&credentialType); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Credential type does not exists.",
+			Log:     logrus.Fields{"Credential Type ID": req.CredentialTypeID.Hex(), "Error": err.Error()},
+		})
+		return false
+	}
+
+	var errs []string
+	for id := range req.Inputs {
+		if _, ok := credentialType.Input(id); !ok {
+			errs = append(errs, "Unknown input "+id)
+		}
+	}
+
+	inputs := map[string]string{}
+	secretInputs := map[string]string{}
+	for _, input := range credentialType.Inputs {
+		value := req.Inputs[input.ID]
+		if input.Secret && value == "$encrypted$" {
+			value = current[input.ID]
+			if len(value) > 0 {
+				secretInputs[input.ID] = value
+				continue
+			}
+		}
+		if len(value) == 0 {
+			if input.Required {
+				errs = append(errs, "Input "+input.ID+" is required")
+			}
+			continue
+		}
+		if input.Secret {
+			secretInputs[input.ID] = util.Cipher(value)
+			continue
+		}
+		inputs[input.ID] = value
+	}
+
+	if len(errs) > 0 {
+		AbortWithErrors(c, http.StatusBadRequest, "Invalid inputs", errs...)
+		return false
+	}
+
+	req.Inputs = inputs
+	req.SecretInputs = secretInputs
+	return true
+}
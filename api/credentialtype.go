@@ -0,0 +1,306 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/log/activity"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/rbac"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/pearsonappeng/tensor/validate"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/gin-gonic/gin.v1/binding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Keys for credential type related items stored in the Gin Context
+const (
+	cCredentialType   = "credential_type"
+	cCredentialTypeID = "credential_type_id"
+)
+
+// CredentialTypeController manages credential types, which describe
+// inputs of custom credentials and how they are injected into jobs
+type CredentialTypeController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes cCredentialTypeID from Gin Context and retrieves credential type data from the collection
+// and store credential type data under key cCredentialType in Gin Context
+func (ctrl CredentialTypeController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cCredentialTypeID)
+	user := c.MustGet(cUser).(common.User)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Credential type does not exist"})
+		return
+	}
+
+	var credentialType common.CredentialType
+	if err := db.CredentialTypes().FindId(bson.ObjectIdHex(objectID)).One(&credentialType); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Credential type does not exist",
+			Log: logrus.Fields{
+				"Credential Type ID": objectID,
+				"Error":              err.Error(),
+			},
+		})
+		return
+	}
+
+	switch c.Request.Method {
+	case "PUT", "DELETE":
+		{
+			// SuperUsers only can modify credential types
+			if !rbac.HasGlobalWrite(user) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	}
+
+	c.Set(cCredentialType, credentialType)
+	c.Next()
+}
+
+// One is a Gin handler function which returns the credential type as a JSON object
+func (ctrl CredentialTypeController) One(c *gin.Context) {
+	credentialType := c.MustGet(cCredentialType).(common.CredentialType)
+	metadata.CredentialTypeMetadata(&credentialType)
+	c.JSON(http.StatusOK, credentialType)
+}
+
+// All is a Gin handler function which returns list of credential types
+// This takes lookup parameters and order parameters to filter and sort output data
+func (ctrl CredentialTypeController) All(c *gin.Context) {
+	parser := util.NewQueryParser(c)
+	match := bson.M{}
+	match = parser.Lookups([]string{"name", "description"}, match)
+	query := db.CredentialTypes().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var credentialTypes []common.CredentialType
+	iter := query.Iter()
+	var tmpType common.CredentialType
+	for iter.Next(&tmpType) {
+		metadata.CredentialTypeMetadata(&tmpType)
+		credentialTypes = append(credentialTypes, tmpType)
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Credential types",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	count := len(credentialTypes)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     credentialTypes[pgi.Skip():pgi.End()],
+	})
+}
+
+// Create is a Gin handler function which creates a new credential type using request payload.
+func (ctrl CredentialTypeController) Create(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	// SuperUsers only can create credential types
+	if !rbac.HasGlobalWrite(user) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	var req common.CredentialType
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	req.Name = strings.Trim(req.Name, " ")
+	req.Description = strings.Trim(req.Description, " ")
+
+	if !req.IsUnique() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Credential type with this Name already exists.",
+		})
+		return
+	}
+
+	if errs := checkInjectors(req); len(errs) > 0 {
+		AbortWithErrors(c, http.StatusBadRequest, "Invalid injectors", errs...)
+		return
+	}
+
+	req.ID = bson.NewObjectId()
+	req.Created = time.Now()
+	req.CreatedByID = user.ID
+	req.Modified = time.Now()
+	req.ModifiedByID = user.ID
+
+	if err := db.CredentialTypes().Insert(req); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while creating Credential type",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Create, user.ID, req, nil)
+	metadata.CredentialTypeMetadata(&req)
+	c.JSON(http.StatusCreated, req)
+}
+
+// Update is a Gin handler function which updates a credential type using request payload.
+// Inputs used by existing credentials cannot be removed or change secrecy
+func (ctrl CredentialTypeController) Update(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	credentialType := c.MustGet(cCredentialType).(common.CredentialType)
+	tmpType := credentialType
+
+	var req common.CredentialType
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	req.Name = strings.Trim(req.Name, " ")
+	if req.Name != credentialType.Name && !req.IsUnique() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Credential type with this Name already exists.",
+		})
+		return
+	}
+
+	if errs := checkInjectors(req); len(errs) > 0 {
+		AbortWithErrors(c, http.StatusBadRequest, "Invalid injectors", errs...)
+		return
+	}
+
+	inUse, err := db.Credentials().Find(bson.M{"credential_type_id": credentialType.ID}).Count()
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while updating Credential type",
+			Log:     logrus.Fields{"Credential Type ID": credentialType.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+	if inUse > 0 {
+		for _, input := range credentialType.Inputs {
+			if v, ok := req.Input(input.ID); !ok || v.Secret != input.Secret {
+				AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+					Message: "Input " + input.ID + " is used by credentials and cannot be removed or change secrecy.",
+				})
+				return
+			}
+		}
+	}
+
+	credentialType.Name = req.Name
+	credentialType.Description = strings.Trim(req.Description, " ")
+	credentialType.Inputs = req.Inputs
+	credentialType.Injectors = req.Injectors
+	credentialType.Modified = time.Now()
+	credentialType.ModifiedByID = user.ID
+
+	if err := db.CredentialTypes().UpdateId(credentialType.ID, credentialType); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while updating Credential type",
+			Log:     logrus.Fields{"Credential Type ID": credentialType.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Update, user.ID, tmpType, credentialType)
+	metadata.CredentialTypeMetadata(&credentialType)
+	c.JSON(http.StatusOK, credentialType)
+}
+
+// Delete is a Gin handler function which removes a credential type.
+// Credential types used by credentials cannot be removed
+func (ctrl CredentialTypeController) Delete(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	credentialType := c.MustGet(cCredentialType).(common.CredentialType)
+
+	inUse, err := db.Credentials().Find(bson.M{"credential_type_id": credentialType.ID}).Count()
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Credential type",
+			Log:     logrus.Fields{"Credential Type ID": credentialType.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+	if inUse > 0 {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Credential type is used by " + strconv.Itoa(inUse) + " credentials.",
+		})
+		return
+	}
+
+	if err := db.CredentialTypes().RemoveId(credentialType.ID); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Credential type",
+			Log:     logrus.Fields{"Credential Type ID": credentialType.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Delete, user.ID, credentialType, nil)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// checkInjectors returns an error message for each duplicate input and
+// for each injector referencing a variable that is neither an input nor a file
+func checkInjectors(ct common.CredentialType) []string {
+	var errs []string
+
+	known := map[string]bool{}
+	for _, input := range ct.Inputs {
+		if known[input.ID] {
+			errs = append(errs, "Duplicate input "+input.ID)
+		}
+		known[input.ID] = true
+	}
+
+	check := func(kind string, injectors map[string]string) {
+		for name, tmpl := range injectors {
+			for _, v := range util.TemplateVariables(tmpl) {
+				if !known[v] {
+					errs = append(errs, kind+" "+name+" references unknown variable "+v)
+				}
+			}
+		}
+	}
+	// files are rendered first and cannot reference other files
+	check("File", ct.Injectors.Files)
+	for name := range ct.Injectors.Files {
+		known["tensor.filename."+name] = true
+	}
+	check("Environment variable", ct.Injectors.Env)
+	check("Extra variable", ct.Injectors.ExtraVars)
+
+	return errs
+}
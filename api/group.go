@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/json"
 	"net/http"
 	"strconv"
 	"strings"
@@ -67,8 +66,8 @@ func (ctrl GroupController) Middleware(c *gin.Context) {
 		}
 	case "PUT", "DELETE":
 		{
-			// Reject the request if the user doesn't have inventory write permissions
-			if !roles.WriteByID(user, group.InventoryID) {
+			// Reject the request if the user doesn't have permissions to update inventory hosts
+			if !roles.UpdateHostsByID(user, group.InventoryID) {
 				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 					Message: "You don't have sufficient permissions to perform this action.",
 				})
@@ -91,29 +90,24 @@ func (ctrl GroupController) One(c *gin.Context) {
 // GetGroups is a Gin handler function which returns list of Groups
 // This takes lookup parameters and order parameters to filer and sort output data.
 func (ctrl GroupController) All(c *gin.Context) {
-	user := c.MustGet(cUser).(common.User)
 	parser := util.NewQueryParser(c)
 	match := bson.M{}
 	match = parser.Match([]string{"source", "has_active_failures"}, match)
 	match = parser.Lookups([]string{"name", "description"}, match)
-	query := db.Groups().Find(match)
-	order := parser.OrderBy()
-	if order != "" {
-		query.Sort(order)
-	}
 
-	roles := new(rbac.Inventory)
-	var groups []ansible.Group
-	iter := query.Iter()
-	var tmpGroup ansible.Group
-	for iter.Next(&tmpGroup) {
-		if !roles.ReadByID(user, tmpGroup.InventoryID) {
-			continue
-		}
-		metadata.GroupMetadata(&tmpGroup)
-		groups = append(groups, tmpGroup)
+	// restrict the query to objects the user can read
+	access, err := accessFilter(c, rbac.ResourceInventory, "inventory_id")
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Groups",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
 	}
-	if err := iter.Close(); err != nil {
+
+	query := db.Groups().Find(restrict(match, access))
+	count, err := query.Count()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
 			Message: "Error while getting Groups",
 			Log:     logrus.Fields{"Error": err.Error()},
@@ -121,7 +115,6 @@ func (ctrl GroupController) All(c *gin.Context) {
 		return
 	}
 
-	count := len(groups)
 	pgi := util.NewPagination(c, count)
 	if pgi.HasPage() {
 		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
@@ -130,11 +123,27 @@ func (ctrl GroupController) All(c *gin.Context) {
 		return
 	}
 
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var groups []ansible.Group
+	if err := query.Skip(pgi.Skip()).Limit(pgi.Limit()).All(&groups); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Groups",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range groups {
+		metadata.GroupMetadata(&groups[i])
+	}
+
 	c.JSON(http.StatusOK, common.Response{
 		Count:    count,
 		Next:     pgi.NextPage(),
 		Previous: pgi.PreviousPage(),
-		Data:     groups[pgi.Skip():pgi.End()],
+		Data:     groups,
 	})
 }
 
@@ -158,7 +167,7 @@ func (ctrl GroupController) Create(c *gin.Context) {
 	}
 
 	// Reject the request if the user doesn't have inventory write permissions
-	if !new(rbac.Inventory).WriteByID(user, req.InventoryID) {
+	if !new(rbac.Inventory).UpdateHostsByID(user, req.InventoryID) {
 		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 			Message: "You don't have sufficient permissions to perform this action.",
 		})
@@ -324,8 +333,8 @@ func (ctrl GroupController) Delete(c *gin.Context) {
 // VariableData is Gin handler function which returns host group variables
 func (ctrl GroupController) VariableData(c *gin.Context) {
 	group := c.MustGet(cGroup).(ansible.Group)
-	variables := gin.H{}
-	if err := json.Unmarshal([]byte(group.Variables), &variables); err != nil {
+	variables, err := group.Variables.Map()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
 			Message: "Error while getting group variables",
 			Log:     logrus.Fields{"Group ID": group.ID.Hex(), "Error": err.Error()},
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/json"
 	"net/http"
 	"strconv"
 	"strings"
@@ -66,8 +65,8 @@ func (ctrl HostController) Middleware(c *gin.Context) {
 		}
 	case "PUT", "DELETE":
 		{
-			// Reject the request if the user doesn't have inventory write permissions
-			if !roles.WriteByID(user, host.InventoryID) {
+			// Reject the request if the user doesn't have permissions to update inventory hosts
+			if !roles.UpdateHostsByID(user, host.InventoryID) {
 				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 					Message: "You don't have sufficient permissions to perform this action.",
 				})
@@ -90,30 +89,24 @@ func (ctrl HostController) One(c *gin.Context) {
 // GetHosts is Gin handler function which returns list of hosts
 // This takes lookup parameters and order parameters to filter and sort output data
 func (ctrl HostController) All(c *gin.Context) {
-
-	user := c.MustGet(cUser).(common.User)
 	parser := util.NewQueryParser(c)
 	match := bson.M{}
 	match = parser.Match([]string{"enabled", "has_active_failures"}, match)
 	match = parser.Lookups([]string{"name", "description"}, match)
-	query := db.Hosts().Find(match)
-	if order := parser.OrderBy(); order != "" {
-		query.Sort(order)
-	}
 
-	roles := new(rbac.Inventory)
-	var hosts []ansible.Host
-	iter := query.Iter()
-	var tmpHost ansible.Host
-	for iter.Next(&tmpHost) {
-		if !roles.ReadByID(user, tmpHost.InventoryID) {
-			continue
-		}
-
-		metadata.HostMetadata(&tmpHost)
-		hosts = append(hosts, tmpHost)
+	// restrict the query to objects the user can read
+	access, err := accessFilter(c, rbac.ResourceInventory, "inventory_id")
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting hosts",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
 	}
-	if err := iter.Close(); err != nil {
+
+	query := db.Hosts().Find(restrict(match, access))
+	count, err := query.Count()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
 			Message: "Error while getting hosts",
 			Log:     logrus.Fields{"Error": err.Error()},
@@ -121,7 +114,6 @@ func (ctrl HostController) All(c *gin.Context) {
 		return
 	}
 
-	count := len(hosts)
 	pgi := util.NewPagination(c, count)
 	if pgi.HasPage() {
 		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
@@ -130,11 +122,27 @@ func (ctrl HostController) All(c *gin.Context) {
 		return
 	}
 
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var hosts []ansible.Host
+	if err := query.Skip(pgi.Skip()).Limit(pgi.Limit()).All(&hosts); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting hosts",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range hosts {
+		metadata.HostMetadata(&hosts[i])
+	}
+
 	c.JSON(http.StatusOK, common.Response{
 		Count:    count,
 		Next:     pgi.NextPage(),
 		Previous: pgi.PreviousPage(),
-		Data:     hosts[pgi.Skip():pgi.End()],
+		Data:     hosts,
 	})
 }
 
@@ -160,7 +168,7 @@ func (ctrl HostController) Create(c *gin.Context) {
 	}
 
 	// Reject the request if the user doesn't have inventory write permissions
-	if !new(rbac.Inventory).WriteByID(user, req.InventoryID) {
+	if !new(rbac.Inventory).UpdateHostsByID(user, req.InventoryID) {
 		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 			Message: "You don't have sufficient permissions to perform this action.",
 		})
@@ -284,9 +292,8 @@ func (ctrl HostController) Delete(c *gin.Context) {
 func (ctrl HostController) VariableData(c *gin.Context) {
 	host := c.MustGet(cHost).(ansible.Host)
 
-	variables := gin.H{}
-
-	if err := json.Unmarshal([]byte(host.Variables), &variables); err != nil {
+	variables, err := host.Variables.Map()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
 			Message: "Error while getting host variables",
 			Log:     logrus.Fields{"Host ID": host.ID.Hex(), "Error": err.Error()},
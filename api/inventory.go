@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/json"
 	"net/http"
 	"strconv"
 	"strings"
@@ -90,29 +89,24 @@ func (ctrl InventoryController) One(c *gin.Context) {
 // GetInventories is a Gin handler function which returns list of inventories
 // This takes lookup parameters and order parameters to filter and sort output data.
 func (ctrl InventoryController) All(c *gin.Context) {
-	user := c.MustGet(cUser).(common.User)
 	parser := util.NewQueryParser(c)
 	match := bson.M{}
 	match = parser.Match([]string{"has_inventory_sources", "has_active_failures"}, match)
 	match = parser.Lookups([]string{"name", "organization"}, match)
 
-	query := db.Inventories().Find(match)
-	if order := parser.OrderBy(); order != "" {
-		query.Sort(order)
+	// restrict the query to objects the user can read
+	access, err := accessFilter(c, rbac.ResourceInventory, "_id")
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Inventory",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
 	}
 
-	roles := new(rbac.Inventory)
-	var inventories []ansible.Inventory
-	iter := query.Iter()
-	var tmpInventory ansible.Inventory
-	for iter.Next(&tmpInventory) {
-		if !roles.Read(user, tmpInventory) {
-			continue
-		}
-		metadata.InventoryMetadata(&tmpInventory)
-		inventories = append(inventories, tmpInventory)
-	}
-	if err := iter.Close(); err != nil {
+	query := db.Inventories().Find(restrict(match, access))
+	count, err := query.Count()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
 			Message: "Error while getting Inventory",
 			Log:     logrus.Fields{"Error": err.Error()},
@@ -120,7 +114,6 @@ func (ctrl InventoryController) All(c *gin.Context) {
 		return
 	}
 
-	count := len(inventories)
 	pgi := util.NewPagination(c, count)
 	if pgi.HasPage() {
 		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
@@ -128,11 +121,28 @@ func (ctrl InventoryController) All(c *gin.Context) {
 		})
 		return
 	}
+
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var inventories []ansible.Inventory
+	if err := query.Skip(pgi.Skip()).Limit(pgi.Limit()).All(&inventories); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Inventory",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range inventories {
+		metadata.InventoryMetadata(&inventories[i])
+	}
+
 	c.JSON(http.StatusOK, common.Response{
 		Count:    count,
 		Next:     pgi.NextPage(),
 		Previous: pgi.PreviousPage(),
-		Data:     inventories[pgi.Skip():pgi.End()],
+		Data:     inventories,
 	})
 }
 
@@ -313,8 +323,8 @@ func (ctrl InventoryController) Script(c *gin.Context) {
 			})
 			return
 		}
-		var gv gin.H
-		if err := json.Unmarshal([]byte(host.Variables), &gv); err != nil {
+		gv, err := host.Variables.Map()
+		if err != nil {
 			AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
 				Message: "Error while getting vars",
 				Log:     logrus.Fields{"Error": err.Error()},
@@ -367,15 +377,13 @@ func (ctrl InventoryController) Script(c *gin.Context) {
 		for _, v := range childgroups {
 			groupnames = append(groupnames, v.Name)
 		}
-		gv := gin.H{}
-		if v.Variables != "" {
-			if err := json.Unmarshal([]byte(v.Variables), &gv); err != nil {
-				AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
-					Message: "Error while getting hosts",
-					Log:     logrus.Fields{"Error": err.Error()},
-				})
-				return
-			}
+		gv, err := v.Variables.Map()
+		if err != nil {
+			AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
+				Message: "Error while getting hosts",
+				Log:     logrus.Fields{"Error": err.Error()},
+			})
+			return
 		}
 		resp[v.Name] = gin.H{
 			"hosts":    hostnames,
@@ -388,8 +396,8 @@ func (ctrl InventoryController) Script(c *gin.Context) {
 	hostvars := gin.H{}
 	for _, v := range allhosts {
 		if v.Variables != "" {
-			var gv gin.H
-			if err := json.Unmarshal([]byte(v.Variables), &gv); err != nil {
+			gv, err := v.Variables.Map()
+			if err != nil {
 				AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
 					Message: "Error while getting hosts",
 					Log:     logrus.Fields{"Error": err.Error()},
@@ -414,8 +422,8 @@ func (ctrl InventoryController) Script(c *gin.Context) {
 	hosts := []string{}
 	for _, v := range nghosts {
 		if v.Variables != "" {
-			var gv gin.H
-			if err := json.Unmarshal([]byte(v.Variables), &gv); err != nil {
+			gv, err := v.Variables.Map()
+			if err != nil {
 				AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
 					Message: "Error while getting non-grouped hosts",
 					Log:     logrus.Fields{"Error": err.Error()},
@@ -432,8 +440,18 @@ func (ctrl InventoryController) Script(c *gin.Context) {
 			"hostvars": hostvars,
 		}
 	}
+	// variables of the inventory apply to all hosts
+	vars, err := inv.Variables.Map()
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
+			Message: "Error while getting inventory variables",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
 	resp["all"] = gin.H{
 		"hosts": hosts,
+		"vars":  vars,
 	}
 
 	c.JSON(http.StatusOK, resp)
@@ -453,6 +471,7 @@ func (ctrl InventoryController) JobTemplates(c *gin.Context) {
 		if !roles.Read(user, tmpJobTemplate) {
 			continue
 		}
+		tmpJobTemplate.SurveySpec = hideSurveyPasswords(tmpJobTemplate.SurveySpec)
 		metadata.JTemplateMetadata(&tmpJobTemplate)
 		jobTemplate = append(jobTemplate, tmpJobTemplate)
 	}
@@ -717,8 +736,8 @@ func (ctrl InventoryController) Tree(c *gin.Context) {
 // VariableData is a Gin Handler function which returns variable data for the inventory.
 func (ctrl InventoryController) VariableData(c *gin.Context) {
 	inventory := c.MustGet(cInventory).(ansible.Inventory)
-	variables := gin.H{}
-	if err := json.Unmarshal([]byte(inventory.Variables), &variables); err != nil {
+	variables, err := inventory.Variables.Map()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
 			Message: "Error while getting inventory variables",
 			Log:     logrus.Fields{"Error": err.Error()},
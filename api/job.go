@@ -84,39 +84,31 @@ func (ctrl JobController) One(c *gin.Context) {
 // GetJobs is a Gin handler function which returns list of jobs
 // This takes lookup parameters and order parameters to filter and sort output data
 func (ctrl JobController) All(c *gin.Context) {
-	user := c.MustGet(cUser).(common.User)
-
 	parser := util.NewQueryParser(c)
 	match := bson.M{}
 	match = parser.Match([]string{"status", "type", "failed"}, match)
 	match = parser.Lookups([]string{"id", "name", "labels"}, match)
-	query := db.Jobs().Find(match)
-	if order := parser.OrderBy(); order != "" {
-		query.Sort(order)
-	}
-
-	var jobs []ansible.Job
 
-	roles := new(rbac.JobTemplate)
-	iter := query.Iter()
-	var tmpJob ansible.Job
-	for iter.Next(&tmpJob) {
-		if !roles.ReadByID(user, tmpJob.JobTemplateID) {
-			continue
-		}
-		metadata.JobMetadata(&tmpJob)
-		jobs = append(jobs, tmpJob)
+	// restrict the query to objects the user can read
+	access, err := accessFilter(c, rbac.ResourceJobTemplate, "job_template_id")
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting job",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
 	}
-	if err := iter.Close(); err != nil {
+
+	query := db.Jobs().Find(restrict(match, access))
+	count, err := query.Count()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while getting job", Log: logrus.Fields{
-				"Error": err.Error(),
-			},
+			Message: "Error while getting job",
+			Log:     logrus.Fields{"Error": err.Error()},
 		})
 		return
 	}
 
-	count := len(jobs)
 	pgi := util.NewPagination(c, count)
 	if pgi.HasPage() {
 		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
@@ -125,12 +117,27 @@ func (ctrl JobController) All(c *gin.Context) {
 		return
 	}
 
-	// send response with JSON rendered data
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var jobs []ansible.Job
+	if err := query.Skip(pgi.Skip()).Limit(pgi.Limit()).All(&jobs); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting job",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range jobs {
+		metadata.JobMetadata(&jobs[i])
+	}
+
 	c.JSON(http.StatusOK, common.Response{
 		Count:    count,
 		Next:     pgi.NextPage(),
 		Previous: pgi.PreviousPage(),
-		Data:     jobs[pgi.Skip():pgi.End()],
+		Data:     jobs,
 	})
 }
 
@@ -0,0 +1,17 @@
+package metadata
+
+import (
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/gin-gonic/gin.v1"
+)
+
+// CredentialTypeMetadata attach metadata to credential type
+func CredentialTypeMetadata(ct *common.CredentialType) {
+	ID := ct.ID.Hex()
+	ct.Type = "credential_type"
+	ct.Links = gin.H{
+		"self":        "/v1/credential_types/" + ID,
+		"created_by":  "/v1/users/" + ct.CreatedByID.Hex(),
+		"modified_by": "/v1/users/" + ct.ModifiedByID.Hex(),
+	}
+}
@@ -23,6 +23,8 @@ func ProjectMetadata(p *common.Project) {
 		"notification_templates_any":     "/v1/projects/" + ID + "/notification_templates_any",
 		"project_updates":                "/v1/projects/" + ID + "/project_updates",
 		"update":                         "/v1/projects/" + ID + "/update",
+		"webhook":                        "/v1/projects/" + ID + "/webhook",
+		"webhook_deliveries":             "/v1/projects/" + ID + "/webhook_deliveries",
 		"access_list":                    "/v1/projects/" + ID + "/access_list",
 		"schedules":                      "/v1/projects/" + ID + "/schedules",
 		"teams":                          "/v1/projects/" + ID + "/teams",
@@ -34,9 +36,16 @@ func ProjectMetadata(p *common.Project) {
 		related["playbooks"] = "/v1/projects/" + ID + "/playbooks"
 	}
 
+	if p.ScmType == "manual" {
+		related["archive"] = "/v1/projects/" + ID + "/archive"
+	}
+
 	if p.ScmCredentialID != nil {
 		related["credential"] = "/v1/credentials/" + (*p.ScmCredentialID).Hex()
 	}
+	if p.GalaxyCredentialID != nil {
+		related["galaxy_credential"] = "/v1/credentials/" + (*p.GalaxyCredentialID).Hex()
+	}
 	if p.LastJob != nil {
 		related["last_job"] = "/v1/project_updates/" + (*p.LastJob).Hex()
 	}
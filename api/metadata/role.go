@@ -0,0 +1,17 @@
+package metadata
+
+import (
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/gin-gonic/gin.v1"
+)
+
+// RoleMetadata attach metadata to custom role
+func RoleMetadata(r *common.Role) {
+	ID := r.ID.Hex()
+	r.Type = "role"
+	r.Links = gin.H{
+		"self":        "/v1/roles/" + ID,
+		"created_by":  "/v1/users/" + r.CreatedByID.Hex(),
+		"modified_by": "/v1/users/" + r.ModifiedByID.Hex(),
+	}
+}
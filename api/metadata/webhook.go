@@ -0,0 +1,26 @@
+package metadata
+
+import (
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/gin-gonic/gin.v1"
+)
+
+func WebhookDeliveryMetadata(d *common.WebhookDelivery) {
+	ID := d.ID.Hex()
+	projectID := d.ProjectID.Hex()
+	d.Type = "webhook_delivery"
+	related := gin.H{
+		"project":    "/v1/projects/" + projectID,
+		"redeliver":  "/v1/projects/" + projectID + "/webhook_deliveries/" + ID + "/redeliver",
+		"deliveries": "/v1/projects/" + projectID + "/webhook_deliveries",
+	}
+
+	if d.ProjectUpdateID != nil {
+		related["project_update"] = "/v1/project_updates/" + (*d.ProjectUpdateID).Hex()
+	}
+	if d.CreatedByID != nil {
+		related["created_by"] = "/v1/users/" + (*d.CreatedByID).Hex()
+	}
+
+	d.Links = related
+}
@@ -88,28 +88,23 @@ func (ctrl OrganizationController) One(c *gin.Context) {
 // GetOrganizations is a Gin handler function which returns list of organization
 // This takes lookup parameters and order parameters to filter and sort output data
 func (ctrl OrganizationController) All(c *gin.Context) {
-	user := c.MustGet(cUser).(common.User)
-
 	parser := util.NewQueryParser(c)
 	match := bson.M{}
 	match = parser.Lookups([]string{"name", "description"}, match)
-	query := db.Organizations().Find(match)
-	if order := parser.OrderBy(); order != "" {
-		query.Sort(order)
-	}
 
-	roles := new(rbac.Organization)
-	var organizations []common.Organization
-	iter := query.Iter()
-	var tmpOrganization common.Organization
-	for iter.Next(&tmpOrganization) {
-		if !roles.Read(user, tmpOrganization) {
-			continue
-		}
-		metadata.OrganizationMetadata(&tmpOrganization)
-		organizations = append(organizations, tmpOrganization)
+	// restrict the query to objects the user can read
+	access, err := accessFilter(c, rbac.ResourceOrganization, "_id")
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Organization",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
 	}
-	if err := iter.Close(); err != nil {
+
+	query := db.Organizations().Find(restrict(match, access))
+	count, err := query.Count()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
 			Message: "Error while getting Organization",
 			Log:     logrus.Fields{"Error": err.Error()},
@@ -117,7 +112,6 @@ func (ctrl OrganizationController) All(c *gin.Context) {
 		return
 	}
 
-	count := len(organizations)
 	pgi := util.NewPagination(c, count)
 	if pgi.HasPage() {
 		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
@@ -126,11 +120,27 @@ func (ctrl OrganizationController) All(c *gin.Context) {
 		return
 	}
 
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var organizations []common.Organization
+	if err := query.Skip(pgi.Skip()).Limit(pgi.Limit()).All(&organizations); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Organization",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range organizations {
+		metadata.OrganizationMetadata(&organizations[i])
+	}
+
 	c.JSON(http.StatusOK, common.Response{
 		Count:    count,
 		Next:     pgi.NextPage(),
 		Previous: pgi.PreviousPage(),
-		Data:     organizations[pgi.Skip():pgi.End()],
+		Data:     organizations,
 	})
 }
 
@@ -187,6 +197,8 @@ func (ctrl OrganizationController) Create(c *gin.Context) {
 func (ctrl OrganizationController) Delete(c *gin.Context) {
 	organization := c.MustGet(cOrganization).(common.Organization)
 	user := c.MustGet(cUser).(common.User)
+	// cached organization grants and team memberships are stale once any of them is removed
+	defer rbac.Invalidate()
 
 	var projectIDs []bson.ObjectId
 	orgIter := db.Projects().Find(bson.M{"organization_id": organization.ID}).Select(bson.M{"_id": 1}).Iter()
@@ -95,39 +95,31 @@ func (ctrl ProjectController) One(c *gin.Context) {
 
 // GetProjects returns a JSON array of projects
 func (ctrl ProjectController) All(c *gin.Context) {
-	user := c.MustGet(cUser).(common.User)
-
 	parser := util.NewQueryParser(c)
 	match := bson.M{}
 	match = parser.Match([]string{"type", "status"}, match)
 	match = parser.Lookups([]string{"name"}, match)
 
-	query := db.Projects().Find(match)
-	if order := parser.OrderBy(); order != "" {
-		query.Sort(order)
+	// restrict the query to objects the user can read
+	access, err := accessFilter(c, rbac.ResourceProject, "_id")
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting project",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
 	}
 
-	roles := new(rbac.Project)
-	var projects []common.Project
-	iter := query.Iter()
-	var tmpProject common.Project
-	for iter.Next(&tmpProject) {
-		if !roles.Read(user, tmpProject) {
-			continue
-		}
-		metadata.ProjectMetadata(&tmpProject)
-		projects = append(projects, tmpProject)
-	}
-	if err := iter.Close(); err != nil {
+	query := db.Projects().Find(restrict(match, access))
+	count, err := query.Count()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while getting project", Log: logrus.Fields{
-				"Error": err.Error(),
-			},
+			Message: "Error while getting project",
+			Log:     logrus.Fields{"Error": err.Error()},
 		})
 		return
 	}
 
-	count := len(projects)
 	pgi := util.NewPagination(c, count)
 	if pgi.HasPage() {
 		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
@@ -136,11 +128,27 @@ func (ctrl ProjectController) All(c *gin.Context) {
 		return
 	}
 
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var projects []common.Project
+	if err := query.Skip(pgi.Skip()).Limit(pgi.Limit()).All(&projects); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting project",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range projects {
+		metadata.ProjectMetadata(&projects[i])
+	}
+
 	c.JSON(http.StatusOK, common.Response{
 		Count:    count,
 		Next:     pgi.NextPage(),
 		Previous: pgi.PreviousPage(),
-		Data:     projects[pgi.Skip():pgi.End()],
+		Data:     projects,
 	})
 }
 
@@ -193,13 +201,22 @@ func (ctrl ProjectController) Create(c *gin.Context) {
 			return
 		}
 
-		if !roles.Read(user, cred) {
+		if !roles.Use(user, cred) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 				Message: "You don't have sufficient permissions to perform this action.",
 			})
+			return
 		}
 	}
 
+	if !galaxyCredentialValid(c, user, req) {
+		return
+	}
+
+	if !toolchainValid(c, req.Toolchain, req.ToolchainKind()) {
+		return
+	}
+
 	req.Name = strings.Trim(req.Name, " ")
 	req.Description = strings.Trim(req.Description, " ")
 	req.ID = bson.NewObjectId()
@@ -289,6 +306,21 @@ func (ctrl ProjectController) Update(c *gin.Context) {
 		return
 	}
 
+	if req.ScmCredentialID != nil && !new(rbac.Credential).UseByID(user, *req.ScmCredentialID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	if !galaxyCredentialValid(c, user, req) {
+		return
+	}
+
+	if !toolchainValid(c, req.Toolchain, project.ToolchainKind()) {
+		return
+	}
+
 	// trim strings white space
 	project.Name = strings.Trim(req.Name, " ")
 	project.Description = strings.Trim(req.Description, " ")
@@ -303,6 +335,11 @@ func (ctrl ProjectController) Update(c *gin.Context) {
 	project.ScmDeleteOnNextUpdate = req.ScmDeleteOnNextUpdate
 	project.ScmUpdateOnLaunch = req.ScmUpdateOnLaunch
 	project.ScmUpdateCacheTimeout = req.ScmUpdateCacheTimeout
+	project.ScmRefspec = req.ScmRefspec
+	project.ScmSubmodules = req.ScmSubmodules
+	project.ScmCloneDepth = req.ScmCloneDepth
+	project.GalaxyCredentialID = req.GalaxyCredentialID
+	project.Toolchain = req.Toolchain
 	project.Modified = time.Now()
 
 	// update object
@@ -369,6 +406,21 @@ func (ctrl ProjectController) Delete(c *gin.Context) {
 				"Error": err.Error(),
 			}).Errorln("An error occured while removing project directory")
 		}
+		if err := os.RemoveAll(sync.RevisionsDir(project)); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err.Error(),
+			}).Errorln("An error occured while removing project revisions")
+		}
+		if err := os.RemoveAll(sync.GalaxyDir(project)); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err.Error(),
+			}).Errorln("An error occured while removing project roles and collections")
+		}
+		if err := sync.RemoveAll(sync.TerraformDir(project)); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err.Error(),
+			}).Errorln("An error occured while removing project terraform modules")
+		}
 	}()
 
 	activity.AddActivity(activity.Delete, user.ID, project, nil)
@@ -583,6 +635,29 @@ func (ctrl ProjectController) SCMUpdate(c *gin.Context) {
 	c.JSON(http.StatusAccepted, gin.H{"project_update": updateID.Job.ID.Hex()})
 }
 
+// galaxyCredentialValid checks the galaxy credential of a project. The credential must be
+// a galaxy credential the user can use. Aborts the request and returns false when it is invalid
+func galaxyCredentialValid(c *gin.Context, user common.User, project common.Project) bool {
+	if project.GalaxyCredentialID == nil {
+		return true
+	}
+
+	if !project.GalaxyCredentialExist() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Galaxy Credential does not exists.",
+		})
+		return false
+	}
+
+	if !new(rbac.Credential).UseByID(user, *project.GalaxyCredentialID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return false
+	}
+	return true
+}
+
 // ObjectRoles is a Gin handler function
 // This returns available roles can be associated with a Project model
 func (ctrl ProjectController) ObjectRoles(c *gin.Context) {
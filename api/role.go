@@ -0,0 +1,277 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/log/activity"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/rbac"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/pearsonappeng/tensor/validate"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/gin-gonic/gin.v1/binding"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Keys for custom role related items stored in the Gin Context
+const (
+	cRole   = "role"
+	cRoleID = "role_id"
+)
+
+// RoleController manages custom roles, named sets of permissions
+// which can be granted on resources like built-in roles
+type RoleController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes cRoleID from Gin Context and retrieves role data from the collection
+// and store role data under key cRole in Gin Context
+func (ctrl RoleController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cRoleID)
+	user := c.MustGet(cUser).(common.User)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Role does not exist"})
+		return
+	}
+
+	var role common.Role
+	if err := db.Roles().FindId(bson.ObjectIdHex(objectID)).One(&role); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Role does not exist",
+			Log: logrus.Fields{
+				"Role ID": objectID,
+				"Error":   err.Error(),
+			},
+		})
+		return
+	}
+
+	switch c.Request.Method {
+	case "PUT", "DELETE":
+		{
+			// SuperUsers only can modify custom roles
+			if !rbac.HasGlobalWrite(user) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	}
+
+	c.Set(cRole, role)
+	c.Next()
+}
+
+// One is a Gin handler function which returns the custom role as a JSON object
+func (ctrl RoleController) One(c *gin.Context) {
+	role := c.MustGet(cRole).(common.Role)
+	metadata.RoleMetadata(&role)
+	c.JSON(http.StatusOK, role)
+}
+
+// All is a Gin handler function which returns list of custom roles
+// This takes lookup parameters and order parameters to filter and sort output data
+func (ctrl RoleController) All(c *gin.Context) {
+	parser := util.NewQueryParser(c)
+	match := bson.M{}
+	match = parser.Lookups([]string{"name", "description"}, match)
+	query := db.Roles().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var roles []common.Role
+	iter := query.Iter()
+	var tmpRole common.Role
+	for iter.Next(&tmpRole) {
+		metadata.RoleMetadata(&tmpRole)
+		roles = append(roles, tmpRole)
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Roles",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	count := len(roles)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     roles[pgi.Skip():pgi.End()],
+	})
+}
+
+// Create is a Gin handler function which creates a new custom role using request payload.
+func (ctrl RoleController) Create(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	// SuperUsers only can create custom roles
+	if !rbac.HasGlobalWrite(user) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	var req common.Role
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	req.Name = strings.Trim(req.Name, " ")
+	req.Description = strings.Trim(req.Description, " ")
+
+	if rbac.IsBuiltinRole(req.Name) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Name is reserved for a built-in role.",
+		})
+		return
+	}
+
+	if !req.IsUnique() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Role with this Name already exists.",
+		})
+		return
+	}
+
+	if errs := checkPermissions(req.Permissions); len(errs) > 0 {
+		AbortWithErrors(c, http.StatusBadRequest, "Invalid permissions", errs...)
+		return
+	}
+
+	req.ID = bson.NewObjectId()
+	req.Created = time.Now()
+	req.CreatedByID = user.ID
+	req.Modified = time.Now()
+	req.ModifiedByID = user.ID
+
+	if err := db.Roles().Insert(req); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while creating Role",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	rbac.Invalidate()
+	activity.AddActivity(activity.Create, user.ID, req, nil)
+	metadata.RoleMetadata(&req)
+	c.JSON(http.StatusCreated, req)
+}
+
+// Update is a Gin handler function which updates a custom role using request payload.
+// Roles are granted by name, therefore the name of a role cannot be changed
+func (ctrl RoleController) Update(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	role := c.MustGet(cRole).(common.Role)
+	tmpRole := role
+
+	var req common.Role
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	if strings.Trim(req.Name, " ") != role.Name {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Name of a role cannot be changed.",
+		})
+		return
+	}
+
+	if errs := checkPermissions(req.Permissions); len(errs) > 0 {
+		AbortWithErrors(c, http.StatusBadRequest, "Invalid permissions", errs...)
+		return
+	}
+
+	role.Description = strings.Trim(req.Description, " ")
+	role.Permissions = req.Permissions
+	role.Modified = time.Now()
+	role.ModifiedByID = user.ID
+
+	if err := db.Roles().UpdateId(role.ID, role); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while updating Role",
+			Log:     logrus.Fields{"Role ID": role.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	rbac.Invalidate()
+	activity.AddActivity(activity.Update, user.ID, tmpRole, role)
+	metadata.RoleMetadata(&role)
+	c.JSON(http.StatusOK, role)
+}
+
+// Delete is a Gin handler function which removes a custom role
+// and every grant of the role from resources
+func (ctrl RoleController) Delete(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	role := c.MustGet(cRole).(common.Role)
+
+	access := bson.M{"$pull": bson.M{"roles": bson.M{"role": role.Name}}}
+	for _, collection := range []*mgo.Collection{
+		db.Organizations(),
+		db.Credentials(),
+		db.Projects(),
+		db.Inventories(),
+		db.JobTemplates(),
+		db.TerrafromJobTemplates(),
+		db.Teams(),
+	} {
+		if _, err := collection.UpdateAll(bson.M{"roles.role": role.Name}, access); err != nil {
+			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+				Message: "Error while removing Role",
+				Log:     logrus.Fields{"Role ID": role.ID.Hex(), "Error": err.Error()},
+			})
+			return
+		}
+	}
+
+	if err := db.Roles().RemoveId(role.ID); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Role",
+			Log:     logrus.Fields{"Role ID": role.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	rbac.Invalidate()
+	activity.AddActivity(activity.Delete, user.ID, role, nil)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// checkPermissions returns an error message for each unknown permission
+func checkPermissions(permissions []string) []string {
+	var errs []string
+	for _, v := range permissions {
+		if !rbac.IsValidPermission(v) {
+			errs = append(errs, "Unknown permission "+v)
+		}
+	}
+	return errs
+}
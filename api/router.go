@@ -40,6 +40,8 @@ func Route(r *gin.Engine) {
 		v1.GET("/ping", GetPing)
 		v1.GET("/queue", QueueStats)
 		v1.POST("/authtoken", jwt.HeaderAuthMiddleware.LoginHandler)
+		// webhooks are verified with the project webhook secret
+		v1.POST("/projects/:project_id/webhook/:provider", new(ProjectController).ReceiveWebhook)
 
 		v1.Use(jwt.HeaderAuthMiddleware.MiddlewareFunc())
 		{
@@ -49,6 +51,7 @@ func Route(r *gin.Engine) {
 			v1.GET("/config", getSystemInfo)
 			v1.GET("/dashboard", dashboard.GetInfo)
 			v1.GET("/me", users.One)
+			v1.POST("/me/password", users.ChangePassword)
 
 			organizations := v1.Group("/organizations")
 			{
@@ -68,7 +71,7 @@ func Route(r *gin.Engine) {
 					organization.GET("/teams", ctrl.GetTeams)
 					organization.GET("/credentials", ctrl.GetCredentials)
 					organization.GET("/object_roles", ctrl.ObjectRoles)
-					organization.GET("/access_list", notImplemented)                    //TODO: implement
+					organization.GET("/access_list", ctrl.AccessList)
 					organization.GET("/notification_templates_error", notImplemented)   //TODO: implement
 					organization.GET("/notification_templates_success", notImplemented) //TODO: implement
 					organization.GET("/notification_templates", notImplemented)         //TODO: implement
@@ -93,7 +96,7 @@ func Route(r *gin.Engine) {
 					user.GET("/projects", users.Projects)
 					user.GET("/roles", users.GetRoles)
 					user.POST("/roles", users.AssignRole)
-					user.GET("/access_list", notImplemented) //TODO: implement
+					user.GET("/access_list", users.AccessList)
 				}
 			}
 
@@ -115,6 +118,13 @@ func Route(r *gin.Engine) {
 					project.POST("/update", ctrl.SCMUpdate)
 					project.GET("/project_updates", ctrl.ProjectUpdates)
 					project.GET("/object_roles", ctrl.ObjectRoles)
+					project.GET("/archive", ctrl.Archives)
+					project.POST("/archive", ctrl.UploadArchive)
+					project.POST("/archive/:revision/rollback", ctrl.RollbackArchive)
+					project.GET("/webhook", ctrl.Webhook)
+					project.PUT("/webhook", ctrl.UpdateWebhook)
+					project.GET("/webhook_deliveries", ctrl.WebhookDeliveries)
+					project.POST("/webhook_deliveries/:webhook_delivery_id/redeliver", ctrl.RedeliverWebhook)
 					project.GET("/schedules", notImplemented) //TODO: implement
 				}
 			}
@@ -133,7 +143,7 @@ func Route(r *gin.Engine) {
 					credential.GET("/owner_users", ctrl.OwnerUsers)
 					credential.GET("/activity_stream", ctrl.ActivityStream)
 					credential.GET("/object_roles", ctrl.ObjectRoles)
-					credential.GET("/access_list", notImplemented) //TODO: implement
+					credential.GET("/access_list", ctrl.AccessList)
 				}
 			}
 
@@ -157,6 +167,38 @@ func Route(r *gin.Engine) {
 				}
 			}
 
+			credentialTypes := v1.Group("/credential_types")
+			{
+				ctrl := new(CredentialTypeController)
+				credentialTypes.GET("", ctrl.All)
+				credentialTypes.POST("", ctrl.Create)
+				credentialType := credentialTypes.Group("/:credential_type_id", ctrl.Middleware)
+				{
+					credentialType.GET("", ctrl.One)
+					credentialType.PUT("", ctrl.Update)
+					credentialType.DELETE("", ctrl.Delete)
+				}
+			}
+
+			toolchains := v1.Group("/toolchains")
+			{
+				ctrl := new(ToolchainController)
+				toolchains.GET("", ctrl.All)
+			}
+
+			customRoles := v1.Group("/roles")
+			{
+				ctrl := new(RoleController)
+				customRoles.GET("", ctrl.All)
+				customRoles.POST("", ctrl.Create)
+				role := customRoles.Group("/:role_id", ctrl.Middleware)
+				{
+					role.GET("", ctrl.One)
+					role.PUT("", ctrl.Update)
+					role.DELETE("", ctrl.Delete)
+				}
+			}
+
 			inventories := v1.Group("/inventories")
 			{
 				ctrl := new(InventoryController)
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/gin-gonic/gin.v1"
+)
+
+// checkSurveySpec validates the survey spec of a template and encrypts defaults of password
+// questions. A password default "$encrypted$" keeps the default of the question in current.
+// A failure aborts the request and returns false
+func checkSurveySpec(c *gin.Context, spec common.SurveySpec, current common.SurveySpec) bool {
+	errs := spec.Errors()
+	for i, q := range spec {
+		if q.Type != common.SurveyTypePassword || q.Default == nil {
+			continue
+		}
+		value, ok := q.Default.(string)
+		if !ok {
+			errs = append(errs, "Default of "+q.Variable+" must be a string")
+			continue
+		}
+		if value == "$encrypted$" {
+			spec[i].Default = nil
+			for _, v := range current {
+				if v.Variable == q.Variable && v.Type == common.SurveyTypePassword {
+					spec[i].Default = v.Default
+				}
+			}
+			continue
+		}
+		if len(value) > 0 {
+			spec[i].Default = util.Cipher(value)
+		}
+	}
+
+	if len(errs) > 0 {
+		AbortWithErrors(c, http.StatusBadRequest, "Invalid survey spec", errs...)
+		return false
+	}
+	return true
+}
+
+// hideSurveyPasswords returns a copy of spec where defaults of password questions are replaced by $encrypted$
+func hideSurveyPasswords(spec common.SurveySpec) common.SurveySpec {
+	if spec == nil {
+		return nil
+	}
+	hidden := make(common.SurveySpec, len(spec))
+	copy(hidden, spec)
+	for i, q := range hidden {
+		if q.Type == common.SurveyTypePassword && q.Default != nil {
+			hidden[i].Default = "$encrypted$"
+		}
+	}
+	return hidden
+}
+
+// surveyAnswers validates answers to the survey of a template and returns the variables they set.
+// Answers to password questions are masked in the variables and returned encrypted in passwords,
+// an answer "$encrypted$" takes the default of the question.
+// A failure aborts the request and returns false
+func surveyAnswers(c *gin.Context, spec common.SurveySpec, answers gin.H) (gin.H, map[string]string, bool) {
+	// answers are validated against decrypted password defaults
+	plain := make(common.SurveySpec, len(spec))
+	copy(plain, spec)
+	given := gin.H{}
+	for k, v := range answers {
+		given[k] = v
+	}
+	for i, q := range plain {
+		if q.Type != common.SurveyTypePassword {
+			continue
+		}
+		if value, ok := q.Default.(string); ok && len(value) > 0 {
+			plain[i].Default = string(util.Decipher(value))
+		}
+		if given[q.Variable] == "$encrypted$" {
+			delete(given, q.Variable)
+		}
+	}
+
+	vars, errs := plain.Answers(given)
+	if len(errs) > 0 {
+		AbortWithErrors(c, http.StatusBadRequest, "Invalid survey answers", errs...)
+		return nil, nil, false
+	}
+
+	passwords := map[string]string{}
+	for _, q := range plain {
+		if value, ok := vars[q.Variable].(string); ok && q.Type == common.SurveyTypePassword {
+			passwords[q.Variable] = util.Cipher(value)
+			vars[q.Variable] = "$encrypted$"
+		}
+	}
+	return vars, passwords, true
+}
+
+// surveyVariablesNeeded returns variables of required questions without a default
+func surveyVariablesNeeded(spec common.SurveySpec) []string {
+	needed := []string{}
+	for _, q := range spec {
+		if q.Required && (q.Default == nil || q.Default == "") {
+			needed = append(needed, q.Variable)
+		}
+	}
+	return needed
+}
@@ -89,27 +89,23 @@ func (ctrl TeamController) One(c *gin.Context) {
 // GetTeams is a Gin handler function which returns list of teams
 // This takes lookup parameters and order parameters to filter and sort output data
 func (ctrl TeamController) All(c *gin.Context) {
-	user := c.MustGet(cUser).(common.User)
 	parser := util.NewQueryParser(c)
 	match := bson.M{}
 	match = parser.Lookups([]string{"name", "description", "organization"}, match)
-	query := db.Teams().Find(match)
-	if order := parser.OrderBy(); order != "" {
-		query.Sort(order)
-	}
 
-	roles := new(rbac.Team)
-	var teams []common.Team
-	iter := query.Iter()
-	var tmpTeam common.Team
-	for iter.Next(&tmpTeam) {
-		if !roles.Read(user, tmpTeam) {
-			continue
-		}
-		metadata.TeamMetadata(&tmpTeam)
-		teams = append(teams, tmpTeam)
+	// restrict the query to objects the user can read
+	access, err := accessFilter(c, rbac.ResourceTeam, "_id")
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting teams",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
 	}
-	if err := iter.Close(); err != nil {
+
+	query := db.Teams().Find(restrict(match, access))
+	count, err := query.Count()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
 			Message: "Error while getting teams",
 			Log:     logrus.Fields{"Error": err.Error()},
@@ -117,7 +113,6 @@ func (ctrl TeamController) All(c *gin.Context) {
 		return
 	}
 
-	count := len(teams)
 	pgi := util.NewPagination(c, count)
 	if pgi.HasPage() {
 		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
@@ -126,11 +121,27 @@ func (ctrl TeamController) All(c *gin.Context) {
 		return
 	}
 
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var teams []common.Team
+	if err := query.Skip(pgi.Skip()).Limit(pgi.Limit()).All(&teams); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting teams",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range teams {
+		metadata.TeamMetadata(&teams[i])
+	}
+
 	c.JSON(http.StatusOK, common.Response{
 		Count:    count,
 		Next:     pgi.NextPage(),
 		Previous: pgi.PreviousPage(),
-		Data:     teams[pgi.Skip():pgi.End()],
+		Data:     teams,
 	})
 }
 
@@ -246,6 +257,8 @@ func (ctrl TeamController) Update(c *gin.Context) {
 func (ctrl TeamController) Delete(c *gin.Context) {
 	team := c.MustGet(cTeam).(common.Team)
 	user := c.MustGet(cUser).(common.User)
+	// cached memberships and grants are stale once any of them is removed
+	defer rbac.Invalidate()
 
 	// Remove permissions
 	access := bson.M{"$pull": bson.M{"roles": common.AccessControl{GranteeID: team.ID}}}
@@ -535,7 +548,7 @@ func (ctrl TeamController) AssignRole(c *gin.Context) {
 		{
 			roles := new(rbac.Team)
 			var rteam common.Team
-			if err := db.Teams().FindId(req.ResourceID).One(&team); err != nil {
+			if err := db.Teams().FindId(req.ResourceID).One(&rteam); err != nil {
 				c.JSON(http.StatusBadRequest, common.Error{
 					Code:   http.StatusBadRequest,
 					Errors: []string{"Could not find resource"},
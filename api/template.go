@@ -25,7 +25,6 @@ import (
 	"gopkg.in/gin-gonic/gin.v1"
 	"gopkg.in/gin-gonic/gin.v1/binding"
 	"gopkg.in/mgo.v2/bson"
-	"os"
 )
 
 // Keys for credential related items stored in the Gin Context
@@ -80,6 +79,16 @@ func (ctrl JobTemplateController) Middleware(c *gin.Context) {
 				return
 			}
 		}
+	case "POST":
+		{
+			// Reject the request if the user doesn't have launch permissions
+			if !roles.Launch(user, jobTemplate) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
 	}
 
 	c.Set(cJobTemplate, jobTemplate)
@@ -91,6 +100,7 @@ func (ctrl JobTemplateController) Middleware(c *gin.Context) {
 // A failure will return 500 status code
 func (ctrl JobTemplateController) One(c *gin.Context) {
 	jobTemplate := c.MustGet(cJobTemplate).(ansible.JobTemplate)
+	jobTemplate.SurveySpec = hideSurveyPasswords(jobTemplate.SurveySpec)
 	metadata.JTemplateMetadata(&jobTemplate)
 	c.JSON(http.StatusOK, jobTemplate)
 }
@@ -112,38 +122,30 @@ func (ctrl JobTemplateController) One(c *gin.Context) {
 // A failure returns 500 status code
 // This takes lookup parameters and order parameters to filter and sort output data
 func (ctrl JobTemplateController) All(c *gin.Context) {
-	user := c.MustGet(cUser).(common.User)
-
 	parser := util.NewQueryParser(c)
 	match := bson.M{}
 	match = parser.Lookups([]string{"name", "description", "labels"}, match)
 
-	query := db.JobTemplates().Find(match)
-	if order := parser.OrderBy(); order != "" {
-		query.Sort(order)
+	// restrict the query to objects the user can read
+	access, err := accessFilter(c, rbac.ResourceJobTemplate, "_id")
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting job template",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
 	}
 
-	roles := new(rbac.JobTemplate)
-	var jobTemplates []ansible.JobTemplate
-	iter := query.Iter()
-	var tmpJobTemplate ansible.JobTemplate
-	for iter.Next(&tmpJobTemplate) {
-		if !roles.Read(user, tmpJobTemplate) {
-			continue
-		}
-		metadata.JTemplateMetadata(&tmpJobTemplate)
-		jobTemplates = append(jobTemplates, tmpJobTemplate)
-	}
-	if err := iter.Close(); err != nil {
+	query := db.JobTemplates().Find(restrict(match, access))
+	count, err := query.Count()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while getting job template", Log: logrus.Fields{
-				"Error": err.Error(),
-			},
+			Message: "Error while getting job template",
+			Log:     logrus.Fields{"Error": err.Error()},
 		})
 		return
 	}
 
-	count := len(jobTemplates)
 	pgi := util.NewPagination(c, count)
 	if pgi.HasPage() {
 		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
@@ -152,11 +154,28 @@ func (ctrl JobTemplateController) All(c *gin.Context) {
 		return
 	}
 
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var jobTemplates []ansible.JobTemplate
+	if err := query.Skip(pgi.Skip()).Limit(pgi.Limit()).All(&jobTemplates); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting job template",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range jobTemplates {
+		jobTemplates[i].SurveySpec = hideSurveyPasswords(jobTemplates[i].SurveySpec)
+		metadata.JTemplateMetadata(&jobTemplates[i])
+	}
+
 	c.JSON(http.StatusOK, common.Response{
 		Count:    count,
 		Next:     pgi.NextPage(),
 		Previous: pgi.PreviousPage(),
-		Data:     jobTemplates[pgi.Skip():pgi.End()],
+		Data:     jobTemplates,
 	})
 }
 
@@ -184,7 +203,7 @@ func (ctrl JobTemplateController) All(c *gin.Context) {
 //   - 3: 3 Debug
 //   - 4: 4 Connection Debug
 //   - 5: 5 WinRM Debug
-// extra_vars:  string, default=""
+// extra_vars:  JSON object or YAML or JSON text of a mapping, default=""
 // job_tags:  string, default=""
 // force_handlers:  boolean, default=False
 // skip_tags:  string, default=""
@@ -197,8 +216,21 @@ func (ctrl JobTemplateController) All(c *gin.Context) {
 // ask_job_type_on_launch:  boolean, default=False
 // ask_inventory_on_launch:  boolean, default=False
 // ask_credential_on_launch:  boolean, default=False
+// extra_credentials:  list of cloud credential ids, at most one of each kind
+// ask_extra_credentials_on_launch:  boolean, default=False
 // become_enabled:  boolean, default=False
 // allow_simultaneous:  boolean, default=False
+// toolchain:  name of a registered ansible toolchain, default="" uses the project toolchain
+// execution_image:  image of job containers, default="" uses the default execution image
+// timeout:  seconds before running jobs are killed, default=0 uses the global job timeout
+// idle_timeout:  seconds running jobs may write no output before they are killed, default=0 disables it
+// retry_count:  relaunches of failed jobs, max=10 default=0
+// retry_backoff:  seconds before the first relaunch, doubled with every attempt, default=0
+// retry_on:  failures which are retried, any, error or unreachable, default="" retries any failure
+// survey_enabled:  boolean, default=False
+// survey_spec:  ordered questions asked on launch, answers are passed as extra variables.
+//   Types are text, textarea, password, integer, float, multiplechoice and multiselect.
+//   min and max bound the length of text answers and the value of numeric answers
 func (ctrl JobTemplateController) Create(c *gin.Context) {
 	user := c.MustGet(cUser).(common.User)
 
@@ -258,7 +290,7 @@ func (ctrl JobTemplateController) Create(c *gin.Context) {
 			return
 		}
 
-		if !roles.ReadByID(user, *req.MachineCredentialID) {
+		if !roles.UseByID(user, *req.MachineCredentialID) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 				Message: "You don't have sufficient permissions to perform this action.",
 			})
@@ -275,7 +307,7 @@ func (ctrl JobTemplateController) Create(c *gin.Context) {
 			return
 		}
 
-		if !roles.ReadByID(user, *req.NetworkCredentialID) {
+		if !roles.UseByID(user, *req.NetworkCredentialID) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 				Message: "You don't have sufficient permissions to perform this action.",
 			})
@@ -292,7 +324,7 @@ func (ctrl JobTemplateController) Create(c *gin.Context) {
 			return
 		}
 
-		if !roles.ReadByID(user, *req.CloudCredentialID) {
+		if !roles.UseByID(user, *req.CloudCredentialID) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 				Message: "You don't have sufficient permissions to perform this action.",
 			})
@@ -300,6 +332,22 @@ func (ctrl JobTemplateController) Create(c *gin.Context) {
 		}
 	}
 
+	if !checkVaultCredentials(c, user, req.VaultCredentialIDs) {
+		return
+	}
+
+	if _, ok := getExtraCredentials(c, user, req.CloudCredentialID, req.ExtraCredentialIDs); !ok {
+		return
+	}
+
+	if !toolchainValid(c, req.Toolchain, "ansible") {
+		return
+	}
+
+	if !checkSurveySpec(c, req.SurveySpec, nil) {
+		return
+	}
+
 	req.ID = bson.NewObjectId()
 	req.Created = time.Now()
 	req.Modified = time.Now()
@@ -323,6 +371,7 @@ func (ctrl JobTemplateController) Create(c *gin.Context) {
 	}
 
 	activity.AddActivity(activity.Create, user.ID, req, nil)
+	req.SurveySpec = hideSurveyPasswords(req.SurveySpec)
 	metadata.JTemplateMetadata(&req)
 	c.JSON(http.StatusCreated, req)
 }
@@ -375,7 +424,7 @@ func (ctrl JobTemplateController) Update(c *gin.Context) {
 			return
 		}
 
-		if !roles.ReadByID(user, *req.MachineCredentialID) {
+		if !roles.UseByID(user, *req.MachineCredentialID) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 				Message: "You don't have sufficient permissions to perform this action.",
 			})
@@ -392,7 +441,7 @@ func (ctrl JobTemplateController) Update(c *gin.Context) {
 			return
 		}
 
-		if !roles.ReadByID(user, *req.NetworkCredentialID) {
+		if !roles.UseByID(user, *req.NetworkCredentialID) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 				Message: "You don't have sufficient permissions to perform this action.",
 			})
@@ -409,7 +458,7 @@ func (ctrl JobTemplateController) Update(c *gin.Context) {
 			return
 		}
 
-		if !roles.ReadByID(user, *req.CloudCredentialID) {
+		if !roles.UseByID(user, *req.CloudCredentialID) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 				Message: "You don't have sufficient permissions to perform this action.",
 			})
@@ -417,6 +466,22 @@ func (ctrl JobTemplateController) Update(c *gin.Context) {
 		}
 	}
 
+	if !checkVaultCredentials(c, user, req.VaultCredentialIDs) {
+		return
+	}
+
+	if _, ok := getExtraCredentials(c, user, req.CloudCredentialID, req.ExtraCredentialIDs); !ok {
+		return
+	}
+
+	if !toolchainValid(c, req.Toolchain, "ansible") {
+		return
+	}
+
+	if !checkSurveySpec(c, req.SurveySpec, jobTemplate.SurveySpec) {
+		return
+	}
+
 	jobTemplate.Name = strings.Trim(req.Name, " ")
 	jobTemplate.JobType = req.JobType
 	jobTemplate.InventoryID = req.InventoryID
@@ -436,6 +501,9 @@ func (ctrl JobTemplateController) Update(c *gin.Context) {
 	jobTemplate.BecomeEnabled = req.BecomeEnabled
 	jobTemplate.CloudCredentialID = req.CloudCredentialID
 	jobTemplate.NetworkCredentialID = req.NetworkCredentialID
+	jobTemplate.VaultCredentialIDs = req.VaultCredentialIDs
+	jobTemplate.ExtraCredentialIDs = req.ExtraCredentialIDs
+	jobTemplate.PromptExtraCredentials = req.PromptExtraCredentials
 	jobTemplate.PromptLimit = req.PromptLimit
 	jobTemplate.PromptInventory = req.PromptInventory
 	jobTemplate.PromptCredential = req.PromptCredential
@@ -443,6 +511,15 @@ func (ctrl JobTemplateController) Update(c *gin.Context) {
 	jobTemplate.PromptTags = req.PromptTags
 	jobTemplate.PromptSkipTags = req.PromptSkipTags
 	jobTemplate.AllowSimultaneous = req.AllowSimultaneous
+	jobTemplate.Toolchain = req.Toolchain
+	jobTemplate.ExecutionImage = req.ExecutionImage
+	jobTemplate.Timeout = req.Timeout
+	jobTemplate.IdleTimeout = req.IdleTimeout
+	jobTemplate.RetryCount = req.RetryCount
+	jobTemplate.RetryBackoff = req.RetryBackoff
+	jobTemplate.RetryOn = req.RetryOn
+	jobTemplate.SurveyEnabled = req.SurveyEnabled
+	jobTemplate.SurveySpec = req.SurveySpec
 	jobTemplate.PolymorphicCtypeID = req.PolymorphicCtypeID
 	jobTemplate.Modified = time.Now()
 	jobTemplate.ModifiedByID = user.ID
@@ -465,6 +542,7 @@ func (ctrl JobTemplateController) Update(c *gin.Context) {
 	}
 
 	activity.AddActivity(activity.Update, user.ID, tmpJobTemplate, jobTemplate)
+	jobTemplate.SurveySpec = hideSurveyPasswords(jobTemplate.SurveySpec)
 	metadata.JTemplateMetadata(&jobTemplate)
 	c.JSON(http.StatusOK, jobTemplate)
 }
@@ -583,7 +661,7 @@ func (ctrl JobTemplateController) Jobs(c *gin.Context) {
 
 // Launch creates a new job and adds the job into job queue. If any
 // passwords, inventory, or extra variables (extra_vars) are required, they must
-// be passed via POST data, with extra_vars given as a JSON string.
+// be passed via POST data, with extra_vars given as a JSON object or as YAML or JSON text.
 // If `credential_needed_to_start` is `true` then the `credential` field is required
 // and if the `inventory_needed_to_start` is `True` then the `inventory` is required as well.
 // success returns JSON serialized Job model with 201 status code
@@ -600,12 +678,25 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 		return
 	}
 
+	job, ok := launchJobTemplate(c, template, user, req, ansible.JOB_LAUNCH_TYPE_MANUAL, nil)
+	if !ok {
+		return
+	}
+
+	metadata.JobMetadata(&job)
+	c.JSON(http.StatusCreated, job)
+}
+
+// launchJobTemplate creates a job from the job template and adds it to the job queue.
+// Variables in vars take precedence over other job variables, see jobVars.
+// A failure aborts the request and returns false
+func launchJobTemplate(c *gin.Context, template ansible.JobTemplate, user common.User, req ansible.Launch, launchType string, vars gin.H) (ansible.Job, bool) {
 	// create new Job
 	job := ansible.Job{
 		ID:                  bson.NewObjectId(),
 		Name:                template.Name,
 		Description:         template.Description,
-		LaunchType:          "manual",
+		LaunchType:          launchType,
 		CancelFlag:          false,
 		Status:              "new",
 		JobType:             ansible.JOBTYPE_ANSIBLE_JOB,
@@ -625,6 +716,8 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 		BecomeEnabled:       template.BecomeEnabled,
 		NetworkCredentialID: template.NetworkCredentialID,
 		CloudCredentialID:   template.CloudCredentialID,
+		VaultCredentialIDs:  template.VaultCredentialIDs,
+		ExtraCredentialIDs:  template.ExtraCredentialIDs,
 		SCMCredentialID:     nil,
 		CreatedByID:         user.ID,
 		ModifiedByID:        user.ID,
@@ -637,27 +730,33 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 		PromptTags:          template.PromptTags,
 		PromptVariables:     template.PromptVariables,
 		AllowSimultaneous:   template.AllowSimultaneous,
+		ExecutionImage:      template.ExecutionImage,
+		Timeout:             template.Timeout,
+		IdleTimeout:         template.IdleTimeout,
+		RetryCount:          template.RetryCount,
+		RetryBackoff:        template.RetryBackoff,
+		RetryOn:             template.RetryOn,
+
+		PromptExtraCredentials: template.PromptExtraCredentials,
 	}
 
-	// if prompt is true override Job template
-	// if not provided return an error message
-	if template.PromptVariables {
-		if !(len(req.ExtraVars) > 0) {
-			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
-				Message: "Additional variables required.",
-			})
-			return
-		}
-
-		job.ExtraVars = req.ExtraVars
+	var survey common.SurveySpec
+	if template.SurveyEnabled {
+		survey = template.SurveySpec
+	}
+	extraVars, passwords, ok := jobVars(c, template.ExtraVars, req.ExtraVars, template.PromptVariables, survey, vars)
+	if !ok {
+		return job, false
 	}
+	job.ExtraVars = extraVars
+	job.SurveyPasswords = passwords
 
 	if template.PromptLimit {
 		if !(len(req.Limit) > 0) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
 				Message: "Limit required.",
 			})
-			return
+			return job, false
 		}
 
 		job.Limit = req.Limit
@@ -668,7 +767,7 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
 				Message: "Job tags required.",
 			})
-			return
+			return job, false
 		}
 
 		job.JobTags = req.JobTags
@@ -679,7 +778,7 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
 				Message: "Skip tags required.",
 			})
-			return
+			return job, false
 		}
 
 		job.SkipTags = req.SkipTags
@@ -690,12 +789,17 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
 				Message: "Job type required.",
 			})
-			return
+			return job, false
 		}
 
 		job.JobType = req.JobType
 	}
 
+	// extra credentials are replaced only when provided
+	if template.PromptExtraCredentials && req.ExtraCredentialIDs != nil {
+		job.ExtraCredentialIDs = *req.ExtraCredentialIDs
+	}
+
 	// create new Ansible runner Job
 	runnerJob := types.AnsibleJob{
 		Job:      job,
@@ -708,7 +812,7 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
 				Message: "Inventory required.",
 			})
-			return
+			return job, false
 		}
 		job.InventoryID = req.InventoryID
 	}
@@ -718,11 +822,20 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
 				Message: "Credential required.",
 			})
-			return
+			return job, false
 		}
 		job.MachineCredentialID = &req.MachineCredentialID
 	}
 
+	// the user must be able to use every credential the job references
+	if !canUseCredentials(user, job.MachineCredentialID, job.NetworkCredentialID, job.CloudCredentialID) ||
+		!canUseCredentials(user, credentialRefs(job.VaultCredentialIDs)...) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to use the job credentials.",
+		})
+		return job, false
+	}
+
 	if job.NetworkCredentialID != nil {
 		var credential common.Credential
 		if err := db.Credentials().FindId(*job.NetworkCredentialID).One(&credential); err != nil {
@@ -730,7 +843,7 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 				Message: "Error while getting network credential",
 				Log:     logrus.Fields{"Error": err.Error()},
 			})
-			return
+			return job, false
 		}
 		runnerJob.Network = credential
 	}
@@ -743,18 +856,36 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 				Message: "Error while getting cloud credential",
 				Log:     logrus.Fields{"Error": err.Error()},
 			})
-			return
+			return job, false
 		}
 		runnerJob.Cloud = credential
 	}
 
+	if len(job.VaultCredentialIDs) > 0 {
+		var credentials []common.Credential
+		if err := db.Credentials().Find(bson.M{"_id": bson.M{"$in": job.VaultCredentialIDs}}).All(&credentials); err != nil {
+			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+				Message: "Error while getting vault credentials",
+				Log:     logrus.Fields{"Error": err.Error()},
+			})
+			return job, false
+		}
+		runnerJob.Vaults = credentials
+	}
+
+	extras, ok := getExtraCredentials(c, user, job.CloudCredentialID, job.ExtraCredentialIDs)
+	if !ok {
+		return job, false
+	}
+	runnerJob.Extras = extras
+
 	var inventory ansible.Inventory
 	if err := db.Inventories().FindId(job.InventoryID).One(&inventory); err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
 			Message: "Error while getting inventory",
 			Log:     logrus.Fields{"Error": err.Error()},
 		})
-		return
+		return job, false
 	}
 	runnerJob.Inventory = inventory
 
@@ -765,7 +896,7 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 				Message: "Error while getting machine credential",
 				Log:     logrus.Fields{"Error": err.Error()},
 			})
-			return
+			return job, false
 		}
 		runnerJob.Machine = credential
 	}
@@ -777,10 +908,19 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 			Message: "Error while getting project",
 			Log:     logrus.Fields{"Error": err.Error()},
 		})
-		return
+		return job, false
 	}
 	runnerJob.Project = project
 
+	// the template toolchain takes precedence over the project toolchain
+	job.Toolchain = template.Toolchain
+	if len(job.Toolchain) == 0 {
+		job.Toolchain = project.Toolchain
+	}
+	if !toolchainValid(c, job.Toolchain, "ansible") {
+		return job, false
+	}
+
 	// Get jwt token for authorize Ansible inventory plugin
 	var token jwt.LocalToken
 	if err := jwt.NewAuthToken(&token); err != nil {
@@ -788,7 +928,7 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 			Message: "Error while getting token",
 			Log:     logrus.Fields{"Error": err.Error()},
 		})
-		return
+		return job, false
 	}
 	runnerJob.Token = token.Token
 
@@ -798,23 +938,23 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 			Message: "Error while creating job",
 			Log:     logrus.Fields{"Error": err.Error()},
 		})
-		return
+		return job, false
 	}
 
-	// update if requested
-	if _, err := os.Stat(project.LocalPath); os.IsNotExist(err) || runnerJob.Project.ScmUpdateOnLaunch {
-		tj, err := sync.UpdateProject(project)
-		runnerJob.PreviousJob = tj
-		if err != nil {
-			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-				Message: "Error while creating update job",
-				Log:     logrus.Fields{"Error": err.Error()},
-			})
-			return
-		}
+	// update if requested, the job waits for a running update of the project
+	tj, err := sync.UpdateOnLaunch(project)
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while creating update job",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return job, false
 	}
+	runnerJob.PreviousJob = tj
 
 	// Add the job to queue
+	runnerJob.Job = job
+	runnerJob.SurveyPasswords = job.SurveyPasswords
 	jobQueue := queue.OpenAnsibleQueue()
 	jobBytes, err := json.Marshal(runnerJob)
 	if err != nil {
@@ -822,12 +962,11 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 			Message: "Error while queueing job",
 			Log:     logrus.Fields{"Error": err.Error()},
 		})
-		return
+		return job, false
 	}
 
 	jobQueue.PublishBytes(jobBytes)
-	metadata.JobMetadata(&job)
-	c.JSON(http.StatusCreated, job)
+	return job, true
 }
 
 // LaunchInfo returns JSON serialized launch information to determine if the job_template can be
@@ -840,6 +979,9 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 // ask_limit_on_launch: Flag indicating whether the job template is configured to prompt for limit upon launch
 // ask_inventory_on_launch: Flag indicating whether the job template is configured to prompt for inventory upon launch
 // ask_credential_on_launch: Flag indicating whether the job template is configured to prompt for credential upon launch
+// ask_extra_credentials_on_launch: Flag indicating whether the job template is configured to prompt for extra credentials upon launch
+// survey_enabled: Flag indicating whether answers to the survey are passed as extra variables
+// survey_spec: Questions of the survey, answers are given in extra_vars
 // can_start_without_user_input: Flag indicating if the job template can be launched without user-input
 // variables_needed_to_start: Required variable names required to launch the job_template
 // credential_needed_to_start: Flag indicating the presence of a credential associated with the job template.
@@ -859,6 +1001,7 @@ func (ctrl JobTemplateController) LaunchInfo(c *gin.Context) {
 		"job_type":   jt.JobType,
 		"skip_tags":  jt.SkipTags,
 		"limit":      jt.Limit,
+		"extra_credentials": jt.ExtraCredentialIDs,
 		"inventory": gin.H{
 			"id":   jt.InventoryID,
 			"name": "Demo Inventory",
@@ -895,6 +1038,11 @@ func (ctrl JobTemplateController) LaunchInfo(c *gin.Context) {
 		}
 	}
 
+	variablesNeeded := []string{}
+	if jt.SurveyEnabled {
+		variablesNeeded = surveyVariablesNeeded(jt.SurveySpec)
+	}
+
 	resp := gin.H{
 		"passwords_needed_to_start":  []gin.H{},
 		"ask_variables_on_launch":    jt.PromptVariables,
@@ -903,7 +1051,10 @@ func (ctrl JobTemplateController) LaunchInfo(c *gin.Context) {
 		"ask_limit_on_launch":        jt.PromptInventory,
 		"ask_inventory_on_launch":    jt.PromptInventory,
 		"ask_credential_on_launch":   jt.PromptCredential,
-		"variables_needed_to_start":  []gin.H{},
+		"ask_extra_credentials_on_launch": jt.PromptExtraCredentials,
+		"variables_needed_to_start":  variablesNeeded,
+		"survey_enabled":             jt.SurveyEnabled,
+		"survey_spec":                hideSurveyPasswords(jt.SurveySpec),
 		"credential_needed_to_start": isCredentialNeeded,
 		"inventory_needed_to_start":  isInventoryNeeded,
 		"job_template_data": gin.H{
@@ -968,3 +1119,49 @@ func (ctrl JobTemplateController) ObjectRoles(c *gin.Context) {
 	})
 
 }
+
+// checkVaultCredentials makes sure every vault credential exists, can be used by
+// the user and has a distinct vault ID. aborts the request and returns false otherwise
+func checkVaultCredentials(c *gin.Context, user common.User, credentialIDs []bson.ObjectId) bool {
+	if len(credentialIDs) == 0 {
+		return true
+	}
+
+	var credentials []common.Credential
+	query := bson.M{"_id": bson.M{"$in": credentialIDs}, "kind": common.CredentialKindVAULT}
+	if err := db.Credentials().Find(query).All(&credentials); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting vault credentials",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return false
+	}
+
+	if len(credentials) != len(credentialIDs) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Vault credential does not exists",
+		})
+		return false
+	}
+
+	roles := new(rbac.Credential)
+	vaultIDs := map[string]bool{}
+	for _, credential := range credentials {
+		if !roles.Use(user, credential) {
+			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+				Message: "You don't have sufficient permissions to perform this action.",
+			})
+			return false
+		}
+
+		if vaultIDs[credential.VaultID] {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Vault credentials must have distinct vault IDs",
+			})
+			return false
+		}
+		vaultIDs[credential.VaultID] = true
+	}
+
+	return true
+}
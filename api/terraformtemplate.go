@@ -25,7 +25,6 @@ import (
 	"gopkg.in/gin-gonic/gin.v1"
 	"gopkg.in/gin-gonic/gin.v1/binding"
 	"gopkg.in/mgo.v2/bson"
-	"os"
 )
 
 // Keys for credential related items stored in the Gin Context
@@ -70,7 +69,7 @@ func (ctrl TJobTmplController) Middleware(c *gin.Context) {
 				return
 			}
 		}
-	case "PUT", "POST":
+	case "PUT", "DELETE":
 		{
 			// Reject the request if the user doesn't have write permissions
 			if !roles.Write(user, jobTemplate) {
@@ -80,6 +79,16 @@ func (ctrl TJobTmplController) Middleware(c *gin.Context) {
 				return
 			}
 		}
+	case "POST":
+		{
+			// Reject the request if the user doesn't have launch permissions
+			if !roles.Launch(user, jobTemplate) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
 	}
 
 	c.Set(cTerraformJobTemplate, jobTemplate)
@@ -91,6 +100,7 @@ func (ctrl TJobTmplController) Middleware(c *gin.Context) {
 // A failure will return 500 status code
 func (ctrl TJobTmplController) One(c *gin.Context) {
 	jobTemplate := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
+	jobTemplate.SurveySpec = hideSurveyPasswords(jobTemplate.SurveySpec)
 	metadata.JTemplateMetadata(&jobTemplate)
 	c.JSON(http.StatusOK, jobTemplate)
 }
@@ -112,36 +122,30 @@ func (ctrl TJobTmplController) One(c *gin.Context) {
 // A failure returns 500 status code
 // This takes lookup parameters and order parameters to filter and sort output data
 func (ctrl TJobTmplController) All(c *gin.Context) {
-	user := c.MustGet(cUser).(common.User)
 	parser := util.NewQueryParser(c)
 	match := bson.M{}
 	match = parser.Lookups([]string{"name", "description", "labels"}, match)
-	query := db.TerrafromJobTemplates().Find(match)
-	if order := parser.OrderBy(); order != "" {
-		query.Sort(order)
-	}
 
-	roles := new(rbac.TerraformJobTemplate)
-	var jobTemplates []terraform.JobTemplate
-	iter := query.Iter()
-	var tmpJobTemplate terraform.JobTemplate
-	for iter.Next(&tmpJobTemplate) {
-		if !roles.Read(user, tmpJobTemplate) {
-			continue
-		}
-		metadata.JTemplateMetadata(&tmpJobTemplate)
-		jobTemplates = append(jobTemplates, tmpJobTemplate)
+	// restrict the query to objects the user can read
+	access, err := accessFilter(c, rbac.ResourceTerraformJobTemplate, "_id")
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting job template",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
 	}
-	if err := iter.Close(); err != nil {
+
+	query := db.TerrafromJobTemplates().Find(restrict(match, access))
+	count, err := query.Count()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while getting job template", Log: logrus.Fields{
-				"Error": err.Error(),
-			},
+			Message: "Error while getting job template",
+			Log:     logrus.Fields{"Error": err.Error()},
 		})
 		return
 	}
 
-	count := len(jobTemplates)
 	pgi := util.NewPagination(c, count)
 	if pgi.HasPage() {
 		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
@@ -150,11 +154,28 @@ func (ctrl TJobTmplController) All(c *gin.Context) {
 		return
 	}
 
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var jobTemplates []terraform.JobTemplate
+	if err := query.Skip(pgi.Skip()).Limit(pgi.Limit()).All(&jobTemplates); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting job template",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range jobTemplates {
+		jobTemplates[i].SurveySpec = hideSurveyPasswords(jobTemplates[i].SurveySpec)
+		metadata.JTemplateMetadata(&jobTemplates[i])
+	}
+
 	c.JSON(http.StatusOK, common.Response{
 		Count:    count,
 		Next:     pgi.NextPage(),
 		Previous: pgi.PreviousPage(),
-		Data:     jobTemplates[pgi.Skip():pgi.End()],
+		Data:     jobTemplates,
 	})
 }
 
@@ -182,7 +203,7 @@ func (ctrl TJobTmplController) All(c *gin.Context) {
 //   - 3: 3 Debug
 //   - 4: 4 Connection Debug
 //   - 5: 5 WinRM Debug
-// extra_vars:  string, default=""
+// vars:  JSON object or YAML or JSON text of a mapping, default=""
 // job_tags:  string, default=""
 // force_handlers:  boolean, default=False
 // skip_tags:  string, default=""
@@ -195,8 +216,21 @@ func (ctrl TJobTmplController) All(c *gin.Context) {
 // ask_job_type_on_launch:  boolean, default=False
 // ask_inventory_on_launch:  boolean, default=False
 // ask_credential_on_launch:  boolean, default=False
+// extra_credentials:  list of cloud credential ids, at most one of each kind
+// ask_extra_credentials_on_launch:  boolean, default=False
 // become_enabled:  boolean, default=False
 // allow_simultaneous:  boolean, default=False
+// toolchain:  name of a registered terraform toolchain, default="" uses the project toolchain
+// execution_image:  image of job containers, default="" uses the default execution image
+// timeout:  seconds before running jobs are killed, default=0 uses the global job timeout
+// idle_timeout:  seconds running jobs may write no output before they are killed, default=0 disables it
+// retry_count:  relaunches of failed jobs, max=10 default=0
+// retry_backoff:  seconds before the first relaunch, doubled with every attempt, default=0
+// retry_on:  failures which are retried, any or error, default="" retries any failure
+// survey_enabled:  boolean, default=False
+// survey_spec:  ordered questions asked on launch, answers are passed as variables.
+//   Types are text, textarea, password, integer, float, multiplechoice and multiselect.
+//   min and max bound the length of text answers and the value of numeric answers
 func (ctrl TJobTmplController) Create(c *gin.Context) {
 	var req terraform.JobTemplate
 	// get user from the gin.Context
@@ -241,7 +275,7 @@ func (ctrl TJobTmplController) Create(c *gin.Context) {
 			return
 		}
 
-		if !roles.ReadByID(user, *req.MachineCredentialID) {
+		if !roles.UseByID(user, *req.MachineCredentialID) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 				Message: "You don't have sufficient permissions to perform this action.",
 			})
@@ -258,7 +292,7 @@ func (ctrl TJobTmplController) Create(c *gin.Context) {
 			return
 		}
 
-		if !roles.ReadByID(user, *req.NetworkCredentialID) {
+		if !roles.UseByID(user, *req.NetworkCredentialID) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 				Message: "You don't have sufficient permissions to perform this action.",
 			})
@@ -275,7 +309,7 @@ func (ctrl TJobTmplController) Create(c *gin.Context) {
 			return
 		}
 
-		if !roles.ReadByID(user, *req.CloudCredentialID) {
+		if !roles.UseByID(user, *req.CloudCredentialID) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 				Message: "You don't have sufficient permissions to perform this action.",
 			})
@@ -283,6 +317,25 @@ func (ctrl TJobTmplController) Create(c *gin.Context) {
 		}
 	}
 
+	if req.SCMCredentialID != nil && !roles.UseByID(user, *req.SCMCredentialID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	if _, ok := getExtraCredentials(c, user, req.CloudCredentialID, req.ExtraCredentialIDs); !ok {
+		return
+	}
+
+	if !toolchainValid(c, req.Toolchain, "terraform") {
+		return
+	}
+
+	if !checkSurveySpec(c, req.SurveySpec, nil) {
+		return
+	}
+
 	req.ID = bson.NewObjectId()
 	req.Created = time.Now()
 	req.Modified = time.Now()
@@ -307,6 +360,7 @@ func (ctrl TJobTmplController) Create(c *gin.Context) {
 	}
 
 	activity.AddActivity(activity.Create, user.ID, req, nil)
+	req.SurveySpec = hideSurveyPasswords(req.SurveySpec)
 	metadata.JTemplateMetadata(&req)
 	c.JSON(http.StatusCreated, req)
 }
@@ -353,7 +407,7 @@ func (ctrl TJobTmplController) Update(c *gin.Context) {
 			return
 		}
 
-		if !roles.ReadByID(user, *req.MachineCredentialID) {
+		if !roles.UseByID(user, *req.MachineCredentialID) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 				Message: "You don't have sufficient permissions to perform this action.",
 			})
@@ -370,7 +424,7 @@ func (ctrl TJobTmplController) Update(c *gin.Context) {
 			return
 		}
 
-		if !roles.ReadByID(user, *req.NetworkCredentialID) {
+		if !roles.UseByID(user, *req.NetworkCredentialID) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 				Message: "You don't have sufficient permissions to perform this action.",
 			})
@@ -387,7 +441,7 @@ func (ctrl TJobTmplController) Update(c *gin.Context) {
 			return
 		}
 
-		if !roles.ReadByID(user, *req.CloudCredentialID) {
+		if !roles.UseByID(user, *req.CloudCredentialID) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
 				Message: "You don't have sufficient permissions to perform this action.",
 			})
@@ -395,6 +449,18 @@ func (ctrl TJobTmplController) Update(c *gin.Context) {
 		}
 	}
 
+	if _, ok := getExtraCredentials(c, user, req.CloudCredentialID, req.ExtraCredentialIDs); !ok {
+		return
+	}
+
+	if !toolchainValid(c, req.Toolchain, "terraform") {
+		return
+	}
+
+	if !checkSurveySpec(c, req.SurveySpec, jobTemplate.SurveySpec) {
+		return
+	}
+
 	jobTemplate.Name = strings.Trim(req.Name, " ")
 	jobTemplate.JobType = req.JobType
 	jobTemplate.ProjectID = req.ProjectID
@@ -404,9 +470,20 @@ func (ctrl TJobTmplController) Update(c *gin.Context) {
 	jobTemplate.PromptVariables = req.PromptVariables
 	jobTemplate.CloudCredentialID = req.CloudCredentialID
 	jobTemplate.NetworkCredentialID = req.NetworkCredentialID
+	jobTemplate.ExtraCredentialIDs = req.ExtraCredentialIDs
+	jobTemplate.PromptExtraCredentials = req.PromptExtraCredentials
 	jobTemplate.PromptCredential = req.PromptCredential
 	jobTemplate.PromptJobType = req.PromptJobType
 	jobTemplate.AllowSimultaneous = req.AllowSimultaneous
+	jobTemplate.Toolchain = req.Toolchain
+	jobTemplate.ExecutionImage = req.ExecutionImage
+	jobTemplate.Timeout = req.Timeout
+	jobTemplate.IdleTimeout = req.IdleTimeout
+	jobTemplate.RetryCount = req.RetryCount
+	jobTemplate.RetryBackoff = req.RetryBackoff
+	jobTemplate.RetryOn = req.RetryOn
+	jobTemplate.SurveyEnabled = req.SurveyEnabled
+	jobTemplate.SurveySpec = req.SurveySpec
 	jobTemplate.Modified = time.Now()
 	jobTemplate.ModifiedByID = user.ID
 
@@ -428,6 +505,7 @@ func (ctrl TJobTmplController) Update(c *gin.Context) {
 	}
 
 	activity.AddActivity(activity.Update, user.ID, tmpJobTemplate, jobTemplate)
+	jobTemplate.SurveySpec = hideSurveyPasswords(jobTemplate.SurveySpec)
 	metadata.JTemplateMetadata(&jobTemplate)
 	c.JSON(http.StatusOK, jobTemplate)
 }
@@ -561,7 +639,7 @@ func (ctrl TJobTmplController) Jobs(c *gin.Context) {
 
 // Launch creates a new job and adds the job into job queue. If any
 // passwords, inventory, or extra variables (extra_vars) are required, they must
-// be passed via POST data, with extra_vars given as a JSON string.
+// be passed via POST data, with vars given as a JSON object or as YAML or JSON text.
 // If `credential_needed_to_start` is `true` then the `credential` field is required
 // and if the `inventory_needed_to_start` is `True` then the `inventory` is required as well.
 // success returns JSON serialized Job model with 201 status code
@@ -577,12 +655,25 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 		return
 	}
 
+	job, ok := launchTerraformJobTemplate(c, template, user, req, terraform.JobLaunchTypeManual, nil)
+	if !ok {
+		return
+	}
+
+	metadata.JobMetadata(&job)
+	c.JSON(http.StatusCreated, job)
+}
+
+// launchTerraformJobTemplate creates a job from the terraform job template and adds it to the job queue.
+// Variables in vars take precedence over other job variables, see jobVars.
+// A failure aborts the request and returns false
+func launchTerraformJobTemplate(c *gin.Context, template terraform.JobTemplate, user common.User, req terraform.Launch, launchType string, vars gin.H) (terraform.Job, bool) {
 	// create new Job
 	job := terraform.Job{
 		ID:                  bson.NewObjectId(),
 		Name:                template.Name,
 		Description:         template.Description,
-		LaunchType:          "manual",
+		LaunchType:          launchType,
 		CancelFlag:          false,
 		Status:              "new",
 		JobType:             template.JobType,
@@ -596,6 +687,7 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 		NetworkCredentialID: template.NetworkCredentialID,
 		CloudCredentialID:   template.CloudCredentialID,
 		SCMCredentialID:     template.SCMCredentialID,
+		ExtraCredentialIDs:  template.ExtraCredentialIDs,
 		CreatedByID:         user.ID,
 		ModifiedByID:        user.ID,
 		Created:             time.Now(),
@@ -605,32 +697,43 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 		PromptVariables:     template.PromptVariables,
 		AllowSimultaneous:   template.AllowSimultaneous,
 		Directory: template.Directory,
-	}
+		ExecutionImage:      template.ExecutionImage,
+		Timeout:             template.Timeout,
+		IdleTimeout:         template.IdleTimeout,
+		RetryCount:          template.RetryCount,
+		RetryBackoff:        template.RetryBackoff,
+		RetryOn:             template.RetryOn,
 
-	// if prompt is true override Job template
-	// if not provided return an error message
-	if template.PromptVariables {
-		if !(len(req.Vars) > 0) {
-			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
-				Message: "Additional variables required.",
-			})
-			return
-		}
+		PromptExtraCredentials: template.PromptExtraCredentials,
+	}
 
-		job.Vars = req.Vars
+	var survey common.SurveySpec
+	if template.SurveyEnabled {
+		survey = template.SurveySpec
+	}
+	variables, passwords, ok := jobVars(c, template.Vars, req.Vars, template.PromptVariables, survey, vars)
+	if !ok {
+		return job, false
 	}
+	job.Vars = variables
+	job.SurveyPasswords = passwords
 
 	if template.PromptJobType {
 		if !(len(req.JobType) > 0) {
 			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
 				Message: "Job type required.",
 			})
-			return
+			return job, false
 		}
 
 		job.JobType = req.JobType
 	}
 
+	// extra credentials are replaced only when provided
+	if template.PromptExtraCredentials && req.ExtraCredentialIDs != nil {
+		job.ExtraCredentialIDs = *req.ExtraCredentialIDs
+	}
+
 	// create new Ansible runner Job
 	runnerJob := types.TerraformJob{
 		Job:      job,
@@ -644,11 +747,19 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 				Code:   http.StatusBadRequest,
 				Errors: []string{"Credential required"},
 			})
-			return
+			return job, false
 		}
 		job.MachineCredentialID = req.MachineCredentialID
 	}
 
+	// the user must be able to use every credential the job references
+	if !canUseCredentials(user, job.MachineCredentialID, job.NetworkCredentialID, job.CloudCredentialID, job.SCMCredentialID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to use the job credentials.",
+		})
+		return job, false
+	}
+
 	if job.NetworkCredentialID != nil {
 		var credential common.Credential
 		if err := db.Credentials().FindId(*job.NetworkCredentialID).One(&credential); err != nil {
@@ -656,7 +767,7 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 				Message: "Error while getting network credential",
 				Log:     logrus.Fields{"Error": err.Error()},
 			})
-			return
+			return job, false
 		}
 		runnerJob.Network = credential
 	}
@@ -668,11 +779,17 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 				Message: "Error while getting cloud credential",
 				Log:     logrus.Fields{"Error": err.Error()},
 			})
-			return
+			return job, false
 		}
 		runnerJob.Cloud = credential
 	}
 
+	extras, ok := getExtraCredentials(c, user, job.CloudCredentialID, job.ExtraCredentialIDs)
+	if !ok {
+		return job, false
+	}
+	runnerJob.Extras = extras
+
 	if job.MachineCredentialID != nil {
 		var credential common.Credential
 		if err := db.Credentials().FindId(*job.MachineCredentialID).One(&credential); err != nil {
@@ -680,7 +797,7 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 				Message: "Error while getting machine credential",
 				Log:     logrus.Fields{"Error": err.Error()},
 			})
-			return
+			return job, false
 		}
 		runnerJob.Machine = credential
 	}
@@ -691,10 +808,19 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 			Message: "Error while getting project",
 			Log:     logrus.Fields{"Error": err.Error()},
 		})
-		return
+		return job, false
 	}
 	runnerJob.Project = project
 
+	// the template toolchain takes precedence over the project toolchain
+	job.Toolchain = template.Toolchain
+	if len(job.Toolchain) == 0 {
+		job.Toolchain = project.Toolchain
+	}
+	if !toolchainValid(c, job.Toolchain, "terraform") {
+		return job, false
+	}
+
 	// Get jwt token for authorize API
 	var token jwt.LocalToken
 	if err := jwt.NewAuthToken(&token); err != nil {
@@ -702,7 +828,7 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 			Message: "Error while getting token",
 			Log:     logrus.Fields{"Error": err.Error()},
 		})
-		return
+		return job, false
 	}
 	runnerJob.Token = token.Token
 
@@ -711,22 +837,23 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 			Message: "Error while creating job",
 			Log:     logrus.Fields{"Error": err.Error()},
 		})
-		return
+		return job, false
 	}
 
-	if _, err := os.Stat(project.LocalPath); os.IsNotExist(err) || runnerJob.Project.ScmUpdateOnLaunch {
-		tj, err := sync.UpdateProject(project)
-		runnerJob.PreviousJob = tj
-		if err != nil {
-			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-				Message: "Error while creating update job",
-				Log:     logrus.Fields{"Error": err.Error()},
-			})
-			return
-		}
+	// update if requested, the job waits for a running update of the project
+	tj, err := sync.UpdateOnLaunch(project)
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while creating update job",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return job, false
 	}
+	runnerJob.PreviousJob = tj
 
 	// Add the job to queue
+	runnerJob.Job = job
+	runnerJob.SurveyPasswords = job.SurveyPasswords
 	jobQueue := queue.OpenTerraformQueue()
 	jobBytes, err := json.Marshal(runnerJob)
 	if err != nil {
@@ -734,12 +861,11 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 			Message: "Error while queueing job",
 			Log:     logrus.Fields{"Error": err.Error()},
 		})
-		return
+		return job, false
 	}
 
 	jobQueue.PublishBytes(jobBytes)
-	metadata.JobMetadata(&job)
-	c.JSON(http.StatusCreated, job)
+	return job, true
 }
 
 // LaunchInfo returns JSON serialized launch information to determine if the job_template can be
@@ -752,6 +878,9 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 // ask_limit_on_launch: Flag indicating whether the job template is configured to prompt for limit upon launch
 // ask_inventory_on_launch: Flag indicating whether the job template is configured to prompt for inventory upon launch
 // ask_credential_on_launch: Flag indicating whether the job template is configured to prompt for credential upon launch
+// ask_extra_credentials_on_launch: Flag indicating whether the job template is configured to prompt for extra credentials upon launch
+// survey_enabled: Flag indicating whether answers to the survey are passed as variables
+// survey_spec: Questions of the survey, answers are given in vars
 // can_start_without_user_input: Flag indicating if the job template can be launched without user-input
 // variables_needed_to_start: Required variable names required to launch the job_template
 // credential_needed_to_start: Flag indicating the presence of a credential associated with the job template.
@@ -767,6 +896,7 @@ func (ctrl TJobTmplController) LaunchInfo(c *gin.Context) {
 	defaults := gin.H{
 		"vars":     jt.Vars,
 		"job_type": jt.JobType,
+		"extra_credentials": jt.ExtraCredentialIDs,
 	}
 
 	var cred common.Credential
@@ -784,12 +914,20 @@ func (ctrl TJobTmplController) LaunchInfo(c *gin.Context) {
 		}
 	}
 
+	variablesNeeded := []string{}
+	if jt.SurveyEnabled {
+		variablesNeeded = surveyVariablesNeeded(jt.SurveySpec)
+	}
+
 	resp := gin.H{
 		"passwords_needed_to_start":  []gin.H{},
 		"ask_variables_on_launch":    jt.PromptVariables,
 		"ask_job_type_on_launch":     jt.PromptJobType,
 		"ask_credential_on_launch":   jt.PromptCredential,
-		"variables_needed_to_start":  []gin.H{},
+		"ask_extra_credentials_on_launch": jt.PromptExtraCredentials,
+		"variables_needed_to_start":  variablesNeeded,
+		"survey_enabled":             jt.SurveyEnabled,
+		"survey_spec":                hideSurveyPasswords(jt.SurveySpec),
 		"credential_needed_to_start": isCredentialNeeded,
 		"job_template_data": gin.H{
 			"id":          jt.ID.Hex(),
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/gin-gonic/gin.v1"
+)
+
+// ToolchainController lists execution toolchains registered in the configuration
+type ToolchainController struct{}
+
+// All is a Gin handler function which returns list of registered toolchains,
+// the kind query parameter restricts the list to ansible or terraform toolchains
+func (ctrl ToolchainController) All(c *gin.Context) {
+	kind := c.Query("kind")
+
+	toolchains := []gin.H{}
+	for _, name := range util.ToolchainNames() {
+		toolchain := util.Config.Toolchains[name]
+		if len(kind) > 0 && toolchain.Kind != kind {
+			continue
+		}
+		toolchains = append(toolchains, gin.H{
+			"type":        "toolchain",
+			"name":        name,
+			"kind":        toolchain.Kind,
+			"path":        toolchain.Path,
+			"description": toolchain.Description,
+		})
+	}
+
+	count := len(toolchains)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     toolchains[pgi.Skip():pgi.End()],
+	})
+}
+
+// toolchainValid checks that toolchain name, selected by a project or a template,
+// is registered for jobs of kind. An empty name selects the default toolchain.
+// A failure aborts the request and returns false
+func toolchainValid(c *gin.Context, name string, kind string) bool {
+	if len(name) == 0 {
+		return true
+	}
+
+	if _, err := util.FindToolchain(name, kind); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: err.Error() + ".",
+		})
+		return false
+	}
+	return true
+}
@@ -104,24 +104,15 @@ func (ctrl UserController) All(c *gin.Context) {
 	match := bson.M{}
 	match = parser.Lookups([]string{"username", "first_name", "last_name"}, match)
 
-	query := db.Users().Find(match)
-	if order := parser.OrderBy(); order != "" {
-		query.Sort(order)
+	// users other than super users and system auditors can only see themselves
+	access := bson.M{}
+	if !rbac.HasGlobalRead(user) {
+		access = bson.M{"_id": user.ID}
 	}
 
-	roles := new(rbac.User)
-	var users []common.User
-	iter := query.Iter()
-	var tmpUser common.User
-	for iter.Next(&tmpUser) {
-		if !roles.Read(user, tmpUser) {
-			continue
-		}
-		metadata.UserMetadata(&tmpUser)
-		tmpUser.Password = "$encrypted$"
-		users = append(users, tmpUser)
-	}
-	if err := iter.Close(); err != nil {
+	query := db.Users().Find(restrict(match, access))
+	count, err := query.Count()
+	if err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
 			Message: "Error while getting users",
 			Log:     logrus.Fields{"Error": err.Error()},
@@ -129,7 +120,6 @@ func (ctrl UserController) All(c *gin.Context) {
 		return
 	}
 
-	count := len(users)
 	pgi := util.NewPagination(c, count)
 	if pgi.HasPage() {
 		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
@@ -138,11 +128,28 @@ func (ctrl UserController) All(c *gin.Context) {
 		return
 	}
 
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var users []common.User
+	if err := query.Skip(pgi.Skip()).Limit(pgi.Limit()).All(&users); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting users",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range users {
+		metadata.UserMetadata(&users[i])
+		users[i].Password = "$encrypted$"
+	}
+
 	c.JSON(http.StatusOK, common.Response{
 		Count:    count,
 		Next:     pgi.NextPage(),
 		Previous: pgi.PreviousPage(),
-		Data:     users[pgi.Skip():pgi.End()],
+		Data:     users,
 	})
 }
 
@@ -179,9 +186,20 @@ func (ctrl UserController) Create(c *gin.Context) {
 		return
 	}
 
+	password := req.Password
+	if !checkPassword(c, common.User{}, password) {
+		return
+	}
+
 	req.ID = bson.NewObjectId()
-	pwdHash, _ := bcrypt.GenerateFromPassword([]byte(req.Password), 11)
-	req.Password = string(pwdHash)
+	req.Password = ""
+	if err := req.SetPassword(password); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
+			Message: "Error while creating user",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
 	req.Created = time.Now()
 	req.Modified = time.Now()
 
@@ -232,8 +250,26 @@ func (ctrl UserController) Update(c *gin.Context) {
 	user.Email = req.Email
 
 	if req.Password != "$encrypted$" {
-		pwdHash, _ := bcrypt.GenerateFromPassword([]byte(req.Password), 11)
-		user.Password = string(pwdHash)
+		// Users must change their own password through /me/password
+		// which requires the current password
+		if actor.ID == user.ID {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Use /v1/me/password to change your own password.",
+			})
+			return
+		}
+
+		if !checkPassword(c, user, req.Password) {
+			return
+		}
+
+		if err := user.SetPassword(req.Password); err != nil {
+			AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
+				Message: "Error while updating user.",
+				Log:     logrus.Fields{"User ID": user.ID.Hex(), "Error": err.Error()},
+			})
+			return
+		}
 	}
 	user.Modified = time.Now()
 	if err := db.Users().UpdateId(user.ID, user); err != nil {
@@ -250,9 +286,95 @@ func (ctrl UserController) Update(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
+// ChangePassword changes the password of the logged in user.
+// The current password is required, a token alone is not sufficient.
+func (ctrl UserController) ChangePassword(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	tmpUser := user
+
+	var req common.PasswordChange
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	// a locked account must not be able to keep guessing the current password
+	if user.IsLocked() {
+		activity.AddLoginActivity(activity.LoginFailed, user, c.ClientIP())
+		AbortWithError(LogFields{Context: c, Status: http.StatusForbidden,
+			Message: "Account is locked, try again later.",
+		})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		activity.AddLoginActivity(activity.LoginFailed, user, c.ClientIP())
+		if locked, err := user.AddFailedLogin(); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"User ID": user.ID.Hex(),
+				"Error":   err.Error(),
+			}).Errorln("Failed to record failed login")
+		} else if locked {
+			activity.AddLoginActivity(activity.Lockout, user, c.ClientIP())
+		}
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Current password is incorrect.",
+		})
+		return
+	}
+
+	if !checkPassword(c, user, req.NewPassword) {
+		return
+	}
+
+	if err := user.SetPassword(req.NewPassword); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
+			Message: "Error while changing password.",
+			Log:     logrus.Fields{"User ID": user.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	user.Modified = time.Now()
+	if err := db.Users().UpdateId(user.ID, user); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while changing password.",
+			Log:     logrus.Fields{"User ID": user.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Update, user.ID, tmpUser, user)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// checkPassword validates the password against the password policy and the
+// user's password history, aborts the request and returns false if it is not acceptable
+func checkPassword(c *gin.Context, user common.User, password string) bool {
+	if errs := util.CheckPasswordPolicy(password); len(errs) > 0 {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Password does not meet the password policy",
+			errs...)
+		return false
+	}
+
+	if user.IsPasswordReused(password) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Password has been used recently, choose a different password.",
+		})
+		return false
+	}
+
+	return true
+}
+
 func (ctrl UserController) Delete(c *gin.Context) {
 	loginUser := c.MustGet(cUser).(common.User)
 	user := c.MustGet("_user").(common.User)
+	// cached memberships and grants are stale once any of them is removed
+	defer rbac.Invalidate()
 
 	// Remove permissions
 	access := bson.M{"$pull": bson.M{"roles": common.AccessControl{GranteeID: user.ID}}}
@@ -3,12 +3,18 @@ package api
 import (
 	"errors"
 	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
 	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/rbac"
 	"github.com/pearsonappeng/tensor/util"
 	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/mgo.v2/bson"
 	"net/http"
 )
 
+// cResolver is the key of the permission resolver stored in the Gin Context
+const cResolver = "_resolver"
+
 type LogFields struct {
 	Context *gin.Context
 	Status  int
@@ -54,6 +60,31 @@ func AbortWithErrors(c *gin.Context, status int, message string, emsgs ...string
 	c.Abort()
 }
 
+// resolver returns the permission resolver of the request, accessible objects
+// are computed once per request and reused by subsequent checks
+func resolver(c *gin.Context) *rbac.Resolver {
+	if r, exists := c.Get(cResolver); exists {
+		return r.(*rbac.Resolver)
+	}
+	r := rbac.NewResolver(c.MustGet(cUser).(common.User))
+	c.Set(cResolver, r)
+	return r
+}
+
+// accessFilter returns a mongo filter restricting field to
+// objects of the resource type the logged in user can read
+func accessFilter(c *gin.Context, resourceType string, field string) (bson.M, error) {
+	return resolver(c).Filter(resourceType, rbac.ActionRead, field)
+}
+
+// restrict combines the query match with an access filter
+func restrict(match bson.M, access bson.M) bson.M {
+	if len(access) == 0 {
+		return match
+	}
+	return bson.M{"$and": []bson.M{match, access}}
+}
+
 // hideEncrypted is replaces encrypted fields by $encrypted$ string
 func hideEncrypted(c *common.Credential) {
 	encrypted := "$encrypted$"
@@ -64,6 +95,98 @@ func hideEncrypted(c *common.Credential) {
 	c.VaultPassword = encrypted
 	c.AuthorizePassword = encrypted
 	c.Secret = encrypted
+	c.SecurityToken = encrypted
+	for k := range c.SecretInputs {
+		if c.Inputs == nil {
+			c.Inputs = map[string]string{}
+		}
+		c.Inputs[k] = encrypted
+	}
+	c.SecretInputs = nil
+}
+
+// credentialRefs converts credential IDs to references accepted by canUseCredentials
+func credentialRefs(credentialIDs []bson.ObjectId) []*bson.ObjectId {
+	refs := make([]*bson.ObjectId, len(credentialIDs))
+	for i := range credentialIDs {
+		refs[i] = &credentialIDs[i]
+	}
+	return refs
+}
+
+// canUseCredentials reports whether the user holds the use permission
+// on every referenced credential, nil references are skipped
+func canUseCredentials(user common.User, credentialIDs ...*bson.ObjectId) bool {
+	roles := new(rbac.Credential)
+	for _, id := range credentialIDs {
+		if id != nil && !roles.UseByID(user, *id) {
+			return false
+		}
+	}
+	return true
+}
+
+// getExtraCredentials loads extra cloud credentials of a template or job. Every credential must
+// exist, be a cloud credential and be usable by the user, the cloud credential and extra credentials
+// can hold at most one credential of each kind, or of each credential type for custom credentials.
+// aborts the request and returns false otherwise
+func getExtraCredentials(c *gin.Context, user common.User, cloudCredentialID *bson.ObjectId,
+	credentialIDs []bson.ObjectId) ([]common.Credential, bool) {
+	if len(credentialIDs) == 0 {
+		return nil, true
+	}
+
+	var credentials []common.Credential
+	query := bson.M{"_id": bson.M{"$in": credentialIDs}, "kind": bson.M{"$in": common.CloudCredentialKinds}}
+	if err := db.Credentials().Find(query).All(&credentials); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting extra credentials",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return nil, false
+	}
+
+	if len(credentials) != len(credentialIDs) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Extra credential does not exists",
+		})
+		return nil, false
+	}
+
+	kind := func(credential common.Credential) string {
+		if credential.Kind == common.CredentialKindCUSTOM && credential.CredentialTypeID != nil {
+			return credential.Kind + ":" + credential.CredentialTypeID.Hex()
+		}
+		return credential.Kind
+	}
+
+	kinds := map[string]bool{}
+	if cloudCredentialID != nil {
+		var cloud common.Credential
+		if err := db.Credentials().FindId(*cloudCredentialID).One(&cloud); err == nil {
+			kinds[kind(cloud)] = true
+		}
+	}
+
+	roles := new(rbac.Credential)
+	for _, credential := range credentials {
+		if !roles.Use(user, credential) {
+			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+				Message: "You don't have sufficient permissions to perform this action.",
+			})
+			return nil, false
+		}
+
+		if kinds[kind(credential)] {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Only one cloud credential of kind " + credential.Kind + " can be used",
+			})
+			return nil, false
+		}
+		kinds[kind(credential)] = true
+	}
+
+	return credentials, true
 }
 
 func GetAPIVersion(c *gin.Context) {
@@ -88,6 +211,8 @@ func GetAPIInfo(c *gin.Context) {
 		"projects":                "/v1/projects",
 		"teams":                   "/v1/teams",
 		"credentials":             "/v1/credentials",
+		"credential_types":        "/v1/credential_types",
+		"toolchains":              "/v1/toolchains",
 		"inventory":               "/v1/inventories",
 		"inventory_scripts":       "/v1/inventory_scripts",
 		"inventory_sources":       "/v1/inventory_sources",
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/gin-gonic/gin.v1"
+)
+
+// jobVars returns the variables of a job launched from a template and the encrypted answers
+// to password questions of the survey. Variables are merged from these sources,
+// later sources take precedence:
+//
+//  1. variables of the template
+//  2. variables of the launch, when the template prompts for variables.
+//     Schedules launch jobs with their variables as launch variables
+//  3. answers to the survey, which are given in the variables of the launch
+//  4. variables set by tensor, such as details of webhook pushes
+//
+// The job stores the merged variables. Variables of the template are kept as written
+// when no other source sets variables.
+// A failure aborts the request and returns false
+func jobVars(c *gin.Context, templateVars common.Vars, launchVars common.Vars, prompt bool,
+	survey common.SurveySpec, vars gin.H) (common.Vars, map[string]string, bool) {
+	fromTemplate, err := templateVars.Map()
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Invalid variables of the job template.",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return "", nil, false
+	}
+	fromLaunch, err := launchVars.Map()
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Invalid launch variables.",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return "", nil, false
+	}
+
+	// if prompt is true launch variables are required
+	var prompted gin.H
+	if prompt {
+		if len(fromLaunch) == 0 {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Additional variables required.",
+			})
+			return "", nil, false
+		}
+		prompted = fromLaunch
+	}
+
+	var answers gin.H
+	var passwords map[string]string
+	if len(survey) > 0 {
+		var ok bool
+		if answers, passwords, ok = surveyAnswers(c, survey, fromLaunch); !ok {
+			return "", nil, false
+		}
+		// password answers replaced by variables set by tensor are not passed to the job
+		for k := range vars {
+			delete(passwords, k)
+		}
+	}
+
+	if len(prompted) == 0 && len(answers) == 0 && len(vars) == 0 {
+		return templateVars, passwords, true
+	}
+	merged, err := common.NewVars(common.MergeVars(fromTemplate, prompted, answers, vars))
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Invalid job variables.",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return "", nil, false
+	}
+	return merged, passwords, true
+}
@@ -0,0 +1,494 @@
+package api
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/sync"
+	"github.com/pearsonappeng/tensor/log/activity"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/pearsonappeng/tensor/rbac"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/pearsonappeng/tensor/validate"
+	"github.com/pearsonappeng/tensor/webhook"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/gin-gonic/gin.v1/binding"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Keys for webhook related items stored in the Gin Context
+const (
+	cWebhookDeliveryID = "webhook_delivery_id"
+)
+
+// maxWebhookPayload limits the size of webhook request bodies
+const maxWebhookPayload = 5 << 20
+
+// ReceiveWebhook handles push webhooks sent by SCM providers. The request is not authenticated,
+// deliveries are verified with the webhook secret of the project.
+// A push to the project branch updates the project and launches the webhook job templates
+// with the commit details as extra variables
+func (ctrl ProjectController) ReceiveWebhook(c *gin.Context) {
+	objectID := c.Params.ByName(cProjectID)
+	provider := c.Params.ByName("provider")
+
+	if !webhook.IsProvider(provider) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "Webhook provider is not supported",
+		})
+		return
+	}
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Project does not exist"})
+		return
+	}
+
+	var project common.Project
+	if err := db.Projects().FindId(bson.ObjectIdHex(objectID)).One(&project); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Project does not exist",
+			Log: logrus.Fields{
+				"Project ID": objectID,
+				"Error":      err.Error(),
+			},
+		})
+		return
+	}
+
+	if !project.Webhook.Enabled {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "Webhook is not enabled for the project",
+		})
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, maxWebhookPayload))
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Error while reading webhook payload",
+		})
+		return
+	}
+
+	// deliveries with an invalid signature are rejected without being recorded
+	if err := webhook.Verify(provider, util.Decipher(project.Webhook.Secret), c.Request.Header, body); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: err.Error(),
+			Log: logrus.Fields{
+				"Project ID": project.ID.Hex(),
+				"Provider":   provider,
+			},
+		})
+		return
+	}
+
+	event, guid := webhook.Event(provider, c.Request.Header)
+	delivery := common.WebhookDelivery{
+		ID:        bson.NewObjectId(),
+		ProjectID: project.ID,
+		Provider:  provider,
+		Event:     event,
+		GUID:      guid,
+		Payload:   string(body),
+		Created:   time.Now(),
+	}
+	if len(guid) > 0 {
+		delivery.ReceivedGUID = project.ID.Hex() + ":" + provider + ":" + guid
+	}
+
+	deliver(c, project, delivery)
+}
+
+// Webhook returns the webhook configuration of the project, the secret is never returned
+func (ctrl ProjectController) Webhook(c *gin.Context) {
+	project := c.MustGet(cProject).(common.Project)
+
+	c.JSON(http.StatusOK, maskWebhook(project.Webhook))
+}
+
+// UpdateWebhook configures the webhook of the project.
+// Job templates launched by the webhook must use the project and are launched
+// on behalf of the user who configured the webhook
+func (ctrl ProjectController) UpdateWebhook(c *gin.Context) {
+	project := c.MustGet(cProject).(common.Project)
+	tmpProject := project
+	user := c.MustGet(cUser).(common.User)
+
+	var req common.Webhook
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	// the masked secret keeps the current secret
+	if req.Secret == "$encrypted$" {
+		req.Secret = project.Webhook.Secret
+	} else if len(req.Secret) > 0 {
+		req.Secret = util.Cipher(req.Secret)
+	}
+
+	if req.Enabled && len(req.Secret) == 0 {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Webhook secret required.",
+		})
+		return
+	}
+
+	for _, id := range req.JobTemplateIDs {
+		var template ansible.JobTemplate
+		if err := db.JobTemplates().FindId(id).One(&template); err != nil {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Job Template " + id.Hex() + " does not exists.",
+			})
+			return
+		}
+
+		if template.ProjectID != project.ID {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Job Template " + id.Hex() + " does not use the project.",
+			})
+			return
+		}
+
+		if !new(rbac.JobTemplate).Launch(user, template) {
+			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+				Message: "You don't have sufficient permissions to perform this action.",
+			})
+			return
+		}
+	}
+
+	for _, id := range req.TerraformJobTemplateIDs {
+		var template terraform.JobTemplate
+		if err := db.TerrafromJobTemplates().FindId(id).One(&template); err != nil {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Terraform Job Template " + id.Hex() + " does not exists.",
+			})
+			return
+		}
+
+		if template.ProjectID != project.ID {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Terraform Job Template " + id.Hex() + " does not use the project.",
+			})
+			return
+		}
+
+		if !new(rbac.TerraformJobTemplate).Launch(user, template) {
+			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+				Message: "You don't have sufficient permissions to perform this action.",
+			})
+			return
+		}
+	}
+
+	req.UserID = &user.ID
+	project.Webhook = req
+	project.Modified = time.Now()
+
+	if err := db.Projects().UpdateId(project.ID, bson.M{
+		"$set": bson.M{"webhook": req, "modified": project.Modified},
+	}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while updating project webhook",
+			Log:     logrus.Fields{"Project ID": project.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Update, user.ID, tmpProject, project)
+	c.JSON(http.StatusOK, maskWebhook(project.Webhook))
+}
+
+// WebhookDeliveries returns the webhook deliveries of the project, latest first.
+// Payloads are left out of the list
+func (ctrl ProjectController) WebhookDeliveries(c *gin.Context) {
+	project := c.MustGet(cProject).(common.Project)
+
+	parser := util.NewQueryParser(c)
+	match := parser.Match([]string{"provider", "event", "status", "ref", "sha"}, bson.M{})
+	match["project_id"] = project.ID
+	query := db.WebhookDeliveries().Find(match)
+	count, err := query.Count()
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting webhook deliveries",
+			Log:     logrus.Fields{"Project ID": project.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	} else {
+		query.Sort("-created")
+	}
+
+	var deliveries []common.WebhookDelivery
+	if err := query.Select(bson.M{"payload": 0}).Skip(pgi.Skip()).Limit(pgi.Limit()).All(&deliveries); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting webhook deliveries",
+			Log:     logrus.Fields{"Project ID": project.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+	for i := range deliveries {
+		metadata.WebhookDeliveryMetadata(&deliveries[i])
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     deliveries,
+	})
+}
+
+// RedeliverWebhook processes the payload of a recorded delivery again and records a new delivery
+func (ctrl ProjectController) RedeliverWebhook(c *gin.Context) {
+	project := c.MustGet(cProject).(common.Project)
+	user := c.MustGet(cUser).(common.User)
+	objectID := c.Params.ByName(cWebhookDeliveryID)
+
+	if !new(rbac.Project).Update(user, project) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Webhook delivery does not exist"})
+		return
+	}
+
+	var previous common.WebhookDelivery
+	if err := db.WebhookDeliveries().Find(bson.M{
+		"_id":        bson.ObjectIdHex(objectID),
+		"project_id": project.ID,
+	}).One(&previous); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Webhook delivery does not exist",
+			Log: logrus.Fields{
+				"Webhook Delivery ID": objectID,
+				"Error":               err.Error(),
+			},
+		})
+		return
+	}
+
+	if !project.Webhook.Enabled {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Webhook is not enabled for the project",
+		})
+		return
+	}
+
+	delivery := common.WebhookDelivery{
+		ID:             bson.NewObjectId(),
+		ProjectID:      project.ID,
+		Provider:       previous.Provider,
+		Event:          previous.Event,
+		GUID:           previous.GUID,
+		Payload:        previous.Payload,
+		RedeliveryOfID: &previous.ID,
+		CreatedByID:    &user.ID,
+		Created:        time.Now(),
+	}
+
+	deliver(c, project, delivery)
+}
+
+// deliver records a verified delivery and processes it. A push matching the project branch
+// updates the project and launches the webhook job templates, other events are ignored.
+// Deliveries with a GUID which has already been received are rejected
+func deliver(c *gin.Context, project common.Project, delivery common.WebhookDelivery) {
+	delivery.Status = common.WebhookDeliveryPending
+	if err := db.WebhookDeliveries().Insert(delivery); err != nil {
+		if mgo.IsDup(err) {
+			AbortWithError(LogFields{Context: c, Status: http.StatusConflict,
+				Message: "Webhook delivery " + delivery.GUID + " has already been received",
+				Log:     logrus.Fields{"Project ID": project.ID.Hex(), "Provider": delivery.Provider},
+			})
+			return
+		}
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while recording webhook delivery",
+			Log:     logrus.Fields{"Project ID": project.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	push, err := webhook.Parse(delivery.Provider, delivery.Event, []byte(delivery.Payload))
+	switch {
+	case err != nil:
+		delivery.Status = common.WebhookDeliveryFailed
+		delivery.Message = "Invalid webhook payload, " + err.Error()
+	case push == nil:
+		delivery.Status = common.WebhookDeliveryIgnored
+		delivery.Message = "Event " + delivery.Event + " is not a push"
+	default:
+		delivery.Ref = push.Ref
+		delivery.RefType = push.RefType
+		delivery.SHA = push.SHA
+		delivery.Pusher = push.Pusher
+
+		if push.Matches(project.ScmBranch, project.Webhook.Tags) {
+			launchWebhook(c, project, *push, &delivery)
+		} else {
+			delivery.Status = common.WebhookDeliveryIgnored
+			delivery.Message = "Push to " + push.RefType + " " + push.Ref + " does not match the project"
+		}
+	}
+
+	if err := db.WebhookDeliveries().UpdateId(delivery.ID, delivery); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Project ID": project.ID.Hex(),
+			"Error":      err.Error(),
+		}).Errorln("Error while recording webhook delivery")
+	}
+
+	// failed launches have already responded with the error
+	if c.IsAborted() {
+		return
+	}
+
+	metadata.WebhookDeliveryMetadata(&delivery)
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// launchWebhook updates the project and launches the webhook job templates on behalf of the webhook user.
+// Launched jobs wait for the project update. The outcome is recorded in delivery
+func launchWebhook(c *gin.Context, project common.Project, push webhook.Push, delivery *common.WebhookDelivery) {
+	fail := func(message string) {
+		delivery.Status = common.WebhookDeliveryFailed
+		delivery.Message = message
+	}
+
+	update, err := sync.UpdateProject(project)
+	if err != nil {
+		fail("SCM Update failed")
+		AbortWithError(LogFields{Context: c, Status: http.StatusMethodNotAllowed,
+			Message: "SCM Update failed",
+			Log:     logrus.Fields{"Project ID": project.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+	delivery.ProjectUpdateID = &update.Job.ID
+
+	hook := project.Webhook
+	if len(hook.JobTemplateIDs) == 0 && len(hook.TerraformJobTemplateIDs) == 0 {
+		delivery.Status = common.WebhookDeliverySuccessful
+		return
+	}
+
+	var user common.User
+	if hook.UserID == nil || db.Users().FindId(*hook.UserID).One(&user) != nil {
+		fail("Webhook user does not exist")
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Webhook user does not exist",
+		})
+		return
+	}
+
+	vars := gin.H(push.Vars())
+	for _, id := range hook.JobTemplateIDs {
+		var template ansible.JobTemplate
+		if err := db.JobTemplates().FindId(id).One(&template); err != nil {
+			fail("Job Template " + id.Hex() + " does not exists.")
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: delivery.Message,
+			})
+			return
+		}
+
+		if !new(rbac.JobTemplate).Launch(user, template) {
+			fail("Webhook user cannot launch Job Template " + id.Hex())
+			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+				Message: "You don't have sufficient permissions to perform this action.",
+			})
+			return
+		}
+
+		// prompts are answered with the template values
+		req := ansible.Launch{
+			ExtraVars: template.ExtraVars,
+			Limit:     template.Limit,
+			JobTags:   template.JobTags,
+			SkipTags:  template.SkipTags,
+			JobType:   template.JobType,
+
+			InventoryID: template.InventoryID,
+		}
+		if template.MachineCredentialID != nil {
+			req.MachineCredentialID = *template.MachineCredentialID
+		}
+
+		job, ok := launchJobTemplate(c, template, user, req, ansible.JOB_LAUNCH_TYPE_WEBHOOK, vars)
+		if !ok {
+			fail(c.Errors.Last().Error())
+			return
+		}
+		delivery.JobIDs = append(delivery.JobIDs, job.ID)
+	}
+
+	for _, id := range hook.TerraformJobTemplateIDs {
+		var template terraform.JobTemplate
+		if err := db.TerrafromJobTemplates().FindId(id).One(&template); err != nil {
+			fail("Terraform Job Template " + id.Hex() + " does not exists.")
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: delivery.Message,
+			})
+			return
+		}
+
+		if !new(rbac.TerraformJobTemplate).Launch(user, template) {
+			fail("Webhook user cannot launch Terraform Job Template " + id.Hex())
+			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+				Message: "You don't have sufficient permissions to perform this action.",
+			})
+			return
+		}
+
+		req := terraform.Launch{
+			Vars:                template.Vars,
+			JobType:             template.JobType,
+			MachineCredentialID: template.MachineCredentialID,
+		}
+
+		job, ok := launchTerraformJobTemplate(c, template, user, req, terraform.JobLaunchTypeWebhook, vars)
+		if !ok {
+			fail(c.Errors.Last().Error())
+			return
+		}
+		delivery.TerraformJobIDs = append(delivery.TerraformJobIDs, job.ID)
+	}
+
+	delivery.Status = common.WebhookDeliverySuccessful
+}
+
+// maskWebhook hides the webhook secret
+func maskWebhook(hook common.Webhook) common.Webhook {
+	if len(hook.Secret) > 0 {
+		hook.Secret = "$encrypted$"
+	}
+	return hook
+}
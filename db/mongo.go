@@ -6,6 +6,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/pearsonappeng/tensor/util"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 // MongoDb store the name an session to mongodb
@@ -32,6 +33,11 @@ const (
 	CTeams                 = "teams"
 	CUsers                 = "users"
 	CActivityStream        = "activity_stream"
+	CRoles                 = "roles"
+	CCredentialTypes       = "credential_types"
+	CJobEvents             = "job_events"
+	CWebhookDeliveries     = "webhook_deliveries"
+	CRetries               = "retries"
 )
 
 // Connect will create a session to Mongodb database given in the Config file or env
@@ -73,6 +79,7 @@ func Connect() error {
 
 	//Create indexes for each collection
 	createIndexes()
+	createCappedCollections()
 
 	return nil
 }
@@ -106,6 +113,67 @@ func createIndexes() {
 		logrus.Errorln("Failed to create Unique Index for username of ", CUsers, "Collection")
 	}
 
+	// Unique index custom role name
+	if err := MongoDb.C(CRoles).EnsureIndex(mgo.Index{
+		Key:        []string{"name"},
+		Unique:     true,
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Unique Index for name of ", CRoles, "Collection")
+	}
+
+	// Unique index credential type name
+	if err := MongoDb.C(CCredentialTypes).EnsureIndex(mgo.Index{
+		Key:        []string{"name"},
+		Unique:     true,
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Unique Index for name of ", CCredentialTypes, "Collection")
+	}
+
+	// Unique index of webhook deliveries received with a GUID
+	if err := MongoDb.C(CWebhookDeliveries).EnsureIndex(mgo.Index{
+		Key:        []string{"received_guid"},
+		Unique:     true,
+		Sparse:     true,
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Unique Index for received_guid of ", CWebhookDeliveries, "Collection")
+	}
+
+	// Index of retries by the time they are due
+	if err := MongoDb.C(CRetries).EnsureIndex(mgo.Index{
+		Key:        []string{"due"},
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Index for due of ", CRetries, "Collection")
+	}
+}
+
+// createCappedCollections creates fixed size collections which are read by tailable cursors.
+// A tailable cursor on an empty collection is dead immediately, the first document keeps it alive
+func createCappedCollections() {
+	names, err := MongoDb.CollectionNames()
+	if err != nil {
+		logrus.Errorln("Failed to get collection names", err)
+		return
+	}
+	for _, name := range names {
+		if name == CJobEvents {
+			return
+		}
+	}
+
+	if err := MongoDb.C(CJobEvents).Create(&mgo.CollectionInfo{
+		Capped:   true,
+		MaxBytes: 1024 * 1024,
+	}); err != nil {
+		logrus.Errorln("Failed to create capped collection", CJobEvents, err)
+		return
+	}
+	if err := MongoDb.C(CJobEvents).Insert(bson.M{"_id": bson.NewObjectId()}); err != nil {
+		logrus.Errorln("Failed to initialize capped collection", CJobEvents, err)
+	}
 }
 
 // Organizations returns a mgo.Collection for organizations
@@ -172,3 +240,28 @@ func Projects() *mgo.Collection {
 func ActivityStream() *mgo.Collection {
 	return MongoDb.C(CActivityStream)
 }
+
+// Roles returns mgo.Collection for custom roles
+func Roles() *mgo.Collection {
+	return MongoDb.C(CRoles)
+}
+
+// CredentialTypes returns mgo.Collection for user defined credential types
+func CredentialTypes() *mgo.Collection {
+	return MongoDb.C(CCredentialTypes)
+}
+
+// JobEvents returns mgo.Collection for job_events, a capped collection notifying about finished jobs
+func JobEvents() *mgo.Collection {
+	return MongoDb.C(CJobEvents)
+}
+
+// WebhookDeliveries returns mgo.Collection for webhook_deliveries
+func WebhookDeliveries() *mgo.Collection {
+	return MongoDb.C(CWebhookDeliveries)
+}
+
+// Retries returns mgo.Collection for retries, jobs waiting for the backoff of their retry policy
+func Retries() *mgo.Collection {
+	return MongoDb.C(CRetries)
+}
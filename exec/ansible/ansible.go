@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"strconv"
@@ -14,15 +15,17 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gamunu/rmq"
-	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/isolation"
 	"github.com/pearsonappeng/tensor/exec/misc"
 	"github.com/pearsonappeng/tensor/exec/sync"
 	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/log/redact"
 	"github.com/pearsonappeng/tensor/models/ansible"
 	"github.com/pearsonappeng/tensor/models/common"
 
 	"github.com/adjust/uniuri"
 	"github.com/pearsonappeng/tensor/queue"
+	"github.com/pearsonappeng/tensor/secrets"
 	"github.com/pearsonappeng/tensor/ssh"
 	"github.com/pearsonappeng/tensor/util"
 	"path/filepath"
@@ -74,6 +77,7 @@ func (consumer *Consumer) Consume(delivery rmq.Delivery) {
 			Job:           jb.Job,
 			JobTemplateID: jb.Template.ID,
 			ProjectID:     jb.Project.ID,
+			Project:       jb.Project,
 			SCM:           jb.SCM,
 			Token:         jb.Token,
 			User:          jb.User,
@@ -107,32 +111,22 @@ func ansibleRun(j *types.AnsibleJob) {
 			"Name":   j.Job.Name,
 		}).Infoln("Job changed status to waiting")
 
-		ticker := time.NewTicker(time.Second * 2)
-
-		for range ticker.C {
-			if err := db.Jobs().FindId(j.PreviousJob.Job.ID).One(&j.PreviousJob.Job); err != nil {
-				logrus.Warningln("Could not find Previous Job", err)
-				continue
-			}
-
-			if j.PreviousJob.Job.Status == "failed" || j.PreviousJob.Job.Status == "error" {
-				e := "Previous Task Failed: {\"job_type\": \"project_update\", \"job_name\": \"" + j.Job.Name + "\", \"job_id\": \"" + j.PreviousJob.Job.ID.Hex() + "\"}"
-				logrus.Errorln(e)
-				j.Job.JobExplanation = e
-				j.Job.ResultStdout = "stdout capture is missing"
-				jobError(j)
-				return
-			}
-			if j.PreviousJob.Job.Status == "successful" {
-				// stop the ticker and break the loop
-				logrus.WithFields(logrus.Fields{
-					"Job ID": j.PreviousJob.Job.ID.Hex(),
-					"Name":   j.PreviousJob.Job.Name,
-				}).Infoln("Update job successful")
-				ticker.Stop()
-				break
-			}
+		// resumes as soon as the update job finishes
+		update, err := sync.Wait(j.PreviousJob.Job.ID)
+		if err != nil || update.Status != "successful" {
+			e := "Previous Task Failed: {\"job_type\": \"project_update\", \"job_name\": \"" + j.Job.Name + "\", \"job_id\": \"" + j.PreviousJob.Job.ID.Hex() + "\"}"
+			logrus.Errorln(e)
+			j.Job.JobExplanation = e
+			j.Job.ResultStdout = "stdout capture is missing"
+			jobError(j)
+			return
 		}
+		j.PreviousJob.Job = update
+
+		logrus.WithFields(logrus.Fields{
+			"Job ID": update.ID.Hex(),
+			"Name":   update.Name,
+		}).Infoln("Update job successful")
 	}
 
 	start(j)
@@ -142,91 +136,71 @@ func ansibleRun(j *types.AnsibleJob) {
 		"Name":   j.Job.Name,
 	}).Infoln("Job started")
 
-	// Start SSH agent
-	client, socket, pid, sshcleanup := ssh.StartAgent()
-
-	if len(j.Machine.SSHKeyData) > 0 {
-		if len(j.Machine.SSHKeyUnlock) > 0 {
-			key, err := ssh.GetKey(util.Decipher(j.Machine.SSHKeyData), util.Decipher(j.Machine.SSHKeyUnlock))
-			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"Error": err.Error(),
-				}).Errorln("Error while decyrpting Machine Credential")
-				j.Job.JobExplanation = err.Error()
-				jobFail(j)
-				return
-			}
-			if client.Add(key); err != nil {
-				logrus.WithFields(logrus.Fields{
-					"Error": err.Error(),
-				}).Errorln("Error while adding decyrpted Machine Credential to SSH Agent")
-				j.Job.JobExplanation = err.Error()
-				jobFail(j)
-				return
-			}
+	// retries are queued as the job was received, credential lookups are resolved by every attempt
+	queued := *j
+	queued.Vaults = append([]common.Credential{}, j.Vaults...)
+	queued.Extras = append([]common.Credential{}, j.Extras...)
+	failure := misc.FailureError
+	defer func() {
+		if j.Job.Failed {
+			retry(queued, failure)
 		}
+	}()
 
-		key, err := ssh.GetKey(util.Decipher(j.Machine.SSHKeyData), nil)
-		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"Error": err.Error(),
-			}).Errorln("Error while decyrpting Machine Credential")
-			j.Job.JobExplanation = err.Error()
-			jobFail(j)
-			return
-		}
+	// the timeout of the template takes precedence over the ansible job timeout
+	timeout := time.Duration(util.Config.AnsibleJobTimeOut) * time.Second
+	if j.Job.Timeout > 0 {
+		timeout = time.Duration(j.Job.Timeout) * time.Second
+	}
 
-		if client.Add(key); err != nil {
-			logrus.WithFields(logrus.Fields{
-				"Error": err.Error(),
-			}).Errorln("Error while adding decyrpted Machine Credential to SSH Agent")
-			j.Job.JobExplanation = err.Error()
-			jobFail(j)
-			return
-		}
+	// resolve credential fields kept in external secret stores
+	credentials := []*common.Credential{&j.Machine, &j.Network, &j.Cloud}
+	for i := range j.Vaults {
+		credentials = append(credentials, &j.Vaults[i])
+	}
+	for i := range j.Extras {
+		credentials = append(credentials, &j.Extras[i])
+	}
+	if err := secrets.Resolve(credentials...); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Error while resolving credential lookups")
+		j.Job.JobExplanation = err.Error()
+		jobFail(j)
+		return
+	}
 
+	// decrypted secrets of the job are masked in its output, arguments, environment and server logs
+	j.Redactor = redact.New()
+	defer j.Redactor.Close()
+	for _, credential := range credentials {
+		j.Redactor.AddCredential(*credential)
+	}
+	j.Redactor.Add(j.Token)
+	for _, password := range j.SurveyPasswords {
+		j.Redactor.Add(string(util.Decipher(password)))
 	}
 
-	if len(j.Network.SSHKeyData) > 0 {
-		if len(j.Network.SSHKeyUnlock) > 0 {
-			key, err := ssh.GetKey(util.Decipher(j.Machine.SSHKeyData), util.Decipher(j.Network.SSHKeyUnlock))
-			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"Error": err.Error(),
-				}).Errorln("Error while decyrpting Machine Credential")
-				j.Job.JobExplanation = err.Error()
-				jobFail(j)
-				return
-			}
-			if client.Add(key); err != nil {
-				logrus.WithFields(logrus.Fields{
-					"Error": err.Error(),
-				}).Errorln("Error while adding decyrpted Machine Credential to SSH Agent")
-				j.Job.JobExplanation = err.Error()
-				jobFail(j)
-				return
-			}
-		}
+	// Start SSH agent
+	client, socket, pid, sshcleanup := ssh.StartAgent()
 
-		key, err := ssh.GetKey(util.Decipher(j.Machine.SSHKeyData), nil)
-		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"Error": err.Error(),
-			}).Errorln("Error while decyrpting Machine Credential")
-			j.Job.JobExplanation = err.Error()
-			jobFail(j)
-			return
+	// machine and network keys are added to the agent separately
+	for _, credential := range []common.Credential{j.Machine, j.Network} {
+		if len(credential.SSHKeyData) == 0 {
+			continue
 		}
-
-		if client.Add(key); err != nil {
+		// certificates are identified by the job and expire with the job timeout
+		keyID := "tensor-job-" + j.Job.ID.Hex() + "-" + j.User.Username
+		if err := misc.AddAgentKey(client, credential, keyID, timeout); err != nil {
 			logrus.WithFields(logrus.Fields{
-				"Error": err.Error(),
-			}).Errorln("Error while adding decyrpted Machine Credential to SSH Agent")
+				"Credential ID": credential.ID.Hex(),
+				"Error":         err.Error(),
+			}).Errorln("Error while adding decrypted " + credential.Name + " credential to SSH Agent")
 			j.Job.JobExplanation = err.Error()
 			jobFail(j)
+			sshcleanup()
 			return
 		}
-
 	}
 
 	cmd, cleanup, err := getCmd(j, socket, pid)
@@ -251,41 +225,42 @@ func ansibleRun(j *types.AnsibleJob) {
 		cleanup()
 	}()
 
+	// output resets the idle timeout
 	var b bytes.Buffer
-	cmd.Stdout = &b
-	cmd.Stderr = &b
+	stdout := j.Redactor.Writer(&b)
+	watchdog := misc.NewWatchdog(timeout, time.Duration(j.Job.IdleTimeout)*time.Second)
+	output := io.MultiWriter(stdout, watchdog)
+	cmd.Stdout = output
+	cmd.Stderr = output
 
 	// Set setsid to create a new session, The new process group has no controlling
 	// terminal which disables the stdin & will skip prompts
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 
-	if err := cmd.Start(); err != nil {
+	err = watchdog.Run(cmd)
+	stdout.Flush()
+	if expired := watchdog.Stop(); len(expired) > 0 {
 		logrus.WithFields(logrus.Fields{
-			"Error": err.Error(),
-		}).Errorln("Running ansible job failed")
-		j.Job.JobExplanation = err.Error()
+			"Job ID": j.Job.ID.Hex(),
+			"Reason": expired,
+		}).Errorln("Killed the process, execution exceeded threshold value")
+		j.Job.JobExplanation = expired
 		j.Job.ResultStdout = string(b.Bytes())
-		jobFail(j)
+		failure = misc.FailureTimeout
+		jobTimeout(j)
 		return
 	}
-
-	var timer *time.Timer
-	timer = time.AfterFunc(time.Duration(util.Config.AnsibleJobTimeOut) * time.Second, func() {
-		logrus.Println("Killing the process. Execution exceeded threashold value")
-		cmd.Process.Kill()
-	})
-
-	if err := cmd.Wait(); err != nil {
+	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
 		}).Errorln("Running playbook failed")
 		j.Job.JobExplanation = err.Error()
 		j.Job.ResultStdout = string(b.Bytes())
+		failure = failureReason(err)
 		jobFail(j)
 		return
 	}
 
-	timer.Stop()
 	// set stdout
 	j.Job.ResultStdout = string(b.Bytes())
 	//success
@@ -294,6 +269,11 @@ func ansibleRun(j *types.AnsibleJob) {
 
 // runPlaybook runs a Job using ansible-playbook command
 func getCmd(j *types.AnsibleJob, socket string, pid int) (cmd *exec.Cmd, cleanup func(), err error) {
+	// binaries of the selected toolchain come first on the PATH
+	toolchainPath, err := util.ToolchainPath(j.Job.Toolchain, "ansible")
+	if err != nil {
+		return nil, nil, err
+	}
 	// Generate directory paths and create directories
 	tmp := "/tmp/tensor_proot_" + uniuri.New() + "/"
 	j.Paths = types.JobPaths{
@@ -314,8 +294,46 @@ func getCmd(j *types.AnsibleJob, socket string, pid int) (cmd *exec.Cmd, cleanup
 		"ansible-playbook", "-i", "/var/lib/tensor/plugins/inventory/tensorrest.py",
 	}
 	pPlaybook = buildParams(*j, pPlaybook)
+	// vault password files, paths are safe to show in job arguments
+	vaultArgs, err := vaultParams(j)
+	if err != nil {
+		return nil, nil, err
+	}
+	pPlaybook = append(pPlaybook, vaultArgs...)
+	// network credential is passed to network modules by environment variables
+	netEnv, err := networkEnv(j)
+	if err != nil {
+		return nil, nil, err
+	}
 	// parameters that are hidden from output
 	pSecure := []string{}
+	// cloud credentials add environment variables, files and extra variables
+	injection, err := misc.InjectCloudCredentials(append([]common.Credential{j.Cloud}, j.Extras...),
+		j.Paths.CredentialPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(injection.ExtraVars) > 0 {
+		vars, err := json.Marshal(injection.ExtraVars)
+		if err != nil {
+			misc.RemoveFiles(injection.Files)
+			return nil, nil, err
+		}
+		pSecure = append(pSecure, "-e", string(vars))
+	}
+	// answers to password questions of the survey replace the masked extra variables
+	if len(j.SurveyPasswords) > 0 {
+		passwords := map[string]string{}
+		for name, password := range j.SurveyPasswords {
+			passwords[name] = string(util.Decipher(password))
+		}
+		vars, err := json.Marshal(passwords)
+		if err != nil {
+			misc.RemoveFiles(injection.Files)
+			return nil, nil, err
+		}
+		pSecure = append(pSecure, "-e", string(vars))
+	}
 	// check whether the username not empty
 	if len(j.Machine.Username) > 0 {
 		uname := j.Machine.Username
@@ -348,30 +366,20 @@ func getCmd(j *types.AnsibleJob, socket string, pid int) (cmd *exec.Cmd, cleanup
 			pSecure = append(pSecure, "-e", "'ansible_become_pass=" + string(util.Decipher(j.Machine.BecomePassword)) + "'")
 		}
 	}
-	// add proot and ansible parameters
-	pargs := []string{"-v", "0", "-r", "/",
-		"-b", j.Paths.Etc + ":/etc/tensor",
-		"-b", j.Paths.Tmp + ":/tmp",
-		"-b", j.Paths.VarLib + ":/var/lib/tensor",
-		"-b", j.Paths.VarLibJobStatus + ":/var/lib/tensor/job_status",
-		"-b", j.Paths.VarLibProjects + ":" + util.Config.ProjectsHome,
-		"-b", j.Paths.VarLog + ":/var/log",
-		"-b", j.Paths.TmpRand + ":" + j.Paths.TmpRand,
-		"-b", filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()) + ":" + filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
-		"-b", "/var/lib/tensor:/var/lib/tensor",
-		"-w", filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
-	}
-	pargs = append(pargs, pPlaybook...)
-	j.Job.JobARGS = pargs
-	// should not included in any output
-	pargs = append(pargs, pSecure...)
-	// set job arguments, exclude unencrypted passwords etc.
-	j.Job.JobARGS = []string{strings.Join(j.Job.JobARGS, " ") + " " + j.Job.Playbook + "'"}
-	pargs = append(pargs, j.Job.Playbook)
-	logrus.Infoln("Job Arguments", append([]string{}, j.Job.JobARGS...))
-	cmd = exec.Command("proot", pargs...)
-	cmd.Dir = filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex())
-	cmd.Env = []string{
+	// roles and collections installed by the project update
+	galaxyEnv := sync.GalaxyEnv(j.Project)
+	// directories visible to the job
+	spec := isolation.Spec{
+		Name:    j.Job.ID.Hex(),
+		Binds:   misc.JobBinds(j.Paths, socket),
+		WorkDir: j.Paths.ProjectRoot,
+		Image:   misc.ExecutionImage(j.Job.ExecutionImage),
+	}
+	spec.Binds = append(spec.Binds, isolation.Bind{Source: j.Paths.VarLibJobStatus, Target: "/var/lib/tensor/job_status"})
+	if len(galaxyEnv) > 0 {
+		spec.Binds = append(spec.Binds, isolation.Bind{Source: sync.GalaxyDir(j.Project), Target: sync.GalaxyDir(j.Project), ReadOnly: true})
+	}
+	spec.Env = []string{
 		"TERM=xterm",
 		"PROJECT_PATH=" + filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
 		"HOME_PATH=" + util.Config.ProjectsHome,
@@ -380,7 +388,7 @@ func getCmd(j *types.AnsibleJob, socket string, pid int) (cmd *exec.Cmd, cleanup
 		"HOME=" + os.Getenv("HOME"),
 		"_=/usr/bin/tensord",
 		"PROOT_NO_SECCOMP=1",
-		"PATH=/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"PATH=" + toolchainPath,
 		"REST_API_TOKEN=" + j.Token,
 		"ANSIBLE_PARAMIKO_RECORD_HOST_KEYS=False",
 		"ANSIBLE_CALLBACK_PLUGINS=/var/lib/tensor/plugins/callback",
@@ -404,7 +412,7 @@ func getCmd(j *types.AnsibleJob, socket string, pid int) (cmd *exec.Cmd, cleanup
 		"HOME=" + os.Getenv("HOME"),
 		"_=/usr/bin/tensord",
 		"PROOT_NO_SECCOMP=1",
-		"PATH=/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"PATH=" + toolchainPath,
 		"REST_API_TOKEN=" + strings.Repeat("*", len(j.Token)),
 		"ANSIBLE_PARAMIKO_RECORD_HOST_KEYS=False",
 		"ANSIBLE_CALLBACK_PLUGINS=/var/lib/tensor/plugins/callback",
@@ -417,22 +425,39 @@ func getCmd(j *types.AnsibleJob, socket string, pid int) (cmd *exec.Cmd, cleanup
 		"SSH_AUTH_SOCK=" + socket,
 		"SSH_AGENT_PID=" + strconv.Itoa(pid),
 	}
-	var f *os.File
-	if j.Cloud.Cloud {
-		cmd.Env, f, err = misc.GetCloudCredential(cmd.Env, j.Cloud)
-		if err != nil {
-			return nil, nil, err
-		}
+	spec.Env = append(spec.Env, galaxyEnv...)
+	j.Job.JobENV = append(j.Job.JobENV, galaxyEnv...)
+	spec.Env = append(spec.Env, netEnv...)
+	spec.Env = append(spec.Env, injection.Env...)
+
+	backend, err := misc.IsolationBackend()
+	if err != nil {
+		misc.RemoveFiles(injection.Files)
+		return nil, nil, err
+	}
+	// set job arguments, exclude unencrypted passwords etc.
+	record, err := backend.Command(spec, pPlaybook...)
+	if err != nil {
+		misc.RemoveFiles(injection.Files)
+		return nil, nil, err
+	}
+	j.Job.JobARGS = j.Redactor.Strings([]string{strings.Join(record.Args, " ") + " " + j.Job.Playbook + "'"})
+	logrus.Infoln("Job Arguments", append([]string{}, j.Job.JobARGS...))
+	// secure parameters should not included in any output
+	pPlaybook = append(append(pPlaybook, pSecure...), j.Job.Playbook)
+	cmd, err = backend.Command(spec, pPlaybook...)
+	if err != nil {
+		misc.RemoveFiles(injection.Files)
+		return nil, nil, err
 	}
 	logrus.WithFields(logrus.Fields{
-		"Dir":         cmd.Dir,
-		"Environment": append([]string{}, cmd.Env...),
+		"Dir":         spec.WorkDir,
+		"Environment": j.Redactor.Strings(spec.Env),
 	}).Infoln("Job Directory and Environment")
 	return cmd, func() {
-		if f != nil {
-			if err := os.RemoveAll(f.Name()); err != nil {
-				logrus.Errorln("Unable to remove cloud credential")
-			}
+		misc.RemoveFiles(injection.Files)
+		if err := backend.Remove(spec); err != nil {
+			logrus.Errorln("Unable to remove job containers")
 		}
 
 		if err := os.RemoveAll(tmp); err != nil {
@@ -484,14 +509,15 @@ func buildParams(j types.AnsibleJob, params []string) []string {
 		params = append(params, "-vvvv")
 	}
 	// extra variables -e EXTRA_VARS, --extra-vars=EXTRA_VARS
+	// variables are passed as written in a file, ansible reads YAML and JSON
 	if len(j.Job.ExtraVars) > 0 {
-		vars, err := json.Marshal(j.Job.ExtraVars)
-		if err != nil {
+		path := filepath.Join(j.Paths.TmpRand, uniuri.NewLen(5)+".yml")
+		if err := ioutil.WriteFile(path, []byte(j.Job.ExtraVars), 0600); err != nil {
 			logrus.WithFields(logrus.Fields{
 				"Error": err,
-			}).Errorln("Could not marshal extra vars")
+			}).Errorln("Could not write extra vars to a variable file")
 		}
-		params = append(params, "-e", string(vars))
+		params = append(params, "-e", "@"+path)
 	}
 	// -t, TAGS, --tags=TAGS
 	if len(j.Job.JobTags) > 0 {
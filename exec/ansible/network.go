@@ -0,0 +1,46 @@
+package ansible
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/adjust/uniuri"
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// networkEnv returns environment variables read by ansible network modules for the job
+// network credential. An unencrypted ssh key is written to a file in the credential path,
+// encrypted keys are available through the ssh agent only.
+// The file is removed along with the credential path when the job finishes
+func networkEnv(j *types.AnsibleJob) ([]string, error) {
+	network := j.Network
+	if len(network.Kind) == 0 {
+		return nil, nil
+	}
+
+	env := []string{"ANSIBLE_NET_USERNAME=" + network.Username}
+
+	if len(network.Password) > 0 {
+		env = append(env, "ANSIBLE_NET_PASSWORD="+string(util.Decipher(network.Password)))
+	}
+
+	if len(network.SSHKeyData) > 0 && len(network.SSHKeyUnlock) == 0 {
+		file := filepath.Join(j.Paths.CredentialPath, "network_"+uniuri.New())
+		if err := ioutil.WriteFile(file, util.Decipher(network.SSHKeyData), 0600); err != nil {
+			return nil, err
+		}
+		env = append(env, "ANSIBLE_NET_SSH_KEYFILE="+file)
+	}
+
+	if network.Authorize {
+		env = append(env, "ANSIBLE_NET_AUTHORIZE=1")
+		if len(network.AuthorizePassword) > 0 {
+			env = append(env, "ANSIBLE_NET_AUTH_PASS="+string(util.Decipher(network.AuthorizePassword)))
+		}
+	} else {
+		env = append(env, "ANSIBLE_NET_AUTHORIZE=0")
+	}
+
+	return env, nil
+}
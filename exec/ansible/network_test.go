@@ -0,0 +1,93 @@
+package ansible
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func networkJob() *types.AnsibleJob {
+	return &types.AnsibleJob{
+		Job: ansible.Job{
+			ID:       bson.NewObjectId(),
+			Playbook: "site.yml",
+		},
+		Project: common.Project{ID: bson.NewObjectId()},
+		Network: common.Credential{
+			Kind:              common.CredentialKindNET,
+			Username:          "admin",
+			Password:          util.Cipher("secret"),
+			SSHKeyData:        util.Cipher("key"),
+			Authorize:         true,
+			AuthorizePassword: util.Cipher("enable"),
+		},
+	}
+}
+
+func TestNetworkEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "tensor_network")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	j := networkJob()
+	j.Paths.CredentialPath = dir
+
+	env, err := networkEnv(j)
+	assert.NoError(err)
+	assert.Len(env, 5)
+	assert.Equal("ANSIBLE_NET_USERNAME=admin", env[0])
+	assert.Equal("ANSIBLE_NET_PASSWORD=secret", env[1])
+	assert.Equal("ANSIBLE_NET_AUTHORIZE=1", env[3])
+	assert.Equal("ANSIBLE_NET_AUTH_PASS=enable", env[4])
+
+	keyfile := strings.TrimPrefix(env[2], "ANSIBLE_NET_SSH_KEYFILE=")
+	content, _ := ioutil.ReadFile(keyfile)
+	assert.Equal("key", string(content), "Network key file has invalid content")
+
+	info, _ := os.Stat(keyfile)
+	assert.Equal(os.FileMode(0600), info.Mode(), "Network key file has incorrect permissions")
+
+	// encrypted keys are not written, enable mode is off
+	j.Network.SSHKeyUnlock = util.Cipher("unlock")
+	j.Network.Authorize = false
+	env, err = networkEnv(j)
+	assert.NoError(err)
+	assert.Equal([]string{"ANSIBLE_NET_USERNAME=admin", "ANSIBLE_NET_PASSWORD=secret",
+		"ANSIBLE_NET_AUTHORIZE=0"}, env)
+
+	// jobs without a network credential
+	env, err = networkEnv(&types.AnsibleJob{})
+	assert.NoError(err)
+	assert.Empty(env)
+}
+
+func TestGetCmdNetwork(t *testing.T) {
+	assert := assert.New(t)
+
+	j := networkJob()
+	cmd, cleanup, err := getCmd(j, "/tmp/agent.sock", 1)
+	assert.NoError(err)
+	defer cleanup()
+
+	assert.Contains(cmd.Env, "ANSIBLE_NET_USERNAME=admin")
+	assert.Contains(cmd.Env, "ANSIBLE_NET_PASSWORD=secret")
+	assert.Contains(cmd.Env, "ANSIBLE_NET_AUTHORIZE=1")
+	assert.Contains(cmd.Env, "ANSIBLE_NET_AUTH_PASS=enable")
+	assert.Contains(cmd.Env, "SSH_AUTH_SOCK=/tmp/agent.sock")
+
+	// secrets must not be exposed in job arguments or environment
+	for _, v := range append(j.Job.JobARGS, j.Job.JobENV...) {
+		assert.NotContains(v, "secret")
+		assert.NotContains(v, "enable")
+	}
+}
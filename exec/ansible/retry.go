@@ -0,0 +1,100 @@
+package ansible
+
+import (
+	"encoding/json"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/misc"
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/queue"
+)
+
+// failureReason classifies an error of ansible-playbook, which exits
+// with 2 when hosts failed and with 4 when hosts were unreachable
+func failureReason(err error) string {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			switch status.ExitStatus() {
+			case 2:
+				return misc.FailureFailed
+			case 4:
+				return misc.FailureUnreachable
+			}
+		}
+	}
+	return misc.FailureError
+}
+
+// retry relaunches job j, which failed for reason, when the retry policy of its template allows it.
+// The new job is created right away, its runner job is scheduled to be queued once the backoff elapsed
+func retry(j types.AnsibleJob, reason string) {
+	if !misc.Retry(j.Job.RetryCount, j.Job.RetryAttempt, j.Job.RetryOn, reason) {
+		return
+	}
+
+	job := j.Job
+	job.ID = bson.NewObjectId()
+	job.Status = "pending"
+	job.Failed = false
+	job.Started = time.Time{}
+	job.Finished = time.Time{}
+	job.Elapsed = 0
+	job.ResultStdout = ""
+	job.JobExplanation = ""
+	job.JobCWD = ""
+	job.JobARGS = nil
+	job.JobENV = nil
+	job.Created = time.Now()
+	job.Modified = time.Now()
+	job.RetryAttempt++
+	if job.RetryOfID == nil {
+		first := j.Job.ID
+		job.RetryOfID = &first
+	}
+
+	// the project was updated for the failed job, the token is issued once the backoff elapsed
+	j.Job = job
+	j.PreviousJob = nil
+	j.Paths = types.JobPaths{}
+	j.Token = ""
+
+	jobBytes, err := json.Marshal(j)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Job ID": job.RetryOfID.Hex(),
+			"Error":  err.Error(),
+		}).Errorln("Unable to marshal Job, job will not be retried")
+		return
+	}
+
+	if err := db.Jobs().Insert(job); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Job ID": job.RetryOfID.Hex(),
+			"Error":  err.Error(),
+		}).Errorln("Error while creating retry Job")
+		return
+	}
+
+	delay := misc.RetryDelay(job.RetryBackoff, job.RetryAttempt-1)
+	if err := misc.ScheduleRetry(job.ID, queue.AnsibleQueue, delay, jobBytes); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Job ID": job.ID.Hex(),
+			"Error":  err.Error(),
+		}).Errorln("Error while scheduling retry Job")
+		j.Job.JobExplanation = "Unable to schedule the retry: " + err.Error()
+		jobError(&j)
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"Job ID":  job.ID.Hex(),
+		"Attempt": job.RetryAttempt,
+		"Delay":   delay.String(),
+	}).Infoln("Job failed, retrying")
+}
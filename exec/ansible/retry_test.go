@@ -0,0 +1,24 @@
+package ansible
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/pearsonappeng/tensor/exec/misc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureReason(t *testing.T) {
+	assert := assert.New(t)
+
+	exit := func(code string) error {
+		return exec.Command("sh", "-c", "exit "+code).Run()
+	}
+
+	assert.Equal(misc.FailureFailed, failureReason(exit("2")))
+	assert.Equal(misc.FailureUnreachable, failureReason(exit("4")))
+	assert.Equal(misc.FailureError, failureReason(exit("1")))
+	assert.Equal(misc.FailureError, failureReason(exit("250")))
+	assert.Equal(misc.FailureError, failureReason(errors.New("fork/exec proot: no such file or directory")))
+}
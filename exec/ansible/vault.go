@@ -0,0 +1,38 @@
+package ansible
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/adjust/uniuri"
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// vaultParams writes vault passwords of the job credentials to files in the
+// credential path and returns ansible-playbook parameters referencing them.
+// The files are removed along with the credential path when the job finishes
+func vaultParams(j *types.AnsibleJob) ([]string, error) {
+	var params []string
+
+	credentials := append([]common.Credential{j.Machine}, j.Vaults...)
+	for _, credential := range credentials {
+		if len(credential.VaultPassword) == 0 {
+			continue
+		}
+
+		file := filepath.Join(j.Paths.CredentialPath, "vault_"+uniuri.New())
+		if err := ioutil.WriteFile(file, util.Decipher(credential.VaultPassword), 0600); err != nil {
+			return nil, err
+		}
+
+		if len(credential.VaultID) > 0 {
+			params = append(params, "--vault-id", credential.VaultID+"@"+file)
+			continue
+		}
+		params = append(params, "--vault-password-file", file)
+	}
+
+	return params, nil
+}
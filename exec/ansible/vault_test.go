@@ -0,0 +1,63 @@
+package ansible
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVaultParams(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "tensor_vault")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	j := &types.AnsibleJob{
+		Machine: common.Credential{VaultPassword: util.Cipher("machine")},
+		Vaults: []common.Credential{
+			{VaultPassword: util.Cipher("dev"), VaultID: "dev"},
+			{VaultPassword: util.Cipher("prod"), VaultID: "prod"},
+			// credentials without a vault password are skipped
+			{VaultID: "empty"},
+		},
+	}
+	j.Paths.CredentialPath = dir
+
+	params, err := vaultParams(j)
+	assert.NoError(err)
+	assert.Len(params, 6)
+
+	expected := []struct{ flag, id, password string }{
+		{"--vault-password-file", "", "machine"},
+		{"--vault-id", "dev", "dev"},
+		{"--vault-id", "prod", "prod"},
+	}
+	for i, e := range expected {
+		assert.Equal(e.flag, params[i*2])
+		file := params[i*2+1]
+		if len(e.id) > 0 {
+			assert.True(strings.HasPrefix(file, e.id+"@"), file)
+			file = strings.TrimPrefix(file, e.id+"@")
+		}
+		assert.True(strings.HasPrefix(file, dir+"/vault_"), file)
+
+		info, err := os.Stat(file)
+		assert.NoError(err)
+		assert.Equal(os.FileMode(0600), info.Mode().Perm())
+		content, err := ioutil.ReadFile(file)
+		assert.NoError(err)
+		assert.Equal(e.password, string(content))
+	}
+
+	// jobs without vault passwords have no parameters
+	params, err = vaultParams(&types.AnsibleJob{})
+	assert.NoError(err)
+	assert.Empty(params)
+}
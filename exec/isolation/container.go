@@ -0,0 +1,70 @@
+package isolation
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// jobLabel labels containers with the name of the job which started them
+const jobLabel = "tensor.job"
+
+// container runs commands in a container of the execution image with a docker compatible runtime
+type container struct {
+	runtime string
+}
+
+func (c container) Command(s Spec, args ...string) (*exec.Cmd, error) {
+	if len(s.Image) == 0 {
+		return nil, errors.New("Execution image required to run jobs in containers")
+	}
+
+	// files written to binds are owned by the user running tensord
+	cargs := []string{"run", "--rm", "--network", "host",
+		"--user", strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid()),
+		"--label", jobLabel + "=" + s.Name,
+		"--workdir", s.WorkDir,
+	}
+	for _, b := range s.Binds {
+		volume := b.Source + ":" + b.Target
+		if b.ReadOnly {
+			volume += ":ro"
+		}
+		cargs = append(cargs, "--volume", volume)
+	}
+	// values are read from the environment of the runtime, they do not show up in process lists
+	for _, e := range s.Env {
+		cargs = append(cargs, "--env", strings.SplitN(e, "=", 2)[0])
+	}
+	cargs = append(cargs, s.Image)
+
+	cmd := exec.Command(c.runtime, append(cargs, args...)...)
+	cmd.Env = append(runtimeEnv(), s.Env...)
+	return cmd, nil
+}
+
+// Remove removes containers which outlived their job, killing the runtime client does not stop them
+func (c container) Remove(s Spec) error {
+	out, err := exec.Command(c.runtime, "ps", "--all", "--quiet", "--filter", "label="+jobLabel+"="+s.Name).Output()
+	if err != nil {
+		return err
+	}
+	ids := strings.Fields(string(out))
+	if len(ids) == 0 {
+		return nil
+	}
+	return exec.Command(c.runtime, append([]string{"rm", "--force"}, ids...)...).Run()
+}
+
+// runtimeEnv returns variables of tensord which configure the container runtime
+func runtimeEnv() []string {
+	var env []string
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "DOCKER_") || strings.HasPrefix(e, "CONTAINER_") || strings.HasPrefix(e, "XDG_RUNTIME_DIR=") {
+			env = append(env, e)
+		}
+	}
+	return env
+}
@@ -0,0 +1,118 @@
+// Package isolation runs job commands in an environment isolated from the host.
+// Backends are selected by name, proot is the default
+package isolation
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Bind makes host path Source available as Target inside the isolated environment
+type Bind struct {
+	Source string
+	Target string
+	// ReadOnly binds are not writable by jobs when the backend supports it
+	ReadOnly bool
+}
+
+// Spec describes the isolated environment of job commands
+type Spec struct {
+	// Name identifies the job, containers are labelled with it
+	Name string
+	// Binds are applied in order, later binds take precedence
+	Binds []Bind
+	// WorkDir is the working directory of commands
+	WorkDir string
+	// Env is the complete environment of commands
+	Env []string
+	// Image is the execution image of container backends
+	Image string
+}
+
+// Backend isolates job commands from the host
+type Backend interface {
+	// Command returns the command which runs args inside the environment described by s
+	Command(s Spec, args ...string) (*exec.Cmd, error)
+	// Remove releases everything commands of s left behind, e.g. containers of a killed job
+	Remove(s Spec) error
+}
+
+// New returns the backend name, one of proot, bubblewrap, container and none.
+// Containers are run by runtime, a docker compatible command
+func New(name string, runtime string) (Backend, error) {
+	switch name {
+	case "", "proot":
+		return proot{}, nil
+	case "bubblewrap":
+		return bubblewrap{}, nil
+	case "container":
+		if len(runtime) == 0 {
+			runtime = "docker"
+		}
+		return container{runtime: runtime}, nil
+	case "none":
+		return none{}, nil
+	}
+	return nil, errors.New("Unknown isolation backend " + name)
+}
+
+// proot binds host directories with ptrace, binds are always writable
+type proot struct{}
+
+func (proot) Command(s Spec, args ...string) (*exec.Cmd, error) {
+	pargs := []string{"-v", "0", "-r", "/"}
+	for _, b := range s.Binds {
+		pargs = append(pargs, "-b", b.Source+":"+b.Target)
+	}
+	pargs = append(pargs, "-w", s.WorkDir)
+
+	cmd := exec.Command("proot", append(pargs, args...)...)
+	cmd.Dir = s.WorkDir
+	cmd.Env = s.Env
+	return cmd, nil
+}
+
+func (proot) Remove(s Spec) error {
+	return nil
+}
+
+// bubblewrap binds host directories in a mount namespace
+type bubblewrap struct{}
+
+func (bubblewrap) Command(s Spec, args ...string) (*exec.Cmd, error) {
+	bargs := []string{"--bind", "/", "/", "--dev", "/dev", "--proc", "/proc", "--unshare-pid", "--die-with-parent"}
+	for _, b := range s.Binds {
+		if b.ReadOnly {
+			bargs = append(bargs, "--ro-bind", b.Source, b.Target)
+		} else {
+			bargs = append(bargs, "--bind", b.Source, b.Target)
+		}
+	}
+	bargs = append(bargs, "--chdir", s.WorkDir, "--")
+
+	cmd := exec.Command("bwrap", append(bargs, args...)...)
+	cmd.Dir = s.WorkDir
+	cmd.Env = s.Env
+	return cmd, nil
+}
+
+func (bubblewrap) Remove(s Spec) error {
+	return nil
+}
+
+// none runs commands on the host, binds are ignored. It is meant for development only
+type none struct{}
+
+func (none) Command(s Spec, args ...string) (*exec.Cmd, error) {
+	if len(args) == 0 {
+		return nil, errors.New("Command required")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = s.WorkDir
+	cmd.Env = s.Env
+	return cmd, nil
+}
+
+func (none) Remove(s Spec) error {
+	return nil
+}
@@ -0,0 +1,85 @@
+package isolation
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var spec = Spec{
+	Name: "job-1",
+	Binds: []Bind{
+		{Source: "/tmp/job", Target: "/tmp"},
+		{Source: "/var/cache/modules", Target: "/tmp/rand/modules", ReadOnly: true},
+	},
+	WorkDir: "/opt/tensor/projects/p",
+	Env:     []string{"HOME=/tmp/rand", "ANSIBLE_FORCE_COLOR=True"},
+	Image:   "tensor/runner:latest",
+}
+
+func TestProot(t *testing.T) {
+	b, err := New("", "")
+	assert.NoError(t, err)
+
+	cmd, err := b.Command(spec, "ansible-playbook", "site.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"proot", "-v", "0", "-r", "/",
+		"-b", "/tmp/job:/tmp", "-b", "/var/cache/modules:/tmp/rand/modules",
+		"-w", "/opt/tensor/projects/p", "ansible-playbook", "site.yml"}, cmd.Args)
+	assert.Equal(t, spec.WorkDir, cmd.Dir)
+	assert.Equal(t, spec.Env, cmd.Env)
+}
+
+func TestBubblewrap(t *testing.T) {
+	b, err := New("bubblewrap", "")
+	assert.NoError(t, err)
+
+	cmd, err := b.Command(spec, "terraform", "plan")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bwrap", "--bind", "/", "/", "--dev", "/dev", "--proc", "/proc",
+		"--unshare-pid", "--die-with-parent",
+		"--bind", "/tmp/job", "/tmp", "--ro-bind", "/var/cache/modules", "/tmp/rand/modules",
+		"--chdir", "/opt/tensor/projects/p", "--", "terraform", "plan"}, cmd.Args)
+	assert.Equal(t, spec.Env, cmd.Env)
+}
+
+func TestContainer(t *testing.T) {
+	b, err := New("container", "podman")
+	assert.NoError(t, err)
+
+	cmd, err := b.Command(spec, "ansible-playbook", "site.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"podman", "run", "--rm", "--network", "host",
+		"--user", strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid()),
+		"--label", "tensor.job=job-1", "--workdir", "/opt/tensor/projects/p",
+		"--volume", "/tmp/job:/tmp", "--volume", "/var/cache/modules:/tmp/rand/modules:ro",
+		"--env", "HOME", "--env", "ANSIBLE_FORCE_COLOR",
+		"tensor/runner:latest", "ansible-playbook", "site.yml"}, cmd.Args)
+	// values are passed through the environment of the runtime
+	assert.Subset(t, cmd.Env, spec.Env)
+
+	noImage := spec
+	noImage.Image = ""
+	_, err = b.Command(noImage, "ansible-playbook")
+	assert.EqualError(t, err, "Execution image required to run jobs in containers")
+}
+
+func TestNone(t *testing.T) {
+	b, err := New("none", "")
+	assert.NoError(t, err)
+
+	cmd, err := b.Command(spec, "terraform", "plan")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"terraform", "plan"}, cmd.Args)
+	assert.Equal(t, spec.WorkDir, cmd.Dir)
+
+	_, err = b.Command(spec)
+	assert.EqualError(t, err, "Command required")
+}
+
+func TestNewUnknown(t *testing.T) {
+	_, err := New("chroot", "")
+	assert.EqualError(t, err, "Unknown isolation backend chroot")
+}
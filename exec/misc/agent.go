@@ -0,0 +1,47 @@
+package misc
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/ssh"
+	"github.com/pearsonappeng/tensor/util"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// AddAgentKey adds the private key of a credential to the ssh agent. For ssh_ca credentials
+// an ephemeral key and a certificate identified by keyID are added instead, the certificate
+// expires after the certificate ttl of the credential or after ttl when it is not set
+func AddAgentKey(client agent.Agent, c common.Credential, keyID string, ttl time.Duration) error {
+	if c.Kind != common.CredentialKindSSHCA {
+		return ssh.AddKey(client, util.Decipher(c.SSHKeyData), util.Decipher(c.SSHKeyUnlock))
+	}
+
+	principals := c.Principals
+	if len(principals) == 0 {
+		principals = []string{c.Username}
+	}
+	if c.CertificateTTL > 0 {
+		ttl = time.Duration(c.CertificateTTL) * time.Second
+	}
+
+	key, err := ssh.NewCertificate(util.Decipher(c.SSHKeyData), util.Decipher(c.SSHKeyUnlock), ssh.CertificateOptions{
+		KeyID:      keyID,
+		Principals: principals,
+		TTL:        ttl,
+	})
+	if err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"Credential ID": c.ID.Hex(),
+		"Key ID":        keyID,
+		"Serial":        key.Certificate.Serial,
+		"Principals":    principals,
+		"Valid Before":  time.Unix(int64(key.Certificate.ValidBefore), 0),
+	}).Infoln("Signed SSH certificate")
+
+	return client.Add(key)
+}
@@ -8,8 +8,12 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/pearsonappeng/tensor/models/common"
 	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/yaml.v2"
 )
 
+// openStackCloud is the name of the cloud in generated clouds.yaml files
+const openStackCloud = "tensor"
+
 // raxCredFile creates a Rackspace credential file in the system temporary directory
 // and returns the resulting *os.File.
 // Multiple programs calling raxCredFile simultaneously
@@ -67,18 +71,92 @@ func GCECredFile(c common.Credential) (f *os.File, err error) {
 	return
 }
 
+// credFile writes content to a new file in the system temporary directory
+// readable only by the process user. It is the caller's responsibility
+// to remove the file when no longer needed.
+func credFile(prefix string, content []byte) (f *os.File, err error) {
+	f, err = ioutil.TempFile("", prefix)
+	if err != nil {
+		return
+	}
+
+	if _, err = f.Write(content); err != nil {
+		f.Close()
+		return
+	}
+	err = f.Close()
+	return
+}
+
+// openStackCredFile creates an OpenStack clouds.yaml file with a single cloud
+// named tensor in the system temporary directory and returns the resulting *os.File.
+// It is the caller's responsibility to remove the file when no longer needed.
+func openStackCredFile(c common.Credential) (*os.File, error) {
+	auth := yaml.MapSlice{
+		{Key: "auth_url", Value: c.Host},
+		{Key: "username", Value: c.Username},
+		{Key: "password", Value: string(util.Decipher(c.Password))},
+		{Key: "project_name", Value: c.Project},
+	}
+	if len(c.Domain) > 0 {
+		auth = append(auth, yaml.MapItem{Key: "domain_name", Value: c.Domain})
+	}
+
+	content, err := yaml.Marshal(yaml.MapSlice{
+		{Key: "clouds", Value: yaml.MapSlice{
+			{Key: openStackCloud, Value: yaml.MapSlice{
+				{Key: "auth", Value: auth},
+			}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := credFile("tensor_credential_openstack", content)
+	if err != nil {
+		logrus.Errorln("OpenStack credential file creation failed")
+	}
+	return f, err
+}
+
+// iniCredFile creates an ini file with a single section for inventory scripts
+// in the system temporary directory and returns the resulting *os.File.
+// It is the caller's responsibility to remove the file when no longer needed.
+func iniCredFile(section string, c common.Credential) (*os.File, error) {
+	content := "[" + section + "]" +
+		"\nurl=" + c.Host +
+		"\nusername=" + c.Username +
+		"\npassword=" + string(util.Decipher(c.Password)) +
+		"\nssl_verify=True\n"
+
+	f, err := credFile("tensor_credential_"+section, []byte(content))
+	if err != nil {
+		logrus.Errorln(section + " credential file creation failed")
+	}
+	return f, err
+}
+
 // GetCloudCredential cloud credential files and generates environment variables,
 // This accepts string slice and common.Credential (cloud credential) interface
 // and returns slice of environment variables generated and file handler to the
 // credential file
 func GetCloudCredential(env []string, c common.Credential) (menv []string, f *os.File, err error) {
+	menv = env
+
 	switch c.Kind {
 	//if Cloud Credential type is AWS
 	case common.CredentialKindAWS:
 		{
 			// add environment variables for aws
-			menv = append(env, "AWS_SECRET_ACCESS_KEY="+string(util.Decipher(c.Secret)),
+			menv = append(menv, "AWS_SECRET_ACCESS_KEY="+string(util.Decipher(c.Secret)),
 				"AWS_ACCESS_KEY_ID="+c.Client)
+
+			// temporary credentials issued by STS
+			if len(c.SecurityToken) > 0 {
+				token := c.SecretValue("security_token")
+				menv = append(menv, "AWS_SESSION_TOKEN="+token, "AWS_SECURITY_TOKEN="+token)
+			}
 		}
 	case common.CredentialKindRAX:
 		{
@@ -89,34 +167,84 @@ func GetCloudCredential(env []string, c common.Credential) (menv []string, f *os
 			}
 
 			// add environment variables for Rackspace credential
-			menv = append(env, "RAX_CREDS_FILE="+f.Name())
+			menv = append(menv, "RAX_CREDS_FILE="+f.Name())
 		}
 	case common.CredentialKindGCE:
 		{
 			f, err = GCECredFile(c)
 			if err != nil {
 				err = errors.New("GCE credential file creation failed")
+				return
 			}
 
 			// add environment variables for GCE credential
-			menv = append(env, "GCE_EMAIL="+c.Email, "GCE_PROJECT="+c.Project, "GCE_CREDENTIALS_FILE_PATH="+f.Name())
+			menv = append(menv, "GCE_EMAIL="+c.Email, "GCE_PROJECT="+c.Project, "GCE_CREDENTIALS_FILE_PATH="+f.Name())
 		}
 	case common.CredentialKindAZURE:
 		{
 			// Azure Active Directory
 			if len(c.Username) > 0 {
 				// add environment variables for Azure active directory credential
-				menv = append(env, "AZURE_AD_USER="+c.Username,
+				menv = append(menv, "AZURE_AD_USER="+c.Username,
 					"AZURE_PASSWORD="+string(util.Decipher(c.Password)),
 					"AZURE_SUBSCRIPTION_ID="+c.Subscription)
 			} else {
 				// add environment variables for Azure service principle credential
-				menv = append(env, "AZURE_CLIENT_ID="+c.Client,
+				menv = append(menv, "AZURE_CLIENT_ID="+c.Client,
 					"AZURE_SECRET="+string(util.Decipher(c.Secret)),
 					"AZURE_SUBSCRIPTION_ID="+c.Subscription,
 					"AZURE_TENANT="+c.Tenant)
 			}
 		}
+	case common.CredentialKindOPENSTACK:
+		{
+			f, err = openStackCredFile(c)
+			if err != nil {
+				err = errors.New("OpenStack credential file creation failed")
+				return
+			}
+
+			// openstack modules and the terraform provider read the cloud from clouds.yaml
+			menv = append(menv, "OS_CLIENT_CONFIG_FILE="+f.Name(), "OS_CLOUD="+openStackCloud)
+		}
+	case common.CredentialKindVMWARE:
+		{
+			password := string(util.Decipher(c.Password))
+			// VMWARE_* for ansible modules and inventory, VSPHERE_* for the terraform provider
+			menv = append(menv, "VMWARE_USER="+c.Username,
+				"VMWARE_PASSWORD="+password,
+				"VMWARE_HOST="+c.Host,
+				"VSPHERE_USER="+c.Username,
+				"VSPHERE_PASSWORD="+password,
+				"VSPHERE_SERVER="+c.Host)
+		}
+	case common.CredentialKindSATELLITE6:
+		{
+			f, err = iniCredFile("foreman", c)
+			if err != nil {
+				err = errors.New("Satellite 6 credential file creation failed")
+				return
+			}
+
+			// FOREMAN_* for ansible modules and the terraform provider
+			menv = append(menv, "SATELLITE6_INI_PATH="+f.Name(),
+				"FOREMAN_SERVER_URL="+c.Host,
+				"FOREMAN_USERNAME="+c.Username,
+				"FOREMAN_PASSWORD="+string(util.Decipher(c.Password)))
+		}
+	case common.CredentialKindCLOUDFORMS:
+		{
+			f, err = iniCredFile("cloudforms", c)
+			if err != nil {
+				err = errors.New("CloudForms credential file creation failed")
+				return
+			}
+
+			menv = append(menv, "CLOUDFORMS_INI_PATH="+f.Name(),
+				"CLOUDFORMS_URL="+c.Host,
+				"CLOUDFORMS_USERNAME="+c.Username,
+				"CLOUDFORMS_PASSWORD="+string(util.Decipher(c.Password)))
+		}
 	}
 
 	return
@@ -114,3 +114,205 @@ func TestGetCloudCredential(t *testing.T) {
 	expected = []string{"AZURE_CLIENT_ID=test", "AZURE_SECRET=test", "AZURE_SUBSCRIPTION_ID=test", "AZURE_TENANT=test"}
 	assert.Equal(expected, actual, "Must be equal")
 }
+
+func TestGetCloudCredentialAWSSecurityToken(t *testing.T) {
+	assert := assert.New(t)
+	c := common.Credential{
+		Secret:        util.Cipher("test"),
+		Client:        "test",
+		SecurityToken: util.Cipher("token"),
+		Kind:          common.CredentialKindAWS,
+	}
+
+	actual, _, _ := GetCloudCredential([]string{}, c)
+	expected := []string{"AWS_SECRET_ACCESS_KEY=test", "AWS_ACCESS_KEY_ID=test",
+		"AWS_SESSION_TOKEN=token", "AWS_SECURITY_TOKEN=token"}
+	assert.Equal(expected, actual, "Must be equal")
+
+	// tokens stored before they were encrypted are plaintext
+	c.SecurityToken = "FQoGZXIvYXdzEJr//////////wEaDM+token=="
+	actual, _, _ = GetCloudCredential([]string{}, c)
+	expected = []string{"AWS_SECRET_ACCESS_KEY=test", "AWS_ACCESS_KEY_ID=test",
+		"AWS_SESSION_TOKEN=" + c.SecurityToken, "AWS_SECURITY_TOKEN=" + c.SecurityToken}
+	assert.Equal(expected, actual, "Must be equal")
+}
+
+func TestGetCloudCredentialOpenStack(t *testing.T) {
+	assert := assert.New(t)
+	c := common.Credential{
+		Host:     "https://keystone.example.com:5000/v3",
+		Username: "test",
+		Password: util.Cipher("test: pass"),
+		Project:  "demo",
+		Domain:   "Default",
+		Kind:     common.CredentialKindOPENSTACK,
+	}
+
+	actual, f, err := GetCloudCredential([]string{}, c)
+	assert.NoError(err)
+	defer os.Remove(f.Name())
+
+	expected := []string{"OS_CLIENT_CONFIG_FILE=" + f.Name(), "OS_CLOUD=tensor"}
+	assert.Equal(expected, actual, "Must be equal")
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Equal("clouds:\n"+
+		"  tensor:\n"+
+		"    auth:\n"+
+		"      auth_url: https://keystone.example.com:5000/v3\n"+
+		"      username: test\n"+
+		"      password: 'test: pass'\n"+
+		"      project_name: demo\n"+
+		"      domain_name: Default\n", string(content), "OpenStack credential has invalid content")
+
+	info, _ := os.Stat(f.Name())
+	assert.Equal(os.FileMode(0600), info.Mode(), "OpenStack file has incorrect permissions")
+}
+
+func TestGetCloudCredentialVMware(t *testing.T) {
+	assert := assert.New(t)
+	c := common.Credential{
+		Host:     "vcenter.example.com",
+		Username: "test",
+		Password: util.Cipher("test"),
+		Kind:     common.CredentialKindVMWARE,
+	}
+
+	actual, f, err := GetCloudCredential([]string{}, c)
+	assert.NoError(err)
+	assert.Nil(f)
+
+	expected := []string{"VMWARE_USER=test", "VMWARE_PASSWORD=test", "VMWARE_HOST=vcenter.example.com",
+		"VSPHERE_USER=test", "VSPHERE_PASSWORD=test", "VSPHERE_SERVER=vcenter.example.com"}
+	assert.Equal(expected, actual, "Must be equal")
+}
+
+func TestGetCloudCredentialSatellite6(t *testing.T) {
+	assert := assert.New(t)
+	c := common.Credential{
+		Host:     "https://satellite.example.com",
+		Username: "test",
+		Password: util.Cipher("test"),
+		Kind:     common.CredentialKindSATELLITE6,
+	}
+
+	actual, f, err := GetCloudCredential([]string{}, c)
+	assert.NoError(err)
+	defer os.Remove(f.Name())
+
+	expected := []string{"SATELLITE6_INI_PATH=" + f.Name(), "FOREMAN_SERVER_URL=https://satellite.example.com",
+		"FOREMAN_USERNAME=test", "FOREMAN_PASSWORD=test"}
+	assert.Equal(expected, actual, "Must be equal")
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Equal("[foreman]\nurl=https://satellite.example.com\nusername=test\npassword=test\nssl_verify=True\n",
+		string(content), "Satellite 6 credential has invalid content")
+}
+
+func TestGetCloudCredentialCloudForms(t *testing.T) {
+	assert := assert.New(t)
+	c := common.Credential{
+		Host:     "https://cloudforms.example.com",
+		Username: "test",
+		Password: util.Cipher("test"),
+		Kind:     common.CredentialKindCLOUDFORMS,
+	}
+
+	actual, f, err := GetCloudCredential([]string{}, c)
+	assert.NoError(err)
+	defer os.Remove(f.Name())
+
+	expected := []string{"CLOUDFORMS_INI_PATH=" + f.Name(), "CLOUDFORMS_URL=https://cloudforms.example.com",
+		"CLOUDFORMS_USERNAME=test", "CLOUDFORMS_PASSWORD=test"}
+	assert.Equal(expected, actual, "Must be equal")
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Equal("[cloudforms]\nurl=https://cloudforms.example.com\nusername=test\npassword=test\nssl_verify=True\n",
+		string(content), "CloudForms credential has invalid content")
+}
+
+func TestGetCloudCredentialUnknownKind(t *testing.T) {
+	assert := assert.New(t)
+	c := common.Credential{Kind: common.CredentialKindSSH}
+
+	actual, f, err := GetCloudCredential([]string{"HOME=/root"}, c)
+	assert.NoError(err)
+	assert.Nil(f)
+	assert.Equal([]string{"HOME=/root"}, actual, "Environment must be unchanged")
+}
+
+func TestInject(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "tensor_injector")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	credentialType := common.CredentialType{
+		Name: "Internal API",
+		Inputs: []common.CredentialTypeInput{
+			{ID: "url", Label: "URL", Required: true},
+			{ID: "token", Label: "Token", Secret: true, Required: true},
+		},
+		Injectors: common.CredentialInjectors{
+			Env: map[string]string{
+				"API_URL":    "{{ url }}",
+				"API_CONFIG": "{{ tensor.filename.config }}",
+			},
+			ExtraVars: map[string]string{"api_token": "{{ token }}"},
+			Files:     map[string]string{"config": "url={{ url }}\ntoken={{ token }}\n"},
+		},
+	}
+	c := common.Credential{
+		Kind:         common.CredentialKindCUSTOM,
+		Inputs:       map[string]string{"url": "https://api.example.com"},
+		SecretInputs: map[string]string{"token": util.Cipher("s3cret")},
+	}
+
+	injection, err := Inject(credentialType, c, dir)
+	assert.NoError(err)
+	assert.Len(injection.Files, 1)
+	assert.Equal([]string{"API_CONFIG=" + injection.Files[0], "API_URL=https://api.example.com"}, injection.Env)
+	assert.Equal(map[string]string{"api_token": "s3cret"}, injection.ExtraVars)
+
+	content, _ := ioutil.ReadFile(injection.Files[0])
+	assert.Equal("url=https://api.example.com\ntoken=s3cret\n", string(content))
+
+	info, _ := os.Stat(injection.Files[0])
+	assert.Equal(os.FileMode(0600), info.Mode(), "Credential file has incorrect permissions")
+
+	// referencing an undefined variable fails
+	credentialType.Injectors.Env["API_USER"] = "{{ username }}"
+	_, err = Inject(credentialType, c, dir)
+	assert.Error(err)
+}
+
+func TestInjectCloudCredentials(t *testing.T) {
+	assert := assert.New(t)
+	credentials := []common.Credential{
+		{},
+		{
+			Secret: util.Cipher("test"),
+			Client: "test",
+			Kind:   common.CredentialKindAWS,
+		},
+		{
+			Host:     "https://keystone.example.com:5000/v3",
+			Username: "test",
+			Password: util.Cipher("test"),
+			Project:  "demo",
+			Kind:     common.CredentialKindOPENSTACK,
+		},
+	}
+
+	injection, err := InjectCloudCredentials(credentials, "")
+	assert.NoError(err)
+	assert.Len(injection.Files, 1)
+	assert.Equal([]string{"AWS_SECRET_ACCESS_KEY=test", "AWS_ACCESS_KEY_ID=test",
+		"OS_CLIENT_CONFIG_FILE=" + injection.Files[0], "OS_CLOUD=tensor"}, injection.Env)
+	assert.Empty(injection.ExtraVars)
+
+	RemoveFiles(injection.Files)
+	_, err = os.Stat(injection.Files[0])
+	assert.True(os.IsNotExist(err), "Credential file must be removed")
+}
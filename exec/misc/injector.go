@@ -0,0 +1,153 @@
+package misc
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// Injection holds environment variables, extra variables and
+// credential files a custom credential adds to a job
+type Injection struct {
+	Env       []string
+	ExtraVars map[string]string
+	Files     []string
+}
+
+// InjectCredential loads the credential type of a custom credential and applies its injectors.
+// Credential files are created in dir, it is the caller's responsibility
+// to remove them when no longer needed
+func InjectCredential(c common.Credential, dir string) (Injection, error) {
+	if c.CredentialTypeID == nil {
+		return Injection{}, errors.New("Credential " + c.Name + " does not have a credential type")
+	}
+
+	var credentialType common.CredentialType
+	if err := db.CredentialTypes().FindId(*c.CredentialTypeID).One(&credentialType); err != nil {
+		return Injection{}, errors.New("Credential type of " + c.Name + " could not be loaded: " + err.Error())
+	}
+
+	return Inject(credentialType, c, dir)
+}
+
+// Inject renders injectors of the credential type with the credential inputs.
+// Files are rendered first so environment and extra variables can
+// reference them with {{ tensor.filename.name }}
+func Inject(credentialType common.CredentialType, c common.Credential, dir string) (Injection, error) {
+	injection := Injection{ExtraVars: map[string]string{}}
+
+	values := map[string]string{}
+	for _, input := range credentialType.Inputs {
+		if input.Secret {
+			values[input.ID] = string(util.Decipher(c.SecretInputs[input.ID]))
+			continue
+		}
+		values[input.ID] = c.Inputs[input.ID]
+	}
+
+	for _, name := range sortedKeys(credentialType.Injectors.Files) {
+		content, err := util.RenderTemplate(credentialType.Injectors.Files[name], values)
+		if err != nil {
+			return injection, errors.New("Credential file " + name + " of " + credentialType.Name + ": " + err.Error())
+		}
+
+		f, err := ioutil.TempFile(dir, "tensor_credential_"+name)
+		if err != nil {
+			return injection, err
+		}
+		injection.Files = append(injection.Files, f.Name())
+		values["tensor.filename."+name] = f.Name()
+
+		// TempFile creates files readable only by the owner
+		if _, err := f.Write([]byte(content)); err != nil {
+			f.Close()
+			return injection, err
+		}
+		if err := f.Close(); err != nil {
+			return injection, err
+		}
+	}
+
+	for _, name := range sortedKeys(credentialType.Injectors.Env) {
+		value, err := util.RenderTemplate(credentialType.Injectors.Env[name], values)
+		if err != nil {
+			return injection, errors.New("Environment variable " + name + " of " + credentialType.Name + ": " + err.Error())
+		}
+		injection.Env = append(injection.Env, name+"="+value)
+	}
+
+	for _, name := range sortedKeys(credentialType.Injectors.ExtraVars) {
+		value, err := util.RenderTemplate(credentialType.Injectors.ExtraVars[name], values)
+		if err != nil {
+			return injection, errors.New("Extra variable " + name + " of " + credentialType.Name + ": " + err.Error())
+		}
+		injection.ExtraVars[name] = value
+	}
+
+	return injection, nil
+}
+
+// InjectCloudCredentials applies each cloud credential of a job, credentials without a kind are skipped.
+// Custom credentials are injected as described by their credential type and others
+// by GetCloudCredential. Paths of every file created are returned in Injection.Files,
+// it is the caller's responsibility to remove them when no longer needed
+func InjectCloudCredentials(credentials []common.Credential, dir string) (Injection, error) {
+	injection := Injection{ExtraVars: map[string]string{}}
+
+	for _, c := range credentials {
+		switch c.Kind {
+		case "":
+			continue
+		case common.CredentialKindCUSTOM:
+			custom, err := InjectCredential(c, dir)
+			injection.Files = append(injection.Files, custom.Files...)
+			if err != nil {
+				RemoveFiles(injection.Files)
+				return Injection{}, err
+			}
+			injection.Env = append(injection.Env, custom.Env...)
+			for name, value := range custom.ExtraVars {
+				injection.ExtraVars[name] = value
+			}
+		default:
+			env, f, err := GetCloudCredential(nil, c)
+			if f != nil {
+				injection.Files = append(injection.Files, f.Name())
+			}
+			if err != nil {
+				RemoveFiles(injection.Files)
+				return Injection{}, err
+			}
+			injection.Env = append(injection.Env, env...)
+		}
+	}
+
+	return injection, nil
+}
+
+// RemoveFiles removes credential files, failures are logged
+func RemoveFiles(files []string) {
+	for _, name := range files {
+		if err := os.RemoveAll(name); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"File":  name,
+				"Error": err.Error(),
+			}).Errorln("Unable to remove credential file")
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
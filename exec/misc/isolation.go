@@ -0,0 +1,44 @@
+package misc
+
+import (
+	"path/filepath"
+
+	"github.com/pearsonappeng/tensor/exec/isolation"
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// IsolationBackend returns the configured backend which isolates jobs
+func IsolationBackend() (isolation.Backend, error) {
+	return isolation.New(util.Config.Isolation.Backend, util.Config.Isolation.ContainerRuntime)
+}
+
+// ExecutionImage returns image, or the default execution image when it is empty
+func ExecutionImage(image string) string {
+	if len(image) == 0 {
+		return util.Config.Isolation.DefaultImage
+	}
+	return image
+}
+
+// JobBinds returns binds shared by ansible and terraform jobs. Directories of tensor and of
+// other projects are replaced with job directories in paths, the project checkout, job
+// directories and the directory of the ssh agent socket stay visible
+func JobBinds(paths types.JobPaths, socket string) []isolation.Bind {
+	binds := []isolation.Bind{
+		{Source: paths.Etc, Target: "/etc/tensor"},
+		{Source: paths.Tmp, Target: "/tmp"},
+		{Source: paths.VarLibProjects, Target: util.Config.ProjectsHome},
+		{Source: paths.VarLog, Target: "/var/log"},
+		{Source: paths.TmpRand, Target: paths.TmpRand},
+		{Source: paths.CredentialPath, Target: paths.CredentialPath},
+		{Source: paths.ProjectRoot, Target: paths.ProjectRoot},
+		// plugins of tensor
+		{Source: "/var/lib/tensor", Target: "/var/lib/tensor"},
+	}
+	if len(socket) > 0 {
+		dir := filepath.Dir(socket)
+		binds = append(binds, isolation.Bind{Source: dir, Target: dir})
+	}
+	return binds
+}
@@ -0,0 +1,47 @@
+package misc
+
+import "time"
+
+// reasons of job failures, retry policies of templates select failures by reason
+const (
+	// FailureFailed jobs ran and failed on one or more hosts
+	FailureFailed = "failed"
+	// FailureUnreachable jobs could not reach one or more hosts
+	FailureUnreachable = "unreachable"
+	// FailureError jobs could not be run or failed for reasons other than hosts
+	FailureError = "error"
+	// FailureTimeout jobs were killed by the job timeout or idle timeout
+	FailureTimeout = "timeout"
+)
+
+// maxRetryDelay caps the backoff of retries
+const maxRetryDelay = time.Hour
+
+// Retry reports whether a job which failed for reason is relaunched. attempt is the number of
+// retries before the job, at most count retries are made. on restricts retries to errors,
+// which include timeouts, or to unreachable hosts. Every failure is retried when on is any or empty
+func Retry(count int, attempt int, on string, reason string) bool {
+	if attempt >= count {
+		return false
+	}
+	switch on {
+	case "", "any":
+		return true
+	case FailureError:
+		return reason == FailureError || reason == FailureTimeout
+	}
+	return on == reason
+}
+
+// RetryDelay returns the delay before the retry of a job which failed at attempt,
+// backoff seconds are doubled with every attempt
+func RetryDelay(backoff int, attempt int) time.Duration {
+	delay := time.Duration(backoff) * time.Second
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,43 @@
+package misc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(Retry(0, 0, "", FailureFailed), "Retries are disabled by default")
+	assert.True(Retry(2, 1, "", FailureFailed))
+	assert.False(Retry(2, 2, "", FailureFailed), "Retried more than retry_count times")
+
+	assert.True(Retry(1, 0, "any", FailureUnreachable))
+	assert.True(Retry(1, 0, "error", FailureError))
+	assert.True(Retry(1, 0, "error", FailureTimeout))
+	assert.False(Retry(1, 0, "error", FailureFailed))
+	assert.True(Retry(1, 0, "unreachable", FailureUnreachable))
+	assert.False(Retry(1, 0, "unreachable", FailureError))
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(time.Duration(0), RetryDelay(0, 3))
+	assert.Equal(30*time.Second, RetryDelay(30, 0))
+	assert.Equal(120*time.Second, RetryDelay(30, 2))
+	assert.Equal(maxRetryDelay, RetryDelay(30, 20))
+}
+
+func TestSetToken(t *testing.T) {
+	assert := assert.New(t)
+
+	payload, err := setToken([]byte(`{"Job":{"name":"deploy"},"Token":"","Paths":{}}`), "t0ken")
+	assert.NoError(err)
+	assert.JSONEq(`{"Job":{"name":"deploy"},"Token":"t0ken","Paths":{}}`, string(payload))
+
+	_, err = setToken([]byte("not json"), "t0ken")
+	assert.Error(err)
+}
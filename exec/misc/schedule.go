@@ -0,0 +1,103 @@
+package misc
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/jwt"
+	"github.com/pearsonappeng/tensor/queue"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// retrySweepInterval is how often due retries are looked up, retries which were
+// due while tensord was stopped are published by the first sweep
+const retrySweepInterval = time.Minute
+
+// scheduledRetry is a retry job waiting for the backoff of its retry policy. Payload is the runner
+// job without token, the token is issued when the retry is published to its queue
+type scheduledRetry struct {
+	ID      bson.ObjectId `bson:"_id"`
+	Queue   string        `bson:"queue"`
+	Due     time.Time     `bson:"due"`
+	Payload []byte        `bson:"payload"`
+}
+
+// ScheduleRetry records the runner job of retry job id, which is published to the named queue after delay
+func ScheduleRetry(id bson.ObjectId, name string, delay time.Duration, payload []byte) error {
+	r := scheduledRetry{ID: id, Queue: name, Due: time.Now().Add(delay), Payload: payload}
+	if err := db.Retries().Insert(r); err != nil {
+		return err
+	}
+	time.AfterFunc(delay, PublishRetries)
+	return nil
+}
+
+// RunRetries publishes retries once they are due
+func RunRetries() {
+	PublishRetries()
+	for range time.Tick(retrySweepInterval) {
+		PublishRetries()
+	}
+}
+
+// PublishRetries publishes due retries with a new token. A retry is removed before it is published
+// so it is published once when several instances of tensord look up retries
+func PublishRetries() {
+	var retries []scheduledRetry
+	if err := db.Retries().Find(bson.M{"due": bson.M{"$lte": time.Now()}}).All(&retries); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Error while looking up retries")
+		return
+	}
+
+	for _, r := range retries {
+		// retries without token are looked up again by the next sweep
+		var token jwt.LocalToken
+		if err := jwt.NewAuthToken(&token); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Job ID": r.ID.Hex(),
+				"Error":  err.Error(),
+			}).Errorln("Error while getting token, retry is delayed")
+			return
+		}
+		payload, err := setToken(r.Payload, token.Token)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Job ID": r.ID.Hex(),
+				"Error":  err.Error(),
+			}).Errorln("Unable to marshal Job, job will not be retried")
+			db.Retries().RemoveId(r.ID)
+			continue
+		}
+
+		if err := db.Retries().RemoveId(r.ID); err != nil {
+			// published by another instance
+			if err != mgo.ErrNotFound {
+				logrus.WithFields(logrus.Fields{
+					"Job ID": r.ID.Hex(),
+					"Error":  err.Error(),
+				}).Errorln("Error while removing retry")
+			}
+			continue
+		}
+		queue.Queue.OpenQueue(r.Queue).PublishBytes(payload)
+	}
+}
+
+// setToken sets the token of the runner job in payload
+func setToken(payload []byte, token string) ([]byte, error) {
+	var job map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(token)
+	if err != nil {
+		return nil, err
+	}
+	job["Token"] = b
+	return json.Marshal(job)
+}
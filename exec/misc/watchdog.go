@@ -0,0 +1,101 @@
+package misc
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Watchdog kills job commands which exceed the job timeout or write no output for the idle timeout.
+// Output of watched commands is written to the watchdog, which resets the idle timeout
+type Watchdog struct {
+	mu      sync.Mutex
+	idle    time.Duration
+	hard    *time.Timer
+	quiet   *time.Timer
+	cmd     *exec.Cmd
+	expired string
+	stopped bool
+}
+
+// NewWatchdog starts the timeouts of a job, a zero timeout or idle disables it
+func NewWatchdog(timeout time.Duration, idle time.Duration) *Watchdog {
+	w := &Watchdog{idle: idle}
+	if timeout > 0 {
+		w.hard = time.AfterFunc(timeout, func() {
+			w.expire("Job exceeded the timeout of " + timeout.String())
+		})
+	}
+	if idle > 0 {
+		w.quiet = time.AfterFunc(idle, func() {
+			w.expire("Job wrote no output for " + idle.String())
+		})
+	}
+	return w
+}
+
+// Write resets the idle timeout
+func (w *Watchdog) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.quiet != nil && len(w.expired) == 0 && !w.stopped {
+		w.quiet.Reset(w.idle)
+	}
+	return len(p), nil
+}
+
+// Run starts cmd and waits for it, cmd is killed as soon as a timeout expires.
+// cmd must be started in a new session, its process group is killed
+func (w *Watchdog) Run(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.cmd = cmd
+	if len(w.expired) > 0 {
+		kill(cmd)
+	}
+	w.mu.Unlock()
+
+	err := cmd.Wait()
+
+	w.mu.Lock()
+	w.cmd = nil
+	w.mu.Unlock()
+	return err
+}
+
+// Stop stops the timeouts and returns the reason the job was killed, or an empty string
+func (w *Watchdog) Stop() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	if w.hard != nil {
+		w.hard.Stop()
+	}
+	if w.quiet != nil {
+		w.quiet.Stop()
+	}
+	return w.expired
+}
+
+func (w *Watchdog) expire(reason string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.expired) > 0 || w.stopped {
+		return
+	}
+	w.expired = reason
+	if w.cmd != nil {
+		kill(w.cmd)
+	}
+}
+
+// kill kills the process group of cmd, which includes processes started by isolation backends
+func kill(cmd *exec.Cmd) {
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,45 @@
+package misc
+
+import (
+	"bytes"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func watched(script string) *exec.Cmd {
+	cmd := exec.Command("sh", "-c", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	return cmd
+}
+
+func TestWatchdogTimeout(t *testing.T) {
+	w := NewWatchdog(100*time.Millisecond, 0)
+	err := w.Run(watched("sleep 10"))
+	assert.Error(t, err)
+	assert.Equal(t, "Job exceeded the timeout of 100ms", w.Stop())
+}
+
+func TestWatchdogIdle(t *testing.T) {
+	w := NewWatchdog(0, 300*time.Millisecond)
+	cmd := watched("for i in 1 2 3 4 5; do echo $i; sleep 0.1; done; sleep 10")
+	cmd.Stdout = w
+	start := time.Now()
+	assert.Error(t, w.Run(cmd))
+	assert.Equal(t, "Job wrote no output for 300ms", w.Stop())
+	// output kept the job alive
+	assert.True(t, time.Since(start) > 500*time.Millisecond)
+}
+
+func TestWatchdogStop(t *testing.T) {
+	w := NewWatchdog(time.Second, time.Second)
+	cmd := watched("echo done")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	assert.NoError(t, w.Run(cmd))
+	assert.Empty(t, w.Stop())
+	assert.Equal(t, "done\n", out.String())
+}
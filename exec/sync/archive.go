@@ -0,0 +1,442 @@
+package sync
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"golang.org/x/sys/unix"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// localRevision names content of a manual project which was not uploaded as an archive
+const localRevision = "local"
+
+// archiveMu serializes changes of manual project checkouts
+var archiveMu sync.Mutex
+
+// RevisionsDir returns the directory keeping previous revisions of a manual project
+func RevisionsDir(p common.Project) string {
+	return p.LocalPath + ".revisions"
+}
+
+// UploadArchive validates the .tar.gz or .zip archive in file, unpacks it and makes its content the
+// checkout of manual project p. The previous content is kept for rollback along with the latest
+// revisions, older revisions are removed. The updated project is returned
+func UploadArchive(p common.Project, file string, archive common.ProjectArchive) (common.Project, error) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+
+	if err := db.Projects().FindId(p.ID).One(&p); err != nil {
+		return p, err
+	}
+
+	revision, err := checksum(file)
+	if err != nil {
+		return p, err
+	}
+	archive.Revision = revision
+
+	// unpack next to the checkout, renames must not cross file systems
+	staging, err := ioutil.TempDir(filepath.Dir(p.LocalPath), "."+filepath.Base(p.LocalPath)+".")
+	if err != nil {
+		return p, err
+	}
+	defer os.RemoveAll(staging)
+
+	limit := int64(util.Config.ProjectArchive.MaxUnpackedSize) << 20
+	if err := unpackArchive(file, staging, limit); err != nil {
+		return p, err
+	}
+
+	previous := p.ScmRevision
+	if len(previous) == 0 && !isEmpty(p.LocalPath) {
+		previous = localRevision
+		p.Archives = append([]common.ProjectArchive{{Revision: localRevision, Uploaded: time.Now()}}, p.Archives...)
+	}
+	if err := replaceCheckout(p, staging, previous); err != nil {
+		return p, err
+	}
+
+	archives := []common.ProjectArchive{archive}
+	for _, a := range p.Archives {
+		if a.Revision != revision {
+			archives = append(archives, a)
+		}
+	}
+	if len(archives) > util.Config.ProjectArchive.Revisions+1 {
+		archives = archives[:util.Config.ProjectArchive.Revisions+1]
+	}
+	pruneRevisions(p, archives[1:])
+
+	return p, setArchives(&p, revision, archives)
+}
+
+// RollbackArchive makes a kept revision the checkout of manual project p,
+// the current content is kept in its place. The updated project is returned
+func RollbackArchive(p common.Project, revision string) (common.Project, error) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+
+	if err := db.Projects().FindId(p.ID).One(&p); err != nil {
+		return p, err
+	}
+
+	index := -1
+	for i, a := range p.Archives {
+		if a.Revision == revision {
+			index = i
+		}
+	}
+	if index < 0 || revision == p.ScmRevision {
+		return p, errors.New("Revision " + revision + " is not available for rollback")
+	}
+
+	previous := p.ScmRevision
+	if len(previous) == 0 {
+		previous = localRevision
+	}
+	if err := replaceCheckout(p, filepath.Join(RevisionsDir(p), revision), previous); err != nil {
+		return p, err
+	}
+
+	archives := []common.ProjectArchive{p.Archives[index]}
+	archives = append(archives, p.Archives[:index]...)
+	archives = append(archives, p.Archives[index+1:]...)
+
+	return p, setArchives(&p, revision, archives)
+}
+
+// setArchives records the revision of the checkout of manual project p
+func setArchives(p *common.Project, revision string, archives []common.ProjectArchive) error {
+	now := time.Now()
+	p.ScmRevision = revision
+	p.Archives = archives
+	p.LastUpdated = &now
+	p.LastUpdateFailed = false
+	p.Status = "successful"
+
+	return db.Projects().UpdateId(p.ID, bson.M{"$set": bson.M{
+		"scm_revision":       p.ScmRevision,
+		"archives":           p.Archives,
+		"last_updated":       p.LastUpdated,
+		"last_update_failed": p.LastUpdateFailed,
+		"status":             p.Status,
+	}})
+}
+
+// replaceCheckout moves dir in place of the checkout of project p. The current checkout is kept
+// under previous in the revisions directory, or removed when previous is empty. The checkout and dir
+// are exchanged in a single rename, jobs never find the checkout missing and running jobs keep the
+// directory they started in
+func replaceCheckout(p common.Project, dir string, previous string) error {
+	revisions := RevisionsDir(p)
+	if err := os.MkdirAll(revisions, 0770); err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(p.LocalPath); os.IsNotExist(err) {
+		return os.Rename(dir, p.LocalPath)
+	}
+
+	var kept string
+	if len(previous) > 0 {
+		kept = filepath.Join(revisions, previous)
+		if err := os.RemoveAll(kept); err != nil {
+			return err
+		}
+	}
+
+	// dir holds the previous checkout after the exchange
+	if err := unix.Renameat2(unix.AT_FDCWD, dir, unix.AT_FDCWD, p.LocalPath, unix.RENAME_EXCHANGE); err != nil {
+		return &os.LinkError{Op: "exchange", Old: dir, New: p.LocalPath, Err: err}
+	}
+	if len(kept) == 0 {
+		return os.RemoveAll(dir)
+	}
+	if err := os.Rename(dir, kept); err != nil {
+		// restore the previous checkout
+		unix.Renameat2(unix.AT_FDCWD, dir, unix.AT_FDCWD, p.LocalPath, unix.RENAME_EXCHANGE)
+		return err
+	}
+	return nil
+}
+
+// pruneRevisions removes revisions of project p other than the kept ones
+func pruneRevisions(p common.Project, kept []common.ProjectArchive) {
+	files, err := ioutil.ReadDir(RevisionsDir(p))
+	if err != nil {
+		return
+	}
+
+next:
+	for _, f := range files {
+		for _, a := range kept {
+			if a.Revision == f.Name() {
+				continue next
+			}
+		}
+		os.RemoveAll(filepath.Join(RevisionsDir(p), f.Name()))
+	}
+}
+
+// checksum returns the sha256 checksum of a file
+func checksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isEmpty reports whether dir is missing or has no content
+func isEmpty(dir string) bool {
+	files, err := ioutil.ReadDir(dir)
+	return err != nil || len(files) == 0
+}
+
+// unpackArchive extracts a gzip compressed tar or a zip archive into dir. Entries must stay inside
+// dir, symbolic links must point to content of the archive and the unpacked size must not
+// exceed limit bytes
+func unpackArchive(file string, dir string, limit int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return errors.New("Unsupported archive format, expected .tar.gz or .zip")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	u := &unpacker{root: dir, limit: limit}
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		err = u.tarGz(f)
+	case bytes.Equal(magic, []byte("PK\x03\x04")), bytes.Equal(magic, []byte("PK\x05\x06")):
+		var info os.FileInfo
+		if info, err = f.Stat(); err == nil {
+			err = u.zip(f, info.Size())
+		}
+	default:
+		err = errors.New("Unsupported archive format, expected .tar.gz or .zip")
+	}
+	if err != nil {
+		return err
+	}
+	return u.checkLinks()
+}
+
+// unpacker writes entries of an archive below root
+type unpacker struct {
+	root  string
+	limit int64
+	size  int64
+	links []string
+}
+
+func (u *unpacker) tarGz(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = u.dir(h.Name)
+		case tar.TypeReg, tar.TypeRegA:
+			err = u.file(h.Name, os.FileMode(h.Mode), tr)
+		case tar.TypeSymlink:
+			err = u.symlink(h.Name, h.Linkname)
+		case tar.TypeXGlobalHeader:
+		default:
+			err = errors.New("Unsupported archive entry " + h.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (u *unpacker) zip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = u.dir(f.Name)
+		case mode&os.ModeSymlink != 0:
+			err = u.zipSymlink(f)
+		case mode.IsRegular():
+			var rc io.ReadCloser
+			if rc, err = f.Open(); err == nil {
+				err = u.file(f.Name, mode, rc)
+				rc.Close()
+			}
+		default:
+			err = errors.New("Unsupported archive entry " + f.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *unpacker) zipSymlink(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	target, err := ioutil.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return err
+	}
+	return u.symlink(f.Name, string(target))
+}
+
+// path returns the location of an archive entry. Entries outside of the root and entries
+// below symbolic links are rejected, links are never followed while unpacking
+func (u *unpacker) path(name string) (string, error) {
+	name = filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", errors.New("Archive entry " + name + " is outside of the project")
+	}
+
+	path := u.root
+	parts := strings.Split(name, string(filepath.Separator))
+	for _, part := range parts[:len(parts)-1] {
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", errors.New("Archive entry " + name + " is below a symbolic link")
+		}
+	}
+	return filepath.Join(u.root, name), nil
+}
+
+func (u *unpacker) dir(name string) error {
+	path, err := u.path(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+func (u *unpacker) file(name string, mode os.FileMode, r io.Reader) error {
+	path, err := u.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// replace entries of the same name, an existing link must not be written through
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()&0755|0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, io.LimitReader(r, u.limit-u.size+1))
+	u.size += n
+	if err != nil {
+		return err
+	}
+	if u.size > u.limit {
+		return errors.New("Archive content exceeds the size limit")
+	}
+	return nil
+}
+
+func (u *unpacker) symlink(name string, target string) error {
+	path, err := u.path(name)
+	if err != nil {
+		return err
+	}
+	if filepath.IsAbs(target) {
+		return errors.New("Symbolic link " + name + " points outside of the project")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(target, path); err != nil {
+		return err
+	}
+	u.links = append(u.links, path)
+	return nil
+}
+
+// checkLinks resolves the unpacked symbolic links, links must resolve to content of the archive
+func (u *unpacker) checkLinks() error {
+	root, err := filepath.EvalSymlinks(u.root)
+	if err != nil {
+		return err
+	}
+
+	for _, link := range u.links {
+		name, _ := filepath.Rel(u.root, link)
+		target, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			return errors.New("Symbolic link " + name + " does not point to content of the project")
+		}
+		if target != root && !strings.HasPrefix(target, root+string(filepath.Separator)) {
+			return errors.New("Symbolic link " + name + " points outside of the project")
+		}
+	}
+	return nil
+}
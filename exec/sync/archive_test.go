@@ -0,0 +1,198 @@
+package sync
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// entry is a file, directory or symbolic link of a test archive
+type entry struct {
+	name string
+	body string
+	link string
+	dir  bool
+}
+
+// writeTarGz writes a gzip compressed tar archive with the entries and returns its path
+func writeTarGz(t *testing.T, dir string, entries ...entry) string {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		switch {
+		case e.dir:
+			h = &tar.Header{Name: e.name, Mode: 0755, Typeflag: tar.TypeDir}
+		case len(e.link) > 0:
+			h = &tar.Header{Name: e.name, Mode: 0777, Linkname: e.link, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			tw.Write([]byte(e.body))
+		}
+	}
+	tw.Close()
+	gz.Close()
+
+	file := filepath.Join(dir, "project.tar.gz")
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// writeZip writes a zip archive with the entries and returns its path
+func writeZip(t *testing.T, dir string, entries ...entry) string {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name}
+		h.SetMode(0644)
+		body := e.body
+		switch {
+		case e.dir:
+			h.SetMode(os.ModeDir | 0755)
+		case len(e.link) > 0:
+			h.SetMode(os.ModeSymlink | 0777)
+			body = e.link
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	zw.Close()
+
+	file := filepath.Join(dir, "project.zip")
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestUnpackArchive(t *testing.T) {
+	assert := assert.New(t)
+
+	tmp, err := ioutil.TempDir("", "tensor_archive")
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	unpack := func(file string) (string, error) {
+		dir, err := ioutil.TempDir(tmp, "project")
+		assert.NoError(err)
+		return dir, unpackArchive(file, dir, 1024)
+	}
+
+	entries := []entry{
+		{name: "roles/", dir: true},
+		{name: "roles/common/tasks/main.yml", body: "- ping:"},
+		{name: "site.yml", body: "- hosts: all"},
+		{name: "playbook.yml", link: "site.yml"},
+		{name: "tasks", link: "roles/common/tasks"},
+	}
+	for _, file := range []string{writeTarGz(t, tmp, entries...), writeZip(t, tmp, entries...)} {
+		dir, err := unpack(file)
+		assert.NoError(err, file)
+		content, _ := ioutil.ReadFile(filepath.Join(dir, "playbook.yml"))
+		assert.Equal("- hosts: all", string(content))
+		content, _ = ioutil.ReadFile(filepath.Join(dir, "tasks", "main.yml"))
+		assert.Equal("- ping:", string(content))
+	}
+
+	// path traversal
+	_, err = unpack(writeTarGz(t, tmp, entry{name: "../escape.yml", body: "x"}))
+	assert.Error(err)
+	_, err = unpack(writeZip(t, tmp, entry{name: "roles/../../escape.yml", body: "x"}))
+	assert.Error(err)
+	assert.False(exists(filepath.Join(tmp, "escape.yml")))
+
+	// symbolic links escaping the project
+	_, err = unpack(writeTarGz(t, tmp, entry{name: "passwd", link: "/etc/passwd"}))
+	assert.Error(err)
+	_, err = unpack(writeZip(t, tmp, entry{name: "parent", link: "../.."}))
+	assert.Error(err)
+	_, err = unpack(writeTarGz(t, tmp,
+		entry{name: "d/", dir: true},
+		entry{name: "d/up", link: ".."},
+		entry{name: "escape", link: "d/up/d/up/.."}))
+	assert.Error(err)
+
+	// entries written through links
+	_, err = unpack(writeTarGz(t, tmp,
+		entry{name: "self", link: "."},
+		entry{name: "self/self/escape.yml", body: "x"}))
+	assert.Error(err)
+
+	// size limit
+	_, err = unpack(writeTarGz(t, tmp, entry{name: "large.yml", body: string(make([]byte, 2048))}))
+	assert.Error(err)
+
+	// unsupported formats
+	file := filepath.Join(tmp, "project.txt")
+	assert.NoError(ioutil.WriteFile(file, []byte("plain text"), 0644))
+	_, err = unpack(file)
+	assert.Error(err)
+}
+
+func TestReplaceCheckout(t *testing.T) {
+	assert := assert.New(t)
+
+	tmp, err := ioutil.TempDir("", "tensor_archive")
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	p := common.Project{LocalPath: filepath.Join(tmp, "project")}
+	upload := func(content string) string {
+		dir, err := ioutil.TempDir(tmp, "staging")
+		assert.NoError(err)
+		assert.NoError(ioutil.WriteFile(filepath.Join(dir, "site.yml"), []byte(content), 0644))
+		return dir
+	}
+	read := func(path string) string {
+		content, _ := ioutil.ReadFile(filepath.Join(path, "site.yml"))
+		return string(content)
+	}
+
+	assert.NoError(replaceCheckout(p, upload("v1"), ""))
+	assert.Equal("v1", read(p.LocalPath))
+
+	// jobs running in the replaced checkout keep reading its content
+	running, err := os.Open(p.LocalPath)
+	assert.NoError(err)
+	defer running.Close()
+
+	staging := upload("v2")
+	assert.NoError(replaceCheckout(p, staging, "r1"))
+	assert.Equal("v2", read(p.LocalPath))
+	assert.Equal("v1", read(filepath.Join(RevisionsDir(p), "r1")))
+	assert.False(exists(staging))
+	names, err := running.Readdirnames(-1)
+	assert.NoError(err)
+	assert.Equal([]string{"site.yml"}, names)
+	info, err := os.Lstat(p.LocalPath)
+	assert.NoError(err)
+	assert.True(info.IsDir())
+
+	// rollback keeps the current content
+	assert.NoError(replaceCheckout(p, filepath.Join(RevisionsDir(p), "r1"), "r2"))
+	assert.Equal("v1", read(p.LocalPath))
+	assert.Equal("v2", read(filepath.Join(RevisionsDir(p), "r2")))
+	assert.False(exists(filepath.Join(RevisionsDir(p), "r1")))
+
+	assert.NoError(replaceCheckout(p, upload("v3"), "r1"))
+	pruneRevisions(p, []common.ProjectArchive{{Revision: "r1"}})
+	assert.True(exists(filepath.Join(RevisionsDir(p), "r1")))
+	assert.False(exists(filepath.Join(RevisionsDir(p), "r2")))
+}
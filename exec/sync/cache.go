@@ -0,0 +1,86 @@
+package sync
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// updateCache makes content prepared for revision key the current content of cache directory dir.
+// Content is prepared once per key in a staging directory, the current and the previous revision
+// are kept for running jobs. Read only content is protected from jobs which use it
+func updateCache(u *scmUpdate, dir string, key string, readOnly bool, prepare func(staging string) error) error {
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return err
+	}
+
+	target := filepath.Join(dir, key)
+	if exists(target) {
+		fmt.Fprintln(&u.output, "Using "+filepath.Base(dir)+" content prepared for revision "+key)
+	} else {
+		staging, err := ioutil.TempDir(dir, ".prepare")
+		if err != nil {
+			return err
+		}
+		defer RemoveAll(staging)
+
+		if err := prepare(staging); err != nil {
+			return err
+		}
+		if readOnly {
+			if err := setReadOnly(staging); err != nil {
+				return err
+			}
+		}
+		if err := os.Rename(staging, target); err != nil {
+			return err
+		}
+	}
+
+	// replace the link in a single rename, running jobs see either revision
+	current := filepath.Join(dir, "current")
+	previous, _ := os.Readlink(current)
+	link := filepath.Join(dir, ".current")
+	os.Remove(link)
+	if err := os.Symlink(key, link); err != nil {
+		return err
+	}
+	if err := os.Rename(link, current); err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		name := f.Name()
+		if name != key && name != previous && name != "current" && !strings.HasPrefix(name, ".") {
+			RemoveAll(filepath.Join(dir, name))
+		}
+	}
+	return nil
+}
+
+// setReadOnly removes write permissions from the content of dir
+func setReadOnly(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			return err
+		}
+		return os.Chmod(path, info.Mode().Perm()&^0222)
+	})
+}
+
+// RemoveAll removes path along with read only content, which os.RemoveAll fails to remove
+func RemoveAll(path string) error {
+	filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			os.Chmod(path, info.Mode().Perm()|0700)
+		}
+		return nil
+	})
+	return os.RemoveAll(path)
+}
@@ -0,0 +1,114 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// Default search paths which are kept after the galaxy content of a project
+const (
+	defaultRolesPath       = "~/.ansible/roles:/usr/share/ansible/roles:/etc/ansible/roles"
+	defaultCollectionsPath = "~/.ansible/collections:/usr/share/ansible/collections"
+)
+
+// GalaxyDir returns the directory holding roles and collections installed for a project.
+// Content of the current revision is linked as current
+func GalaxyDir(p common.Project) string {
+	return p.LocalPath + ".galaxy"
+}
+
+// GalaxyEnv returns the environment which makes roles and collections installed
+// for project p available to ansible-playbook
+func GalaxyEnv(p common.Project) []string {
+	current := filepath.Join(GalaxyDir(p), "current")
+
+	var env []string
+	if roles := filepath.Join(current, "roles"); exists(roles) {
+		env = append(env, "ANSIBLE_ROLES_PATH="+roles+":"+defaultRolesPath)
+	}
+	if collections := filepath.Join(current, "collections"); exists(collections) {
+		path := collections + ":" + defaultCollectionsPath
+		// ansible 2.10 renamed the variable
+		env = append(env, "ANSIBLE_COLLECTIONS_PATHS="+path, "ANSIBLE_COLLECTIONS_PATH="+path)
+	}
+	return env
+}
+
+// galaxyEnv points ansible-galaxy to the server of credential c. The configuration holding
+// the token or password is written to dir, credentials without a server are ignored
+func galaxyEnv(u *scmUpdate, c common.Credential, dir string) error {
+	if len(c.Host) == 0 {
+		return nil
+	}
+
+	config := "[galaxy]\nserver_list = tensor\n\n[galaxy_server.tensor]\nurl = " + c.Host + "\n"
+	if password := string(util.Decipher(c.Password)); len(c.Username) > 0 {
+		config += "username = " + c.Username + "\npassword = " + password + "\n"
+	} else if len(password) > 0 {
+		config += "token = " + password + "\n"
+	}
+
+	file := filepath.Join(dir, "ansible.cfg")
+	if err := ioutil.WriteFile(file, []byte(config), 0600); err != nil {
+		return err
+	}
+	u.env = append(u.env, "ANSIBLE_CONFIG="+file)
+	return nil
+}
+
+// installGalaxy installs roles listed in roles/requirements.yml and collections listed in
+// collections/requirements.yml of the checkout. Content is installed once for each revision of
+// the project, checkouts without a revision are cached by the content of the requirements
+func installGalaxy(u *scmUpdate, p common.Project, revision string) error {
+	roles := exists(filepath.Join(u.dir, "roles", "requirements.yml"))
+	collections := exists(filepath.Join(u.dir, "collections", "requirements.yml"))
+	galaxy := GalaxyDir(p)
+	if !roles && !collections {
+		// content of previous revisions must not be used by jobs
+		return os.RemoveAll(galaxy)
+	}
+
+	key := revision
+	if len(key) == 0 {
+		var err error
+		if key, err = requirementsChecksum(u.dir); err != nil {
+			return err
+		}
+	}
+
+	return updateCache(u, galaxy, key, false, func(staging string) error {
+		if roles {
+			if _, err := u.run("ansible-galaxy", "install", "-r", "roles/requirements.yml",
+				"-p", filepath.Join(staging, "roles"), "--force"); err != nil {
+				return err
+			}
+		}
+		if collections {
+			if _, err := u.run("ansible-galaxy", "collection", "install", "-r", "collections/requirements.yml",
+				"-p", filepath.Join(staging, "collections"), "--force"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// requirementsChecksum returns the checksum of the requirements files of a checkout
+func requirementsChecksum(dir string) (string, error) {
+	h := sha256.New()
+	for _, name := range []string{"roles", "collections"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name, "requirements.yml"))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		h.Write([]byte(name + "\x00"))
+		h.Write(content)
+	}
+	return "requirements-" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGalaxy is an ansible-galaxy stand-in which creates the install path given by -p
+const fakeGalaxy = `#!/bin/sh
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-p" ]; then mkdir -p "$2"; touch "$2/installed"; fi
+  shift
+done
+`
+
+func TestInstallGalaxy(t *testing.T) {
+	assert := assert.New(t)
+
+	tmp, err := ioutil.TempDir("", "tensor_galaxy")
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	bin := filepath.Join(tmp, "bin")
+	assert.NoError(os.Mkdir(bin, 0755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(bin, "ansible-galaxy"), []byte(fakeGalaxy), 0755))
+	// commands are looked up in the path of tensord
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+	p := common.Project{LocalPath: filepath.Join(tmp, "project")}
+	assert.NoError(os.MkdirAll(filepath.Join(p.LocalPath, "roles"), 0755))
+	assert.NoError(os.MkdirAll(filepath.Join(p.LocalPath, "collections"), 0755))
+
+	// checkouts without requirements install nothing
+	u := newUpdate(p.LocalPath)
+	assert.NoError(installGalaxy(u, p, "r1"))
+	assert.Empty(u.args)
+	assert.Empty(GalaxyEnv(p))
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(p.LocalPath, "roles", "requirements.yml"), []byte("- src: a"), 0644))
+	assert.NoError(ioutil.WriteFile(filepath.Join(p.LocalPath, "collections", "requirements.yml"), []byte("collections: []"), 0644))
+
+	u = newUpdate(p.LocalPath)
+	assert.NoError(installGalaxy(u, p, "r1"))
+	assert.Len(u.args, 2)
+	assert.True(exists(filepath.Join(GalaxyDir(p), "current", "roles", "installed")))
+	assert.True(exists(filepath.Join(GalaxyDir(p), "current", "collections", "installed")))
+
+	env := GalaxyEnv(p)
+	assert.Contains(env, "ANSIBLE_ROLES_PATH="+filepath.Join(GalaxyDir(p), "current", "roles")+":"+defaultRolesPath)
+	assert.Len(env, 3)
+
+	// content is installed once per revision
+	u = newUpdate(p.LocalPath)
+	assert.NoError(installGalaxy(u, p, "r1"))
+	assert.Empty(u.args)
+
+	u = newUpdate(p.LocalPath)
+	assert.NoError(installGalaxy(u, p, "r2"))
+	assert.Len(u.args, 2)
+	target, _ := os.Readlink(filepath.Join(GalaxyDir(p), "current"))
+	assert.Equal("r2", target)
+
+	// the previous revision is kept for running jobs
+	assert.NoError(installGalaxy(newUpdate(p.LocalPath), p, "r3"))
+	assert.True(exists(filepath.Join(GalaxyDir(p), "r2")))
+	assert.False(exists(filepath.Join(GalaxyDir(p), "r1")))
+
+	// checkouts without a revision are cached by their requirements
+	u = newUpdate(p.LocalPath)
+	assert.NoError(installGalaxy(u, p, ""))
+	assert.Len(u.args, 2)
+	u = newUpdate(p.LocalPath)
+	assert.NoError(installGalaxy(u, p, ""))
+	assert.Empty(u.args)
+
+	// failed installs fail the update
+	assert.NoError(ioutil.WriteFile(filepath.Join(bin, "ansible-galaxy"), []byte("#!/bin/sh\nexit 1\n"), 0755))
+	assert.Error(installGalaxy(newUpdate(p.LocalPath), p, "r4"))
+	target, _ = os.Readlink(filepath.Join(GalaxyDir(p), "current"))
+	assert.NotEqual("r4", target)
+}
+
+func TestGalaxyEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "tensor_galaxy")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	u := newUpdate(dir)
+	u.env = nil
+	assert.NoError(galaxyEnv(u, common.Credential{}, dir))
+	assert.Empty(u.env)
+
+	c := common.Credential{Host: "https://galaxy.example.com", Password: util.Cipher("t0ken")}
+	assert.NoError(galaxyEnv(u, c, dir))
+	assert.Equal([]string{"ANSIBLE_CONFIG=" + filepath.Join(dir, "ansible.cfg")}, u.env)
+	config, _ := ioutil.ReadFile(filepath.Join(dir, "ansible.cfg"))
+	assert.Contains(string(config), "url = https://galaxy.example.com")
+	assert.Contains(string(config), "token = t0ken")
+}
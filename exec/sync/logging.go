@@ -3,6 +3,7 @@ package sync
 import (
 	"time"
 
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/Sirupsen/logrus"
@@ -46,7 +47,16 @@ func status(t types.SyncJob, s string) {
 	}
 }
 
+// redacted masks decrypted secrets of the job before it is persisted
+func redacted(t *types.SyncJob) {
+	t.Job.ResultStdout = t.Redactor.String(t.Job.ResultStdout)
+	t.Job.JobExplanation = t.Redactor.String(t.Job.JobExplanation)
+	t.Job.JobARGS = t.Redactor.Strings(t.Job.JobARGS)
+	t.Job.JobENV = t.Redactor.Strings(t.Job.JobENV)
+}
+
 func jobFail(t types.SyncJob) {
+	redacted(&t)
 	t.Job.Status = "failed"
 	t.Job.Finished = time.Now()
 	t.Job.Failed = true
@@ -79,6 +89,7 @@ func jobFail(t types.SyncJob) {
 }
 
 func jobCancel(t types.SyncJob) {
+	redacted(&t)
 	t.Job.Status = "canceled"
 	t.Job.Finished = time.Now()
 	t.Job.Failed = false
@@ -112,6 +123,7 @@ func jobCancel(t types.SyncJob) {
 }
 
 func jobError(t types.SyncJob) {
+	redacted(&t)
 	t.Job.Status = "error"
 	t.Job.Finished = time.Now()
 	t.Job.Failed = true
@@ -143,7 +155,42 @@ func jobError(t types.SyncJob) {
 	updateProject(t)
 }
 
+// jobTimeout marks an update killed by the sync job timeout
+func jobTimeout(t types.SyncJob) {
+	redacted(&t)
+	t.Job.Status = "timeout"
+	t.Job.Finished = time.Now()
+	t.Job.Failed = true
+
+	//get elapsed time in minutes
+	diff := t.Job.Finished.Sub(t.Job.Started)
+
+	d := bson.M{
+		"$set": bson.M{
+			"status":          t.Job.Status,
+			"failed":          t.Job.Failed,
+			"finished":        t.Job.Finished,
+			"elapsed":         diff.Minutes(),
+			"result_stdout":   t.Job.ResultStdout,
+			"job_explanation": t.Job.JobExplanation,
+			"job_args":        t.Job.JobARGS,
+			"job_env":         t.Job.JobENV,
+			"job_cwd":         t.Job.JobCWD,
+		},
+	}
+
+	if err := db.Jobs().UpdateId(t.Job.ID, d); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Status": t.Job.Status,
+			"Error":  err,
+		}).Errorln("Failed to update job status")
+	}
+
+	updateProject(t)
+}
+
 func jobSuccess(t types.SyncJob) {
+	redacted(&t)
 	t.Job.Status = "successful"
 	t.Job.Finished = time.Now()
 	t.Job.Failed = false
@@ -162,6 +209,7 @@ func jobSuccess(t types.SyncJob) {
 			"job_args":        t.Job.JobARGS,
 			"job_env":         t.Job.JobENV,
 			"job_cwd":         t.Job.JobCWD,
+			"scm_revision":    t.Job.ScmRevision,
 		},
 	}
 
@@ -176,17 +224,38 @@ func jobSuccess(t types.SyncJob) {
 }
 
 func updateProject(t types.SyncJob) {
-	d := bson.M{
-		"$set": bson.M{
-			"last_updated":       t.Job.Finished,
-			"last_update_failed": t.Job.Failed,
-			"status":             t.Job.Status,
-		},
+	set := bson.M{
+		"last_updated":       t.Job.Finished,
+		"last_update_failed": t.Job.Failed,
+		"status":             t.Job.Status,
 	}
+	// the checkout was replaced by a successful update
+	if len(t.Job.ScmRevision) > 0 {
+		set["scm_revision"] = t.Job.ScmRevision
+		set["scm_delete_on_next_update"] = false
+	}
+	d := bson.M{"$set": set}
 
 	if err := db.Projects().UpdateId(t.ProjectID, d); err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err,
 		}).Errorln("Failed to update project")
 	}
-}
\ No newline at end of file
+
+	// launches create a new update job once this one is released
+	release := bson.M{"_id": t.ProjectID, "scm_update_job_id": t.Job.ID}
+	if err := db.Projects().Update(release, bson.M{"$unset": bson.M{"scm_update_job_id": ""}}); err != nil && err != mgo.ErrNotFound {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Errorln("Failed to release project update")
+	}
+
+	// updates requested while this one was running
+	if err := startNextUpdate(t.ProjectID); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Errorln("Failed to start follow-up project update")
+	}
+
+	notify(t.Job.ID, t.Job.Status)
+}
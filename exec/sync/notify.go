@@ -0,0 +1,133 @@
+package sync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// recheckInterval is how often waiting jobs read the update job in case a notification is lost
+const recheckInterval = time.Minute
+
+// jobEvent is written to the job_events capped collection when an update job finishes
+type jobEvent struct {
+	ID     bson.ObjectId `bson:"_id"`
+	JobID  bson.ObjectId `bson:"job_id"`
+	Status string        `bson:"status"`
+}
+
+var (
+	listenOnce sync.Once
+	waitersMu  sync.Mutex
+	waiters    = map[bson.ObjectId][]chan struct{}{}
+)
+
+// notify wakes jobs waiting for the update job on every tensor instance
+func notify(jobID bson.ObjectId, status string) {
+	if err := db.JobEvents().Insert(jobEvent{ID: bson.NewObjectId(), JobID: jobID, Status: status}); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Job ID": jobID.Hex(),
+			"Error":  err.Error(),
+		}).Errorln("Failed to notify waiting jobs")
+	}
+}
+
+// listen tails the job_events collection and wakes jobs waiting for finished update jobs
+func listen(since time.Time) {
+	last := bson.NewObjectIdWithTime(since)
+	for {
+		session := db.MongoDb.Session.Copy()
+		// object ids of other instances created in the same second may sort before the last event,
+		// events are read again from the beginning of that second
+		iter := db.MongoDb.With(session).C(db.CJobEvents).Find(bson.M{
+			"_id": bson.M{"$gte": bson.NewObjectIdWithTime(last.Time())},
+		}).Tail(-1)
+
+		var event jobEvent
+		for iter.Next(&event) {
+			last = event.ID
+			if len(event.JobID) > 0 {
+				wake(event.JobID)
+			}
+		}
+		if err := iter.Close(); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err.Error(),
+			}).Errorln("Error while reading job events")
+		}
+		session.Close()
+		time.Sleep(time.Second)
+	}
+}
+
+// wake closes the channels of jobs waiting for jobID
+func wake(jobID bson.ObjectId) {
+	waitersMu.Lock()
+	defer waitersMu.Unlock()
+	for _, ch := range waiters[jobID] {
+		close(ch)
+	}
+	delete(waiters, jobID)
+}
+
+// Wait blocks until the update job finishes and returns it
+func Wait(jobID bson.ObjectId) (job ansible.Job, err error) {
+	started := time.Now()
+	listenOnce.Do(func() {
+		go listen(started)
+	})
+
+	for {
+		var done bool
+		if job, done, err = waitFor(jobID, recheckInterval); done || err != nil {
+			return
+		}
+	}
+}
+
+// waitFor waits up to timeout for the update job to finish and reports whether it has finished
+func waitFor(jobID bson.ObjectId, timeout time.Duration) (job ansible.Job, done bool, err error) {
+	ch := make(chan struct{})
+	waitersMu.Lock()
+	waiters[jobID] = append(waiters[jobID], ch)
+	waitersMu.Unlock()
+	defer unwait(jobID, ch)
+
+	// the job may have finished before the waiter was registered
+	if err = db.Jobs().FindId(jobID).One(&job); err != nil || finished(job.Status) {
+		return job, err == nil, err
+	}
+
+	select {
+	case <-ch:
+	case <-time.After(timeout):
+	}
+	return job, false, nil
+}
+
+// unwait removes the channel of a waiting job, channels of woken jobs are already removed
+func unwait(jobID bson.ObjectId, ch chan struct{}) {
+	waitersMu.Lock()
+	defer waitersMu.Unlock()
+	chans := waiters[jobID]
+	for i, c := range chans {
+		if c == ch {
+			chans = append(chans[:i], chans[i+1:]...)
+			break
+		}
+	}
+	if len(chans) == 0 {
+		delete(waiters, jobID)
+		return
+	}
+	waiters[jobID] = chans
+}
+
+// finished reports whether a job with status s has stopped
+func finished(s string) bool {
+	return s == "successful" || s == "failed" || s == "error" || s == "canceled" || s == "timeout"
+}
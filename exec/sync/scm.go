@@ -0,0 +1,369 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pearsonappeng/tensor/log/redact"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// sshCommand accepts host keys of SCM servers without recording them
+const sshCommand = "ssh -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null"
+
+// rxCommit matches abbreviated and full commit hashes
+var rxCommit = regexp.MustCompile("^[0-9a-fA-F]{7,40}$")
+
+// scmUpdate runs the commands which bring a project checkout up to date
+type scmUpdate struct {
+	ctx context.Context
+	// dir is the project checkout
+	dir string
+	env []string
+	// output collects output of all commands
+	output bytes.Buffer
+	// args records executed commands with secrets masked
+	args     []string
+	redactor *redact.Redactor
+	// bin is the directory of the project toolchain, its binaries take precedence
+	bin string
+}
+
+// run executes an SCM command inside the project checkout and returns its standard output
+func (u *scmUpdate) run(name string, args ...string) (string, error) {
+	return u.runInput("", name, args...)
+}
+
+// runInput executes an SCM command which reads input from its standard input
+func (u *scmUpdate) runInput(input string, name string, args ...string) (string, error) {
+	record := u.redactor.String(strings.Join(append([]string{name}, args...), " "))
+	u.args = append(u.args, record)
+	fmt.Fprintln(&u.output, "$ "+record)
+
+	if len(u.bin) > 0 && exists(filepath.Join(u.bin, name)) {
+		name = filepath.Join(u.bin, name)
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(u.ctx, name, args...)
+	cmd.Dir = u.dir
+	cmd.Env = u.env
+	if len(input) > 0 {
+		cmd.Stdin = strings.NewReader(input)
+	}
+	cmd.Stdout = io.MultiWriter(&stdout, &u.output)
+	cmd.Stderr = &u.output
+	// Set setsid to create a new session, The new process group has no controlling
+	// terminal which disables the stdin & will skip prompts
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Run(); err != nil {
+		if u.ctx.Err() != nil {
+			return "", errors.New("Execution exceeded threshold value")
+		}
+		return "", errors.New(record + ": " + err.Error())
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// scmEnv returns the environment of SCM commands. Host keys are accepted and ssh keys are
+// read from the agent listening on socket. Username and password of the credential are
+// written to files in dir, which are read by git and hg when a server asks for them
+func scmEnv(u *scmUpdate, p common.Project, c common.Credential, dir string, socket string, pid int) error {
+	u.env = []string{
+		"HOME=" + os.Getenv("HOME"),
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"SSH_AUTH_SOCK=" + socket,
+		"SSH_AGENT_PID=" + strconv.Itoa(pid),
+		"GIT_SSH_COMMAND=" + sshCommand,
+		"GIT_TERMINAL_PROMPT=0",
+		"SVN_SSH=" + sshCommand,
+		"HGPLAIN=1",
+	}
+
+	password := string(util.Decipher(c.Password))
+
+	switch p.ScmType {
+	case "git":
+		if len(c.Username) == 0 && len(password) == 0 {
+			return nil
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "username"), []byte(c.Username), 0600); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "password"), []byte(password), 0600); err != nil {
+			return err
+		}
+		askpass := filepath.Join(dir, "askpass")
+		script := "#!/bin/sh\ncase \"$1\" in\nUsername*) cat " + filepath.Join(dir, "username") +
+			" ;;\n*) cat " + filepath.Join(dir, "password") + " ;;\nesac\n"
+		if err := ioutil.WriteFile(askpass, []byte(script), 0700); err != nil {
+			return err
+		}
+		u.env = append(u.env, "GIT_ASKPASS="+askpass)
+	case "hg":
+		hgrc := "[ui]\nssh = " + sshCommand + "\n"
+		if len(c.Username) > 0 {
+			hgrc += "[auth]\ntensor.prefix = *\ntensor.username = " + c.Username + "\n"
+			if len(password) > 0 {
+				hgrc += "tensor.password = " + password + "\n"
+			}
+		}
+		file := filepath.Join(dir, "hgrc")
+		if err := ioutil.WriteFile(file, []byte(hgrc), 0600); err != nil {
+			return err
+		}
+		u.env = append(u.env, "HGRCPATH="+file)
+	case "svn":
+		// subversion reads the password from standard input, it is masked in case a command echoes it
+		u.redactor.Add(password)
+	}
+	return nil
+}
+
+// updateSCM clones or updates the checkout of project p and returns the resolved revision.
+// The checkout is removed first when the project is set to delete it on update
+func updateSCM(u *scmUpdate, p common.Project, c common.Credential) (string, error) {
+	switch p.ScmType {
+	case "git", "hg", "svn":
+	default:
+		// manual projects are managed by users
+		return "", os.MkdirAll(u.dir, 0770)
+	}
+
+	if p.ScmDeleteOnUpdate || p.ScmDeleteOnNextUpdate {
+		fmt.Fprintln(&u.output, "Removing "+u.dir)
+		if err := os.RemoveAll(u.dir); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(u.dir, 0770); err != nil {
+		return "", err
+	}
+
+	switch p.ScmType {
+	case "git":
+		return updateGit(u, p)
+	case "hg":
+		return updateHg(u, p)
+	default:
+		return updateSvn(u, p, c)
+	}
+}
+
+// updateGit fetches the branch, tag or commit in ScmBranch along with refs in ScmRefspec and checks it
+// out. Commits and refs fetched by the refspec which cannot be fetched directly are resolved after
+// fetching all branches. Submodules are checked out when ScmSubmodules is set.
+// Options are terminated before urls and refs so they are never read as options
+func updateGit(u *scmUpdate, p common.Project) (string, error) {
+	if !exists(filepath.Join(u.dir, ".git")) {
+		if err := resetDir(u.dir); err != nil {
+			return "", err
+		}
+		if _, err := u.run("git", "init", "--quiet"); err != nil {
+			return "", err
+		}
+		if _, err := u.run("git", "remote", "add", "--", "origin", p.ScmURL); err != nil {
+			return "", err
+		}
+	} else if _, err := u.run("git", "remote", "set-url", "--", "origin", p.ScmURL); err != nil {
+		return "", err
+	}
+
+	fetch := []string{"fetch", "--force"}
+	if p.ScmCloneDepth > 0 {
+		fetch = append(fetch, "--depth", strconv.Itoa(p.ScmCloneDepth))
+	} else if exists(filepath.Join(u.dir, ".git", "shallow")) {
+		fetch = append(fetch, "--unshallow")
+	}
+	fetch = append(fetch, "--", "origin")
+
+	if refspec := strings.Fields(p.ScmRefspec); len(refspec) > 0 {
+		if _, err := u.run("git", append(fetch, refspec...)...); err != nil {
+			return "", err
+		}
+		// the repository is no longer shallow
+		fetch = removeArg(fetch, "--unshallow")
+	}
+
+	branch := p.ScmBranch
+	if len(branch) == 0 {
+		branch = "HEAD"
+	}
+
+	target := "FETCH_HEAD"
+	if _, err := u.run("git", append(fetch, branch)...); err != nil {
+		if len(p.ScmRefspec) == 0 && !rxCommit.MatchString(branch) {
+			return "", err
+		}
+		fetch = removeArg(fetch, "--unshallow")
+		if _, err := u.run("git", append(fetch, "+refs/heads/*:refs/remotes/origin/*")...); err != nil {
+			return "", err
+		}
+		target = branch
+	}
+
+	checkout := []string{"checkout", "--quiet", "--detach"}
+	if p.ScmClean {
+		checkout = append(checkout, "--force")
+	}
+	// target is a revision, paths would follow the separator
+	if _, err := u.run("git", append(checkout, target, "--")...); err != nil {
+		return "", err
+	}
+	if p.ScmClean {
+		if _, err := u.run("git", "clean", "-ffd"); err != nil {
+			return "", err
+		}
+	}
+
+	if p.ScmSubmodules {
+		if _, err := u.run("git", "submodule", "sync", "--recursive"); err != nil {
+			return "", err
+		}
+		update := []string{"submodule", "update", "--init", "--recursive"}
+		if p.ScmCloneDepth > 0 {
+			update = append(update, "--depth", strconv.Itoa(p.ScmCloneDepth))
+		}
+		if p.ScmClean {
+			update = append(update, "--force")
+		}
+		if _, err := u.run("git", update...); err != nil {
+			return "", err
+		}
+	}
+
+	return u.run("git", "rev-parse", "HEAD")
+}
+
+// updateHg pulls the repository and updates the checkout to the branch, tag or changeset in ScmBranch
+func updateHg(u *scmUpdate, p common.Project) (string, error) {
+	if !exists(filepath.Join(u.dir, ".hg")) {
+		if err := resetDir(u.dir); err != nil {
+			return "", err
+		}
+		if _, err := u.run("hg", "clone", "--noupdate", "--", p.ScmURL, "."); err != nil {
+			return "", err
+		}
+	} else if _, err := u.run("hg", "pull", "--", p.ScmURL); err != nil {
+		return "", err
+	}
+
+	revision := p.ScmBranch
+	if len(revision) == 0 {
+		revision = "default"
+	}
+
+	update := []string{"update", "--rev", revision}
+	if p.ScmClean {
+		if _, err := u.run("hg", "--config", "extensions.purge=", "purge"); err != nil {
+			return "", err
+		}
+		update = append(update, "--clean")
+	}
+	if _, err := u.run("hg", update...); err != nil {
+		return "", err
+	}
+
+	return u.run("hg", "log", "--rev", ".", "--template", "{node}")
+}
+
+// updateSvn checks out or updates the working copy to the revision in ScmBranch.
+// A working copy of another repository url is checked out again. The password is read from
+// standard input, arguments are visible to other processes of the host
+func updateSvn(u *scmUpdate, p common.Project, c common.Credential) (string, error) {
+	auth := []string{"--non-interactive", "--no-auth-cache"}
+	if len(c.Username) > 0 {
+		auth = append(auth, "--username", c.Username)
+	}
+	password := string(util.Decipher(c.Password))
+	if len(password) > 0 {
+		auth = append(auth, "--password-from-stdin")
+	}
+
+	revision := p.ScmBranch
+	if len(revision) == 0 {
+		revision = "HEAD"
+	}
+
+	if exists(filepath.Join(u.dir, ".svn")) {
+		url, err := u.run("svn", "info", "--show-item", "url")
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSuffix(url, "/") != strings.TrimSuffix(p.ScmURL, "/") {
+			fmt.Fprintln(&u.output, "Repository url changed, removing "+u.dir)
+			if err := resetDir(u.dir); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if !exists(filepath.Join(u.dir, ".svn")) {
+		if err := resetDir(u.dir); err != nil {
+			return "", err
+		}
+		args := append([]string{"checkout", "--revision", revision}, auth...)
+		if _, err := u.runInput(password, "svn", append(args, "--", p.ScmURL, ".")...); err != nil {
+			return "", err
+		}
+	} else {
+		if p.ScmClean {
+			if _, err := u.run("svn", "revert", "--recursive", "."); err != nil {
+				return "", err
+			}
+			if _, err := u.run("svn", "cleanup", "--remove-unversioned", "."); err != nil {
+				return "", err
+			}
+		}
+		args := append([]string{"update", "--revision", revision}, auth...)
+		if _, err := u.runInput(password, "svn", args...); err != nil {
+			return "", err
+		}
+	}
+
+	return u.run("svn", "info", "--show-item", "revision")
+}
+
+// exists reports whether the path exists
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// resetDir removes the content of a directory which is not a checkout of the project repository
+func resetDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.RemoveAll(filepath.Join(dir, f.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeArg returns args without arg
+func removeArg(args []string, arg string) []string {
+	var result []string
+	for _, a := range args {
+		if a != arg {
+			result = append(result, a)
+		}
+	}
+	return result
+}
@@ -0,0 +1,182 @@
+package sync
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pearsonappeng/tensor/log/redact"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// git runs a git command in dir and returns its output
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=tensor", "-c", "user.email=tensor@localhost"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit writes a file to the repository and commits it
+func commit(t *testing.T, dir string, name string, content string) string {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, dir, "add", name)
+	git(t, dir, "commit", "--quiet", "-m", "Update "+name)
+	return git(t, dir, "rev-parse", "HEAD")
+}
+
+func newUpdate(dir string) *scmUpdate {
+	return &scmUpdate{ctx: context.Background(), dir: dir, env: os.Environ(), redactor: redact.New()}
+}
+
+func TestUpdateGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	assert := assert.New(t)
+
+	tmp, err := ioutil.TempDir("", "tensor_scm")
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	origin := filepath.Join(tmp, "origin")
+	assert.NoError(os.Mkdir(origin, 0755))
+	git(t, origin, "init", "--quiet")
+	first := commit(t, origin, "site.yml", "v1")
+	git(t, origin, "tag", "-a", "v1", "-m", "v1")
+	second := commit(t, origin, "site.yml", "v2")
+	git(t, origin, "update-ref", "refs/pull/1/head", first)
+
+	p := common.Project{ScmType: "git", ScmURL: "file://" + origin}
+	checkout := filepath.Join(tmp, "project")
+
+	// default branch
+	revision, err := updateSCM(newUpdate(checkout), p, common.Credential{})
+	assert.NoError(err)
+	assert.Equal(second, revision)
+
+	// tags and commits
+	p.ScmBranch = "v1"
+	revision, err = updateSCM(newUpdate(checkout), p, common.Credential{})
+	assert.NoError(err)
+	assert.Equal(first, revision)
+
+	p.ScmBranch = second
+	revision, err = updateSCM(newUpdate(checkout), p, common.Credential{})
+	assert.NoError(err)
+	assert.Equal(second, revision)
+
+	// refs fetched by the refspec
+	p.ScmBranch = "origin/pull/1/head"
+	p.ScmRefspec = "+refs/pull/*:refs/remotes/origin/pull/*"
+	revision, err = updateSCM(newUpdate(checkout), p, common.Credential{})
+	assert.NoError(err)
+	assert.Equal(first, revision)
+
+	// local modifications are discarded when scm clean is set
+	p.ScmBranch = ""
+	p.ScmRefspec = ""
+	p.ScmClean = true
+	assert.NoError(ioutil.WriteFile(filepath.Join(checkout, "site.yml"), []byte("local"), 0644))
+	assert.NoError(ioutil.WriteFile(filepath.Join(checkout, "untracked.yml"), []byte("local"), 0644))
+	revision, err = updateSCM(newUpdate(checkout), p, common.Credential{})
+	assert.NoError(err)
+	assert.Equal(second, revision)
+	content, _ := ioutil.ReadFile(filepath.Join(checkout, "site.yml"))
+	assert.Equal("v2", string(content))
+	assert.False(exists(filepath.Join(checkout, "untracked.yml")))
+
+	// shallow clones after deleting the checkout
+	p.ScmDeleteOnUpdate = true
+	p.ScmCloneDepth = 1
+	revision, err = updateSCM(newUpdate(checkout), p, common.Credential{})
+	assert.NoError(err)
+	assert.Equal(second, revision)
+	assert.True(exists(filepath.Join(checkout, ".git", "shallow")))
+
+	// missing branches fail the update
+	p.ScmBranch = "missing"
+	_, err = updateSCM(newUpdate(checkout), p, common.Credential{})
+	assert.Error(err)
+
+	// branches and refspecs are never read as options
+	pwned := filepath.Join(tmp, "pwned")
+	p.ScmBranch = "--upload-pack=touch " + pwned + "; git-upload-pack"
+	_, err = updateSCM(newUpdate(checkout), p, common.Credential{})
+	assert.Error(err)
+	p.ScmBranch = ""
+	p.ScmRefspec = "--upload-pack=touch " + pwned + "; git-upload-pack"
+	_, err = updateSCM(newUpdate(checkout), p, common.Credential{})
+	assert.Error(err)
+	assert.False(exists(pwned))
+}
+
+func TestUpdateManual(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "tensor_scm")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "site.yml"), []byte("local"), 0644))
+
+	// manual projects are never removed
+	u := newUpdate(dir)
+	revision, err := updateSCM(u, common.Project{ScmType: "manual", ScmDeleteOnUpdate: true}, common.Credential{})
+	assert.NoError(err)
+	assert.Empty(revision)
+	assert.Empty(u.args)
+	assert.True(exists(filepath.Join(dir, "site.yml")))
+}
+
+func TestScmEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "tensor_scm")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	c := common.Credential{Username: "deploy", Password: util.Cipher("s3cret")}
+
+	// git reads credentials through the askpass helper
+	u := newUpdate(dir)
+	assert.NoError(scmEnv(u, common.Project{ScmType: "git"}, c, dir, "/tmp/agent.sock", 1))
+	assert.Contains(u.env, "SSH_AUTH_SOCK=/tmp/agent.sock")
+	assert.Contains(u.env, "GIT_ASKPASS="+filepath.Join(dir, "askpass"))
+	username, err := u.run(filepath.Join(dir, "askpass"), "Username for 'https://example.com': ")
+	assert.NoError(err)
+	assert.Equal("deploy", username)
+	password, err := u.run(filepath.Join(dir, "askpass"), "Password for 'https://deploy@example.com': ")
+	assert.NoError(err)
+	assert.Equal("s3cret", password)
+
+	// hg reads credentials from the configuration file
+	u = newUpdate(dir)
+	assert.NoError(scmEnv(u, common.Project{ScmType: "hg"}, c, dir, "/tmp/agent.sock", 1))
+	assert.Contains(u.env, "HGRCPATH="+filepath.Join(dir, "hgrc"))
+	hgrc, _ := ioutil.ReadFile(filepath.Join(dir, "hgrc"))
+	assert.Contains(string(hgrc), "tensor.password = s3cret")
+
+	// svn reads passwords from standard input instead of arguments
+	u = newUpdate(dir)
+	assert.NoError(scmEnv(u, common.Project{ScmType: "svn"}, c, dir, "/tmp/agent.sock", 1))
+	password, err = u.runInput("s3cret", "cat")
+	assert.NoError(err)
+	assert.Equal("s3cret", password)
+	assert.Equal([]string{"cat"}, u.args)
+
+	// secrets must not be exposed in the environment
+	for _, v := range u.env {
+		assert.NotContains(v, "s3cret")
+	}
+}
@@ -1,27 +1,27 @@
 package sync
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"os"
-	"os/exec"
-	"strconv"
-	"strings"
-	"syscall"
+	"path"
 	"time"
 
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pearsonappeng/tensor/db"
 	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/log/redact"
 	"github.com/pearsonappeng/tensor/models/ansible"
 	"github.com/pearsonappeng/tensor/models/common"
 	"github.com/pearsonappeng/tensor/queue"
+	"github.com/pearsonappeng/tensor/secrets"
 	"github.com/pearsonappeng/tensor/ssh"
 	"github.com/pearsonappeng/tensor/util"
-	"path"
 )
 
 func Sync(j types.SyncJob) {
@@ -34,50 +34,47 @@ func Sync(j types.SyncJob) {
 		"Name":   j.Job.Name,
 	}).Infoln("Started system job")
 
-	// Start SSH agent
-	agent, socket, pid, cleanup := ssh.StartAgent()
-
-	if len(j.SCM.SSHKeyData) > 0 {
-		if len(j.SCM.SSHKeyUnlock) > 0 {
-			key, err := ssh.GetKey(util.Decipher(j.SCM.SSHKeyData), util.Decipher(j.SCM.SSHKeyUnlock))
-			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"Error": err.Error(),
-				}).Errorln("Error while decrypting Credential")
-				j.Job.JobExplanation = err.Error()
-				jobFail(j)
-				return
-			}
-			if agent.Add(key); err != nil {
-				logrus.WithFields(logrus.Fields{
-					"Error": err.Error(),
-				}).Errorln("Error while adding decrypted Key")
-				j.Job.JobExplanation = err.Error()
-				jobFail(j)
-				return
-			}
-		}
+	// resolve credential fields kept in external secret stores
+	if err := secrets.Resolve(&j.SCM, &j.Galaxy); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Error while resolving credential lookups")
+		j.Job.JobExplanation = err.Error()
+		jobFail(j)
+		return
+	}
 
-		key, err := ssh.GetKey(util.Decipher(j.SCM.SSHKeyData), nil)
+	// decrypted secrets of the update are masked in its output, arguments and server logs
+	j.Redactor = redact.New()
+	defer j.Redactor.Close()
+	j.Redactor.AddCredential(j.SCM)
+	j.Redactor.AddCredential(j.Galaxy)
 
-		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"Error": err.Error(),
-			}).Errorln("Error while decrypting Credential")
-			j.Job.JobExplanation = err.Error()
-			jobFail(j)
-			return
-		}
+	// Start SSH agent
+	client, socket, pid, cleanup := ssh.StartAgent()
 
-		if agent.Add(key); err != nil {
+	if len(j.SCM.SSHKeyData) > 0 {
+		if err := ssh.AddKey(client, util.Decipher(j.SCM.SSHKeyData), util.Decipher(j.SCM.SSHKeyUnlock)); err != nil {
 			logrus.WithFields(logrus.Fields{
 				"Error": err.Error(),
 			}).Errorln("Error while adding decrypted Key to SSH Agent")
 			j.Job.JobExplanation = err.Error()
 			jobFail(j)
+			cleanup()
 			return
 		}
+	}
 
+	// credential files are kept out of the project checkout
+	credentialPath, err := ioutil.TempDir("", "tensor_sync")
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Unable to create credential directory")
+		j.Job.JobExplanation = err.Error()
+		jobFail(j)
+		cleanup()
+		return
 	}
 
 	defer func() {
@@ -87,128 +84,169 @@ func Sync(j types.SyncJob) {
 		}).Infoln("Stopped running update system jobs")
 		// cleanup the mess
 		cleanup()
+		os.RemoveAll(credentialPath)
 	}()
 
-	cmd, err := getCmd(&j, socket, pid)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(util.Config.SyncJobTimeOut)*time.Second)
+	defer cancel()
 
+	u := &scmUpdate{ctx: ctx, dir: path.Join(util.Config.ProjectsHome, j.ProjectID.Hex()), redactor: j.Redactor}
+	if len(j.Job.Toolchain) > 0 {
+		toolchain, err := util.FindToolchain(j.Job.Toolchain, j.Project.ToolchainKind())
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err.Error(),
+			}).Errorln("Unable to find the project toolchain")
+			j.Job.JobExplanation = err.Error()
+			jobFail(j)
+			return
+		}
+		u.bin = toolchain.Path
+	}
+	err = scmEnv(u, j.Project, j.SCM, credentialPath, socket, pid)
+	if err == nil {
+		err = galaxyEnv(u, j.Galaxy, credentialPath)
+	}
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
-		}).Errorln("Running Project update task failed")
+		}).Errorln("Unable to write SCM or Galaxy credential")
 		j.Job.JobExplanation = err.Error()
 		jobFail(j)
 		return
 	}
 
-	var b bytes.Buffer
-	cmd.Stdout = &b
-	cmd.Stderr = &b
-
-	// Set setsid to create a new session, The new process group has no controlling
-	// terminal which disables the stdin & will skip prompts
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	// set job arguments, exclude unencrypted passwords etc.
+	j.Job.JobCWD = u.dir
+	j.Job.JobENV = u.env
+
+	revision, err := updateSCM(u, j.Project, j.SCM)
+	if err == nil {
+		// content of manual projects is cached by the revision of the uploaded archive
+		cacheKey := revision
+		if len(cacheKey) == 0 {
+			cacheKey = j.Project.ScmRevision
+		}
+		err = installGalaxy(u, j.Project, cacheKey)
+		if err == nil {
+			err = prepareTerraform(u, j.Project, cacheKey)
+		}
+	}
+	j.Job.JobARGS = u.args
+	j.Job.ResultStdout = u.output.String()
 
-	if err := cmd.Start(); err != nil {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
 		logrus.WithFields(logrus.Fields{
-			"Error": err.Error(),
-		}).Errorln("Running Project update task failed")
-		j.Job.ResultStdout = string(b.Bytes())
-		j.Job.JobExplanation = err.Error()
-		jobFail(j)
+			"Job ID": j.Job.ID.Hex(),
+		}).Errorln("Killed the project update, execution exceeded threshold value")
+		j.Job.JobExplanation = "Project update exceeded the timeout of " +
+			(time.Duration(util.Config.SyncJobTimeOut) * time.Second).String()
+		jobTimeout(j)
 		return
 	}
-
-	var timer *time.Timer
-	timer = time.AfterFunc(time.Duration(util.Config.SyncJobTimeOut) * time.Second, func() {
-		logrus.Println("Killing the process. Execution exceeded threashold value")
-		cmd.Process.Kill()
-	})
-
-	if err := cmd.Wait(); err != nil {
+	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
 		}).Errorln("Running Project update task failed")
-		j.Job.ResultStdout = string(b.Bytes())
 		j.Job.JobExplanation = err.Error()
 		jobFail(j)
 		return
 	}
 
-	timer.Stop()
-
-	// set stdout
-	j.Job.ResultStdout = string(b.Bytes())
+	j.Job.ScmRevision = revision
 	//success
 	jobSuccess(j)
 }
 
-func getCmd(j *types.SyncJob, socket string, pid int) (*exec.Cmd, error) {
+func createJobDirs(j types.SyncJob) {
+	if err := os.MkdirAll(util.Config.ProjectsHome + "/" + j.Job.ProjectID.Hex(), 0770); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Dir":   util.Config.ProjectsHome + "/" + j.Job.ProjectID.Hex(),
+			"Error": err.Error(),
+		}).Errorln("Unable to create directory: ")
+	}
+}
+
+// UpdateProject will create and start a update system job
+// which clones or updates the project repository.
+// When an update of the project is running, it started before this request and may miss its changes.
+// A follow-up update is created instead which starts once the running update finishes, requests
+// made before the follow-up starts share it
+func UpdateProject(p common.Project) (*types.SyncJob, error) {
+	runnerJob := newUpdateJob(p, bson.NewObjectId())
+	job := runnerJob.Job
+	if err := updateCredentials(&runnerJob); err != nil {
+		return nil, err
+	}
 
-	vars, err := json.Marshal(j.Job.ExtraVars)
+	jobBytes, err := json.Marshal(runnerJob)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
-		}).Errorln("Could not marshal extra vars")
+		}).Errorln("Unable to marshal Job")
+		return nil, err
 	}
-	// ansible-playbook parameters
-	arguments := []string{"-i", "localhost,", "-v", "-e", string(vars), j.Job.Playbook}
 
-	// set job arguments, exclude unencrypted passwords etc.
-	j.Job.JobARGS = []string{"ansible-playbook", strings.Join(arguments, " ")}
-
-	cmd := exec.Command("ansible-playbook", arguments...)
-	cmd.Dir = "/var/lib/tensor/playbooks/"
-
-	cmd.Env = []string{
-		"TERM=xterm",
-		"PROJECT_PATH=" + path.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
-		"HOME_PATH=" + path.Join(util.Config.ProjectsHome, "/"),
-		"PWD=" + path.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
-		"SHLVL=1",
-		"HOME=" + os.Getenv("HOME"),
-		"_=/usr/bin/tensord",
-		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
-		"ANSIBLE_PARAMIKO_RECORD_HOST_KEYS=False",
-		"ANSIBLE_CALLBACK_PLUGINS=/var/lib/tensor/plugins/callback",
-		"ANSIBLE_HOST_KEY_CHECKING=False",
-		"JOB_ID=" + j.Job.ID.Hex(),
-		"ANSIBLE_FORCE_COLOR=True",
-		"SSH_AUTH_SOCK=" + socket,
-		"SSH_AGENT_PID=" + strconv.Itoa(pid),
-	}
-
-	j.Job.JobENV = cmd.Env
-
-	return cmd, nil
-}
+	// Insert new job into jobs collection
+	if err := db.Jobs().Insert(job); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Error while creating update Job")
+		return nil, errors.New("Error while creating update Job")
+	}
 
-func createJobDirs(j types.SyncJob) {
-	if err := os.MkdirAll(util.Config.ProjectsHome + "/" + j.Job.ProjectID.Hex(), 0770); err != nil {
+	current, err := claimUpdate(p.ID, job.ID)
+	var next *ansible.Job
+	if err == nil && current != nil {
+		next, err = claimNextUpdate(p.ID, job.ID)
+	}
+	if err != nil || next != nil {
+		// the job is never queued
+		if err := db.Jobs().RemoveId(job.ID); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Job ID": job.ID.Hex(),
+				"Error":  err.Error(),
+			}).Errorln("Error while removing update Job")
+		}
+	}
+	if err != nil {
 		logrus.WithFields(logrus.Fields{
-			"Dir":   util.Config.ProjectsHome + "/" + j.Job.ProjectID.Hex(),
 			"Error": err.Error(),
-		}).Errorln("Unable to create directory: ")
+		}).Errorln("Error while claiming project update")
+		return nil, errors.New("Error while creating update Job")
 	}
+	if next != nil {
+		return &types.SyncJob{Job: *next, ProjectID: p.ID, Project: p}, nil
+	}
+	// queued by startNextUpdate once the running update finishes
+	if current != nil {
+		return &runnerJob, nil
+	}
+
+	// Add the job to queue
+	jobQueue := queue.OpenAnsibleQueue()
+	jobQueue.PublishBytes(jobBytes)
+
+	return &runnerJob, nil
 }
 
-// UpdateProject will create and start a update system job
-// using ansible playbook project_update.yml
-func UpdateProject(p common.Project) (*types.SyncJob, error) {
+// newUpdateJob returns the update job of project p with the given id
+func newUpdateJob(p common.Project, id bson.ObjectId) types.SyncJob {
 	job := ansible.Job{
-		ID:           bson.NewObjectId(),
+		ID:           id,
 		Name:         p.Name + " update Job",
 		Description:  "Updates " + p.Name + " Project",
 		LaunchType:   ansible.JOB_LAUNCH_TYPE_MANUAL,
 		CancelFlag:   false,
 		Status:       "pending",
 		JobType:      ansible.JOBTYPE_UPDATE_JOB,
-		Playbook:     "project_update.yml",
 		Verbosity:    0,
 		ProjectID:    p.ID,
 		Created:      time.Now(),
 		Modified:     time.Now(),
 		CreatedByID:  p.CreatedByID,
 		ModifiedByID: p.ModifiedByID,
+		Toolchain:    p.Toolchain,
 	}
 
 	if p.ScmCredentialID != nil {
@@ -222,6 +260,9 @@ func UpdateProject(p common.Project) (*types.SyncJob, error) {
 		"scm_clean":            p.ScmClean,
 		"scm_url":              p.ScmURL,
 		"scm_delete_on_update": p.ScmDeleteOnUpdate,
+		"scm_refspec":          p.ScmRefspec,
+		"scm_submodules":       p.ScmSubmodules,
+		"scm_clone_depth":      p.ScmCloneDepth,
 		"scm_accept_hostkey":   true,
 	}
 
@@ -229,43 +270,231 @@ func UpdateProject(p common.Project) (*types.SyncJob, error) {
 		extras["scm_branch"] = "HEAD"
 	}
 
-	job.ExtraVars = extras
-
-	// Insert new job into jobs collection
-	if err := db.Jobs().Insert(job); err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Error": err.Error(),
-		}).Errorln("Error while creating update Job")
-		return nil, errors.New("Error while creating update Job")
-	}
+	// strings, booleans and numbers are always written as JSON
+	job.ExtraVars, _ = common.NewVars(extras)
 
 	// create new background job
-	runnerJob := types.SyncJob{
-		Job:     job,
-		Project: p,
+	return types.SyncJob{
+		Job:       job,
+		ProjectID: p.ID,
+		Project:   p,
 	}
+}
 
-	if job.SCMCredentialID != nil {
+// updateCredentials sets the SCM and Galaxy credentials of the project to the update job
+func updateCredentials(runnerJob *types.SyncJob) error {
+	if runnerJob.Job.SCMCredentialID != nil {
 		var credential common.Credential
-		if err := db.Credentials().FindId(*job.SCMCredentialID).One(&credential); err != nil {
+		if err := db.Credentials().FindId(*runnerJob.Job.SCMCredentialID).One(&credential); err != nil {
 			logrus.WithFields(logrus.Fields{
 				"Error": err.Error(),
 			}).Errorln("Error while getting SCM Credential")
-			return nil, errors.New("Error while getting SCM Credential")
+			return errors.New("Error while getting SCM Credential")
 		}
 		runnerJob.SCM = credential
 	}
 
-	// Add the job to queue
-	jobQueue := queue.OpenAnsibleQueue()
+	if runnerJob.Project.GalaxyCredentialID != nil {
+		var credential common.Credential
+		if err := db.Credentials().FindId(*runnerJob.Project.GalaxyCredentialID).One(&credential); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err.Error(),
+			}).Errorln("Error while getting Galaxy Credential")
+			return errors.New("Error while getting Galaxy Credential")
+		}
+		runnerJob.Galaxy = credential
+	}
+	return nil
+}
+
+// UpdateOnLaunch returns the update job a job launched from project p waits for, or nil when the job
+// can run right away. Projects are updated when the checkout is missing or ScmUpdateOnLaunch is set,
+// unless the last update succeeded within ScmUpdateCacheTimeout seconds.
+// Launched jobs share a follow-up or running update and wait for it even when no update is requested
+func UpdateOnLaunch(p common.Project) (*types.SyncJob, error) {
+	if p.ScmUpdateNextID != nil {
+		var job ansible.Job
+		err := db.Jobs().FindId(*p.ScmUpdateNextID).One(&job)
+		if err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+		if err == nil && job.Status == "pending" {
+			return &types.SyncJob{Job: job, ProjectID: p.ID, Project: p}, nil
+		}
+	}
+
+	if p.ScmUpdateJobID != nil {
+		var job ansible.Job
+		err := db.Jobs().FindId(*p.ScmUpdateJobID).One(&job)
+		if err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+		if err == nil && running(job) {
+			return &types.SyncJob{Job: job, ProjectID: p.ID, Project: p}, nil
+		}
+	}
+
+	if _, err := os.Stat(p.LocalPath); err == nil {
+		if !p.ScmUpdateOnLaunch {
+			return nil, nil
+		}
+		if p.ScmUpdateCacheTimeout > 0 && p.LastUpdated != nil && !p.LastUpdateFailed &&
+			time.Since(*p.LastUpdated) < time.Duration(p.ScmUpdateCacheTimeout)*time.Second {
+			return nil, nil
+		}
+	}
+
+	return UpdateProject(p)
+}
+
+// claimUpdate marks jobID as the running update of the project. The running update job holding the
+// claim is returned instead, claims of finished or expired update jobs are taken over
+func claimUpdate(projectID bson.ObjectId, jobID bson.ObjectId) (*ansible.Job, error) {
+	change := mgo.Change{Update: bson.M{"$set": bson.M{"scm_update_job_id": jobID}}}
+	query := bson.M{"_id": projectID, "scm_update_job_id": bson.M{"$exists": false}}
+	for {
+		_, err := db.Projects().Find(query).Apply(change, nil)
+		if err == nil {
+			return nil, nil
+		}
+		if err != mgo.ErrNotFound {
+			return nil, err
+		}
+
+		var project common.Project
+		if err := db.Projects().FindId(projectID).One(&project); err != nil {
+			return nil, err
+		}
+		if project.ScmUpdateJobID == nil {
+			// released meanwhile
+			query = bson.M{"_id": projectID, "scm_update_job_id": bson.M{"$exists": false}}
+			continue
+		}
+
+		var job ansible.Job
+		err = db.Jobs().FindId(*project.ScmUpdateJobID).One(&job)
+		if err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+		if err == nil && running(job) {
+			return &job, nil
+		}
+		query = bson.M{"_id": projectID, "scm_update_job_id": *project.ScmUpdateJobID}
+	}
+}
+
+// claimNextUpdate marks jobID as the follow-up update of the project. A follow-up update job which has
+// not started yet is returned instead, follow-ups which already started or were removed are taken over
+func claimNextUpdate(projectID bson.ObjectId, jobID bson.ObjectId) (*ansible.Job, error) {
+	change := mgo.Change{Update: bson.M{"$set": bson.M{"scm_update_next_id": jobID}}}
+	query := bson.M{"_id": projectID, "scm_update_next_id": bson.M{"$exists": false}}
+	for {
+		_, err := db.Projects().Find(query).Apply(change, nil)
+		if err == nil {
+			// the running update may have finished before the follow-up was claimed
+			return nil, startNextUpdate(projectID)
+		}
+		if err != mgo.ErrNotFound {
+			return nil, err
+		}
+
+		var project common.Project
+		if err := db.Projects().FindId(projectID).One(&project); err != nil {
+			return nil, err
+		}
+		if project.ScmUpdateNextID == nil {
+			// started meanwhile
+			query = bson.M{"_id": projectID, "scm_update_next_id": bson.M{"$exists": false}}
+			continue
+		}
+
+		var job ansible.Job
+		err = db.Jobs().FindId(*project.ScmUpdateNextID).One(&job)
+		if err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+		if err == nil && job.Status == "pending" {
+			return &job, nil
+		}
+		query = bson.M{"_id": projectID, "scm_update_next_id": *project.ScmUpdateNextID}
+	}
+}
+
+// startNextUpdate queues the follow-up update of the project unless an update is running.
+// The follow-up becomes the running update of the project
+func startNextUpdate(projectID bson.ObjectId) error {
+	for {
+		var project common.Project
+		if err := db.Projects().FindId(projectID).One(&project); err != nil {
+			return err
+		}
+		if project.ScmUpdateNextID == nil {
+			return nil
+		}
+
+		query := bson.M{"_id": projectID, "scm_update_next_id": *project.ScmUpdateNextID}
+		if project.ScmUpdateJobID != nil {
+			var current ansible.Job
+			err := db.Jobs().FindId(*project.ScmUpdateJobID).One(&current)
+			if err != nil && err != mgo.ErrNotFound {
+				return err
+			}
+			// the running update starts the follow-up once it finishes
+			if err == nil && running(current) {
+				return nil
+			}
+			query["scm_update_job_id"] = *project.ScmUpdateJobID
+		} else {
+			query["scm_update_job_id"] = bson.M{"$exists": false}
+		}
+
+		change := bson.M{
+			"$set":   bson.M{"scm_update_job_id": *project.ScmUpdateNextID},
+			"$unset": bson.M{"scm_update_next_id": ""},
+		}
+		if err := db.Projects().Update(query, change); err == mgo.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		return queueNextUpdate(project, *project.ScmUpdateNextID)
+	}
+}
+
+// queueNextUpdate adds the follow-up update job to the queue. The job counts as created when it is
+// queued, running updates expire after the sync job timeout
+func queueNextUpdate(p common.Project, jobID bson.ObjectId) error {
+	var job ansible.Job
+	if err := db.Jobs().FindId(jobID).One(&job); err != nil {
+		return err
+	}
+	job.Created = time.Now()
+	if err := db.Jobs().UpdateId(jobID, bson.M{"$set": bson.M{"created": job.Created}}); err != nil {
+		return err
+	}
+
+	runnerJob := types.SyncJob{Job: job, ProjectID: p.ID, Project: p}
+	if err := updateCredentials(&runnerJob); err != nil {
+		runnerJob.Job.JobExplanation = err.Error()
+		jobFail(runnerJob)
+		return nil
+	}
+
 	jobBytes, err := json.Marshal(runnerJob)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Error": err.Error(),
-		}).Errorln("Unable to marshal Job")
-		return nil, err
+		runnerJob.Job.JobExplanation = err.Error()
+		jobFail(runnerJob)
+		return nil
 	}
-	jobQueue.PublishBytes(jobBytes)
+	queue.OpenAnsibleQueue().PublishBytes(jobBytes)
+	return nil
+}
 
-	return &runnerJob, nil
+// running reports whether the update job is still in progress. Jobs older than the sync job timeout
+// are treated as finished, their runner is gone
+func running(job ansible.Job) bool {
+	if finished(job.Status) {
+		return false
+	}
+	return time.Since(job.Created) < time.Duration(util.Config.SyncJobTimeOut)*time.Second
 }
@@ -0,0 +1,44 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestRunning(t *testing.T) {
+	assert := assert.New(t)
+	util.Config.SyncJobTimeOut = 3600
+
+	assert.True(running(ansible.Job{Status: "pending", Created: time.Now()}))
+	assert.True(running(ansible.Job{Status: "running", Created: time.Now()}))
+	assert.False(running(ansible.Job{Status: "successful", Created: time.Now()}))
+	assert.False(running(ansible.Job{Status: "canceled", Created: time.Now()}))
+
+	// runners of expired jobs are gone
+	assert.False(running(ansible.Job{Status: "running", Created: time.Now().Add(-2 * time.Hour)}))
+}
+
+func TestUnwait(t *testing.T) {
+	assert := assert.New(t)
+	jobID := bson.NewObjectId()
+	first, second := make(chan struct{}), make(chan struct{})
+	waiters[jobID] = []chan struct{}{first, second}
+
+	unwait(jobID, first)
+	assert.Equal([]chan struct{}{second}, waiters[jobID])
+	unwait(jobID, second)
+	assert.NotContains(waiters, jobID)
+
+	// woken jobs are already removed
+	waiters[jobID] = []chan struct{}{first}
+	wake(jobID)
+	unwait(jobID, first)
+	assert.NotContains(waiters, jobID)
+	_, open := <-first
+	assert.False(open)
+}
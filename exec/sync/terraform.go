@@ -0,0 +1,106 @@
+package sync
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pearsonappeng/tensor/models/common"
+)
+
+// TerraformDir returns the directory holding modules downloaded for a terraform project.
+// Modules of the current revision are linked as current
+func TerraformDir(p common.Project) string {
+	return p.LocalPath + ".terraform"
+}
+
+// TerraformModules returns the module directory prepared for the configuration in directory dir
+// of project p. An empty string is returned when modules of the current revision are not cached.
+// Links are resolved, a job keeps using the same modules when the project is updated
+func TerraformModules(p common.Project, dir string) string {
+	modules, err := filepath.EvalSymlinks(filepath.Join(TerraformDir(p), "current", moduleCacheName(dir), "modules"))
+	if err != nil {
+		return ""
+	}
+	return modules
+}
+
+// moduleCacheName returns the name of the terraform data directory of configuration directory dir
+func moduleCacheName(dir string) string {
+	dir = filepath.Clean(dir)
+	if dir == "." {
+		return "root"
+	}
+	return "dir-" + url.PathEscape(filepath.ToSlash(dir))
+}
+
+// prepareTerraform downloads modules of every configuration in the checkout of a terraform project.
+// Modules are downloaded once for each revision and are read only, jobs share them.
+// Checkouts without a revision are not cached, their jobs download modules themselves
+func prepareTerraform(u *scmUpdate, p common.Project, revision string) error {
+	if p.Kind != "terraform" {
+		return nil
+	}
+
+	cache := TerraformDir(p)
+	dirs, err := terraformDirs(u.dir)
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 || len(revision) == 0 {
+		// modules of previous revisions must not be used by jobs
+		return RemoveAll(cache)
+	}
+
+	return updateCache(u, cache, revision, true, func(staging string) error {
+		env := u.env
+		defer func() { u.env = env }()
+
+		for _, dir := range dirs {
+			u.env = append(append([]string{}, env...), "TF_DATA_DIR="+filepath.Join(staging, moduleCacheName(dir)))
+			args := []string{"get"}
+			if dir != "." {
+				args = append(args, dir)
+			}
+			if _, err := u.run("terraform", args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// terraformDirs returns directories of the checkout, relative to the checkout, which contain
+// terraform configuration files in lexical order. Hidden directories are skipped
+func terraformDirs(root string) ([]string, error) {
+	var dirs []string
+	seen := map[string]bool{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".tf") && !strings.HasSuffix(path, ".tf.json") {
+			return nil
+		}
+
+		dir, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+		return nil
+	})
+	sort.Strings(dirs)
+	return dirs, err
+}
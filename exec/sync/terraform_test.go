@@ -0,0 +1,85 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTerraform is a terraform stand-in which creates the module directory of TF_DATA_DIR
+const fakeTerraform = `#!/bin/sh
+mkdir -p "$TF_DATA_DIR/modules" && touch "$TF_DATA_DIR/modules/installed"
+`
+
+func TestPrepareTerraform(t *testing.T) {
+	assert := assert.New(t)
+
+	tmp, err := ioutil.TempDir("", "tensor_terraform")
+	assert.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	bin := filepath.Join(tmp, "bin")
+	assert.NoError(os.Mkdir(bin, 0755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(bin, "terraform"), []byte(fakeTerraform), 0755))
+	// commands are looked up in the path of tensord
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+	p := common.Project{Kind: "terraform", LocalPath: filepath.Join(tmp, "project")}
+	defer RemoveAll(TerraformDir(p))
+	assert.NoError(os.MkdirAll(filepath.Join(p.LocalPath, "env", "prod"), 0755))
+	assert.NoError(os.MkdirAll(filepath.Join(p.LocalPath, ".terraform"), 0755))
+	for _, file := range []string{"main.tf", "outputs.tf", "env/prod/main.tf.json", ".terraform/ignored.tf"} {
+		assert.NoError(ioutil.WriteFile(filepath.Join(p.LocalPath, file), []byte("{}"), 0644))
+	}
+
+	// ansible projects are not prepared
+	u := newUpdate(p.LocalPath)
+	assert.NoError(prepareTerraform(u, common.Project{Kind: "ansible", LocalPath: p.LocalPath}, "r1"))
+	assert.Empty(u.args)
+
+	u = newUpdate(p.LocalPath)
+	assert.NoError(prepareTerraform(u, p, "r1"))
+	assert.Equal([]string{"terraform get", "terraform get env/prod"}, u.args)
+	for _, dir := range []string{"", ".", "env/prod"} {
+		modules := TerraformModules(p, dir)
+		assert.True(exists(filepath.Join(modules, "installed")), dir)
+		// jobs must not modify the cache
+		info, err := os.Stat(modules)
+		assert.NoError(err)
+		assert.Zero(info.Mode().Perm()&0222, dir)
+	}
+	assert.Empty(TerraformModules(p, "env"))
+
+	// modules are downloaded once per revision
+	u = newUpdate(p.LocalPath)
+	assert.NoError(prepareTerraform(u, p, "r1"))
+	assert.Empty(u.args)
+
+	// the previous revision is kept for running jobs
+	modules := TerraformModules(p, "")
+	assert.NoError(prepareTerraform(newUpdate(p.LocalPath), p, "r2"))
+	assert.NoError(prepareTerraform(newUpdate(p.LocalPath), p, "r3"))
+	assert.False(exists(modules))
+	assert.True(exists(filepath.Join(TerraformDir(p), "r2")))
+
+	// checkouts without a revision are not cached
+	assert.NoError(prepareTerraform(newUpdate(p.LocalPath), p, ""))
+	assert.False(exists(TerraformDir(p)))
+	assert.Empty(TerraformModules(p, ""))
+
+	// terraform of the project toolchain takes precedence
+	toolchain := filepath.Join(tmp, "toolchain")
+	assert.NoError(os.Mkdir(toolchain, 0755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(toolchain, "terraform"),
+		[]byte(strings.Replace(fakeTerraform, "installed", "toolchain", 1)), 0755))
+	u = newUpdate(p.LocalPath)
+	u.bin = toolchain
+	assert.NoError(prepareTerraform(u, p, "r4"))
+	assert.True(exists(filepath.Join(TerraformModules(p, ""), "toolchain")))
+}
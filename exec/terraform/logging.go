@@ -46,7 +46,16 @@ func status(t *types.TerraformJob, s string) {
 	}
 }
 
+// redacted masks decrypted secrets of the job before it is persisted
+func redacted(t *types.TerraformJob) {
+	t.Job.ResultStdout = t.Redactor.String(t.Job.ResultStdout)
+	t.Job.JobExplanation = t.Redactor.String(t.Job.JobExplanation)
+	t.Job.JobARGS = t.Redactor.Strings(t.Job.JobARGS)
+	t.Job.JobENV = t.Redactor.Strings(t.Job.JobENV)
+}
+
 func jobFail(t *types.TerraformJob) {
+	redacted(t)
 	t.Job.Status = "failed"
 	t.Job.Finished = time.Now()
 	t.Job.Failed = true
@@ -80,6 +89,7 @@ func jobFail(t *types.TerraformJob) {
 }
 
 func jobCancel(t *types.TerraformJob) {
+	redacted(t)
 	t.Job.Status = "canceled"
 	t.Job.Finished = time.Now()
 	t.Job.Failed = false
@@ -114,6 +124,7 @@ func jobCancel(t *types.TerraformJob) {
 }
 
 func jobError(t *types.TerraformJob) {
+	redacted(t)
 	t.Job.Status = "error"
 	t.Job.Finished = time.Now()
 	t.Job.Failed = true
@@ -146,7 +157,44 @@ func jobError(t *types.TerraformJob) {
 	updateJobTemplate(t)
 }
 
+// jobTimeout marks a job killed by the job timeout or the idle timeout,
+// the explanation of the job tells which timeout expired
+func jobTimeout(t *types.TerraformJob) {
+	redacted(t)
+	t.Job.Status = "timeout"
+	t.Job.Finished = time.Now()
+	t.Job.Failed = true
+
+	//get elapsed time in minutes
+	diff := t.Job.Finished.Sub(t.Job.Started)
+
+	d := bson.M{
+		"$set": bson.M{
+			"status":          t.Job.Status,
+			"failed":          t.Job.Failed,
+			"finished":        t.Job.Finished,
+			"elapsed":         diff.Minutes(),
+			"result_stdout":   t.Job.ResultStdout,
+			"job_explanation": t.Job.JobExplanation,
+			"job_args":        t.Job.JobARGS,
+			"job_env":         t.Job.JobENV,
+			"job_cwd":         t.Job.JobCWD,
+		},
+	}
+
+	if err := db.TerrafromJobs().UpdateId(t.Job.ID, d); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Status": t.Job.Status,
+			"Error":  err,
+		}).Errorln("Failed to update job status")
+	}
+
+	updateProject(t)
+	updateJobTemplate(t)
+}
+
 func jobSuccess(t *types.TerraformJob) {
+	redacted(t)
 	t.Job.Status = "successful"
 	t.Job.Finished = time.Now()
 	t.Job.Failed = false
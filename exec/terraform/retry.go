@@ -0,0 +1,83 @@
+package terraform
+
+import (
+	"encoding/json"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/misc"
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/queue"
+)
+
+// retry relaunches job j, which failed for reason, when the retry policy of its template allows it.
+// The new job is created right away, its runner job is scheduled to be queued once the backoff elapsed
+func retry(j types.TerraformJob, reason string) {
+	if !misc.Retry(j.Job.RetryCount, j.Job.RetryAttempt, j.Job.RetryOn, reason) {
+		return
+	}
+
+	job := j.Job
+	job.ID = bson.NewObjectId()
+	job.Status = "pending"
+	job.Failed = false
+	job.Started = time.Time{}
+	job.Finished = time.Time{}
+	job.Elapsed = 0
+	job.ResultStdout = ""
+	job.ResultGetStdout = ""
+	job.JobExplanation = ""
+	job.JobCWD = ""
+	job.JobARGS = nil
+	job.JobENV = nil
+	job.Created = time.Now()
+	job.Modified = time.Now()
+	job.RetryAttempt++
+	if job.RetryOfID == nil {
+		first := j.Job.ID
+		job.RetryOfID = &first
+	}
+
+	// the project was updated for the failed job, the token is issued once the backoff elapsed
+	j.Job = job
+	j.PreviousJob = nil
+	j.Paths = types.JobPaths{}
+	j.Token = ""
+
+	jobBytes, err := json.Marshal(j)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Terraform Job ID": job.RetryOfID.Hex(),
+			"Error":            err.Error(),
+		}).Errorln("Unable to marshal Job, job will not be retried")
+		return
+	}
+
+	if err := db.TerrafromJobs().Insert(job); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Terraform Job ID": job.RetryOfID.Hex(),
+			"Error":            err.Error(),
+		}).Errorln("Error while creating retry Job")
+		return
+	}
+
+	delay := misc.RetryDelay(job.RetryBackoff, job.RetryAttempt-1)
+	if err := misc.ScheduleRetry(job.ID, queue.TerraformQueue, delay, jobBytes); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Terraform Job ID": job.ID.Hex(),
+			"Error":            err.Error(),
+		}).Errorln("Error while scheduling retry Job")
+		j.Job.JobExplanation = "Unable to schedule the retry: " + err.Error()
+		jobError(&j)
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"Terraform Job ID": job.ID.Hex(),
+		"Attempt":          job.RetryAttempt,
+		"Delay":            delay.String(),
+	}).Infoln("Terraform Job failed, retrying")
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strconv"
@@ -13,12 +14,16 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gamunu/rmq"
-	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/isolation"
 	"github.com/pearsonappeng/tensor/exec/misc"
+	"github.com/pearsonappeng/tensor/exec/sync"
 	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/log/redact"
+	"github.com/pearsonappeng/tensor/models/common"
 
 	"github.com/adjust/uniuri"
 	"github.com/pearsonappeng/tensor/queue"
+	"github.com/pearsonappeng/tensor/secrets"
 	"github.com/pearsonappeng/tensor/ssh"
 	"github.com/pearsonappeng/tensor/util"
 	"path/filepath"
@@ -95,32 +100,22 @@ func terraformRun(j *types.TerraformJob) {
 			"Name":   j.Job.Name,
 		}).Infoln("Terraform Job changed status to waiting")
 
-		ticker := time.NewTicker(time.Second * 2)
-
-		for range ticker.C {
-			if err := db.Jobs().FindId(j.PreviousJob.Job.ID).One(&j.PreviousJob.Job); err != nil {
-				logrus.Warningln("Could not find Previous Job", err)
-				continue
-			}
-
-			if j.PreviousJob.Job.Status == "failed" || j.PreviousJob.Job.Status == "error" {
-				e := "Previous Task Failed: {\"job_type\": \"project_update\", \"job_name\": \"" + j.Job.Name + "\", \"job_id\": \"" + j.PreviousJob.Job.ID.Hex() + "\"}"
-				logrus.Errorln(e)
-				j.Job.JobExplanation = e
-				j.Job.ResultStdout = "stdout capture is missing"
-				jobError(j)
-				return
-			}
-			if j.PreviousJob.Job.Status == "successful" {
-				// stop the ticker and break the loop
-				logrus.WithFields(logrus.Fields{
-					"Job ID": j.PreviousJob.Job.ID.Hex(),
-					"Name":   j.PreviousJob.Job.Name,
-				}).Infoln("Update job successful")
-				ticker.Stop()
-				break
-			}
+		// resumes as soon as the update job finishes
+		update, err := sync.Wait(j.PreviousJob.Job.ID)
+		if err != nil || update.Status != "successful" {
+			e := "Previous Task Failed: {\"job_type\": \"project_update\", \"job_name\": \"" + j.Job.Name + "\", \"job_id\": \"" + j.PreviousJob.Job.ID.Hex() + "\"}"
+			logrus.Errorln(e)
+			j.Job.JobExplanation = e
+			j.Job.ResultStdout = "stdout capture is missing"
+			jobError(j)
+			return
 		}
+		j.PreviousJob.Job = update
+
+		logrus.WithFields(logrus.Fields{
+			"Job ID": update.ID.Hex(),
+			"Name":   update.Name,
+		}).Infoln("Update job successful")
 	}
 
 	start(j)
@@ -130,92 +125,67 @@ func terraformRun(j *types.TerraformJob) {
 		"Name":             j.Job.Name,
 	}).Infoln("Terraform Job started")
 
-	// Start SSH agent
-	client, socket, pid, sshcleanup := ssh.StartAgent()
-
-	if len(j.Machine.SSHKeyData) > 0 {
-		if len(j.Machine.SSHKeyUnlock) > 0 {
-			key, err := ssh.GetKey([]byte(util.Decipher(j.Machine.SSHKeyData)),
-				util.Decipher(j.Machine.SSHKeyUnlock))
-			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"Error": err.Error(),
-				}).Errorln("Error while decrypting Machine Credential")
-				j.Job.JobExplanation = err.Error()
-				jobFail(j)
-				return
-			}
-			if client.Add(key); err != nil {
-				logrus.WithFields(logrus.Fields{
-					"Error": err.Error(),
-				}).Errorln("Error while adding decrypted Machine Credential to SSH Agent")
-				j.Job.JobExplanation = err.Error()
-				jobFail(j)
-				return
-			}
+	// retries are queued as the job was received, credential lookups are resolved by every attempt
+	queued := *j
+	queued.Extras = append([]common.Credential{}, j.Extras...)
+	failure := misc.FailureError
+	defer func() {
+		if j.Job.Failed {
+			retry(queued, failure)
 		}
+	}()
 
-		key, err := ssh.GetKey([]byte(util.Decipher(j.Machine.SSHKeyData)), nil)
-		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"Error": err.Error(),
-			}).Errorln("Error while decrypting Machine Credential")
-			j.Job.JobExplanation = err.Error()
-			jobFail(j)
-			return
-		}
+	// the timeout of the template takes precedence over the terraform job timeout
+	timeout := time.Duration(util.Config.TerraformJobTimeOut) * time.Second
+	if j.Job.Timeout > 0 {
+		timeout = time.Duration(j.Job.Timeout) * time.Second
+	}
 
-		if client.Add(key); err != nil {
-			logrus.WithFields(logrus.Fields{
-				"Error": err.Error(),
-			}).Errorln("Error while adding decrypted Machine Credential to SSH Agent")
-			j.Job.JobExplanation = err.Error()
-			jobFail(j)
-			return
-		}
+	// resolve credential fields kept in external secret stores
+	credentials := []*common.Credential{&j.Machine, &j.Network, &j.Cloud, &j.SCM}
+	for i := range j.Extras {
+		credentials = append(credentials, &j.Extras[i])
+	}
+	if err := secrets.Resolve(credentials...); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Error while resolving credential lookups")
+		j.Job.JobExplanation = err.Error()
+		jobFail(j)
+		return
+	}
 
+	// decrypted secrets of the job are masked in its output, arguments, environment and server logs
+	j.Redactor = redact.New()
+	defer j.Redactor.Close()
+	for _, credential := range credentials {
+		j.Redactor.AddCredential(*credential)
+	}
+	j.Redactor.Add(j.Token)
+	for _, password := range j.SurveyPasswords {
+		j.Redactor.Add(string(util.Decipher(password)))
 	}
 
-	if len(j.Network.SSHKeyData) > 0 {
-		if len(j.Network.SSHKeyUnlock) > 0 {
-			key, err := ssh.GetKey(util.Decipher(j.Machine.SSHKeyData), util.Decipher(j.Network.SSHKeyUnlock))
-			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"Error": err.Error(),
-				}).Errorln("Error while decrypting Machine Credential")
-				j.Job.JobExplanation = err.Error()
-				jobFail(j)
-				return
-			}
-			if client.Add(key); err != nil {
-				logrus.WithFields(logrus.Fields{
-					"Error": err.Error(),
-				}).Errorln("Error while adding decrypted Machine Credential to SSH Agent")
-				j.Job.JobExplanation = err.Error()
-				jobFail(j)
-				return
-			}
-		}
+	// Start SSH agent
+	client, socket, pid, sshcleanup := ssh.StartAgent()
 
-		key, err := ssh.GetKey(util.Decipher(j.Machine.SSHKeyData), nil)
-		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"Error": err.Error(),
-			}).Errorln("Error while decyrpting Machine Credential")
-			j.Job.JobExplanation = err.Error()
-			jobFail(j)
-			return
+	// machine and network keys are added to the agent separately
+	for _, credential := range []common.Credential{j.Machine, j.Network} {
+		if len(credential.SSHKeyData) == 0 {
+			continue
 		}
-
-		if client.Add(key); err != nil {
+		// certificates are identified by the job and expire with the job timeout
+		keyID := "tensor-terraform-job-" + j.Job.ID.Hex() + "-" + j.User.Username
+		if err := misc.AddAgentKey(client, credential, keyID, timeout); err != nil {
 			logrus.WithFields(logrus.Fields{
-				"Error": err.Error(),
-			}).Errorln("Error while adding decyrpted Machine Credential to SSH Agent")
+				"Credential ID": credential.ID.Hex(),
+				"Error":         err.Error(),
+			}).Errorln("Error while adding decrypted " + credential.Name + " credential to SSH Agent")
 			j.Job.JobExplanation = err.Error()
 			jobFail(j)
+			sshcleanup()
 			return
 		}
-
 	}
 
 	cmd, getCmd, cleanup, err := getCmd(j, socket, pid)
@@ -238,49 +208,52 @@ func terraformRun(j *types.TerraformJob) {
 		sshcleanup()
 		cleanup()
 	}()
-	var b bytes.Buffer
-	cmd.Stdout = &b
-	cmd.Stderr = &b
+	// the timeouts cover terraform init, output resets the idle timeout
+	var b, getOutput bytes.Buffer
+	stdout, getStdout := j.Redactor.Writer(&b), j.Redactor.Writer(&getOutput)
+	watchdog := misc.NewWatchdog(timeout, time.Duration(j.Job.IdleTimeout)*time.Second)
+	output := io.MultiWriter(stdout, watchdog)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	getCmdOutput := io.MultiWriter(getStdout, watchdog)
+	getCmd.Stdout = getCmdOutput
+	getCmd.Stderr = getCmdOutput
 	// Set setsid to create a new session, The new process group has no controlling
 	// terminal which disables the stdin & will skip prompts
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 	getCmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 
-	getOutput, err := getCmd.CombinedOutput()
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Error": err.Error(),
-		}).Errorln("Running terraform " + j.Job.JobType + " failed")
-		j.Job.JobExplanation = "terraform get failed"
-		j.Job.ResultStdout = string(getOutput)
-		jobFail(j)
-		return
+	err = watchdog.Run(getCmd)
+	getStdout.Flush()
+	initFailed := err != nil
+	if !initFailed {
+		err = watchdog.Run(cmd)
+		stdout.Flush()
 	}
-
-	if err := cmd.Start(); err != nil {
+	if expired := watchdog.Stop(); len(expired) > 0 {
 		logrus.WithFields(logrus.Fields{
-			"Error": err.Error(),
-		}).Errorln("Running terraform " + j.Job.JobType + " failed")
-		j.Job.JobExplanation = err.Error()
-		j.Job.ResultStdout = string(b.Bytes())
-		jobFail(j)
+			"Terraform Job ID": j.Job.ID.Hex(),
+			"Reason":           expired,
+		}).Errorln("Killed the process, execution exceeded threshold value")
+		j.Job.JobExplanation = expired
+		j.Job.ResultStdout = getOutput.String() + b.String()
+		failure = misc.FailureTimeout
+		jobTimeout(j)
 		return
 	}
-	var timer *time.Timer
-	timer = time.AfterFunc(time.Duration(util.Config.TerraformJobTimeOut) * time.Second, func() {
-		logrus.Println("Killing the process. Execution exceeded threashold value")
-		cmd.Process.Kill()
-	})
-	if err := cmd.Wait(); err != nil {
+	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
 		}).Errorln("Running terraform " + j.Job.JobType + " failed")
 		j.Job.JobExplanation = err.Error()
 		j.Job.ResultStdout = string(b.Bytes())
+		if initFailed {
+			j.Job.JobExplanation = "terraform init failed"
+			j.Job.ResultStdout = getOutput.String()
+		}
 		jobFail(j)
 		return
 	}
-	timer.Stop()
 	// set stdout
 	j.Job.ResultStdout = string(b.Bytes())
 	//success
@@ -289,6 +262,11 @@ func terraformRun(j *types.TerraformJob) {
 
 // runPlaybook runs a Job using ansible-playbook command
 func getCmd(j *types.TerraformJob, socket string, pid int) (cmd *exec.Cmd, getCmd *exec.Cmd, cleanup func(), err error) {
+	// binaries of the selected toolchain come first on the PATH
+	toolchainPath, err := util.ToolchainPath(j.Job.Toolchain, "terraform")
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	// Generate directory paths and create directories
 	tmp := "/tmp/tensor_proot_" + uniuri.New() + "/"
 	j.Paths = types.JobPaths{
@@ -304,26 +282,42 @@ func getCmd(j *types.TerraformJob, socket string, pid int) (cmd *exec.Cmd, getCm
 	}
 	// create job directories
 	createTmpDirs(j)
-	// add proot and ansible parameters
-	args := []string{"-v", "0", "-r", "/",
-		"-b", j.Paths.Etc + ":/etc/tensor",
-		"-b", j.Paths.Tmp + ":/tmp",
-		"-b", j.Paths.VarLib + ":/var/lib/tensor",
-		"-b", j.Paths.VarLibProjects + ":" + util.Config.ProjectsHome,
-		"-b", j.Paths.VarLog + ":/var/log",
-		"-b", j.Paths.TmpRand + ":" + j.Paths.TmpRand,
-		"-b", filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()) + ":" + filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
-		"-b", "/var/lib/tensor:/var/lib/tensor",
-		"-w", filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
-	}
-
-	JobARGS := append(args, buildParams(j, []string{"terraform"})...)
-	j.Job.JobARGS = JobARGS
-	j.Job.JobARGS = []string{strings.Join(j.Job.JobARGS, " ")}
-	logrus.Infoln("Job Arguments", append([]string{}, j.Job.JobARGS...))
-	cmd = exec.Command("proot", JobARGS...)
-	cmd.Dir = filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex())
-	cmd.Env = []string{
+	// directories visible to the job
+	spec := isolation.Spec{
+		Name:    j.Job.ID.Hex(),
+		Binds:   misc.JobBinds(j.Paths, socket),
+		WorkDir: j.Paths.ProjectRoot,
+		Image:   misc.ExecutionImage(j.Job.ExecutionImage),
+	}
+
+	// providers are shared by all jobs through the plugin cache, jobs of air-gapped
+	// installations install them from the mirror only
+	pluginCache := util.Config.Terraform.PluginCacheDir
+	if err := os.MkdirAll(pluginCache, 0770); err != nil {
+		return nil, nil, nil, err
+	}
+	spec.Binds = append(spec.Binds, isolation.Bind{Source: pluginCache, Target: pluginCache})
+	mirror := util.Config.Terraform.ProviderMirror
+	if len(mirror) > 0 {
+		spec.Binds = append(spec.Binds, isolation.Bind{Source: mirror, Target: mirror, ReadOnly: true})
+	}
+
+	// every job has its own data directory, modules downloaded by the project update are
+	// linked into it. The module cache is read only by its permissions as well,
+	// proot binds are always writable
+	dataDir := filepath.Join(j.Paths.TmpRand, "terraform")
+	modules := sync.TerraformModules(j.Project, j.Job.Directory)
+	if len(modules) > 0 {
+		if err := os.MkdirAll(dataDir, 0770); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := os.Symlink(modules, filepath.Join(dataDir, "modules")); err != nil {
+			return nil, nil, nil, err
+		}
+		spec.Binds = append(spec.Binds, isolation.Bind{Source: modules, Target: modules, ReadOnly: true})
+	}
+
+	spec.Env = []string{
 		"PROJECT_PATH=" + filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
 		"HOME_PATH=" + util.Config.ProjectsHome,
 		"PWD=" + filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
@@ -331,12 +325,14 @@ func getCmd(j *types.TerraformJob, socket string, pid int) (cmd *exec.Cmd, getCm
 		"HOME=" + os.Getenv("HOME"),
 		"_=/usr/bin/tensord",
 		"PROOT_NO_SECCOMP=1",
-		"PATH=/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"PATH=" + toolchainPath,
 		"REST_API_TOKEN=" + j.Token,
 		"JOB_ID=" + j.Job.ID.Hex(),
 		"REST_API_URL=http://localhost" + util.Config.Port,
 		"SSH_AUTH_SOCK=" + socket,
 		"SSH_AGENT_PID=" + strconv.Itoa(pid),
+		"TF_DATA_DIR=" + dataDir,
+		"TF_PLUGIN_CACHE_DIR=" + pluginCache,
 	}
 	// Assign job env here to ensure that sensitive information will
 	// not be exposed
@@ -348,45 +344,74 @@ func getCmd(j *types.TerraformJob, socket string, pid int) (cmd *exec.Cmd, getCm
 		"HOME=" + os.Getenv("HOME"),
 		"PROOT_NO_SECCOMP=1",
 		"_=/usr/bin/tensord",
-		"PATH=/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"PATH=" + toolchainPath,
 		"REST_API_TOKEN=" + strings.Repeat("*", len(j.Token)),
 		"JOB_ID=" + j.Job.ID.Hex(),
 		"REST_API_URL=http://localhost" + util.Config.Port,
 		"SSH_AUTH_SOCK=" + socket,
 		"SSH_AGENT_PID=" + strconv.Itoa(pid),
+		"TF_DATA_DIR=" + dataDir,
+		"TF_PLUGIN_CACHE_DIR=" + pluginCache,
 	}
-	var f *os.File
-	if j.Cloud.Cloud {
-		cmd.Env, f, err = misc.GetCloudCredential(cmd.Env, j.Cloud)
-		if err != nil {
-			return nil, nil, nil, err
-		}
+	// cloud credentials add environment variables and files,
+	// extra variables are passed as terraform input variables
+	injection, err := misc.InjectCloudCredentials(append([]common.Credential{j.Cloud}, j.Extras...),
+		j.Paths.CredentialPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	spec.Env = append(spec.Env, injection.Env...)
+	for name, value := range injection.ExtraVars {
+		spec.Env = append(spec.Env, "TF_VAR_"+name+"="+value)
+	}
+	// answers to password questions of the survey are kept out of the variable file
+	for name, password := range j.SurveyPasswords {
+		spec.Env = append(spec.Env, "TF_VAR_"+name+"="+string(util.Decipher(password)))
 	}
 
-	// Issue a terraform get for all jobs
-	// and apply -update parameter if update on launch is true
-	tget := append(args, "terraform", "get")
-	if j.Job.UpdateOnLaunch {
-		tget = append(tget, "-update")
+	backend, err := misc.IsolationBackend()
+	if err != nil {
+		misc.RemoveFiles(injection.Files)
+		return nil, nil, nil, err
+	}
+	cmd, err = backend.Command(spec, buildParams(j, []string{"terraform"})...)
+	if err != nil {
+		misc.RemoveFiles(injection.Files)
+		return nil, nil, nil, err
+	}
+	j.Job.JobARGS = j.Redactor.Strings([]string{strings.Join(cmd.Args, " ")})
+	logrus.Infoln("Job Arguments", append([]string{}, j.Job.JobARGS...))
+
+	// Issue a terraform init for all jobs, cached modules are not downloaded again.
+	// Apply -upgrade parameter if update on launch is true and modules are not cached
+	tinit := []string{"terraform", "init", "-input=false"}
+	if len(mirror) > 0 {
+		tinit = append(tinit, "-plugin-dir=" + mirror)
+	}
+	if len(modules) > 0 {
+		tinit = append(tinit, "-get=false")
+	} else if j.Job.UpdateOnLaunch {
+		tinit = append(tinit, "-upgrade")
 	}
 	if len(j.Job.Directory) > 0 {
-		tget = append(tget, j.Job.Directory)
+		tinit = append(tinit, j.Job.Directory)
 	}
 
-	getCmd = exec.Command("proot", tget...)
-	getCmd.Env = cmd.Env
-	getCmd.Dir = cmd.Dir
+	getCmd, err = backend.Command(spec, tinit...)
+	if err != nil {
+		misc.RemoveFiles(injection.Files)
+		return nil, nil, nil, err
+	}
 
 	logrus.WithFields(logrus.Fields{
-		"Dir":         cmd.Dir,
-		"Environment": append([]string{}, cmd.Env...),
+		"Dir":         spec.WorkDir,
+		"Environment": j.Redactor.Strings(spec.Env),
 	}).Infoln("Job Directory and Environment")
 
 	return cmd, getCmd, func() {
-		if f != nil {
-			if err := os.RemoveAll(f.Name()); err != nil {
-				logrus.Errorln("Unable to remove cloud credential")
-			}
+		misc.RemoveFiles(injection.Files)
+		if err := backend.Remove(spec); err != nil {
+			logrus.Errorln("Unable to remove job containers")
 		}
 		if err := os.RemoveAll(tmp); err != nil {
 			logrus.Errorln("Unable to remove tmp directories")
@@ -427,8 +452,21 @@ func buildParams(j *types.TerraformJob, params []string) []string {
 	}
 
 	// extra variables -e EXTRA_VARS, --extra-vars=EXTRA_VARS
-	if len(j.Job.Vars) > 0 {
-		vars, err := hclencoder.Encode(j.Job.Vars)
+	// masked survey passwords are left out, they are passed by environment variables
+	parsed, err := j.Job.Vars.Map()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Errorln("Could not parse extra vars")
+	}
+	jobVars := map[string]interface{}{}
+	for name, value := range parsed {
+		if _, ok := j.SurveyPasswords[name]; !ok {
+			jobVars[name] = value
+		}
+	}
+	if len(jobVars) > 0 {
+		vars, err := hclencoder.Encode(jobVars)
 		if err != nil {
 			logrus.WithFields(logrus.Fields{
 				"Error": err,
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"github.com/pearsonappeng/tensor/log/redact"
 	"github.com/pearsonappeng/tensor/models/ansible"
 	"github.com/pearsonappeng/tensor/models/common"
 )
@@ -13,12 +14,18 @@ type AnsibleJob struct {
 	Network     common.Credential
 	SCM         common.Credential
 	Cloud       common.Credential
+	Extras      []common.Credential
+	Vaults      []common.Credential
 	Inventory   ansible.Inventory
 	Project     common.Project
 	User        common.User
 	PreviousJob *SyncJob
 	Token       string
 	Paths       JobPaths
+	// encrypted answers to password questions of the survey, job records hold them masked
+	SurveyPasswords map[string]string
+	// Redactor masks decrypted secrets of the running job
+	Redactor *redact.Redactor `json:"-"`
 }
 
 type JobPaths struct {
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"github.com/pearsonappeng/tensor/log/redact"
 	"github.com/pearsonappeng/tensor/models/ansible"
 	"github.com/pearsonappeng/tensor/models/common"
 	"gopkg.in/mgo.v2/bson"
@@ -12,8 +13,11 @@ type SyncJob struct {
 	ProjectID      bson.ObjectId
 	JobTemplateID  bson.ObjectId
 	SCM            common.Credential
+	Galaxy         common.Credential
 	Project        common.Project
 	User           common.User
 	Token          string
 	CredentialPath string // for system jobs
+	// Redactor masks decrypted secrets of the running job
+	Redactor *redact.Redactor `json:"-"`
 }
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/log/activity"
 	"github.com/pearsonappeng/tensor/util"
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/appleboy/gin-jwt.v2"
@@ -21,7 +22,7 @@ var HeaderAuthMiddleware *jwt.GinJWTMiddleware
 func init() {
 	HeaderAuthMiddleware = &jwt.GinJWTMiddleware{
 		Realm:      "api",
-		Key:        []byte(util.Config.Salt),
+		Key:        []byte(util.Config.JWTKey),
 		Timeout:    time.Minute * time.Duration(util.Config.JWTTimeout),
 		MaxRefresh: time.Minute * time.Duration(util.Config.JWTRefreshTimeout),
 		Authenticator: func(loginid string, password string, c *gin.Context) (string, bool) {
@@ -41,15 +42,42 @@ func init() {
 			var user common.User
 
 			if err := db.Users().Find(q).One(&user); err != nil {
-				logrus.Warningln("Auth: User not found", q)
+				logrus.Warningln("Auth: User not found", q, c.ClientIP())
+				activity.AddUnknownLoginActivity(login, c.ClientIP())
+				return "", false
+			}
+
+			if user.IsLocked() {
+				logrus.Warningln("Auth: Account locked", q, c.ClientIP())
+				activity.AddLoginActivity(activity.LoginFailed, user, c.ClientIP())
 				return "", false
 			}
 
 			if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
 				logrus.Warningln("Auth: PasswordHash mismach")
+				activity.AddLoginActivity(activity.LoginFailed, user, c.ClientIP())
+				locked, err := user.AddFailedLogin()
+				if err != nil {
+					logrus.WithFields(logrus.Fields{
+						"User ID": user.ID.Hex(),
+						"Error":   err.Error(),
+					}).Errorln("Auth: Failed to record failed login")
+				}
+				if locked {
+					logrus.Warningln("Auth: Account locked after failed logins", q)
+					activity.AddLoginActivity(activity.Lockout, user, c.ClientIP())
+				}
 				return "", false
 			}
 
+			if err := user.ResetFailedLogins(); err != nil {
+				logrus.WithFields(logrus.Fields{
+					"User ID": user.ID.Hex(),
+					"Error":   err.Error(),
+				}).Errorln("Auth: Failed to reset failed logins")
+			}
+			activity.AddLoginActivity(activity.Login, user, c.ClientIP())
+
 			return user.ID.Hex(), true
 
 		},
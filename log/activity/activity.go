@@ -18,6 +18,9 @@ const (
 	Delete = "delete"
 	Associate = "associate"
 	Disassociate = "disassociate"
+	Login = "login"
+	LoginFailed = "login_failed"
+	Lockout = "lockout"
 )
 
 
@@ -48,7 +51,7 @@ func AddActivity(operation string, userID bson.ObjectId, object1, object2 interf
 						if len(tag) > 0 && tag != "-" {
 							switch v1.Type().Field(i).Name {
 							case "SSHKeyData", "SSHKeyUnlock", "Password", "Secret", "AuthorizePassword",
-								"SecurityToken": {
+								"SecurityToken", "BecomePassword", "VaultPassword", "SecretInputs": {
 								changes[tag] = "$encrypted$"
 								break
 							}
@@ -69,4 +72,43 @@ func AddActivity(operation string, userID bson.ObjectId, object1, object2 interf
 			"Error": err.Error(),
 		}).Errorln("Failed to add new Activity")
 	}
-}
\ No newline at end of file
+}
+
+// AddLoginActivity records authentication attempts of a user
+// along with the address the request originated from
+func AddLoginActivity(operation string, user common.User, sourceIP string) {
+	stream := common.Activity{
+		ID:        bson.NewObjectId(),
+		Timestamp: time.Now(),
+		Operation: operation,
+		ActorID:   user.ID,
+		Object1ID: user.ID,
+		Object1:   user.GetType(),
+		SourceIP:  sourceIP,
+	}
+
+	if err := db.ActivityStream().Insert(stream); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Failed to add new Activity")
+	}
+}
+
+// AddUnknownLoginActivity records a failed authentication attempt for a login
+// that does not belong to any user, so guessing of usernames shows up in the activity stream
+func AddUnknownLoginActivity(login string, sourceIP string) {
+	stream := common.Activity{
+		ID:        bson.NewObjectId(),
+		Timestamp: time.Now(),
+		Operation: LoginFailed,
+		Object1:   common.User{}.GetType(),
+		Changes:   map[string]interface{}{"login": login},
+		SourceIP:  sourceIP,
+	}
+
+	if err := db.ActivityStream().Insert(stream); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Failed to add new Activity")
+	}
+}
@@ -0,0 +1,31 @@
+package redact
+
+import "github.com/Sirupsen/logrus"
+
+// Hook is a logrus hook which masks secrets of running jobs in log messages and fields
+type Hook struct{}
+
+// Levels returns all levels, every entry is masked
+func (Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire masks the message and the string, string list and error fields of entry
+func (Hook) Fire(entry *logrus.Entry) error {
+	entry.Message = String(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = String(v)
+		case []string:
+			masked := make([]string, len(v))
+			for i := range v {
+				masked[i] = String(v[i])
+			}
+			entry.Data[key] = masked
+		case error:
+			entry.Data[key] = String(v.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Package redact masks decrypted secrets of jobs in job output, arguments,
+// environment and server logs before they are persisted or logged
+package redact
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// Mask replaces secret values
+const Mask = "$encrypted$"
+
+// minLength is the length of the shortest secret which is masked,
+// masking shorter values would garble output
+const minLength = 4
+
+// open holds redactors of running jobs, server logs are masked with all of them
+var (
+	openMu sync.RWMutex
+	open   = map[*Redactor]struct{}{}
+)
+
+// Redactor masks the decrypted secrets used by a job.
+// A nil Redactor masks nothing
+type Redactor struct {
+	mu       sync.RWMutex
+	secrets  map[string]bool
+	replacer *strings.Replacer
+}
+
+// New returns a redactor which also masks server logs until it is closed
+func New() *Redactor {
+	r := &Redactor{secrets: map[string]bool{}}
+	openMu.Lock()
+	open[r] = struct{}{}
+	openMu.Unlock()
+	return r
+}
+
+// Close stops masking server logs with secrets of r
+func (r *Redactor) Close() {
+	if r == nil {
+		return
+	}
+	openMu.Lock()
+	delete(open, r)
+	openMu.Unlock()
+}
+
+// Add registers decrypted secret values. Lines of multi-line values, such as keys,
+// and values as they are encoded in JSON extra variables are registered too
+func (r *Redactor) Add(values ...string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, value := range values {
+		r.add(value)
+		if encoded, err := json.Marshal(value); err == nil {
+			r.add(strings.Trim(string(encoded), "\""))
+		}
+		if strings.Contains(value, "\n") {
+			for _, line := range strings.Split(value, "\n") {
+				r.add(strings.TrimSpace(line))
+			}
+		}
+	}
+}
+
+func (r *Redactor) add(value string) {
+	if len(value) < minLength || r.secrets[value] {
+		return
+	}
+	r.secrets[value] = true
+
+	// longer secrets come first, a secret containing another one is masked entirely
+	secrets := make([]string, 0, len(r.secrets))
+	for secret := range r.secrets {
+		secrets = append(secrets, secret)
+	}
+	sort.Sort(byLength(secrets))
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		pairs = append(pairs, secret, Mask)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+// byLength sorts longer strings first
+type byLength []string
+
+func (s byLength) Len() int      { return len(s) }
+func (s byLength) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byLength) Less(i, j int) bool {
+	if len(s[i]) != len(s[j]) {
+		return len(s[i]) > len(s[j])
+	}
+	return s[i] < s[j]
+}
+
+// AddCredential registers the decrypted secret fields and secret inputs of c
+func (r *Redactor) AddCredential(c common.Credential) {
+	for _, name := range common.SecretFieldNames {
+		r.Add(c.SecretValue(name))
+	}
+	for _, value := range c.SecretInputs {
+		r.Add(string(util.Decipher(value)))
+	}
+}
+
+// String returns s with registered secrets masked
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// Strings returns a copy of s with registered secrets masked
+func (r *Redactor) Strings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	masked := make([]string, len(s))
+	for i, v := range s {
+		masked[i] = r.String(v)
+	}
+	return masked
+}
+
+// String masks secrets of all open redactors in s
+func String(s string) string {
+	openMu.RLock()
+	defer openMu.RUnlock()
+	for r := range open {
+		s = r.String(s)
+	}
+	return s
+}
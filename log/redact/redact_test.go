@@ -0,0 +1,83 @@
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestString(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	defer r.Close()
+
+	r.Add("s3cret", "s3cret-longer", "abc", "", "quo\"te", "-----BEGIN KEY-----\nAAAAB3NzaC1yc2EAAAADAQAB\n-----END KEY-----")
+
+	assert.Equal("pass=$encrypted$ token=$encrypted$", r.String("pass=s3cret token=s3cret-longer"))
+	assert.Equal("abc", r.String("abc"), "Short values are not masked")
+	assert.Equal(`{"password": "$encrypted$"}`, r.String(`{"password": "quo\"te"}`))
+	assert.Equal("key line $encrypted$", r.String("key line AAAAB3NzaC1yc2EAAAADAQAB"))
+	assert.Equal([]string{"A=$encrypted$", "B=b"}, r.Strings([]string{"A=s3cret", "B=b"}))
+
+	var nilRedactor *Redactor
+	assert.Equal("s3cret", nilRedactor.String("s3cret"))
+}
+
+func TestAddCredential(t *testing.T) {
+	r := New()
+	defer r.Close()
+
+	r.AddCredential(common.Credential{
+		Password:       util.Cipher("machine-password"),
+		BecomePassword: util.Cipher("become-password"),
+		SecretInputs:   map[string]string{"api_key": util.Cipher("custom-api-key")},
+		// stored in plaintext before security tokens were encrypted
+		SecurityToken: "plaintext-session-token",
+	})
+
+	assert.Equal(t, "-e ansible_ssh_pass=$encrypted$ $encrypted$ $encrypted$ $encrypted$",
+		r.String("-e ansible_ssh_pass=machine-password become-password custom-api-key plaintext-session-token"))
+}
+
+func TestWriter(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	defer r.Close()
+	r.Add("s3cret")
+
+	var b bytes.Buffer
+	w := r.Writer(&b)
+	// the secret is split between chunks
+	w.Write([]byte("ok: password s3"))
+	w.Write([]byte("cret\nchanged: s3c"))
+	assert.Equal("ok: password $encrypted$\n", b.String())
+	w.Write([]byte("ret"))
+	assert.NoError(w.Flush())
+	assert.Equal("ok: password $encrypted$\nchanged: $encrypted$", b.String())
+}
+
+func TestHook(t *testing.T) {
+	r := New()
+	r.Add("s3cret")
+
+	entry := logrus.NewEntry(logrus.StandardLogger()).WithFields(logrus.Fields{
+		"Environment": []string{"AWS_SECRET_ACCESS_KEY=s3cret"},
+		"Error":       errors.New("exit status 1: s3cret"),
+		"Dir":         "/tmp",
+	})
+	entry.Message = "Job Arguments -e s3cret"
+	assert.NoError(t, Hook{}.Fire(entry))
+	assert.Equal(t, "Job Arguments -e $encrypted$", entry.Message)
+	assert.Equal(t, []string{"AWS_SECRET_ACCESS_KEY=$encrypted$"}, entry.Data["Environment"])
+	assert.Equal(t, "exit status 1: $encrypted$", entry.Data["Error"])
+	assert.Equal(t, "/tmp", entry.Data["Dir"])
+
+	// closed redactors no longer mask logs
+	r.Close()
+	assert.Equal(t, "s3cret", String("s3cret"))
+}
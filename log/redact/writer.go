@@ -0,0 +1,50 @@
+package redact
+
+import (
+	"bytes"
+	"io"
+)
+
+// maxPending bounds output held back while waiting for the end of a line
+const maxPending = 64 * 1024
+
+// Writer masks secrets in output written in chunks. Output is passed on line by line,
+// so a secret split between chunks is masked as well. Flush passes on the last line
+type Writer struct {
+	r       *Redactor
+	w       io.Writer
+	pending []byte
+}
+
+// Writer returns a writer which masks secrets of r in output written to w
+func (r *Redactor) Writer(w io.Writer) *Writer {
+	return &Writer{r: r, w: w}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	end := bytes.LastIndexByte(w.pending, '\n') + 1
+	if len(w.pending) > maxPending {
+		end = len(w.pending)
+	}
+	if end == 0 {
+		return len(p), nil
+	}
+
+	lines := w.pending[:end]
+	w.pending = append([]byte{}, w.pending[end:]...)
+	if _, err := io.WriteString(w.w, w.r.String(string(lines))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush passes on output held back after the last line break
+func (w *Writer) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w.w, w.r.String(string(w.pending)))
+	w.pending = nil
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
 	"gopkg.in/gin-gonic/gin.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -13,7 +14,7 @@ type Group struct {
 	ID                       bson.ObjectId  `bson:"_id" json:"id"`
 	Name                     string         `bson:"name" json:"name" binding:"required,min=1,max=500"`
 	Description              string         `bson:"description" json:"description"`
-	Variables                string         `bson:"variables" json:"variables"`
+	Variables                common.Vars    `bson:"variables" json:"variables" binding:"omitempty,vars"`
 	TotalHosts               uint32         `bson:"total_hosts" json:"total_hosts"`
 	HasActiveFailures        bool           `bson:"has_active_failures" json:"has_active_failures"`
 	HostsWithActiveFailures  uint32         `bson:"hosts_with_active_failures" json:"hosts_with_active_failures"`
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
 	"gopkg.in/gin-gonic/gin.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -17,7 +18,7 @@ type Host struct {
 	Description string         `bson:"description,omitempty" json:"description"`
 	GroupID     *bson.ObjectId `bson:"group_id,omitempty" json:"group"`
 	InstanceID  string         `bson:"instance_id,omitempty" json:"instance_id"`
-	Variables   string         `bson:"variables,omitempty" json:"variables"`
+	Variables   common.Vars    `bson:"variables,omitempty" json:"variables" binding:"omitempty,vars"`
 	Enabled     bool           `bson:"enabled,omitempty" json:"enabled"`
 
 	LastJobID            *bson.ObjectId `bson:"last_job_id,omitempty" json:"last_job" binding:"omitempty,naproperty"`
@@ -22,7 +22,7 @@ type Inventory struct {
 	Name           string        `bson:"name" json:"name" binding:"required,min=1,max=500"`
 	OrganizationID bson.ObjectId `bson:"organization_id" json:"organization" binding:"required"`
 	Description    string        `bson:"description,omitempty" json:"description"`
-	Variables      string        `bson:"variables,omitempty" json:"variables"`
+	Variables      common.Vars   `bson:"variables,omitempty" json:"variables" binding:"omitempty,vars"`
 
 	// only output
 	TotalHosts                   uint32 `bson:"total_hosts,omitempty" json:"total_hosts" binding:"omitempty,naproperty"`
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
 	"gopkg.in/gin-gonic/gin.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -13,8 +14,9 @@ const (
 	JOBTYPE_ANSIBLE_JOB = "ansible_job" // A ansible job
 	JOBTYPE_UPDATE_JOB  = "update_job"  // A project scm update job
 
-	JOB_LAUNCH_TYPE_MANUAL = "manual"
-	JOB_LAUNCH_TYPE_SYSTEM = "system"
+	JOB_LAUNCH_TYPE_MANUAL  = "manual"
+	JOB_LAUNCH_TYPE_SYSTEM  = "system"
+	JOB_LAUNCH_TYPE_WEBHOOK = "webhook"
 )
 
 type Job struct {
@@ -35,25 +37,27 @@ type Job struct {
 	JobExplanation  string    `bson:"job_explanation" json:"job_explanation"`
 	JobType         string    `bson:"job_type" json:"job_type"`
 
-	Playbook          string `bson:"playbook" json:"playbook"`
-	Forks             uint8  `bson:"forks" json:"forks"`
-	Limit             string `bson:"limit,omitempty" json:"limit"`
-	Verbosity         uint8  `bson:"verbosity" json:"verbosity"`
-	ExtraVars         gin.H  `bson:"extra_vars,omitempty" json:"extra_vars"`
-	JobTags           string `bson:"job_tags,omitempty" json:"job_tags"`
-	SkipTags          string `bson:"skip_tags,omitempty" json:"skip_tags"`
-	ForceHandlers     bool   `bson:"force_handlers" json:"force_handlers"`
-	StartAtTask       string `bson:"start_at_task,omitempty" json:"start_at_task"`
-	AllowSimultaneous bool   `bson:"allow_simultaneous,omitempty" json:"allow_simultaneous"`
-
-	InventoryID         bson.ObjectId  `bson:"inventory_id,omitempty" json:"inventory"`
-	JobTemplateID       bson.ObjectId  `bson:"job_template_id,omitempty" json:"job_template"`
-	ProjectID           bson.ObjectId  `bson:"project_id,omitempty" json:"project"`
-	BecomeEnabled       bool           `bson:"become_enabled" json:"become_enabled"`
-	SCMCredentialID     *bson.ObjectId `bson:"scm_credential_id,omitempty" json:"scm_credential"`
-	NetworkCredentialID *bson.ObjectId `bson:"network_credential_id,omitempty" json:"network_credential"`
-	CloudCredentialID   *bson.ObjectId `bson:"cloud_credential_id,omitempty" json:"cloud_credential"`
-	MachineCredentialID *bson.ObjectId `bson:"credential_id,omitempty" json:"credential"`
+	Playbook          string      `bson:"playbook" json:"playbook"`
+	Forks             uint8       `bson:"forks" json:"forks"`
+	Limit             string      `bson:"limit,omitempty" json:"limit"`
+	Verbosity         uint8       `bson:"verbosity" json:"verbosity"`
+	ExtraVars         common.Vars `bson:"extra_vars,omitempty" json:"extra_vars"`
+	JobTags           string      `bson:"job_tags,omitempty" json:"job_tags"`
+	SkipTags          string      `bson:"skip_tags,omitempty" json:"skip_tags"`
+	ForceHandlers     bool        `bson:"force_handlers" json:"force_handlers"`
+	StartAtTask       string      `bson:"start_at_task,omitempty" json:"start_at_task"`
+	AllowSimultaneous bool        `bson:"allow_simultaneous,omitempty" json:"allow_simultaneous"`
+
+	InventoryID         bson.ObjectId   `bson:"inventory_id,omitempty" json:"inventory"`
+	JobTemplateID       bson.ObjectId   `bson:"job_template_id,omitempty" json:"job_template"`
+	ProjectID           bson.ObjectId   `bson:"project_id,omitempty" json:"project"`
+	BecomeEnabled       bool            `bson:"become_enabled" json:"become_enabled"`
+	SCMCredentialID     *bson.ObjectId  `bson:"scm_credential_id,omitempty" json:"scm_credential"`
+	NetworkCredentialID *bson.ObjectId  `bson:"network_credential_id,omitempty" json:"network_credential"`
+	CloudCredentialID   *bson.ObjectId  `bson:"cloud_credential_id,omitempty" json:"cloud_credential"`
+	MachineCredentialID *bson.ObjectId  `bson:"credential_id,omitempty" json:"credential"`
+	VaultCredentialIDs  []bson.ObjectId `bson:"vault_credentials,omitempty" json:"vault_credentials"`
+	ExtraCredentialIDs  []bson.ObjectId `bson:"extra_credentials,omitempty" json:"extra_credentials"`
 
 	PromptLimit      bool `bson:"prompt_limit_on_launch" json:"ask_limit_on_launch"`
 	PromptInventory  bool `bson:"prompt_inventory" json:"ask_inventory_on_launch"`
@@ -62,11 +66,34 @@ type Job struct {
 	PromptTags       bool `bson:"prompt_tags" json:"ask_tags_on_launch"`
 	PromptVariables  bool `bson:"prompt_variables" json:"ask_variables_on_launch"`
 
+	PromptExtraCredentials bool `bson:"prompt_extra_credentials" json:"ask_extra_credentials_on_launch"`
+
 	// system generated items
 	JobCWD  string   `bson:"job_cwd" json:"job_cwd"`
 	JobARGS []string `bson:"job_args" json:"job_args"`
 	JobENV  []string `bson:"job_env" json:"job_env"`
 
+	// toolchain which ran the job, empty when binaries on the default PATH were used
+	Toolchain string `bson:"toolchain,omitempty" json:"toolchain"`
+	// image of the container which ran the job
+	ExecutionImage string `bson:"execution_image,omitempty" json:"execution_image"`
+
+	// timeouts and retry policy of the template
+	Timeout      int    `bson:"timeout,omitempty" json:"timeout"`
+	IdleTimeout  int    `bson:"idle_timeout,omitempty" json:"idle_timeout"`
+	RetryCount   int    `bson:"retry_count,omitempty" json:"retry_count"`
+	RetryBackoff int    `bson:"retry_backoff,omitempty" json:"retry_backoff"`
+	RetryOn      string `bson:"retry_on,omitempty" json:"retry_on"`
+	// retries of a failed job refer to the first job, RetryAttempt counts them
+	RetryAttempt int            `bson:"retry_attempt,omitempty" json:"retry_attempt"`
+	RetryOfID    *bson.ObjectId `bson:"retry_of_id,omitempty" json:"retry_of"`
+
+	// encrypted answers to password questions of the survey, extra variables hold them masked
+	SurveyPasswords map[string]string `bson:"survey_passwords,omitempty" json:"-"`
+
+	// revision of the project checked out by update jobs
+	ScmRevision string `bson:"scm_revision,omitempty" json:"scm_revision"`
+
 	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
 	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
 
@@ -24,7 +24,7 @@ type JobTemplate struct {
 	Description         string         `bson:"description,omitempty" json:"description"`
 	Forks               uint8          `bson:"forks,omitempty" json:"forks"`
 	Limit               string         `bson:"limit,omitempty" json:"limit" binding:"max=1024"`
-	ExtraVars           gin.H          `bson:"extra_vars,omitempty" json:"extra_vars"`
+	ExtraVars           common.Vars    `bson:"extra_vars,omitempty" json:"extra_vars" binding:"omitempty,vars"`
 	JobTags             string         `bson:"job_tags,omitempty" json:"job_tags" binding:"max=1024"`
 	SkipTags            string         `bson:"skip_tags,omitempty" json:"skip_tags" binding:"max=1024"`
 	StartAtTask         string         `bson:"start_at_task,omitempty" json:"start_at_task"`
@@ -34,13 +34,37 @@ type JobTemplate struct {
 	CloudCredentialID   *bson.ObjectId `bson:"cloud_credential_id,omitempty" json:"cloud_credential"`
 	NetworkCredentialID *bson.ObjectId `bson:"network_credential_id,omitempty" json:"network_credential"`
 	MachineCredentialID *bson.ObjectId `bson:"credential_id,omitempty" json:"credential"`
-	PromptLimit         bool           `bson:"prompt_limit_on_launch,omitempty" json:"ask_limit_on_launch"`
-	PromptInventory     bool           `bson:"prompt_inventory,omitempty" json:"ask_inventory_on_launch"`
-	PromptCredential    bool           `bson:"prompt_credential,omitempty" json:"ask_credential_on_launch"`
-	PromptJobType       bool           `bson:"prompt_job_type,omitempty" json:"ask_job_type_on_launch"`
-	PromptTags          bool           `bson:"prompt_tags,omitempty" json:"ask_tags_on_launch"`
-	PromptSkipTags      bool           `bson:"prompt_skip_tags,omitempty" json:"ask_skip_tags_on_launch"`
-	AllowSimultaneous   bool           `bson:"allow_simultaneous,omitempty" json:"allow_simultaneous"`
+	// vault credentials are used to decrypt vaulted files, each must have a distinct vault ID
+	VaultCredentialIDs []bson.ObjectId `bson:"vault_credentials,omitempty" json:"vault_credentials"`
+	// extra cloud credentials are injected along with the cloud credential, at most one per kind
+	ExtraCredentialIDs     []bson.ObjectId `bson:"extra_credentials,omitempty" json:"extra_credentials"`
+	PromptExtraCredentials bool            `bson:"prompt_extra_credentials,omitempty" json:"ask_extra_credentials_on_launch"`
+	PromptLimit            bool            `bson:"prompt_limit_on_launch,omitempty" json:"ask_limit_on_launch"`
+	PromptInventory        bool            `bson:"prompt_inventory,omitempty" json:"ask_inventory_on_launch"`
+	PromptCredential       bool            `bson:"prompt_credential,omitempty" json:"ask_credential_on_launch"`
+	PromptJobType          bool            `bson:"prompt_job_type,omitempty" json:"ask_job_type_on_launch"`
+	PromptTags             bool            `bson:"prompt_tags,omitempty" json:"ask_tags_on_launch"`
+	PromptSkipTags         bool            `bson:"prompt_skip_tags,omitempty" json:"ask_skip_tags_on_launch"`
+	AllowSimultaneous      bool            `bson:"allow_simultaneous,omitempty" json:"allow_simultaneous"`
+
+	// registered toolchain which runs jobs, overrides the toolchain of the project
+	Toolchain string `bson:"toolchain,omitempty" json:"toolchain"`
+	// image of containers which run jobs, the default execution image is used when it is empty
+	ExecutionImage string `bson:"execution_image,omitempty" json:"execution_image"`
+
+	// seconds before running jobs are killed, the ansible job timeout is used when it is 0
+	Timeout int `bson:"timeout,omitempty" json:"timeout" binding:"omitempty,min=0"`
+	// seconds running jobs may write no output before they are killed, 0 disables the idle timeout
+	IdleTimeout int `bson:"idle_timeout,omitempty" json:"idle_timeout" binding:"omitempty,min=0"`
+	// failed jobs are relaunched up to RetryCount times, RetryBackoff seconds after the failure
+	// doubled with every attempt. RetryOn restricts retries to errors or unreachable hosts
+	RetryCount   int    `bson:"retry_count,omitempty" json:"retry_count" binding:"omitempty,min=0,max=10"`
+	RetryBackoff int    `bson:"retry_backoff,omitempty" json:"retry_backoff" binding:"omitempty,min=0"`
+	RetryOn      string `bson:"retry_on,omitempty" json:"retry_on" binding:"omitempty,retry_on"`
+
+	// questions asked on launch, the answers are passed to jobs as extra variables
+	SurveyEnabled bool              `bson:"survey_enabled,omitempty" json:"survey_enabled"`
+	SurveySpec    common.SurveySpec `bson:"survey_spec,omitempty" json:"survey_spec" binding:"omitempty,dive"`
 
 	PolymorphicCtypeID *bson.ObjectId `bson:"polymorphic_ctype_id,omitempty" json:"polymorphic_ctype"`
 
@@ -114,13 +138,9 @@ func (h JobTemplate) GetCloudCredential() (common.Credential, error) {
 }
 
 func (jt JobTemplate) GetOrganizationID() (bson.ObjectId, error) {
-	var org common.Organization
-	pID, err := jt.GetProjectID()
-	if err != nil {
-		return org.ID, err
-	}
-	err = db.Organizations().FindId(pID).One(&org)
-	return org.ID, err
+	var prj common.Project
+	err := db.Projects().FindId(jt.ProjectID).One(&prj)
+	return prj.OrganizationID, err
 }
 
 func (jt JobTemplate) GetProjectID() (bson.ObjectId, error) {
@@ -151,6 +171,7 @@ func (jt *JobTemplate) MachineCredentialExist() bool {
 		"kind": bson.M{
 			"$in": []string{
 				common.CredentialKindSSH,
+				common.CredentialKindSSHCA,
 				common.CredentialKindWIN,
 			},
 		},
@@ -172,18 +193,8 @@ func (jt *JobTemplate) NetworkCredentialExist() bool {
 
 func (jt *JobTemplate) CloudCredentialExist() bool {
 	query := bson.M{
-		"_id": jt.CloudCredentialID,
-		"kind": bson.M{
-			"$in": []string{
-				common.CredentialKindAWS,
-				common.CredentialKindAZURE,
-				common.CredentialKindCLOUDFORMS,
-				common.CredentialKindGCE,
-				common.CredentialKindOPENSTACK,
-				common.CredentialKindSATELLITE6,
-				common.CredentialKindVMWARE,
-			},
-		},
+		"_id":  jt.CloudCredentialID,
+		"kind": bson.M{"$in": common.CloudCredentialKinds},
 	}
 	count, err := db.Credentials().Find(query).Count()
 	if err == nil && count > 0 {
@@ -1,16 +1,18 @@
 package ansible
 
 import (
-	"gopkg.in/gin-gonic/gin.v1"
+	"github.com/pearsonappeng/tensor/models/common"
 	"gopkg.in/mgo.v2/bson"
 )
 
 type Launch struct {
 	Limit               string        `bson:"limit,omitempty" json:"limit,omitempty" binding:"omitempty,max=1024"`
-	ExtraVars           gin.H         `bson:"extra_vars,omitempty" json:"extra_vars,omitempty"`
+	ExtraVars           common.Vars   `bson:"extra_vars,omitempty" json:"extra_vars,omitempty" binding:"omitempty,vars"`
 	JobTags             string        `bson:"job_tags,omitempty" json:"job_tags,omitempty" binding:"omitempty,max=1024"`
 	SkipTags            string        `bson:"skip_tags,omitempty" json:"skip_tags,omitempty" binding:"omitempty,max=1024"`
 	JobType             string        `bson:"job_type,omitempty" json:"job_type,omitempty" binding:"omitempty,jobtype"`
 	InventoryID         bson.ObjectId `bson:"inventory_id,omitempty" json:"inventory,omitempty"`
 	MachineCredentialID bson.ObjectId `bson:"credential_id,omitempty" json:"credential,omitempty"`
+	// replaces extra credentials of the template when provided, an empty list removes them
+	ExtraCredentialIDs *[]bson.ObjectId `bson:"extra_credentials,omitempty" json:"extra_credentials,omitempty"`
 }
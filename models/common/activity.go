@@ -11,8 +11,8 @@ import (
 type Activity struct {
 	ID        bson.ObjectId `bson:"_id" json:"id"`
 	Type      string        `bson:"-" json:"type"`
-	ActorID   bson.ObjectId `bson:"actor_id"`
-	Object1ID bson.ObjectId `bson:"object1_id"`
+	ActorID   bson.ObjectId `bson:"actor_id,omitempty"`
+	Object1ID bson.ObjectId `bson:"object1_id,omitempty"`
 	Object2ID bson.ObjectId   `bson:"object2_id,omitempty"`
 	Links     gin.H         `bson:"-" json:"links"`
 	Meta      gin.H         `bson:"-" json:"meta"`
@@ -21,4 +21,5 @@ type Activity struct {
 	Changes   map[string]interface{}   `bson:"changes" json:"changes"`
 	Object1   string   `bson:"object1" json:"object1"`
 	Object2   string   `bson:"object2,omitempty" json:"object2"`
+	SourceIP  string   `bson:"source_ip,omitempty" json:"source_ip,omitempty"`
 }
\ No newline at end of file
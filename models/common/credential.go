@@ -4,12 +4,14 @@ import (
 	"time"
 
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/util"
 	"gopkg.in/gin-gonic/gin.v1"
 	"gopkg.in/mgo.v2/bson"
 )
 
 const (
 	CredentialKindSSH        = "ssh"
+	CredentialKindSSHCA      = "ssh_ca"
 	CredentialKindNET        = "net"
 	CredentialKindWIN        = "windows"
 	CredentialKindSCM        = "scm"
@@ -21,8 +23,41 @@ const (
 	CredentialKindGCE        = "gce"
 	CredentialKindAZURE      = "azure"
 	CredentialKindOPENSTACK  = "openstack"
+	CredentialKindVAULT      = "vault"
+	CredentialKindGALAXY     = "galaxy"
+	CredentialKindCUSTOM     = "custom"
 )
 
+// CloudCredentialKinds are kinds of credentials which can be used as cloud credentials
+var CloudCredentialKinds = []string{
+	CredentialKindAWS,
+	CredentialKindAZURE,
+	CredentialKindCLOUDFORMS,
+	CredentialKindGCE,
+	CredentialKindOPENSTACK,
+	CredentialKindSATELLITE6,
+	CredentialKindVMWARE,
+	CredentialKindCUSTOM,
+}
+
+// Sources a credential field can be looked up from
+const (
+	SecretSourceVault = "vault"
+	SecretSourceFile  = "file"
+	SecretSourceExec  = "exec"
+)
+
+// SecretLookup references a secret held outside of tensor
+type SecretLookup struct {
+	// Source is one of vault, file or exec
+	Source string `bson:"source" json:"source" binding:"required,secret_source"`
+	// Path is the Vault KV path, the file path relative to the secret file root
+	// or the plugin name in the plugin directory
+	Path string `bson:"path" json:"path" binding:"required"`
+	// Key is the key within a Vault secret or the argument passed to an exec plugin
+	Key string `bson:"key,omitempty" json:"key"`
+}
+
 // Credential is the model for Credential collection
 type Credential struct {
 	ID bson.ObjectId `bson:"_id" json:"id"`
@@ -46,6 +81,7 @@ type Credential struct {
 	BecomeUsername    string         `bson:"become_username,omitempty" json:"become_username"`
 	BecomePassword    string         `bson:"become_password,omitempty" json:"become_password"`
 	VaultPassword     string         `bson:"vault_password,omitempty" json:"vault_password"`
+	VaultID           string         `bson:"vault_id,omitempty" json:"vault_id" binding:"omitempty,max=100,excludesall=@ "`
 	Subscription      string         `bson:"subscription,omitempty" json:"subscription"`
 	Tenant            string         `bson:"tenant,omitempty" json:"tenant"`
 	Secret            string         `bson:"secret,omitempty" json:"secret"`
@@ -54,6 +90,22 @@ type Credential struct {
 	AuthorizePassword string         `bson:"authorize_password,omitempty" json:"authorize_password"`
 	OrganizationID    *bson.ObjectId `bson:"organization_id,omitempty" json:"organization"`
 
+	// ssh_ca credentials hold a certificate authority key in SSHKeyData, each job gets a
+	// certificate valid for Principals, or Username when empty, for CertificateTTL seconds
+	Principals     []string `bson:"principals,omitempty" json:"principals" binding:"omitempty,dive,min=1,max=256"`
+	CertificateTTL uint32   `bson:"certificate_ttl,omitempty" json:"certificate_ttl" binding:"omitempty,min=60,max=86400"`
+
+	// custom credentials are described by a credential type, Inputs holds values of
+	// non secret inputs and SecretInputs encrypted values of secret inputs.
+	// SecretInputs is serialized for job payloads and removed from API responses
+	CredentialTypeID *bson.ObjectId    `bson:"credential_type_id,omitempty" json:"credential_type"`
+	Inputs           map[string]string `bson:"inputs,omitempty" json:"inputs"`
+	SecretInputs     map[string]string `bson:"secret_inputs,omitempty" json:"secret_inputs,omitempty"`
+
+	// Lookups reference secrets kept in an external store by field name eg. ssh_key_data,
+	// referenced values are resolved when a job starts and are never stored
+	Lookups map[string]SecretLookup `bson:"lookups,omitempty" json:"lookups" binding:"omitempty,dive"`
+
 	Created  time.Time `bson:"created" json:"created"`
 	Modified time.Time `bson:"modified" json:"modified"`
 
@@ -156,3 +208,53 @@ func (crd Credential) OrganizationExist() bool {
 	}
 	return false
 }
+
+// SecretFieldNames are json names of the encrypted fields of credentials
+var SecretFieldNames = []string{"password", "ssh_key_data", "ssh_key_unlock", "become_password",
+	"vault_password", "authorize_password", "secret", "security_token"}
+
+// SecretField returns the encrypted field with the given json name,
+// nil if the name does not refer to a secret field
+func (c *Credential) SecretField(name string) *string {
+	switch name {
+	case "password":
+		return &c.Password
+	case "ssh_key_data":
+		return &c.SSHKeyData
+	case "ssh_key_unlock":
+		return &c.SSHKeyUnlock
+	case "become_password":
+		return &c.BecomePassword
+	case "vault_password":
+		return &c.VaultPassword
+	case "authorize_password":
+		return &c.AuthorizePassword
+	case "secret":
+		return &c.Secret
+	case "security_token":
+		return &c.SecurityToken
+	}
+	return nil
+}
+
+// SecretValue returns the decrypted value of the secret field with the given json name.
+// Security tokens stored before they were encrypted are read as plaintext
+func (c *Credential) SecretValue(name string) string {
+	field := c.SecretField(name)
+	if field == nil || len(*field) == 0 {
+		return ""
+	}
+	if name == "security_token" && !util.IsCipher(*field) {
+		return *field
+	}
+	return string(util.Decipher(*field))
+}
+
+// HasSecret reports whether the secret field has a value or a lookup
+func (c Credential) HasSecret(name string) bool {
+	if _, ok := c.Lookups[name]; ok {
+		return true
+	}
+	field := c.SecretField(name)
+	return field != nil && len(*field) > 0
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"time"
+
+	"github.com/pearsonappeng/tensor/db"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CredentialType is the model for credential_types collection.
+// A credential type describes the inputs of custom credentials
+// and how those inputs are injected into jobs
+type CredentialType struct {
+	ID    bson.ObjectId `bson:"_id" json:"id"`
+	Type  string        `bson:"-" json:"type"`
+	Links gin.H         `bson:"-" json:"links"`
+	Meta  gin.H         `bson:"-" json:"meta"`
+
+	Name        string                `bson:"name" json:"name" binding:"required,min=1,max=500"`
+	Description string                `bson:"description,omitempty" json:"description"`
+	Inputs      []CredentialTypeInput `bson:"inputs" json:"inputs" binding:"required,min=1,dive"`
+	Injectors   CredentialInjectors   `bson:"injectors" json:"injectors"`
+
+	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
+	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
+
+	Created  time.Time `bson:"created" json:"created"`
+	Modified time.Time `bson:"modified" json:"modified"`
+}
+
+// CredentialTypeInput is a field of credentials of the type
+type CredentialTypeInput struct {
+	ID       string `bson:"id" json:"id" binding:"required,min=1,max=100,identifier"`
+	Label    string `bson:"label" json:"label" binding:"required,min=1,max=500"`
+	HelpText string `bson:"help_text,omitempty" json:"help_text"`
+	// Secret inputs are encrypted and never returned by the API
+	Secret   bool `bson:"secret,omitempty" json:"secret"`
+	Required bool `bson:"required,omitempty" json:"required"`
+}
+
+// CredentialInjectors map inputs to environment variables, extra variables and files.
+// Values are templates where {{ input_id }} is replaced by the input value and
+// {{ tensor.filename.name }} by the path of the file with the given name
+type CredentialInjectors struct {
+	Env       map[string]string `bson:"env,omitempty" json:"env"`
+	ExtraVars map[string]string `bson:"extra_vars,omitempty" json:"extra_vars"`
+	Files     map[string]string `bson:"files,omitempty" json:"files"`
+}
+
+func (CredentialType) GetType() string {
+	return "credential_type"
+}
+
+func (ct CredentialType) IsUnique() bool {
+	count, err := db.CredentialTypes().Find(bson.M{"name": ct.Name}).Count()
+	if err == nil && count > 0 {
+		return false
+	}
+
+	return true
+}
+
+// Input returns the input with the given ID
+func (ct CredentialType) Input(id string) (CredentialTypeInput, bool) {
+	for _, v := range ct.Inputs {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return CredentialTypeInput{}, false
+}
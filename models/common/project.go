@@ -34,6 +34,20 @@ type Project struct {
 	ScmUpdateOnLaunch     bool           `bson:"scm_update_on_launch,omitempty" json:"scm_update_on_launch"`
 	ScmUpdateCacheTimeout int            `bson:"scm_update_cache_timeout,omitempty" json:"scm_update_cache_timeout"`
 
+	// git only, refs fetched in addition to the branch, checkout of submodules and shallow clones
+	ScmRefspec    string `bson:"scm_refspec,omitempty" json:"scm_refspec"`
+	ScmSubmodules bool   `bson:"scm_submodules,omitempty" json:"scm_submodules"`
+	ScmCloneDepth int    `bson:"scm_clone_depth,omitempty" json:"scm_clone_depth" binding:"omitempty,min=0"`
+
+	// authenticates to the galaxy server roles and collections in requirements.yml files are installed from
+	GalaxyCredentialID *bson.ObjectId `bson:"galaxy_credential_id,omitempty" json:"galaxy_credential"`
+
+	// registered toolchain which runs updates and jobs of the project, unless a job template selects another
+	Toolchain string `bson:"toolchain,omitempty" json:"toolchain"`
+
+	// managed through the webhook endpoint
+	Webhook Webhook `bson:"webhook,omitempty" json:"-"`
+
 	// only output
 	LastJob          *bson.ObjectId `bson:"last_job,omitempty" json:"last_job" binding:"omitempty,naproperty"`
 	LastJobRun       *time.Time     `bson:"last_job_run,omitempty" json:"last_job_run" binding:"omitempty,naproperty"`
@@ -43,6 +57,12 @@ type Project struct {
 	Status           string         `bson:"status,omitempty" json:"status" binding:"omitempty,naproperty"`
 	LastUpdateFailed bool           `bson:"last_update_failed,omitempty" json:"last_update_failed" binding:"omitempty,naproperty"`
 	LastUpdated      *time.Time     `bson:"last_updated,omitempty" json:"last_updated" binding:"omitempty,naproperty"`
+	ScmRevision      string         `bson:"scm_revision,omitempty" json:"scm_revision" binding:"omitempty,naproperty"`
+	ScmUpdateJobID   *bson.ObjectId `bson:"scm_update_job_id,omitempty" json:"current_update" binding:"omitempty,naproperty"`
+	// update requested while the current update is running, it starts once the current update finishes
+	ScmUpdateNextID *bson.ObjectId `bson:"scm_update_next_id,omitempty" json:"next_update" binding:"omitempty,naproperty"`
+	// archives uploaded to manual projects which are kept for rollback, the current one first
+	Archives []ProjectArchive `bson:"archives,omitempty" json:"archives" binding:"omitempty,naproperty"`
 
 	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
 	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
@@ -53,6 +73,16 @@ type Project struct {
 	Roles []AccessControl `bson:"roles" json:"-"`
 }
 
+// ProjectArchive is a revision of a manual project uploaded as an archive.
+// Revision is the sha256 checksum of the archive
+type ProjectArchive struct {
+	Revision     string        `bson:"revision" json:"revision"`
+	Name         string        `bson:"name,omitempty" json:"name"`
+	Size         int64         `bson:"size,omitempty" json:"size"`
+	UploadedByID bson.ObjectId `bson:"uploaded_by_id,omitempty" json:"uploaded_by"`
+	Uploaded     time.Time     `bson:"uploaded" json:"uploaded"`
+}
+
 func (Project) GetType() string {
 	return "project"
 }
@@ -98,6 +128,22 @@ func (project Project) OrganizationExist() bool {
 	return false
 }
 
+// ToolchainKind returns the kind of toolchains which run jobs of the project
+func (project Project) ToolchainKind() string {
+	if project.Kind == "terraform" {
+		return "terraform"
+	}
+	return "ansible"
+}
+
+func (project *Project) GalaxyCredentialExist() bool {
+	count, err := db.Credentials().Find(bson.M{"_id": project.GalaxyCredentialID, "kind": CredentialKindGALAXY}).Count()
+	if err == nil && count > 0 {
+		return true
+	}
+	return false
+}
+
 func (project *Project) SCMCredentialExist() bool {
 	count, err := db.Credentials().Find(bson.M{"_id": project.ScmCredentialID, "kind": CredentialKindSCM}).Count()
 	if err == nil && count > 0 {
@@ -0,0 +1,42 @@
+package common
+
+import (
+	"time"
+
+	"github.com/pearsonappeng/tensor/db"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Role is the model for roles collection
+// a custom role is a named set of permissions such as job_template:launch
+// that can be granted on resources the same way as built-in roles
+type Role struct {
+	ID    bson.ObjectId `bson:"_id" json:"id"`
+	Type  string        `bson:"-" json:"type"`
+	Links gin.H         `bson:"-" json:"links"`
+	Meta  gin.H         `bson:"-" json:"meta"`
+
+	Name        string   `bson:"name" json:"name" binding:"required,min=1,max=100"`
+	Description string   `bson:"description" json:"description"`
+	Permissions []string `bson:"permissions" json:"permissions" binding:"required,min=1"`
+
+	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
+	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
+
+	Created  time.Time `bson:"created" json:"created"`
+	Modified time.Time `bson:"modified" json:"modified"`
+}
+
+func (Role) GetType() string {
+	return "role"
+}
+
+func (role Role) IsUnique() bool {
+	count, err := db.Roles().Find(bson.M{"name": role.Name}).Count()
+	if err == nil && count > 0 {
+		return false
+	}
+
+	return true
+}
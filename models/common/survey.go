@@ -0,0 +1,224 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gopkg.in/gin-gonic/gin.v1"
+)
+
+// Types of survey questions
+const (
+	SurveyTypeText           = "text"
+	SurveyTypeTextarea       = "textarea"
+	SurveyTypePassword       = "password"
+	SurveyTypeInteger        = "integer"
+	SurveyTypeFloat          = "float"
+	SurveyTypeMultipleChoice = "multiplechoice"
+	SurveyTypeMultiSelect    = "multiselect"
+)
+
+// SurveySpec is the ordered list of questions asked when a job template is launched
+type SurveySpec []SurveyQuestion
+
+// SurveyQuestion is a typed question of a survey, the answer is passed to jobs
+// as the variable Variable
+type SurveyQuestion struct {
+	Variable    string `bson:"variable" json:"variable" binding:"required,min=1,max=100,identifier"`
+	Question    string `bson:"question_name" json:"question_name" binding:"required,min=1,max=500"`
+	Description string `bson:"question_description,omitempty" json:"question_description"`
+	Type        string `bson:"type" json:"type" binding:"required,survey_type"`
+	Required    bool   `bson:"required,omitempty" json:"required"`
+	// answer used when none is given, defaults of password questions are encrypted
+	Default interface{} `bson:"default,omitempty" json:"default"`
+	// bounds of the length of text answers and of the value of numeric answers
+	Min *float64 `bson:"min,omitempty" json:"min"`
+	Max *float64 `bson:"max,omitempty" json:"max"`
+	// answers of multiple choice and multi-select questions
+	Choices []string `bson:"choices,omitempty" json:"choices"`
+}
+
+// Errors returns problems of the spec which the field validation does not catch
+func (s SurveySpec) Errors() []string {
+	var errs []string
+	variables := map[string]bool{}
+	for _, q := range s {
+		if variables[q.Variable] {
+			errs = append(errs, "Variable "+q.Variable+" is asked more than once")
+		}
+		variables[q.Variable] = true
+
+		if q.Min != nil && q.Max != nil && *q.Min > *q.Max {
+			errs = append(errs, "Min of "+q.Variable+" is greater than max")
+		}
+		switch q.Type {
+		case SurveyTypeMultipleChoice, SurveyTypeMultiSelect:
+			if len(q.Choices) == 0 {
+				errs = append(errs, "Question "+q.Variable+" must have choices")
+			}
+		}
+		// password defaults are encrypted, they are checked when jobs are launched
+		if q.Type != SurveyTypePassword && !empty(q.Default) {
+			if _, err := q.Answer(q.Default); err != nil {
+				errs = append(errs, "Default of "+err.Error())
+			}
+		}
+	}
+	return errs
+}
+
+// Answers validates answers against the spec and returns the variables they set.
+// Questions which are not answered take the default, an empty answer counts as none.
+// Variables not asked by the spec are ignored
+func (s SurveySpec) Answers(answers gin.H) (gin.H, []string) {
+	vars := gin.H{}
+	var errs []string
+	for _, q := range s {
+		answer, ok := answers[q.Variable]
+		if !ok || empty(answer) {
+			answer = q.Default
+		}
+		if empty(answer) {
+			if q.Required {
+				errs = append(errs, "Answer to "+q.Variable+" is required")
+			}
+			continue
+		}
+
+		value, err := q.Answer(answer)
+		if err != nil {
+			errs = append(errs, "Answer to "+err.Error())
+			continue
+		}
+		vars[q.Variable] = value
+	}
+	return vars, errs
+}
+
+// Answer converts an answer to the type of the question.
+// The error describes why the answer is not valid
+func (q SurveyQuestion) Answer(answer interface{}) (interface{}, error) {
+	switch q.Type {
+	case SurveyTypeText, SurveyTypeTextarea, SurveyTypePassword:
+		s, ok := answer.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a string", q.Variable)
+		}
+		if q.Type == SurveyTypeText && strings.Contains(s, "\n") {
+			return nil, fmt.Errorf("%s must be a single line", q.Variable)
+		}
+		if err := q.bounds(float64(len(s)), " characters"); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case SurveyTypeInteger, SurveyTypeFloat:
+		n, ok := number(answer)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a number", q.Variable)
+		}
+		if q.Type == SurveyTypeInteger {
+			if n != math.Trunc(n) {
+				return nil, fmt.Errorf("%s must be an integer", q.Variable)
+			}
+			// 2^63 and beyond overflow the conversion
+			if n < math.MinInt64 || n >= math.MaxInt64 {
+				return nil, fmt.Errorf("%s is out of the integer range", q.Variable)
+			}
+			if err := q.bounds(n, ""); err != nil {
+				return nil, err
+			}
+			return int(n), nil
+		}
+		if err := q.bounds(n, ""); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case SurveyTypeMultipleChoice:
+		s, ok := answer.(string)
+		if !ok || !q.choice(s) {
+			return nil, fmt.Errorf("%s must be one of %s", q.Variable, strings.Join(q.Choices, ","))
+		}
+		return s, nil
+	case SurveyTypeMultiSelect:
+		var selected []string
+		switch v := answer.(type) {
+		case []string:
+			selected = v
+		case []interface{}:
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s must be a list of choices", q.Variable)
+				}
+				selected = append(selected, s)
+			}
+		default:
+			return nil, fmt.Errorf("%s must be a list of choices", q.Variable)
+		}
+		for _, s := range selected {
+			if !q.choice(s) {
+				return nil, fmt.Errorf("%s must only have choices of %s", q.Variable, strings.Join(q.Choices, ","))
+			}
+		}
+		return selected, nil
+	}
+	return nil, fmt.Errorf("%s has an unknown type %s", q.Variable, q.Type)
+}
+
+// bounds checks v against min and max of the question, unit names what text answers count
+func (q SurveyQuestion) bounds(v float64, unit string) error {
+	if q.Min != nil && v < *q.Min {
+		return fmt.Errorf("%s must be at least %v%s", q.Variable, *q.Min, unit)
+	}
+	if q.Max != nil && v > *q.Max {
+		return fmt.Errorf("%s must be at most %v%s", q.Variable, *q.Max, unit)
+	}
+	return nil
+}
+
+func (q SurveyQuestion) choice(s string) bool {
+	for _, c := range q.Choices {
+		if c == s {
+			return true
+		}
+	}
+	return false
+}
+
+// number converts JSON numbers and numeric strings, answers of webhooks and forms are strings.
+// NaN and infinities are not numbers, they cannot be written as JSON
+func number(v interface{}) (float64, bool) {
+	var f float64
+	switch n := v.(type) {
+	case float64:
+		f = n
+	case int:
+		f = float64(n)
+	case int64:
+		f = float64(n)
+	case string:
+		var err error
+		if f, err = strconv.ParseFloat(strings.TrimSpace(n), 64); err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	return f, !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+func empty(v interface{}) bool {
+	switch a := v.(type) {
+	case nil:
+		return true
+	case string:
+		return len(a) == 0
+	case []interface{}:
+		return len(a) == 0
+	case []string:
+		return len(a) == 0
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package common
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gin-gonic/gin.v1"
+)
+
+func TestSurveyAnswers(t *testing.T) {
+	assert := assert.New(t)
+	min, max := 2.0, 10.0
+	spec := SurveySpec{
+		{Variable: "name", Question: "Name", Type: SurveyTypeText, Required: true, Min: &min, Max: &max},
+		{Variable: "replicas", Question: "Replicas", Type: SurveyTypeInteger, Default: 3.0, Min: &min, Max: &max},
+		{Variable: "ratio", Question: "Ratio", Type: SurveyTypeFloat},
+		{Variable: "region", Question: "Region", Type: SurveyTypeMultipleChoice, Choices: []string{"eu", "us"}, Default: "eu"},
+		{Variable: "zones", Question: "Zones", Type: SurveyTypeMultiSelect, Choices: []string{"a", "b", "c"}},
+		{Variable: "notes", Question: "Notes", Type: SurveyTypeTextarea},
+	}
+
+	vars, errs := spec.Answers(gin.H{
+		"name":   "web",
+		"ratio":  "0.5",
+		"zones":  []interface{}{"a", "c"},
+		"notes":  "",
+		"ignore": "not asked",
+	})
+	assert.Empty(errs)
+	assert.Equal(gin.H{
+		"name":     "web",
+		"replicas": 3,
+		"ratio":    0.5,
+		"region":   "eu",
+		"zones":    []string{"a", "c"},
+	}, vars)
+
+	_, errs = spec.Answers(gin.H{
+		"replicas": 2.5,
+		"region":   "ap",
+		"zones":    []interface{}{"d"},
+		"ratio":    true,
+	})
+	assert.Equal([]string{
+		"Answer to name is required",
+		"Answer to replicas must be an integer",
+		"Answer to ratio must be a number",
+		"Answer to region must be one of eu,us",
+		"Answer to zones must only have choices of a,b,c",
+	}, errs)
+
+	_, errs = spec.Answers(gin.H{"name": "a", "replicas": 11.0})
+	assert.Equal([]string{
+		"Answer to name must be at least 2 characters",
+		"Answer to replicas must be at most 10",
+	}, errs)
+}
+
+func TestSurveyNumbers(t *testing.T) {
+	assert := assert.New(t)
+	spec := SurveySpec{
+		{Variable: "count", Question: "Count", Type: SurveyTypeInteger},
+		{Variable: "ratio", Question: "Ratio", Type: SurveyTypeFloat},
+	}
+
+	// NaN and infinities cannot be written as variables
+	for _, answer := range []interface{}{"NaN", "Inf", "-Inf", math.NaN(), math.Inf(1)} {
+		_, errs := spec.Answers(gin.H{"count": answer, "ratio": answer})
+		assert.Equal([]string{
+			"Answer to count must be a number",
+			"Answer to ratio must be a number",
+		}, errs, "%v", answer)
+	}
+
+	_, errs := spec.Answers(gin.H{"count": "1e19"})
+	assert.Equal([]string{"Answer to count is out of the integer range"}, errs)
+
+	vars, errs := spec.Answers(gin.H{"count": "-9e18", "ratio": "1e19"})
+	assert.Empty(errs)
+	assert.Equal(gin.H{"count": -9000000000000000000, "ratio": 1e19}, vars)
+}
+
+func TestSurveySpecErrors(t *testing.T) {
+	min, max := 5.0, 1.0
+	spec := SurveySpec{
+		{Variable: "size", Question: "Size", Type: SurveyTypeInteger, Min: &min, Max: &max},
+		{Variable: "size", Question: "Size again", Type: SurveyTypeText, Default: "one\ntwo"},
+		{Variable: "region", Question: "Region", Type: SurveyTypeMultipleChoice},
+		{Variable: "secret", Question: "Secret", Type: SurveyTypePassword, Default: "encrypted"},
+	}
+
+	assert.Equal(t, []string{
+		"Min of size is greater than max",
+		"Variable size is asked more than once",
+		"Default of size must be a single line",
+		"Question region must have choices",
+	}, spec.Errors())
+}
@@ -4,7 +4,10 @@ import (
 	"time"
 
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/util"
+	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -26,6 +29,17 @@ type User struct {
 	Modified time.Time `bson:"modified" json:"modified"`
 
 	Roles []AccessControl `bson:"roles" json:"-"`
+
+	// Hashes of previous passwords, most recent first
+	PasswordHistory []string   `bson:"password_history,omitempty" json:"-"`
+	FailedLogins    int        `bson:"failed_logins" json:"-"`
+	LockedUntil     *time.Time `bson:"locked_until,omitempty" json:"-"`
+}
+
+// PasswordChange is the request body for self-service password change
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
 }
 
 func (User) GetType() string {
@@ -54,6 +68,78 @@ func (user User) IsUniqueEmail() bool {
 	return true
 }
 
+// SetPassword hashes the password and moves the current hash to the password history.
+// Setting a new password also clears any failed login attempts
+func (user *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 11)
+	if err != nil {
+		return err
+	}
+
+	history := util.Config.PasswordPolicy.History
+	if len(user.Password) > 0 && history > 0 {
+		user.PasswordHistory = append([]string{user.Password}, user.PasswordHistory...)
+		if len(user.PasswordHistory) > history {
+			user.PasswordHistory = user.PasswordHistory[:history]
+		}
+	}
+
+	user.Password = string(hash)
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+	return nil
+}
+
+// IsPasswordReused reports whether the password matches
+// the current password or one in the password history
+func (user User) IsPasswordReused(password string) bool {
+	hashes := append([]string{user.Password}, user.PasswordHistory...)
+	for _, hash := range hashes {
+		if len(hash) > 0 && bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLocked reports whether the account is locked due to failed login attempts
+func (user User) IsLocked() bool {
+	return user.LockedUntil != nil && time.Now().Before(*user.LockedUntil)
+}
+
+// AddFailedLogin increments the failed login counter and locks the account
+// once the configured maximum attempts are reached. Returns true if the account got locked
+func (user User) AddFailedLogin() (bool, error) {
+	var updated User
+	change := mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"failed_logins": 1}},
+		ReturnNew: true,
+	}
+	if _, err := db.Users().FindId(user.ID).Apply(change, &updated); err != nil {
+		return false, err
+	}
+
+	if util.Config.LoginMaxAttempts <= 0 || util.Config.LoginLockoutTime <= 0 ||
+		updated.FailedLogins < util.Config.LoginMaxAttempts {
+		return false, nil
+	}
+
+	until := time.Now().Add(time.Second * time.Duration(util.Config.LoginLockoutTime))
+	err := db.Users().UpdateId(user.ID, bson.M{"$set": bson.M{"failed_logins": 0, "locked_until": until}})
+	return err == nil, err
+}
+
+// ResetFailedLogins clears the failed login counter and any lock on the account
+func (user User) ResetFailedLogins() error {
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	return db.Users().UpdateId(user.ID, bson.M{
+		"$set":   bson.M{"failed_logins": 0},
+		"$unset": bson.M{"locked_until": ""},
+	})
+}
+
 type AccessUser struct {
 	ID      bson.ObjectId `bson:"_id" json:"id"`
 	Type    string        `bson:"-" json:"type"`
@@ -0,0 +1,142 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/yaml.v2"
+)
+
+// Vars are variables written as a YAML or JSON mapping. They are accepted as a JSON object
+// or as YAML or JSON text, text is kept as written so comments and the order of keys survive edits
+type Vars string
+
+// NewVars returns variables holding vars as JSON.
+// The error reports values which cannot be written as JSON
+func NewVars(vars gin.H) (Vars, error) {
+	if len(vars) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(vars)
+	if err != nil {
+		return "", err
+	}
+	return Vars(b), nil
+}
+
+// UnmarshalJSON accepts a JSON object, YAML or JSON text and null
+func (v *Vars) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	switch {
+	case bytes.Equal(b, []byte("null")):
+		*v = ""
+		return nil
+	case len(b) > 0 && b[0] == '{':
+		*v = Vars(b)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(b, &text); err != nil {
+		return errors.New("variables must be an object or YAML or JSON text")
+	}
+	*v = Vars(text)
+	return nil
+}
+
+// SetBSON reads variables stored as text and variables which earlier versions stored as documents
+func (v *Vars) SetBSON(raw bson.Raw) error {
+	switch raw.Kind {
+	case 0x03:
+		var doc bson.M
+		if err := raw.Unmarshal(&doc); err != nil {
+			return err
+		}
+		vars, err := NewVars(gin.H(doc))
+		if err != nil {
+			return err
+		}
+		*v = vars
+		return nil
+	case 0x0A:
+		*v = ""
+		return nil
+	}
+
+	var text string
+	if err := raw.Unmarshal(&text); err != nil {
+		return err
+	}
+	*v = Vars(text)
+	return nil
+}
+
+// Map parses the variables, empty variables are an empty map
+func (v Vars) Map() (gin.H, error) {
+	vars := gin.H{}
+	text := strings.TrimSpace(string(v))
+	if len(text) == 0 {
+		return vars, nil
+	}
+
+	// JSON is parsed as JSON, YAML does not allow the tabs it is often indented with
+	if strings.HasPrefix(text, "{") {
+		if err := json.Unmarshal([]byte(text), &vars); err == nil {
+			return vars, nil
+		}
+		vars = gin.H{}
+	}
+
+	var parsed interface{}
+	if err := yaml.Unmarshal([]byte(text), &parsed); err != nil {
+		return nil, err
+	}
+	// a document of comments only
+	if parsed == nil {
+		return vars, nil
+	}
+	mapping, ok := parsed.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("variables must be a mapping")
+	}
+	for key, value := range mapping {
+		vars[fmt.Sprint(key)] = jsonValue(value)
+	}
+	return vars, nil
+}
+
+// jsonValue converts YAML mappings, which may have keys of any type, to JSON objects
+func jsonValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		object := map[string]interface{}{}
+		for key, item := range value {
+			object[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return object
+	case []interface{}:
+		list := make([]interface{}, len(value))
+		for i, item := range value {
+			list[i] = jsonValue(item)
+		}
+		return list
+	}
+	return v
+}
+
+// MergeVars merges sets of variables, variables of later sets take precedence.
+// Values are replaced as a whole, nested mappings are not merged
+func MergeVars(sets ...gin.H) gin.H {
+	vars := gin.H{}
+	for _, set := range sets {
+		for k, v := range set {
+			vars[k] = v
+		}
+	}
+	return vars
+}
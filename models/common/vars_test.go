@@ -0,0 +1,91 @@
+package common
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestVarsMap(t *testing.T) {
+	assert := assert.New(t)
+
+	vars, err := Vars("# deployment\nregion: eu\nreplicas: 3\nzones: [a, b]\ntags:\n  1: one\n").Map()
+	assert.NoError(err)
+	assert.Equal(gin.H{
+		"region":   "eu",
+		"replicas": 3,
+		"zones":    []interface{}{"a", "b"},
+		"tags":     map[string]interface{}{"1": "one"},
+	}, vars)
+
+	vars, err = Vars("{\n\t\"region\": \"eu\",\n\t\"replicas\": 3\n}").Map()
+	assert.NoError(err)
+	assert.Equal(gin.H{"region": "eu", "replicas": 3.0}, vars)
+
+	vars, err = Vars("{region: eu}").Map()
+	assert.NoError(err)
+	assert.Equal(gin.H{"region": "eu"}, vars)
+
+	vars, err = Vars("  \n# nothing yet\n").Map()
+	assert.NoError(err)
+	assert.Empty(vars)
+
+	_, err = Vars("- a\n- b").Map()
+	assert.Error(err, "Lists are not variables")
+	_, err = Vars("region: [eu").Map()
+	assert.Error(err)
+}
+
+func TestVarsUnmarshal(t *testing.T) {
+	assert := assert.New(t)
+
+	var v struct {
+		Vars Vars `json:"vars"`
+	}
+	assert.NoError(json.Unmarshal([]byte(`{"vars": {"region": "eu"}}`), &v))
+	assert.Equal(Vars(`{"region": "eu"}`), v.Vars)
+	assert.NoError(json.Unmarshal([]byte(`{"vars": "region: eu # kept\n"}`), &v))
+	assert.Equal(Vars("region: eu # kept\n"), v.Vars)
+	assert.NoError(json.Unmarshal([]byte(`{"vars": null}`), &v))
+	assert.Equal(Vars(""), v.Vars)
+	assert.Error(json.Unmarshal([]byte(`{"vars": [1]}`), &v))
+
+	// variables stored as documents by earlier versions
+	b, err := bson.Marshal(bson.M{"vars": bson.M{"region": "eu"}})
+	assert.NoError(err)
+	assert.NoError(bson.Unmarshal(b, &v))
+	assert.Equal(Vars(`{"region":"eu"}`), v.Vars)
+
+	b, err = bson.Marshal(bson.M{"vars": Vars("region: eu\n")})
+	assert.NoError(err)
+	assert.NoError(bson.Unmarshal(b, &v))
+	assert.Equal(Vars("region: eu\n"), v.Vars)
+}
+
+func TestMergeVars(t *testing.T) {
+	merged := MergeVars(
+		gin.H{"region": "eu", "size": "small", "tags": gin.H{"team": "web"}},
+		nil,
+		gin.H{"size": "large"},
+		gin.H{"tags": gin.H{"owner": "ops"}},
+	)
+	assert.Equal(t, gin.H{"region": "eu", "size": "large", "tags": gin.H{"owner": "ops"}}, merged)
+}
+
+func TestNewVars(t *testing.T) {
+	vars, err := NewVars(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Vars(""), vars)
+
+	vars, err = NewVars(gin.H{"size": "large"})
+	assert.NoError(t, err)
+	assert.Equal(t, Vars(`{"size":"large"}`), vars)
+
+	// values which cannot be written as JSON fail instead of dropping every variable
+	_, err = NewVars(gin.H{"size": "large", "ratio": math.NaN()})
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package common
+
+import (
+	"time"
+
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending    = "pending"
+	WebhookDeliverySuccessful = "successful"
+	WebhookDeliveryFailed     = "failed"
+	WebhookDeliveryIgnored    = "ignored"
+)
+
+// Webhook configures inbound SCM webhooks of a project. Pushes matching the project branch
+// update the project and launch the job templates on behalf of the user who configured the webhook
+type Webhook struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Secret verifies deliveries, it is encrypted and never returned by the API
+	Secret string `bson:"secret,omitempty" json:"secret" binding:"omitempty,max=256"`
+	// Tags matches pushed tags in addition to the project branch
+	Tags                    bool            `bson:"tags,omitempty" json:"tags"`
+	JobTemplateIDs          []bson.ObjectId `bson:"job_templates,omitempty" json:"job_templates"`
+	TerraformJobTemplateIDs []bson.ObjectId `bson:"terraform_job_templates,omitempty" json:"terraform_job_templates"`
+
+	UserID *bson.ObjectId `bson:"user_id,omitempty" json:"-"`
+}
+
+// WebhookDelivery is the model for webhook_deliveries collection.
+// Deliveries with a valid signature are recorded along with the jobs they started
+type WebhookDelivery struct {
+	ID    bson.ObjectId `bson:"_id" json:"id"`
+	Type  string        `bson:"-" json:"type"`
+	Links gin.H         `bson:"-" json:"links"`
+
+	ProjectID bson.ObjectId `bson:"project_id" json:"project"`
+	Provider  string        `bson:"provider" json:"provider"`
+	Event     string        `bson:"event" json:"event"`
+	GUID      string        `bson:"guid,omitempty" json:"guid"`
+	// Payload is left out of delivery lists
+	Payload string `bson:"payload" json:"payload,omitempty"`
+	// ReceivedGUID is unique for deliveries received from a provider with a GUID, captured deliveries
+	// cannot be replayed. It is not set on redeliveries
+	ReceivedGUID string `bson:"received_guid,omitempty" json:"-"`
+
+	Ref     string `bson:"ref,omitempty" json:"ref"`
+	RefType string `bson:"ref_type,omitempty" json:"ref_type"`
+	SHA     string `bson:"sha,omitempty" json:"sha"`
+	Pusher  string `bson:"pusher,omitempty" json:"pusher"`
+
+	Status          string          `bson:"status" json:"status"`
+	Message         string          `bson:"message,omitempty" json:"message"`
+	ProjectUpdateID *bson.ObjectId  `bson:"project_update_id,omitempty" json:"project_update"`
+	JobIDs          []bson.ObjectId `bson:"jobs,omitempty" json:"jobs"`
+	TerraformJobIDs []bson.ObjectId `bson:"terraform_jobs,omitempty" json:"terraform_jobs"`
+
+	// RedeliveryOfID is the delivery whose payload was delivered again
+	RedeliveryOfID *bson.ObjectId `bson:"redelivery_of_id,omitempty" json:"redelivery_of"`
+	CreatedByID    *bson.ObjectId `bson:"created_by_id,omitempty" json:"-"`
+
+	Created time.Time `bson:"created" json:"created"`
+}
+
+func (WebhookDelivery) GetType() string {
+	return "webhook_delivery"
+}
@@ -11,9 +11,10 @@ import (
 
 // Job constants
 const (
-	JobTypeTerraformJob = "terraform_job" // A terraform job
-	JobLaunchTypeManual = "manual"
-	JobLaunchTypeSystem = "system"
+	JobTypeTerraformJob  = "terraform_job" // A terraform job
+	JobLaunchTypeManual  = "manual"
+	JobLaunchTypeSystem  = "system"
+	JobLaunchTypeWebhook = "webhook"
 )
 
 type Job struct {
@@ -34,7 +35,7 @@ type Job struct {
 	ResultTraceback     string    `bson:"result_traceback" json:"result_traceback"`
 	JobExplanation      string    `bson:"job_explanation" json:"job_explanation"`
 	JobType             string    `bson:"job_type" json:"job_type,terraform_jobtype"`
-	Vars                gin.H     `bson:"vars,omitempty" json:"vars"`
+	Vars                common.Vars `bson:"vars,omitempty" json:"vars"`
 	Parallelism         uint8     `bson:"parallelism" json:"parallelism"`
 	UpdateOnLaunch      bool      `bson:"update_on_launch" json:"update_on_launch"`
 	Target              string          `bson:"target" json:"target"`
@@ -46,10 +47,12 @@ type Job struct {
 	SCMCredentialID     *bson.ObjectId `bson:"scm_credential_id,omitempty" json:"scm_credential"`
 	NetworkCredentialID *bson.ObjectId `bson:"network_credential_id,omitempty" json:"network_credential"`
 	CloudCredentialID   *bson.ObjectId `bson:"cloud_credential_id,omitempty" json:"cloud_credential"`
+	ExtraCredentialIDs  []bson.ObjectId `bson:"extra_credentials,omitempty" json:"extra_credentials"`
 
 	PromptCredential    bool `bson:"prompt_credential" json:"ask_credential_on_launch"`
 	PromptJobType       bool `bson:"prompt_job_type" json:"ask_job_type_on_launch"`
 	PromptVariables     bool `bson:"prompt_variables" json:"ask_variables_on_launch"`
+	PromptExtraCredentials bool `bson:"prompt_extra_credentials" json:"ask_extra_credentials_on_launch"`
 	AllowSimultaneous   bool `bson:"allow_simultaneous,omitempty" json:"allow_simultaneous"`
 
 	// system generated items
@@ -57,6 +60,23 @@ type Job struct {
 	JobARGS             []string `bson:"job_args" json:"job_args"`
 	JobENV              []string `bson:"job_env" json:"job_env"`
 
+	// toolchain which ran the job, empty when binaries on the default PATH were used
+	Toolchain           string   `bson:"toolchain,omitempty" json:"toolchain"`
+	// image of the container which ran the job
+	ExecutionImage      string   `bson:"execution_image,omitempty" json:"execution_image"`
+
+	// timeouts and retry policy of the template
+	Timeout             int      `bson:"timeout,omitempty" json:"timeout"`
+	IdleTimeout         int      `bson:"idle_timeout,omitempty" json:"idle_timeout"`
+	RetryCount          int      `bson:"retry_count,omitempty" json:"retry_count"`
+	RetryBackoff        int      `bson:"retry_backoff,omitempty" json:"retry_backoff"`
+	RetryOn             string   `bson:"retry_on,omitempty" json:"retry_on"`
+	// retries of a failed job refer to the first job, RetryAttempt counts them
+	RetryAttempt        int            `bson:"retry_attempt,omitempty" json:"retry_attempt"`
+	RetryOfID           *bson.ObjectId `bson:"retry_of_id,omitempty" json:"retry_of"`
+	// encrypted answers to password questions of the survey, variables hold them masked
+	SurveyPasswords     map[string]string `bson:"survey_passwords,omitempty" json:"-"`
+
 	CreatedByID         bson.ObjectId `bson:"created_by_id" json:"-"`
 	ModifiedByID        bson.ObjectId `bson:"modified_by_id" json:"-"`
 
@@ -19,11 +19,14 @@ type JobTemplate struct {
 	MachineCredentialID *bson.ObjectId `bson:"credential_id,omitempty" json:"credential"`
 
 	Description         string         `bson:"description,omitempty" json:"description"`
-	Vars                gin.H          `bson:"vars,omitempty" json:"vars"`
+	Vars                common.Vars    `bson:"vars,omitempty" json:"vars" binding:"omitempty,vars"`
 	PromptVariables     bool           `bson:"ask_variables_on_launch,omitempty" json:"ask_variables_on_launch"`
 	CloudCredentialID   *bson.ObjectId `bson:"cloud_credential_id,omitempty" json:"cloud_credential"`
 	NetworkCredentialID *bson.ObjectId `bson:"network_credential_id,omitempty" json:"network_credential"`
 	SCMCredentialID     *bson.ObjectId `bson:"scm_credential_id,omitempty" json:"scm_credential_id"`
+	// extra cloud credentials are injected along with the cloud credential, at most one per kind
+	ExtraCredentialIDs     []bson.ObjectId `bson:"extra_credentials,omitempty" json:"extra_credentials"`
+	PromptExtraCredentials bool            `bson:"prompt_extra_credentials,omitempty" json:"ask_extra_credentials_on_launch"`
 	PromptCredential    bool           `bson:"prompt_credential,omitempty" json:"ask_credential_on_launch"`
 	PromptJobType       bool           `bson:"prompt_job_type,omitempty" json:"ask_job_type_on_launch"`
 	AllowSimultaneous   bool           `bson:"allow_simultaneous,omitempty" json:"allow_simultaneous"`
@@ -31,6 +34,23 @@ type JobTemplate struct {
 	UpdateOnLaunch      bool           `bson:"update_on_launch" json:"update_on_launch"`
 	Target              string         `bson:"target" json:"target"`
 	Directory           string         `bson:"directory" json:"directory"`
+
+	// registered toolchain which runs jobs, overrides the toolchain of the project
+	Toolchain           string         `bson:"toolchain,omitempty" json:"toolchain"`
+	// image of containers which run jobs, the default execution image is used when it is empty
+	ExecutionImage      string         `bson:"execution_image,omitempty" json:"execution_image"`
+	// seconds before running jobs are killed, the terraform job timeout is used when it is 0
+	Timeout             int            `bson:"timeout,omitempty" json:"timeout" binding:"omitempty,min=0"`
+	// seconds running jobs may write no output before they are killed, 0 disables the idle timeout
+	IdleTimeout         int            `bson:"idle_timeout,omitempty" json:"idle_timeout" binding:"omitempty,min=0"`
+	// failed jobs are relaunched up to RetryCount times, RetryBackoff seconds after the failure
+	// doubled with every attempt. RetryOn restricts retries to errors
+	RetryCount          int            `bson:"retry_count,omitempty" json:"retry_count" binding:"omitempty,min=0,max=10"`
+	RetryBackoff        int            `bson:"retry_backoff,omitempty" json:"retry_backoff" binding:"omitempty,min=0"`
+	RetryOn             string         `bson:"retry_on,omitempty" json:"retry_on" binding:"omitempty,retry_on"`
+	// questions asked on launch, the answers are passed to jobs as variables
+	SurveyEnabled       bool              `bson:"survey_enabled,omitempty" json:"survey_enabled"`
+	SurveySpec          common.SurveySpec `bson:"survey_spec,omitempty" json:"survey_spec" binding:"omitempty,dive"`
 	// output only
 	LastJobRun          *time.Time     `bson:"last_job_run,omitempty" json:"last_job_run" binding:"omitempty,naproperty"`
 	NextJobRun          *time.Time     `bson:"next_job_run,omitempty" json:"next_job_run" binding:"omitempty,naproperty"`
@@ -66,13 +86,9 @@ func (org JobTemplate) GetRoles() []common.AccessControl {
 }
 
 func (jt JobTemplate) GetOrganizationID() (bson.ObjectId, error) {
-	var org common.Organization
-	pID, err := jt.GetProjectID()
-	if err != nil {
-		return org.ID, err
-	}
-	err = db.Organizations().FindId(pID).One(&org)
-	return org.ID, err
+	var prj common.Project
+	err := db.Projects().FindId(jt.ProjectID).One(&prj)
+	return prj.OrganizationID, err
 }
 
 func (jt JobTemplate) GetProjectID() (bson.ObjectId, error) {
@@ -103,6 +119,7 @@ func (jt *JobTemplate) MachineCredentialExist() bool {
 		"kind": bson.M{
 			"$in": []string{
 				common.CredentialKindSSH,
+				common.CredentialKindSSHCA,
 				common.CredentialKindWIN,
 			},
 		},
@@ -125,17 +142,7 @@ func (jt *JobTemplate) NetworkCredentialExist() bool {
 func (jt *JobTemplate) CloudCredentialExist() bool {
 	query := bson.M{
 		"_id": jt.CloudCredentialID,
-		"kind": bson.M{
-			"$in": []string{
-				common.CredentialKindAWS,
-				common.CredentialKindAZURE,
-				common.CredentialKindCLOUDFORMS,
-				common.CredentialKindGCE,
-				common.CredentialKindOPENSTACK,
-				common.CredentialKindSATELLITE6,
-				common.CredentialKindVMWARE,
-			},
-		},
+		"kind": bson.M{"$in": common.CloudCredentialKinds},
 	}
 	count, err := db.Credentials().Find(query).Count()
 	if err == nil && count > 0 {
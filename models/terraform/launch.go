@@ -1,12 +1,14 @@
 package terraform
 
 import (
-	"gopkg.in/gin-gonic/gin.v1"
+	"github.com/pearsonappeng/tensor/models/common"
 	"gopkg.in/mgo.v2/bson"
 )
 
 type Launch struct {
-	Vars                gin.H          `bson:"vars,omitempty" json:"vars,omitempty"`
+	Vars                common.Vars    `bson:"vars,omitempty" json:"vars,omitempty" binding:"omitempty,vars"`
 	JobType             string         `bson:"job_type,omitempty" json:"job_type,omitempty" binding:"omitempty,terraform_jobtype"`
 	MachineCredentialID *bson.ObjectId `bson:"credential_id,omitempty" json:"credential,omitempty"`
+	// replaces extra credentials of the template when provided, an empty list removes them
+	ExtraCredentialIDs *[]bson.ObjectId `bson:"extra_credentials,omitempty" json:"extra_credentials,omitempty"`
 }
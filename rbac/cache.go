@@ -0,0 +1,150 @@
+package rbac
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CacheTTL is how long team memberships, organization grants and custom role
+// lookups are reused before being queried again. The cache is cleared whenever
+// roles are associated or disassociated through this package and when teams,
+// organizations or users are deleted
+var CacheTTL = 10 * time.Second
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+var cache = struct {
+	sync.Mutex
+	entries map[string]cacheEntry
+}{entries: map[string]cacheEntry{}}
+
+func cacheGet(key string) (interface{}, bool) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	entry, ok := cache.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		delete(cache.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func cacheSet(key string, value interface{}) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.entries[key] = cacheEntry{value: value, expires: time.Now().Add(CacheTTL)}
+}
+
+// Invalidate clears cached permission data, call it after changing role grants
+// or custom roles and after deleting teams, organizations or users
+func Invalidate() {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.entries = map[string]cacheEntry{}
+}
+
+// userTeams returns IDs of the teams the user is a member of
+func userTeams(user common.User) []bson.ObjectId {
+	key := "teams:" + user.ID.Hex()
+	if v, ok := cacheGet(key); ok {
+		return v.([]bson.ObjectId)
+	}
+
+	teams := []bson.ObjectId{}
+	var tmpTeam common.Team
+	iter := db.Teams().Find(bson.M{
+		"roles": bson.M{"$elemMatch": bson.M{"type": RoleTypeUser, "grantee_id": user.ID}},
+	}).Select(bson.M{"_id": 1}).Iter()
+	for iter.Next(&tmpTeam) {
+		teams = append(teams, tmpTeam.ID)
+	}
+	if err := iter.Close(); err != nil {
+		logrus.Errorln("Error while retrieving teams of the user:", err)
+		return teams
+	}
+
+	cacheSet(key, teams)
+	return teams
+}
+
+// customRoles returns names of the custom roles which include the permission
+func customRoles(permission string) []string {
+	key := "roles:" + permission
+	if v, ok := cacheGet(key); ok {
+		return v.([]string)
+	}
+
+	names := []string{}
+	var tmpRole common.Role
+	iter := db.Roles().Find(bson.M{"permissions": permission}).Select(bson.M{"name": 1}).Iter()
+	for iter.Next(&tmpRole) {
+		names = append(names, tmpRole.Name)
+	}
+	if err := iter.Close(); err != nil {
+		logrus.Errorln("Error while retrieving custom roles:", err)
+		return names
+	}
+
+	cacheSet(key, names)
+	return names
+}
+
+// userOrganizations returns IDs of the organizations on which
+// the user holds a role that grants the permission
+func userOrganizations(user common.User, permission string) ([]bson.ObjectId, error) {
+	key := "organizations:" + user.ID.Hex() + ":" + permission
+	if v, ok := cacheGet(key); ok {
+		return v.([]bson.ObjectId), nil
+	}
+
+	orgs := []bson.ObjectId{}
+	var tmpOrganization common.Organization
+	iter := db.Organizations().Find(grantFilter(user, rolesWith(ResourceOrganization, permission))).
+		Select(bson.M{"_id": 1}).Iter()
+	for iter.Next(&tmpOrganization) {
+		orgs = append(orgs, tmpOrganization.ID)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	cacheSet(key, orgs)
+	return orgs, nil
+}
+
+// grantFilter returns a filter matching objects on which one of the roles
+// is granted to the user or one of the user's teams
+func grantFilter(user common.User, roles []string) bson.M {
+	return bson.M{"$or": grantConditions(user, roles)}
+}
+
+func grantConditions(user common.User, roles []string) []bson.M {
+	grants := []bson.M{
+		{"roles": bson.M{"$elemMatch": bson.M{
+			"type":       RoleTypeUser,
+			"grantee_id": user.ID,
+			"role":       bson.M{"$in": roles},
+		}}},
+	}
+
+	if teams := userTeams(user); len(teams) > 0 {
+		grants = append(grants, bson.M{"roles": bson.M{"$elemMatch": bson.M{
+			"type":       RoleTypeTeam,
+			"grantee_id": bson.M{"$in": teams},
+			"role":       bson.M{"$in": roles},
+		}}})
+	}
+
+	return grants
+}
@@ -0,0 +1,35 @@
+package rbac
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheTTL(t *testing.T) {
+	ttl := CacheTTL
+	defer func() { CacheTTL = ttl }()
+	defer Invalidate()
+
+	CacheTTL = 20 * time.Millisecond
+	cacheSet("roles:project:read", []string{"viewer"})
+	v, ok := cacheGet("roles:project:read")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"viewer"}, v)
+
+	time.Sleep(2 * CacheTTL)
+	_, ok = cacheGet("roles:project:read")
+	assert.False(t, ok, "Entries expire after the TTL")
+}
+
+func TestInvalidate(t *testing.T) {
+	cacheSet("teams:user", []string{})
+	cacheSet("roles:project:read", []string{})
+	Invalidate()
+
+	_, ok := cacheGet("teams:user")
+	assert.False(t, ok)
+	_, ok = cacheGet("roles:project:read")
+	assert.False(t, ok)
+}
@@ -14,97 +14,27 @@ const (
 
 type Credential struct{}
 
-func (Credential) Read(user common.User, credential common.Credential) bool {
-	// allow access if the user is super user or
-	// a system auditor
-	if HasGlobalRead(user) {
-		return true
-	}
-
-	if credential.OrganizationID != nil {
-		// Organization can be empty in credential objects
-		if IsOrganizationAdmin(*credential.OrganizationID, user.ID) {
-			return true
-		}
-
-	}
-
-	var teams []bson.ObjectId
-	// Check whether the user has access to object
-	// using roles list
-	// if object has granted team get those teams to list
-	for _, v := range credential.Roles {
-		if v.Type == "team" {
-			teams = append(teams, v.GranteeID)
-		}
-
-		if v.Type == "user" && v.GranteeID == user.ID {
-			return true
-		}
-	}
-
-	// check team permissions of the user,
-	// and team has admin and update privileges
-	query := bson.M{
-		"_id:":             bson.M{"$in": teams},
-		"roles.grantee_id": user.ID,
-	}
-	count, err := db.Teams().Find(query).Count()
-
-	if err != nil {
-		logrus.Errorln("Error while checking the user is granted teams' memeber:", err)
-	}
-	if count > 0 {
-		return true
-	}
+func (c Credential) Read(user common.User, credential common.Credential) bool {
+	return HasPermission(user, c.resource(credential), Permission(ResourceCredential, ActionRead))
+}
 
-	return false
+func (c Credential) Write(user common.User, credential common.Credential) bool {
+	return HasPermission(user, c.resource(credential), Permission(ResourceCredential, ActionWrite))
 }
 
-func (Credential) Write(user common.User, credential common.Credential) bool {
-	// allow access if the user is super user or
-	// a system auditor
-	if HasGlobalWrite(user) {
-		return true
-	}
+// Use reports whether the user can reference the credential in templates,
+// projects and job launches
+func (c Credential) Use(user common.User, credential common.Credential) bool {
+	return HasPermission(user, c.resource(credential), Permission(ResourceCredential, ActionUse))
+}
 
+func (Credential) resource(credential common.Credential) Resource {
+	r := Resource{Type: ResourceCredential, Roles: credential.Roles}
+	// Organization can be empty in credential objects
 	if credential.OrganizationID != nil {
-		// Organization can be empty in credential objects
-		if IsOrganizationAdmin(*credential.OrganizationID, user.ID) {
-			return true
-		}
+		r.OrganizationID = *credential.OrganizationID
 	}
-
-	var teams []bson.ObjectId
-	// Check whether the user has access to object
-	// using roles list
-	// if object has granted team get those teams to list
-	for _, v := range credential.Roles {
-		if v.Type == "team" && v.Role == CredentialAdmin {
-			teams = append(teams, v.GranteeID)
-		}
-
-		if v.Type == "user" && v.GranteeID == user.ID && v.Role == CredentialAdmin {
-			return true
-		}
-	}
-
-	// check team permissions of the user,
-	// and team has admin and update privileges
-	query := bson.M{
-		"_id:":             bson.M{"$in": teams},
-		"roles.grantee_id": user.ID,
-	}
-	count, err := db.Teams().Find(query).Count()
-
-	if err != nil {
-		logrus.Errorln("Error while checking the user is granted teams' memeber:", err)
-	}
-	if count > 0 {
-		return true
-	}
-
-	return false
+	return r
 }
 
 func (c Credential) ReadByID(user common.User, credentialID bson.ObjectId) bool {
@@ -118,6 +48,18 @@ func (c Credential) ReadByID(user common.User, credentialID bson.ObjectId) bool
 	return c.Read(user, credential)
 }
 
+func (c Credential) UseByID(user common.User, credentialID bson.ObjectId) bool {
+	var credential common.Credential
+	if err := db.Credentials().FindId(credentialID).One(&credential); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Credential ID": credentialID.Hex(),
+			"Error":         err.Error(),
+		}).Warnln("Error while retrieving credential")
+		return false
+	}
+	return c.Use(user, credential)
+}
+
 func (Credential) Associate(resourceID bson.ObjectId, grantee bson.ObjectId, roleType string, role string) (err error) {
 	access := bson.M{"$addToSet": bson.M{"roles": common.AccessControl{Type: roleType, GranteeID: grantee, Role: role}}}
 
@@ -129,6 +71,7 @@ func (Credential) Associate(resourceID bson.ObjectId, grantee bson.ObjectId, rol
 		}).Errorln("Unable to associate role")
 	}
 
+	Invalidate()
 	return
 }
 
@@ -143,5 +86,6 @@ func (Credential) Disassociate(resourceID bson.ObjectId, grantee bson.ObjectId,
 		}).Errorln("Unable to disassociate role")
 	}
 
+	Invalidate()
 	return
 }
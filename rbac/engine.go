@@ -52,7 +52,7 @@ func HasOrganizationRead(orgID bson.ObjectId, userID bson.ObjectId) bool {
 
 func IsInTeams(userID bson.ObjectId, teams []bson.ObjectId) bool {
 	if count, err := db.Teams().Find(bson.M{
-		"_id:":             bson.M{"$in": teams},
+		"_id":              bson.M{"$in": teams},
 		"roles.grantee_id": userID,
 	}).Count(); count > 0 && err == nil {
 		return true
@@ -17,86 +17,21 @@ const (
 
 type Inventory struct{}
 
-func (Inventory) Read(user common.User, inventory ansible.Inventory) bool {
-	// Allow access if the user is super user or
-	// a system auditor
-	if HasGlobalRead(user) {
-		return true
-	}
-
-	// check whether the user is an member of the objects' organization
-	// since this is write permission it is must user need to be an admin
-	if IsOrganizationAdmin(inventory.OrganizationID, user.ID) {
-		return true
-	}
-
-	var teams []bson.ObjectId
-	// Check whether the user has access to object
-	// using roles list
-	// if object has granted team get those teams to list
-	for _, v := range inventory.GetRoles() {
-		if v.Type == "team" {
-			teams = append(teams, v.GranteeID)
-		}
-
-		if v.Type == "user" && v.GranteeID == user.ID {
-			return true
-		}
-	}
-
-	// Check team permissions of the user,
-	// and team has admin and update privileges
-	query := bson.M{"_id:": bson.M{"$in": teams}, "roles.grantee_id": user.ID}
-	count, err := db.Teams().Find(query).Count()
-	if err != nil {
-		logrus.Errorln("Error while checking the user is granted teams' memeber:", err)
-	}
-	if count > 0 {
-		return true
-	}
-
-	return false
+func (i Inventory) Read(user common.User, inventory ansible.Inventory) bool {
+	return HasPermission(user, i.resource(inventory), Permission(ResourceInventory, ActionRead))
 }
 
-func (Inventory) Write(user common.User, inventory ansible.Inventory) bool {
-	// Allow access if the user is super user or
-	// a system auditor
-	if HasGlobalWrite(user) {
-		return true
-	}
-
-	// check whether the user is an member of the objects' organization
-	// since this is write permission it is must user need to be an admin
-	if IsOrganizationAdmin(inventory.OrganizationID, user.ID) {
-		return true
-	}
-
-	var teams []bson.ObjectId
-	// Check whether the user has access to object
-	// using roles list
-	// if object has granted team get those teams to list
-	for _, v := range inventory.Roles {
-		if v.Type == "team" && (v.Role == InventoryAdmin || v.Role == InventoryUpdate) {
-			teams = append(teams, v.GranteeID)
-		}
-
-		if v.Type == "user" && v.GranteeID == user.ID && (v.Role == InventoryAdmin || v.Role == InventoryUpdate) {
-			return true
-		}
-	}
+func (i Inventory) Write(user common.User, inventory ansible.Inventory) bool {
+	return HasPermission(user, i.resource(inventory), Permission(ResourceInventory, ActionWrite))
+}
 
-	// Check team permissions of the user,
-	// and team has admin and update privileges
-	query := bson.M{"_id:": bson.M{"$in": teams}, "roles.grantee_id": user.ID}
-	count, err := db.Teams().Find(query).Count()
-	if err != nil {
-		logrus.Errorln("Error while checking the user is granted teams' memeber:", err)
-	}
-	if count > 0 {
-		return true
-	}
+// UpdateHosts reports whether the user can modify hosts and groups of the inventory
+func (i Inventory) UpdateHosts(user common.User, inventory ansible.Inventory) bool {
+	return HasPermission(user, i.resource(inventory), Permission(ResourceInventory, ActionUpdateHosts))
+}
 
-	return false
+func (Inventory) resource(inventory ansible.Inventory) Resource {
+	return Resource{Type: ResourceInventory, OrganizationID: inventory.OrganizationID, Roles: inventory.Roles}
 }
 
 func (i Inventory) ReadByID(user common.User, inventoryID bson.ObjectId) bool {
@@ -121,6 +56,16 @@ func (i Inventory) WriteByID(user common.User, inventoryID bson.ObjectId) bool {
 	return i.Write(user, inventory)
 }
 
+func (i Inventory) UpdateHostsByID(user common.User, inventoryID bson.ObjectId) bool {
+	var inventory ansible.Inventory
+	if err := db.Inventories().FindId(inventoryID).One(&inventory); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		})
+		return false
+	}
+	return i.UpdateHosts(user, inventory)
+}
 func (Inventory) Associate(resourceID bson.ObjectId, grantee bson.ObjectId, roleType string, role string) (err error) {
 	access := bson.M{"$addToSet": bson.M{"roles": common.AccessControl{Type: roleType, GranteeID: grantee, Role: role}}}
 
@@ -132,6 +77,7 @@ func (Inventory) Associate(resourceID bson.ObjectId, grantee bson.ObjectId, role
 		}).Errorln("Unable to assign the role")
 	}
 
+	Invalidate()
 	return
 }
 
@@ -146,5 +92,6 @@ func (Inventory) Disassociate(resourceID bson.ObjectId, grantee bson.ObjectId, r
 		}).Errorln("Unable to disassociate role")
 	}
 
+	Invalidate()
 	return
 }
@@ -16,116 +16,25 @@ const (
 
 type JobTemplate struct{}
 
-func (JobTemplate) Read(user common.User, jtemplate ansible.JobTemplate) bool {
-	// Allow access if the user is super user or
-	// a system auditor
-	if HasGlobalRead(user) {
-		return true
-	}
-
-	if jtemplate.MachineCredentialID != nil {
-		return new(Credential).ReadByID(user, *jtemplate.MachineCredentialID)
-	}
-
-	if jtemplate.CloudCredentialID != nil {
-		return new(Credential).ReadByID(user, *jtemplate.CloudCredentialID)
-	}
-
-	if jtemplate.NetworkCredentialID != nil {
-		return new(Credential).ReadByID(user, *jtemplate.NetworkCredentialID)
-	}
-
-	if new(Inventory).ReadByID(user, jtemplate.InventoryID) {
-		return true
-	}
-
-	if new(Project).ReadByID(user, jtemplate.ProjectID) {
-		return true
-	}
-
-	if orgID, err := jtemplate.GetOrganizationID(); err != nil {
-		// check whether the user is an member of the objects' organization
-		// since this is write permission it is must user need to be an admin
-		if IsOrganizationAdmin(orgID, user.ID) {
-			return true
-		}
-	}
-
-	var teams []bson.ObjectId
-	// check whether the user has access to object
-	// using roles list
-	// if object has granted team get those teams to list
-	for _, v := range jtemplate.GetRoles() {
-		if v.Type == RoleTypeTeam {
-			teams = append(teams, v.GranteeID)
-		}
-
-		if v.Type == RoleTypeUser && v.GranteeID == user.ID {
-			return true
-		}
-	}
-
-	// check team permissions of the user,
-	// and team has admin and update privileges
-	query := bson.M{
-		"_id:":             bson.M{"$in": teams},
-		"roles.grantee_id": user.ID,
-	}
-	count, err := db.Teams().Find(query).Count()
-	if err != nil {
-		logrus.Errorln("Error while checking the user is granted teams' memeber:", err)
-	}
-	if count > 0 {
-		return true
-	}
-
-	return false
+func (j JobTemplate) Read(user common.User, jtemplate ansible.JobTemplate) bool {
+	return HasPermission(user, j.resource(jtemplate), Permission(ResourceJobTemplate, ActionRead))
 }
 
-func (JobTemplate) Write(user common.User, jtemplate ansible.JobTemplate) bool {
-	// Allow access if the user is super user or
-	// a system auditor
-	if HasGlobalWrite(user) {
-		return true
-	}
-
-	if orgID, err := jtemplate.GetOrganizationID(); err != nil {
-		// check whether the user is an member of the objects' organization
-		// since this is write permission it is must user need to be an admin
-		if IsOrganizationAdmin(orgID, user.ID) {
-			return true
-		}
-	}
+func (j JobTemplate) Write(user common.User, jtemplate ansible.JobTemplate) bool {
+	return HasPermission(user, j.resource(jtemplate), Permission(ResourceJobTemplate, ActionWrite))
+}
 
-	var teams []bson.ObjectId
-	// check whether the user has access to object
-	// using roles list
-	// if object has granted team get those teams to list
-	for _, v := range jtemplate.GetRoles() {
-		if v.Type == RoleTypeTeam && (v.Role == JobTemplateAdmin || v.Role == JobTemplateExecute) {
-			teams = append(teams, v.GranteeID)
-		}
-
-		if v.Type == RoleTypeUser && v.GranteeID == user.ID && (v.Role == JobTemplateAdmin || v.Role == JobTemplateExecute) {
-			return true
-		}
-	}
+// Launch reports whether the user can launch jobs from the job template
+func (j JobTemplate) Launch(user common.User, jtemplate ansible.JobTemplate) bool {
+	return HasPermission(user, j.resource(jtemplate), Permission(ResourceJobTemplate, ActionLaunch))
+}
 
-	// check team permissions of the user,
-	// and team has admin and update privileges
-	query := bson.M{
-		"_id:":             bson.M{"$in": teams},
-		"roles.grantee_id": user.ID,
+func (JobTemplate) resource(jtemplate ansible.JobTemplate) Resource {
+	r := Resource{Type: ResourceJobTemplate, Roles: jtemplate.Roles}
+	if orgID, err := jtemplate.GetOrganizationID(); err == nil {
+		r.OrganizationID = orgID
 	}
-	count, err := db.Teams().Find(query).Count()
-	if err != nil {
-		logrus.Errorln("Error while checking the user is granted teams' memeber:", err)
-	}
-	if count > 0 {
-		return true
-	}
-
-	return false
+	return r
 }
 
 func (j JobTemplate) ReadByID(user common.User, templateID bson.ObjectId) bool {
@@ -161,6 +70,7 @@ func (JobTemplate) Associate(resourceID bson.ObjectId, grantee bson.ObjectId, ro
 		}).Errorln("Unable to assign the role, an error occured")
 	}
 
+	Invalidate()
 	return
 }
 
@@ -175,5 +85,6 @@ func (JobTemplate) Disassociate(resourceID bson.ObjectId, grantee bson.ObjectId,
 		}).Errorln("Unable to disassociate role")
 	}
 
+	Invalidate()
 	return
 }
@@ -15,37 +15,16 @@ const (
 
 type Organization struct{}
 
-func (Organization) Read(user common.User, organization common.Organization) bool {
-	// Allow access if the user is super user or
-	// a system auditor
-	if HasGlobalRead(user) {
-		return true
-	}
-
-	for _, v := range organization.Roles {
-		if v.Type == RoleTypeUser && v.GranteeID == user.ID {
-			// Any Organization Role could read
-			return true
-		}
-	}
-
-	return false
+func (o Organization) Read(user common.User, organization common.Organization) bool {
+	return HasPermission(user, o.resource(organization), Permission(ResourceOrganization, ActionRead))
 }
 
-func (Organization) Write(user common.User, organization common.Organization) bool {
-	// Allow access if the user is super user or
-	// a system auditor
-	if HasGlobalWrite(user) {
-		return true
-	}
-
-	for _, v := range organization.Roles {
-		if v.Type == RoleTypeUser && v.GranteeID == user.ID && v.Role == OrganizationAdmin {
-			return true
-		}
-	}
+func (o Organization) Write(user common.User, organization common.Organization) bool {
+	return HasPermission(user, o.resource(organization), Permission(ResourceOrganization, ActionWrite))
+}
 
-	return false
+func (Organization) resource(organization common.Organization) Resource {
+	return Resource{Type: ResourceOrganization, OrganizationID: organization.ID, Roles: organization.Roles}
 }
 
 func (o Organization) WriteByID(user common.User, organizationID bson.ObjectId) bool {
@@ -70,6 +49,7 @@ func (Organization) Associate(resourceID bson.ObjectId, grantee bson.ObjectId, r
 		}).Errorln("Unable to assign the role, an error occured")
 	}
 
+	Invalidate()
 	return
 }
 
@@ -84,5 +64,6 @@ func (Organization) Disassociate(resourceID bson.ObjectId, grantee bson.ObjectId
 		}).Errorln("Unable to disassociate role")
 	}
 
+	Invalidate()
 	return
 }
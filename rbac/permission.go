@@ -0,0 +1,315 @@
+package rbac
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Resource types that roles can be granted on
+const (
+	ResourceOrganization         = "organization"
+	ResourceCredential           = "credential"
+	ResourceProject              = "project"
+	ResourceInventory            = "inventory"
+	ResourceJobTemplate          = "job_template"
+	ResourceTerraformJobTemplate = "terraform_job_template"
+	ResourceTeam                 = "team"
+)
+
+// Actions that can be performed on a resource, a permission
+// is a resource type and an action joined by a colon eg. job_template:launch
+const (
+	ActionRead        = "read"
+	ActionWrite       = "write"
+	ActionUse         = "use"
+	ActionUpdate      = "update"
+	ActionUpdateHosts = "update_hosts"
+	ActionLaunch      = "launch"
+)
+
+// Permission returns the permission for the action on the resource type
+func Permission(resourceType, action string) string {
+	return resourceType + ":" + action
+}
+
+// Permissions lists every permission that can be included in a role
+var Permissions = []string{
+	Permission(ResourceOrganization, ActionRead),
+	Permission(ResourceOrganization, ActionWrite),
+	Permission(ResourceCredential, ActionRead),
+	Permission(ResourceCredential, ActionWrite),
+	Permission(ResourceCredential, ActionUse),
+	Permission(ResourceProject, ActionRead),
+	Permission(ResourceProject, ActionWrite),
+	Permission(ResourceProject, ActionUse),
+	Permission(ResourceProject, ActionUpdate),
+	Permission(ResourceInventory, ActionRead),
+	Permission(ResourceInventory, ActionWrite),
+	Permission(ResourceInventory, ActionUse),
+	Permission(ResourceInventory, ActionUpdateHosts),
+	Permission(ResourceJobTemplate, ActionRead),
+	Permission(ResourceJobTemplate, ActionWrite),
+	Permission(ResourceJobTemplate, ActionLaunch),
+	Permission(ResourceTerraformJobTemplate, ActionRead),
+	Permission(ResourceTerraformJobTemplate, ActionWrite),
+	Permission(ResourceTerraformJobTemplate, ActionLaunch),
+	Permission(ResourceTeam, ActionRead),
+	Permission(ResourceTeam, ActionWrite),
+}
+
+// builtinRoles maps the built-in roles of each resource type to their permissions
+var builtinRoles = map[string]map[string][]string{
+	ResourceOrganization: {
+		OrganizationAdmin:   Permissions,
+		OrganizationAuditor: readPermissions(),
+		OrganizationMember: {
+			Permission(ResourceOrganization, ActionRead),
+			Permission(ResourceTeam, ActionRead),
+		},
+	},
+	ResourceCredential: {
+		CredentialAdmin: {
+			Permission(ResourceCredential, ActionRead),
+			Permission(ResourceCredential, ActionWrite),
+			Permission(ResourceCredential, ActionUse),
+		},
+		// use allows referencing the credential without seeing any of its fields
+		CredentialUse: {
+			Permission(ResourceCredential, ActionUse),
+		},
+	},
+	ResourceProject: {
+		ProjectAdmin: {
+			Permission(ResourceProject, ActionRead),
+			Permission(ResourceProject, ActionWrite),
+			Permission(ResourceProject, ActionUse),
+			Permission(ResourceProject, ActionUpdate),
+		},
+		ProjectUse: {
+			Permission(ResourceProject, ActionRead),
+			Permission(ResourceProject, ActionUse),
+		},
+		ProjectUpdate: {
+			Permission(ResourceProject, ActionRead),
+			Permission(ResourceProject, ActionUpdate),
+		},
+	},
+	ResourceInventory: {
+		InventoryAdmin: {
+			Permission(ResourceInventory, ActionRead),
+			Permission(ResourceInventory, ActionWrite),
+			Permission(ResourceInventory, ActionUse),
+			Permission(ResourceInventory, ActionUpdateHosts),
+		},
+		InventoryUse: {
+			Permission(ResourceInventory, ActionRead),
+			Permission(ResourceInventory, ActionUse),
+		},
+		InventoryUpdate: {
+			Permission(ResourceInventory, ActionRead),
+			Permission(ResourceInventory, ActionUpdateHosts),
+		},
+	},
+	ResourceJobTemplate: {
+		JobTemplateAdmin: {
+			Permission(ResourceJobTemplate, ActionRead),
+			Permission(ResourceJobTemplate, ActionWrite),
+			Permission(ResourceJobTemplate, ActionLaunch),
+		},
+		JobTemplateExecute: {
+			Permission(ResourceJobTemplate, ActionRead),
+			Permission(ResourceJobTemplate, ActionLaunch),
+		},
+	},
+	ResourceTerraformJobTemplate: {
+		JobTemplateAdmin: {
+			Permission(ResourceTerraformJobTemplate, ActionRead),
+			Permission(ResourceTerraformJobTemplate, ActionWrite),
+			Permission(ResourceTerraformJobTemplate, ActionLaunch),
+		},
+		JobTemplateExecute: {
+			Permission(ResourceTerraformJobTemplate, ActionRead),
+			Permission(ResourceTerraformJobTemplate, ActionLaunch),
+		},
+	},
+	ResourceTeam: {
+		TeamAdmin: {
+			Permission(ResourceTeam, ActionRead),
+			Permission(ResourceTeam, ActionWrite),
+		},
+		TeamMember: {
+			Permission(ResourceTeam, ActionRead),
+		},
+	},
+}
+
+func readPermissions() []string {
+	var perms []string
+	for _, v := range Permissions {
+		if strings.HasSuffix(v, ":"+ActionRead) {
+			perms = append(perms, v)
+		}
+	}
+	return perms
+}
+
+// IsValidPermission reports whether the permission is a known permission
+func IsValidPermission(permission string) bool {
+	for _, v := range Permissions {
+		if v == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBuiltinRole reports whether the name is used by a built-in role of any resource type
+func IsBuiltinRole(name string) bool {
+	for _, roles := range builtinRoles {
+		if _, ok := roles[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// BuiltinRoles returns the names of the built-in roles of the resource type
+func BuiltinRoles(resourceType string) []string {
+	var names []string
+	for k := range builtinRoles[resourceType] {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsValidRole reports whether the role can be granted on the resource type,
+// either a built-in role of the resource type or a custom role
+func IsValidRole(resourceType string, role string) bool {
+	if _, ok := builtinRoles[resourceType][role]; ok {
+		return true
+	}
+	if IsBuiltinRole(role) {
+		return false
+	}
+	count, err := db.Roles().Find(bson.M{"name": role}).Count()
+	return err == nil && count > 0
+}
+
+// Resource describes an object that permissions are evaluated against
+type Resource struct {
+	Type           string
+	OrganizationID bson.ObjectId
+	Roles          []common.AccessControl
+}
+
+// HasPermission reports whether the user holds the permission on the resource.
+// Permissions are granted to super users, system auditors for read actions,
+// roles granted on the resource to the user or the user's teams and
+// roles granted on the organization the resource belongs to
+func HasPermission(user common.User, resource Resource, permission string) bool {
+	if HasGlobalWrite(user) {
+		return true
+	}
+
+	if HasGlobalRead(user) && strings.HasSuffix(permission, ":"+ActionRead) {
+		return true
+	}
+
+	if hasRolePermission(resource.Type, grantedRoles(user, resource.Roles), permission) {
+		return true
+	}
+
+	if resource.Type == ResourceOrganization || len(resource.OrganizationID) == 0 {
+		return false
+	}
+
+	var organization common.Organization
+	if err := db.Organizations().FindId(resource.OrganizationID).One(&organization); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Organization ID": resource.OrganizationID.Hex(),
+			"Error":           err.Error(),
+		}).Warnln("Error while retrieving resource organization")
+		return false
+	}
+
+	return hasRolePermission(ResourceOrganization, grantedRoles(user, organization.Roles), permission)
+}
+
+// grantedRoles returns the roles granted to the user
+// directly or through team membership
+func grantedRoles(user common.User, roles []common.AccessControl) []string {
+	var granted []string
+	var teams []bson.ObjectId
+
+	for _, v := range roles {
+		switch v.Type {
+		case RoleTypeUser:
+			if v.GranteeID == user.ID {
+				granted = append(granted, v.Role)
+			}
+		case RoleTypeTeam:
+			if teams == nil {
+				teams = userTeams(user)
+			}
+			if containsID(teams, v.GranteeID) {
+				granted = append(granted, v.Role)
+			}
+		}
+	}
+
+	return granted
+}
+
+// hasRolePermission reports whether any of the roles grants the permission.
+// Built-in roles are resolved for the resource type, anything else is looked up as a custom role
+func hasRolePermission(resourceType string, roles []string, permission string) bool {
+	for _, role := range roles {
+		if perms, ok := builtinRoles[resourceType][role]; ok {
+			if containsString(perms, permission) {
+				return true
+			}
+			continue
+		}
+		if containsString(customRoles(permission), role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rolesWith returns names of the built-in roles of the resource type
+// and custom roles which grant the permission
+func rolesWith(resourceType string, permission string) []string {
+	names := []string{}
+	for name, perms := range builtinRoles[resourceType] {
+		if containsString(perms, permission) {
+			names = append(names, name)
+		}
+	}
+	return append(names, customRoles(permission)...)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsID(ids []bson.ObjectId, id bson.ObjectId) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
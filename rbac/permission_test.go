@@ -0,0 +1,185 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestBuiltinRolePermissions(t *testing.T) {
+	Invalidate()
+	expected := map[string]map[string][]string{
+		ResourceOrganization: {
+			OrganizationAdmin: Permissions,
+			OrganizationAuditor: {"organization:read", "credential:read", "project:read", "inventory:read",
+				"job_template:read", "terraform_job_template:read", "team:read"},
+			OrganizationMember: {"organization:read", "team:read"},
+		},
+		ResourceCredential: {
+			CredentialAdmin: {"credential:read", "credential:write", "credential:use"},
+			CredentialUse:   {"credential:use"},
+		},
+		ResourceProject: {
+			ProjectAdmin:  {"project:read", "project:write", "project:use", "project:update"},
+			ProjectUse:    {"project:read", "project:use"},
+			ProjectUpdate: {"project:read", "project:update"},
+		},
+		ResourceInventory: {
+			InventoryAdmin:  {"inventory:read", "inventory:write", "inventory:use", "inventory:update_hosts"},
+			InventoryUse:    {"inventory:read", "inventory:use"},
+			InventoryUpdate: {"inventory:read", "inventory:update_hosts"},
+		},
+		ResourceJobTemplate: {
+			JobTemplateAdmin:   {"job_template:read", "job_template:write", "job_template:launch"},
+			JobTemplateExecute: {"job_template:read", "job_template:launch"},
+		},
+		ResourceTerraformJobTemplate: {
+			JobTemplateAdmin:   {"terraform_job_template:read", "terraform_job_template:write", "terraform_job_template:launch"},
+			JobTemplateExecute: {"terraform_job_template:read", "terraform_job_template:launch"},
+		},
+		ResourceTeam: {
+			TeamAdmin:  {"team:read", "team:write"},
+			TeamMember: {"team:read"},
+		},
+	}
+
+	for resourceType, roles := range expected {
+		assert.Len(t, builtinRoles[resourceType], len(roles), resourceType)
+		for role, perms := range roles {
+			for _, permission := range Permissions {
+				assert.Equal(t, containsString(perms, permission),
+					hasRolePermission(resourceType, []string{role}, permission),
+					resourceType+" "+role+" "+permission)
+			}
+			assert.True(t, IsValidRole(resourceType, role))
+		}
+	}
+}
+
+func TestCustomRoles(t *testing.T) {
+	Invalidate()
+	defer Invalidate()
+	// custom roles are looked up by the permissions they include
+	cacheSet("roles:project:update", []string{"deployer"})
+	cacheSet("roles:project:write", []string{})
+
+	assert.True(t, hasRolePermission(ResourceProject, []string{"deployer"}, "project:update"))
+	assert.False(t, hasRolePermission(ResourceProject, []string{"deployer"}, "project:write"))
+	assert.Len(t, rolesWith(ResourceProject, "project:update"), 3)
+	assert.Contains(t, rolesWith(ResourceProject, "project:update"), "deployer")
+	assert.Equal(t, []string{ProjectAdmin}, rolesWith(ResourceProject, "project:write"))
+}
+
+func TestTeamGrants(t *testing.T) {
+	Invalidate()
+	defer Invalidate()
+	user := common.User{ID: bson.NewObjectId()}
+	team, other := bson.NewObjectId(), bson.NewObjectId()
+	cacheSet("teams:"+user.ID.Hex(), []bson.ObjectId{team})
+
+	roles := []common.AccessControl{
+		{Type: RoleTypeTeam, GranteeID: team, Role: ProjectUse},
+		{Type: RoleTypeTeam, GranteeID: other, Role: ProjectAdmin},
+		{Type: RoleTypeUser, GranteeID: user.ID, Role: ProjectUpdate},
+		{Type: RoleTypeUser, GranteeID: bson.NewObjectId(), Role: ProjectAdmin},
+	}
+	assert.Equal(t, []string{ProjectUse, ProjectUpdate}, grantedRoles(user, roles))
+
+	resource := Resource{Type: ResourceProject, Roles: roles}
+	assert.True(t, HasPermission(user, resource, "project:use"))
+	assert.True(t, HasPermission(user, resource, "project:update"))
+}
+
+func TestUnknownRoles(t *testing.T) {
+	Invalidate()
+	defer Invalidate()
+	cacheSet("roles:project:read", []string{})
+
+	// built-in roles of other resource types are not valid
+	assert.False(t, IsValidRole(ResourceCredential, ProjectUpdate))
+	assert.False(t, IsValidRole(ResourceTeam, JobTemplateExecute))
+	assert.False(t, hasRolePermission(ResourceProject, []string{"unknown"}, "project:read"))
+
+	user := common.User{ID: bson.NewObjectId()}
+	cacheSet("teams:"+user.ID.Hex(), []bson.ObjectId{})
+	resource := Resource{Type: ResourceProject, Roles: []common.AccessControl{
+		{Type: RoleTypeUser, GranteeID: user.ID, Role: "unknown"},
+	}}
+	assert.False(t, HasPermission(user, resource, "project:read"))
+	assert.True(t, HasPermission(common.User{IsSystemAuditor: true}, resource, "project:read"))
+	assert.False(t, HasPermission(common.User{IsSystemAuditor: true}, resource, "project:write"))
+	assert.True(t, HasPermission(common.User{IsSuperUser: true}, resource, "project:write"))
+}
+
+// PermissionTestSuite covers permissions which are resolved from the database
+type PermissionTestSuite struct {
+	suite.Suite
+	user         common.User
+	organization common.Organization
+	role         common.Role
+}
+
+func (suite *PermissionTestSuite) SetupSuite() {
+	if err := db.Connect(); err != nil {
+		suite.Fail(err.Error(), "Unable to initialize a connection to database")
+		return
+	}
+
+	suite.user = common.User{ID: bson.NewObjectId()}
+	suite.role = common.Role{
+		ID:          bson.NewObjectId(),
+		Name:        "deployer-" + bson.NewObjectId().Hex(),
+		Permissions: []string{"project:read", "project:update"},
+	}
+	suite.organization = common.Organization{
+		ID:   bson.NewObjectId(),
+		Name: "rbac-" + bson.NewObjectId().Hex(),
+		Roles: []common.AccessControl{
+			{Type: RoleTypeUser, GranteeID: suite.user.ID, Role: OrganizationAdmin},
+		},
+	}
+	if err := db.Roles().Insert(suite.role); err != nil {
+		suite.Fail(err.Error(), "Unable to create role")
+	}
+	if err := db.Organizations().Insert(suite.organization); err != nil {
+		suite.Fail(err.Error(), "Unable to create organization")
+	}
+	Invalidate()
+}
+
+func (suite *PermissionTestSuite) TearDownSuite() {
+	db.Roles().RemoveId(suite.role.ID)
+	db.Organizations().RemoveId(suite.organization.ID)
+	Invalidate()
+}
+
+func (suite *PermissionTestSuite) TestOrganizationAdmin() {
+	resource := Resource{Type: ResourceJobTemplate, OrganizationID: suite.organization.ID}
+	// organization admins inherit every permission on resources of the organization
+	for _, permission := range []string{"job_template:read", "job_template:write", "job_template:launch"} {
+		suite.True(HasPermission(suite.user, resource, permission), permission)
+	}
+	suite.False(HasPermission(common.User{ID: bson.NewObjectId()}, resource, "job_template:read"))
+
+	resource.OrganizationID = bson.NewObjectId()
+	suite.False(HasPermission(suite.user, resource, "job_template:read"))
+}
+
+func (suite *PermissionTestSuite) TestCustomRole() {
+	suite.True(IsValidRole(ResourceProject, suite.role.Name))
+	suite.False(IsValidRole(ResourceProject, "unknown-"+bson.NewObjectId().Hex()))
+
+	resource := Resource{Type: ResourceProject, Roles: []common.AccessControl{
+		{Type: RoleTypeUser, GranteeID: suite.user.ID, Role: suite.role.Name},
+	}}
+	suite.True(HasPermission(suite.user, resource, "project:update"))
+	suite.False(HasPermission(suite.user, resource, "project:write"))
+}
+
+func TestPermissionTestSuite(t *testing.T) {
+	suite.Run(t, new(PermissionTestSuite))
+}
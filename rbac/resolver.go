@@ -0,0 +1,105 @@
+package rbac
+
+import (
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Resolver computes the objects a user holds a permission on. Results are kept
+// for the lifetime of the resolver, create one per request
+type Resolver struct {
+	user     common.User
+	resolved map[string][]bson.ObjectId
+}
+
+// NewResolver returns a resolver for the user
+func NewResolver(user common.User) *Resolver {
+	return &Resolver{user: user, resolved: map[string][]bson.ObjectId{}}
+}
+
+// Accessible returns IDs of the objects of the resource type the user can perform
+// the action on. all is true if the user can access every object of the type
+func (r *Resolver) Accessible(resourceType string, action string) (ids []bson.ObjectId, all bool, err error) {
+	permission := Permission(resourceType, action)
+	if HasGlobalWrite(r.user) || (HasGlobalRead(r.user) && action == ActionRead) {
+		return nil, true, nil
+	}
+
+	if ids, ok := r.resolved[permission]; ok {
+		return ids, false, nil
+	}
+
+	orgs, err := userOrganizations(r.user, permission)
+	if err != nil {
+		return nil, false, err
+	}
+
+	grants := grantConditions(r.user, rolesWith(resourceType, permission))
+	if len(orgs) > 0 {
+		switch resourceType {
+		case ResourceOrganization:
+			grants = append(grants, bson.M{"_id": bson.M{"$in": orgs}})
+		case ResourceJobTemplate, ResourceTerraformJobTemplate:
+			// job templates belong to the organization of the project
+			projects, err := r.ids(db.Projects(), bson.M{"organization_id": bson.M{"$in": orgs}})
+			if err != nil {
+				return nil, false, err
+			}
+			grants = append(grants, bson.M{"project_id": bson.M{"$in": projects}})
+		default:
+			grants = append(grants, bson.M{"organization_id": bson.M{"$in": orgs}})
+		}
+	}
+
+	if ids, err = r.ids(collection(resourceType), bson.M{"$or": grants}); err != nil {
+		return nil, false, err
+	}
+
+	r.resolved[permission] = ids
+	return ids, false, nil
+}
+
+// Filter returns a mongo filter restricting field to IDs of the objects
+// of the resource type the user can perform the action on
+func (r *Resolver) Filter(resourceType string, action string, field string) (bson.M, error) {
+	ids, all, err := r.Accessible(resourceType, action)
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return bson.M{}, nil
+	}
+	return bson.M{field: bson.M{"$in": ids}}, nil
+}
+
+func (r *Resolver) ids(c *mgo.Collection, query bson.M) ([]bson.ObjectId, error) {
+	ids := []bson.ObjectId{}
+	var tmp struct {
+		ID bson.ObjectId `bson:"_id"`
+	}
+	iter := c.Find(query).Select(bson.M{"_id": 1}).Iter()
+	for iter.Next(&tmp) {
+		ids = append(ids, tmp.ID)
+	}
+	return ids, iter.Close()
+}
+
+func collection(resourceType string) *mgo.Collection {
+	switch resourceType {
+	case ResourceOrganization:
+		return db.Organizations()
+	case ResourceCredential:
+		return db.Credentials()
+	case ResourceProject:
+		return db.Projects()
+	case ResourceInventory:
+		return db.Inventories()
+	case ResourceJobTemplate:
+		return db.JobTemplates()
+	case ResourceTerraformJobTemplate:
+		return db.TerrafromJobTemplates()
+	}
+	return db.Teams()
+}
@@ -0,0 +1,154 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestResolverGlobal(t *testing.T) {
+	filter, err := NewResolver(common.User{IsSuperUser: true}).Filter(ResourceProject, ActionWrite, "_id")
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{}, filter)
+
+	auditor := NewResolver(common.User{IsSystemAuditor: true})
+	_, all, err := auditor.Accessible(ResourceInventory, ActionRead)
+	assert.NoError(t, err)
+	assert.True(t, all)
+}
+
+func TestResolverFilter(t *testing.T) {
+	ids := []bson.ObjectId{bson.NewObjectId(), bson.NewObjectId()}
+	r := NewResolver(common.User{ID: bson.NewObjectId()})
+	// resolved permissions are kept for the lifetime of the resolver
+	r.resolved[Permission(ResourceProject, ActionUse)] = ids
+
+	filter, err := r.Filter(ResourceProject, ActionUse, "project_id")
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{"project_id": bson.M{"$in": ids}}, filter)
+}
+
+// ResolverTestSuite covers objects resolved from grants stored in the database
+type ResolverTestSuite struct {
+	suite.Suite
+	user         common.User
+	organization common.Organization
+	team         common.Team
+	projects     []common.Project
+}
+
+func (suite *ResolverTestSuite) SetupSuite() {
+	if err := db.Connect(); err != nil {
+		suite.Fail(err.Error(), "Unable to initialize a connection to database")
+		return
+	}
+
+	suite.user = common.User{ID: bson.NewObjectId()}
+	suite.organization = common.Organization{
+		ID:   bson.NewObjectId(),
+		Name: "resolver-" + bson.NewObjectId().Hex(),
+		Roles: []common.AccessControl{
+			{Type: RoleTypeUser, GranteeID: suite.user.ID, Role: OrganizationMember},
+		},
+	}
+	suite.team = common.Team{
+		ID:             bson.NewObjectId(),
+		Name:           "resolver-" + bson.NewObjectId().Hex(),
+		OrganizationID: suite.organization.ID,
+		Roles: []common.AccessControl{
+			{Type: RoleTypeUser, GranteeID: suite.user.ID, Role: TeamMember},
+		},
+	}
+	other := bson.NewObjectId()
+	suite.projects = []common.Project{
+		// granted to the user
+		{ID: bson.NewObjectId(), Name: "direct", OrganizationID: other, Roles: []common.AccessControl{
+			{Type: RoleTypeUser, GranteeID: suite.user.ID, Role: ProjectUse},
+		}},
+		// granted to the team of the user
+		{ID: bson.NewObjectId(), Name: "team", OrganizationID: other, Roles: []common.AccessControl{
+			{Type: RoleTypeTeam, GranteeID: suite.team.ID, Role: ProjectAdmin},
+		}},
+		// not granted
+		{ID: bson.NewObjectId(), Name: "other", OrganizationID: other, Roles: []common.AccessControl{
+			{Type: RoleTypeUser, GranteeID: bson.NewObjectId(), Role: ProjectAdmin},
+		}},
+	}
+
+	if err := db.Organizations().Insert(suite.organization); err != nil {
+		suite.Fail(err.Error(), "Unable to create organization")
+	}
+	if err := db.Teams().Insert(suite.team); err != nil {
+		suite.Fail(err.Error(), "Unable to create team")
+	}
+	for _, p := range suite.projects {
+		if err := db.Projects().Insert(p); err != nil {
+			suite.Fail(err.Error(), "Unable to create project")
+		}
+	}
+	Invalidate()
+}
+
+func (suite *ResolverTestSuite) TearDownSuite() {
+	db.Organizations().RemoveId(suite.organization.ID)
+	db.Teams().RemoveId(suite.team.ID)
+	for _, p := range suite.projects {
+		db.Projects().RemoveId(p.ID)
+	}
+	Invalidate()
+}
+
+func (suite *ResolverTestSuite) SetupTest() {
+	Invalidate()
+}
+
+func (suite *ResolverTestSuite) TestFilter() {
+	filter, err := NewResolver(suite.user).Filter(ResourceProject, ActionUse, "_id")
+	suite.NoError(err)
+	ids := filter["_id"].(bson.M)["$in"].([]bson.ObjectId)
+	suite.Len(ids, 2)
+	suite.Contains(ids, suite.projects[0].ID)
+	suite.Contains(ids, suite.projects[1].ID)
+
+	count, err := db.Projects().Find(filter).Count()
+	suite.NoError(err)
+	suite.Equal(2, count)
+
+	// write is only granted through the team
+	filter, err = NewResolver(suite.user).Filter(ResourceProject, ActionWrite, "_id")
+	suite.NoError(err)
+	suite.Equal(bson.M{"_id": bson.M{"$in": []bson.ObjectId{suite.projects[1].ID}}}, filter)
+
+	// organization members see the organization
+	filter, err = NewResolver(suite.user).Filter(ResourceOrganization, ActionRead, "organization_id")
+	suite.NoError(err)
+	suite.Equal(bson.M{"organization_id": bson.M{"$in": []bson.ObjectId{suite.organization.ID}}}, filter)
+}
+
+func (suite *ResolverTestSuite) TestInvalidate() {
+	ids, _, err := NewResolver(suite.user).Accessible(ResourceProject, ActionWrite)
+	suite.NoError(err)
+	suite.Equal([]bson.ObjectId{suite.projects[1].ID}, ids)
+
+	// memberships removed with the team are cached until invalidated
+	team := suite.team
+	suite.NoError(db.Teams().RemoveId(team.ID))
+	defer db.Teams().Insert(team)
+
+	ids, _, err = NewResolver(suite.user).Accessible(ResourceProject, ActionWrite)
+	suite.NoError(err)
+	suite.Len(ids, 1)
+
+	Invalidate()
+	ids, _, err = NewResolver(suite.user).Accessible(ResourceProject, ActionWrite)
+	suite.NoError(err)
+	suite.Empty(ids)
+}
+
+func TestResolverTestSuite(t *testing.T) {
+	suite.Run(t, new(ResolverTestSuite))
+}
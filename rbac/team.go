@@ -15,55 +15,16 @@ const (
 
 type Team struct{}
 
-func (Team) Read(user common.User, team common.Team) bool {
-	// allow access if the user is super user or
-	// a system auditor
-	if HasGlobalRead(user) {
-		return true
-	}
-
-	// check whether the user is an member of the objects' organization
-	// since this is read it doesn't matter what permission assigned to the user
-	count, err := db.Organizations().Find(bson.M{
-		"roles.grantee_id": user.ID,
-		"_id":              team.OrganizationID,
-	}).Count()
-	if err != nil {
-		logrus.Errorln("Error while checking the user and organizational memeber:", err)
-	}
-	if count > 0 {
-		return true
-	}
-
-	for _, v := range team.Roles {
-		if v.Type == RoleTypeUser && v.GranteeID == user.ID {
-			return true
-		}
-	}
-
-	return false
+func (t Team) Read(user common.User, team common.Team) bool {
+	return HasPermission(user, t.resource(team), Permission(ResourceTeam, ActionRead))
 }
 
-func (Team) Write(user common.User, team common.Team) bool {
-	// allow access if the user is super user or
-	// a system auditor
-	if HasGlobalWrite(user) {
-		return true
-	}
-
-	// check whether the user is an member of the objects' organization
-	// since this is write permission it is must user need to be an admin
-	if IsOrganizationAdmin(team.OrganizationID, user.ID) {
-		return true
-	}
-
-	for _, v := range team.Roles {
-		if v.Type == RoleTypeUser && v.GranteeID == user.ID && v.Role == TeamAdmin {
-			return true
-		}
-	}
+func (t Team) Write(user common.User, team common.Team) bool {
+	return HasPermission(user, t.resource(team), Permission(ResourceTeam, ActionWrite))
+}
 
-	return false
+func (Team) resource(team common.Team) Resource {
+	return Resource{Type: ResourceTeam, OrganizationID: team.OrganizationID, Roles: team.Roles}
 }
 
 func (Team) Associate(resourceID bson.ObjectId, grantee bson.ObjectId, roleType string, role string) (err error) {
@@ -77,6 +38,7 @@ func (Team) Associate(resourceID bson.ObjectId, grantee bson.ObjectId, roleType
 		}).Errorln("Unable to associate role")
 	}
 
+	Invalidate()
 	return
 }
 
@@ -91,5 +53,6 @@ func (Team) Disassociate(resourceID bson.ObjectId, grantee bson.ObjectId, roleTy
 		}).Errorln("Unable to disassociate role")
 	}
 
+	Invalidate()
 	return
 }
@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// file reads a secret from a file inside the configured file root
+func file(lookup common.SecretLookup) (string, error) {
+	root := util.Config.SecretLookup.FileRoot
+	if len(root) == 0 {
+		return "", errors.New("file lookups are disabled, file root is not configured")
+	}
+
+	path, err := within(root, lookup.Path)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	// editors add a trailing newline which is not part of passwords
+	return strings.TrimRight(string(b), "\n"), nil
+}
+
+// plugin runs an executable in the configured plugin root with the key
+// as its only argument and returns the standard output
+func plugin(lookup common.SecretLookup) (string, error) {
+	conf := util.Config.SecretLookup
+	if len(conf.PluginRoot) == 0 {
+		return "", errors.New("exec lookups are disabled, plugin root is not configured")
+	}
+
+	path, err := within(conf.PluginRoot, lookup.Path)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf.Timeout)*time.Second)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, lookup.Key)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", errors.New("plugin timed out")
+		}
+		if msg := strings.TrimSpace(stderr.String()); len(msg) > 0 {
+			return "", errors.New(err.Error() + ": " + msg)
+		}
+		return "", err
+	}
+
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
+
+// within joins the path to root and makes sure the result does not escape root
+func within(root string, path string) (string, error) {
+	root = filepath.Clean(root)
+	joined := filepath.Join(root, path)
+	if joined != root && strings.HasPrefix(joined, root+string(filepath.Separator)) {
+		return joined, nil
+	}
+	return "", errors.New("path " + path + " is outside of " + root)
+}
@@ -0,0 +1,58 @@
+// Package secrets resolves credential fields that reference an external
+// secret store instead of holding a value
+package secrets
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// Lookup returns the secret the lookup refers to
+func Lookup(lookup common.SecretLookup) (string, error) {
+	switch lookup.Source {
+	case common.SecretSourceVault:
+		return vault(lookup)
+	case common.SecretSourceFile:
+		return file(lookup)
+	case common.SecretSourceExec:
+		return plugin(lookup)
+	}
+	return "", errors.New("unknown secret source " + lookup.Source)
+}
+
+// Resolve replaces credential fields that have a lookup with the referenced secret.
+// Resolved values are encrypted with the data key so callers can decipher them
+// the same way as stored values
+func Resolve(credentials ...*common.Credential) error {
+	for _, credential := range credentials {
+		if credential == nil {
+			continue
+		}
+
+		// resolve in a stable order so the first failure is reported consistently
+		var names []string
+		for name := range credential.Lookups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			lookup := credential.Lookups[name]
+			field := credential.SecretField(name)
+			if field == nil {
+				return errors.New("Credential " + credential.Name + " has a lookup for unknown field " + name)
+			}
+
+			value, err := Lookup(lookup)
+			if err != nil {
+				return errors.New("Unable to resolve " + name + " of credential " + credential.Name +
+					" from " + lookup.Source + " " + lookup.Path + ": " + err.Error())
+			}
+			*field = util.Cipher(value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// vaultStub serves a KV version 1 secret under secret/ssh and
+// a KV version 2 secret under kv/data/aws
+func vaultStub() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/ssh":
+			w.Write([]byte(`{"data": {"private_key": "ssh-key"}}`))
+		case "/v1/kv/data/aws":
+			w.Write([]byte(`{"data": {"data": {"secret": "aws-secret"}, "metadata": {"version": 2}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func withConfig(conf util.SecretLookupConfig) func() {
+	old := util.Config.SecretLookup
+	if conf.Timeout == 0 {
+		conf.Timeout = 5
+	}
+	util.Config.SecretLookup = conf
+	return func() { util.Config.SecretLookup = old }
+}
+
+func TestVaultLookup(t *testing.T) {
+	server := vaultStub()
+	defer server.Close()
+	defer withConfig(util.SecretLookupConfig{VaultAddress: server.URL, VaultToken: "root"})()
+
+	value, err := Lookup(common.SecretLookup{Source: common.SecretSourceVault, Path: "secret/ssh", Key: "private_key"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ssh-key", value)
+
+	value, err = Lookup(common.SecretLookup{Source: common.SecretSourceVault, Path: "kv/data/aws", Key: "secret"})
+	assert.NoError(t, err)
+	assert.Equal(t, "aws-secret", value)
+
+	_, err = Lookup(common.SecretLookup{Source: common.SecretSourceVault, Path: "kv/data/aws", Key: "missing"})
+	assert.Error(t, err)
+
+	_, err = Lookup(common.SecretLookup{Source: common.SecretSourceVault, Path: "secret/missing", Key: "private_key"})
+	assert.Error(t, err)
+}
+
+func TestFileLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "password"), []byte("s3cret\n"), 0600))
+
+	_, err = Lookup(common.SecretLookup{Source: common.SecretSourceFile, Path: "password"})
+	assert.Error(t, err, "file lookups must be disabled without a file root")
+
+	defer withConfig(util.SecretLookupConfig{FileRoot: dir})()
+
+	value, err := Lookup(common.SecretLookup{Source: common.SecretSourceFile, Path: "password"})
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", value)
+
+	_, err = Lookup(common.SecretLookup{Source: common.SecretSourceFile, Path: "../../etc/passwd"})
+	assert.Error(t, err)
+}
+
+func TestExecLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugins")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "echo"), []byte("#!/bin/sh\necho \"value-$1\"\n"), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "fail"), []byte("#!/bin/sh\necho denied >&2\nexit 1\n"), 0700))
+
+	defer withConfig(util.SecretLookupConfig{PluginRoot: dir})()
+
+	value, err := Lookup(common.SecretLookup{Source: common.SecretSourceExec, Path: "echo", Key: "db"})
+	assert.NoError(t, err)
+	assert.Equal(t, "value-db", value)
+
+	_, err = Lookup(common.SecretLookup{Source: common.SecretSourceExec, Path: "fail"})
+	assert.EqualError(t, err, "exit status 1: denied")
+}
+
+func TestResolve(t *testing.T) {
+	server := vaultStub()
+	defer server.Close()
+	defer withConfig(util.SecretLookupConfig{VaultAddress: server.URL, VaultToken: "root"})()
+
+	credential := common.Credential{
+		Name: "machine",
+		Lookups: map[string]common.SecretLookup{
+			"ssh_key_data": {Source: common.SecretSourceVault, Path: "secret/ssh", Key: "private_key"},
+		},
+	}
+	assert.NoError(t, Resolve(&credential))
+	assert.Equal(t, "ssh-key", string(util.Decipher(credential.SSHKeyData)))
+
+	credential.Lookups["password"] = common.SecretLookup{Source: common.SecretSourceVault, Path: "secret/missing", Key: "password"}
+	err := Resolve(&credential)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Unable to resolve password of credential machine")
+}
@@ -0,0 +1,66 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// vault reads a key of a HashiCorp Vault KV secret.
+// Both version 1 and version 2 (secret/data/...) KV engines are supported
+func vault(lookup common.SecretLookup) (string, error) {
+	conf := util.Config.SecretLookup
+	if len(conf.VaultAddress) == 0 {
+		return "", errors.New("vault address is not configured")
+	}
+	if len(lookup.Key) == 0 {
+		return "", errors.New("key is required for vault lookups")
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimRight(conf.VaultAddress, "/")+"/v1/"+strings.TrimLeft(lookup.Path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", conf.VaultToken)
+
+	client := http.Client{Timeout: time.Duration(conf.Timeout) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("vault responded with " + resp.Status)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	data := body.Data
+	// KV version 2 nests the secret under data with the version metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	value, ok := data[lookup.Key]
+	if !ok {
+		return "", errors.New("key " + lookup.Key + " does not exist")
+	}
+	secret, ok := value.(string)
+	if !ok {
+		return "", errors.New("key " + lookup.Key + " is not a string")
+	}
+	return secret, nil
+}
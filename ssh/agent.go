@@ -70,4 +70,13 @@ func GetKey(key []byte, secret []byte) (addedkey agent.AddedKey, err error) {
 	addedkey = agent.AddedKey{}
 	addedkey.PrivateKey, err = sshkeys.ParseEncryptedRawPrivateKey(key, secret)
 	return
-}
\ No newline at end of file
+}
+// AddKey parses a private key, decrypting it with secret when the key is
+// encrypted, and adds it to the agent
+func AddKey(client agent.Agent, key []byte, secret []byte) error {
+	addedkey, err := GetKey(key, secret)
+	if err != nil {
+		return err
+	}
+	return client.Add(addedkey)
+}
@@ -0,0 +1,91 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// clockSkew backdates certificates to tolerate hosts with clocks running behind
+const clockSkew = time.Minute
+
+// CertificateOptions describe a user certificate signed for a single job
+type CertificateOptions struct {
+	// KeyID identifies the certificate in sshd logs
+	KeyID string
+	// Principals are user names the certificate is valid for
+	Principals []string
+	// TTL is the lifetime of the certificate and the agent key
+	TTL time.Duration
+}
+
+// NewCertificate generates an ephemeral key pair and signs a user certificate for it with
+// the certificate authority key, decrypting the authority key with secret when encrypted.
+// The returned key expires from the agent along with the certificate
+func NewCertificate(caKey []byte, secret []byte, opts CertificateOptions) (addedkey agent.AddedKey, err error) {
+	if len(opts.Principals) == 0 {
+		return addedkey, errors.New("Certificate requires at least one principal")
+	}
+	if opts.TTL < time.Second {
+		return addedkey, errors.New("Certificate lifetime must be at least one second")
+	}
+
+	ca, err := GetKey(caKey, secret)
+	if err != nil {
+		return
+	}
+	signer, err := ssh.NewSignerFromKey(ca.PrivateKey)
+	if err != nil {
+		return
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		return
+	}
+
+	var serial [8]byte
+	if _, err = rand.Read(serial[:]); err != nil {
+		return
+	}
+
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        ssh.UserCert,
+		KeyId:           opts.KeyID,
+		ValidPrincipals: opts.Principals,
+		ValidAfter:      uint64(now.Add(-clockSkew).Unix()),
+		ValidBefore:     uint64(now.Add(opts.TTL).Unix()),
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{
+				"permit-agent-forwarding": "",
+				"permit-port-forwarding":  "",
+				"permit-pty":              "",
+				"permit-user-rc":          "",
+			},
+		},
+	}
+	if err = cert.SignCert(rand.Reader, signer); err != nil {
+		return
+	}
+
+	addedkey = agent.AddedKey{
+		PrivateKey:   key,
+		Certificate:  cert,
+		Comment:      opts.KeyID,
+		LifetimeSecs: uint32(opts.TTL.Seconds()),
+	}
+	return
+}
@@ -0,0 +1,87 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func caKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func TestNewCertificate(t *testing.T) {
+	assert := assert.New(t)
+	ca, caPEM := caKey(t)
+
+	key, err := NewCertificate(caPEM, nil, CertificateOptions{
+		KeyID:      "tensor-job-1",
+		Principals: []string{"deploy"},
+		TTL:        time.Hour,
+	})
+	assert.NoError(err)
+	assert.NotNil(key.PrivateKey)
+	assert.Equal(uint32(3600), key.LifetimeSecs)
+
+	cert := key.Certificate
+	assert.Equal(uint32(ssh.UserCert), cert.CertType)
+	assert.Equal("tensor-job-1", cert.KeyId)
+	assert.Equal([]string{"deploy"}, cert.ValidPrincipals)
+	assert.True(cert.ValidBefore <= uint64(time.Now().Add(time.Hour).Unix()))
+
+	caPub, err := ssh.NewPublicKey(&ca.PublicKey)
+	assert.NoError(err)
+	assert.True(bytes.Equal(caPub.Marshal(), cert.SignatureKey.Marshal()), "Certificate must be signed by the CA")
+
+	checker := ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), caPub.Marshal())
+		},
+	}
+	assert.NoError(checker.CheckCert("deploy", cert))
+	assert.Error(checker.CheckCert("root", cert), "Certificate must not be valid for other principals")
+
+	// ephemeral keys are unique per certificate
+	other, err := NewCertificate(caPEM, nil, CertificateOptions{
+		KeyID:      "tensor-job-2",
+		Principals: []string{"deploy"},
+		TTL:        time.Hour,
+	})
+	assert.NoError(err)
+	assert.NotEqual(cert.Serial, other.Certificate.Serial)
+	assert.False(bytes.Equal(cert.Key.Marshal(), other.Certificate.Key.Marshal()))
+}
+
+func TestNewCertificateInvalid(t *testing.T) {
+	assert := assert.New(t)
+	_, caPEM := caKey(t)
+
+	_, err := NewCertificate(caPEM, nil, CertificateOptions{KeyID: "tensor-job-1", TTL: time.Hour})
+	assert.Error(err, "Principals are required")
+
+	_, err = NewCertificate(caPEM, nil, CertificateOptions{KeyID: "tensor-job-1", Principals: []string{"deploy"}})
+	assert.Error(err, "Lifetime is required")
+
+	_, err = NewCertificate([]byte("not a key"), nil, CertificateOptions{
+		KeyID:      "tensor-job-1",
+		Principals: []string{"deploy"},
+		TTL:        time.Hour,
+	})
+	assert.Error(err)
+}
@@ -10,14 +10,17 @@ Unless required by applicable law or agreed to in writing, software distributed
 package main
 
 import (
+	"os"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pearsonappeng/tensor/api"
 	"github.com/pearsonappeng/tensor/db"
 	"github.com/pearsonappeng/tensor/exec/ansible"
+	"github.com/pearsonappeng/tensor/exec/misc"
 	"github.com/pearsonappeng/tensor/exec/terraform"
 	"github.com/pearsonappeng/tensor/log"
+	"github.com/pearsonappeng/tensor/log/redact"
 	"github.com/pearsonappeng/tensor/queue"
 	"github.com/pearsonappeng/tensor/util"
 	"github.com/pearsonappeng/tensor/validate"
@@ -30,6 +33,8 @@ func main() {
 	if util.Config.Debug {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
+	// secrets of running jobs are masked in server logs
+	logrus.AddHook(redact.Hook{})
 	logrus.Infoln("Tensor:", util.Version)
 	logrus.Infoln("Port:", util.Config.Port)
 	logrus.Infoln("MongoDB:", util.Config.MongoDB.Username, util.Config.MongoDB.Hosts, util.Config.MongoDB.DbName)
@@ -49,6 +54,15 @@ func main() {
 		}).Fatalln("Unable to initialize a connection to redis")
 	}
 
+	if util.RotateKeys {
+		failed := rotateKeys()
+		db.MongoDb.Session.Close()
+		if failed > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	defer func() {
 		db.MongoDb.Session.Close()
 	}()
@@ -70,6 +84,7 @@ func main() {
 	//Background tasks
 	go ansible.Run()
 	go terraform.Run()
+	go misc.RunRetries()
 	go queue.RMQCleaner()
 
 	r.Run(util.Config.Port)
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// rotateKeys re-encrypts secret fields of credentials, webhooks of projects, password defaults of
+// surveys and password answers of jobs with the active data key.
+// Fields already encrypted with the active key are left untouched, so the
+// command can be run again if it is interrupted. Security tokens stored in plaintext are encrypted.
+// returns the number of failures
+func rotateKeys() int {
+	rotated, failed := encryptSecurityTokens()
+
+	r, f := rotateCollection("Credential", db.Credentials(), nil, nil, func(iter *mgo.Iter) (bson.ObjectId, map[string]string, bool) {
+		// fresh value for each document, fields are omitted when empty
+		var credential common.Credential
+		if !iter.Next(&credential) {
+			return "", nil, false
+		}
+		return credential.ID, credentialSecrets(credential), true
+	})
+	rotated, failed = rotated+r, failed+f
+
+	r, f = rotateCollection("Project", db.Projects(), bson.M{"webhook.secret": bson.M{"$exists": true, "$ne": ""}}, nil,
+		func(iter *mgo.Iter) (bson.ObjectId, map[string]string, bool) {
+			var project common.Project
+			if !iter.Next(&project) {
+				return "", nil, false
+			}
+			return project.ID, webhookSecrets(project), true
+		})
+	rotated, failed = rotated+r, failed+f
+
+	// templates and jobs are read only for their survey fields
+	surveyQuery := bson.M{"survey_spec": bson.M{"$elemMatch": bson.M{"type": common.SurveyTypePassword}}}
+	nextTemplate := func(iter *mgo.Iter) (bson.ObjectId, map[string]string, bool) {
+		var template surveyTemplate
+		if !iter.Next(&template) {
+			return "", nil, false
+		}
+		return template.ID, surveySecrets(template.SurveySpec), true
+	}
+	r, f = rotateCollection("Job Template", db.JobTemplates(), surveyQuery, bson.M{"survey_spec": 1}, nextTemplate)
+	rotated, failed = rotated+r, failed+f
+	r, f = rotateCollection("Terraform Job Template", db.TerrafromJobTemplates(), surveyQuery, bson.M{"survey_spec": 1}, nextTemplate)
+	rotated, failed = rotated+r, failed+f
+
+	jobQuery := bson.M{"survey_passwords": bson.M{"$exists": true}}
+	nextJob := func(iter *mgo.Iter) (bson.ObjectId, map[string]string, bool) {
+		var job surveyJob
+		if !iter.Next(&job) {
+			return "", nil, false
+		}
+		return job.ID, surveyPasswordSecrets(job.SurveyPasswords), true
+	}
+	r, f = rotateCollection("Job", db.Jobs(), jobQuery, bson.M{"survey_passwords": 1}, nextJob)
+	rotated, failed = rotated+r, failed+f
+	r, f = rotateCollection("Terraform Job", db.TerrafromJobs(), jobQuery, bson.M{"survey_passwords": 1}, nextJob)
+	rotated, failed = rotated+r, failed+f
+
+	logrus.WithFields(logrus.Fields{
+		"Data Key ID": util.Config.DataKeyID,
+		"Rotated":     rotated,
+		"Failed":      failed,
+	}).Infoln("Key rotation completed")
+
+	return failed
+}
+
+// rotateCollection re-encrypts the secrets which next returns for each document matching query,
+// documents are read with fields only when fields is not nil.
+// returns the number of rotated documents and the number of failures
+func rotateCollection(kind string, c *mgo.Collection, query bson.M, fields bson.M,
+	next func(*mgo.Iter) (bson.ObjectId, map[string]string, bool)) (rotated int, failed int) {
+	iter := c.Find(query).Select(fields).Iter()
+	for {
+		id, secrets, ok := next(iter)
+		if !ok {
+			break
+		}
+
+		set, errs := recipher(secrets)
+		for field, err := range errs {
+			logrus.WithFields(logrus.Fields{
+				kind + " ID": id.Hex(),
+				"Field":      field,
+				"Error":      err.Error(),
+			}).Errorln("Unable to decrypt " + kind + " field")
+			failed++
+		}
+
+		if len(set) == 0 {
+			continue
+		}
+
+		if err := c.UpdateId(id, bson.M{"$set": set}); err != nil {
+			logrus.WithFields(logrus.Fields{
+				kind + " ID": id.Hex(),
+				"Error":      err.Error(),
+			}).Errorln("Unable to update " + kind)
+			failed++
+			continue
+		}
+		rotated++
+	}
+
+	if err := iter.Close(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Error while iterating " + c.Name)
+		failed++
+	}
+	return
+}
+
+// encryptSecurityTokens encrypts security tokens of credentials which were stored in plaintext
+// before they were encrypted. returns the number of encrypted credentials and the number of failures
+func encryptSecurityTokens() (encrypted int, failed int) {
+	var credential common.Credential
+	iter := db.Credentials().Find(bson.M{"security_token": bson.M{"$exists": true, "$ne": ""}}).
+		Select(bson.M{"security_token": 1}).Iter()
+	for iter.Next(&credential) {
+		if util.IsCipher(credential.SecurityToken) {
+			continue
+		}
+		set := bson.M{"security_token": util.Cipher(credential.SecurityToken)}
+		if err := db.Credentials().UpdateId(credential.ID, bson.M{"$set": set}); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Credential ID": credential.ID.Hex(),
+				"Error":         err.Error(),
+			}).Errorln("Unable to encrypt security token of Credential")
+			failed++
+			continue
+		}
+		encrypted++
+	}
+
+	if err := iter.Close(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Error while iterating " + db.CCredentials)
+		failed++
+	}
+	return
+}
+
+// recipher re-encrypts secrets which are not encrypted with the active data key.
+// returns the update of re-encrypted fields and errors of fields that could not be decrypted
+func recipher(secrets map[string]string) (bson.M, map[string]error) {
+	set := bson.M{}
+	errs := map[string]error{}
+	for field, value := range secrets {
+		if util.IsActiveCipher(value) {
+			continue
+		}
+		reciphered, err := util.Recipher(value)
+		if err != nil {
+			errs[field] = err
+			continue
+		}
+		set[field] = reciphered
+	}
+	return set, errs
+}
+
+// credentialSecrets returns the encrypted fields of a credential
+func credentialSecrets(credential common.Credential) map[string]string {
+	secrets := map[string]string{
+		"password":           credential.Password,
+		"ssh_key_data":       credential.SSHKeyData,
+		"ssh_key_unlock":     credential.SSHKeyUnlock,
+		"become_password":    credential.BecomePassword,
+		"vault_password":     credential.VaultPassword,
+		"authorize_password": credential.AuthorizePassword,
+		"secret":             credential.Secret,
+		"security_token":     credential.SecurityToken,
+	}
+	// plaintext security tokens are encrypted by encryptSecurityTokens
+	if !util.IsCipher(credential.SecurityToken) {
+		delete(secrets, "security_token")
+	}
+	// secret inputs of custom credentials are stored as a map
+	for name, value := range credential.SecretInputs {
+		secrets["secret_inputs."+name] = value
+	}
+	return secrets
+}
+
+// webhookSecrets returns the encrypted secret of the webhook of a project
+func webhookSecrets(project common.Project) map[string]string {
+	return map[string]string{"webhook.secret": project.Webhook.Secret}
+}
+
+// surveyTemplate is the survey of an Ansible or Terraform job template
+type surveyTemplate struct {
+	ID         bson.ObjectId     `bson:"_id"`
+	SurveySpec common.SurveySpec `bson:"survey_spec"`
+}
+
+// surveyJob holds the password answers of an Ansible or Terraform job
+type surveyJob struct {
+	ID              bson.ObjectId     `bson:"_id"`
+	SurveyPasswords map[string]string `bson:"survey_passwords"`
+}
+
+// surveySecrets returns the encrypted defaults of password questions of a survey
+func surveySecrets(spec common.SurveySpec) map[string]string {
+	secrets := map[string]string{}
+	for i, q := range spec {
+		if value, ok := q.Default.(string); ok && q.Type == common.SurveyTypePassword {
+			secrets["survey_spec."+strconv.Itoa(i)+".default"] = value
+		}
+	}
+	return secrets
+}
+
+// surveyPasswordSecrets returns the encrypted password answers of a job
+func surveyPasswordSecrets(passwords map[string]string) map[string]string {
+	secrets := map[string]string{}
+	for name, value := range passwords {
+		secrets["survey_passwords."+name] = value
+	}
+	return secrets
+}
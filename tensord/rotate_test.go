@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"testing"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecipher(t *testing.T) {
+	assert := assert.New(t)
+	active := util.Cipher("current")
+
+	set, errs := recipher(map[string]string{
+		"password":        legacyCipher(t, "old"),
+		"ssh_key_data":    active,
+		"become_password": "",
+		"secret":          "v2:retired:AAAA",
+	})
+	assert.Len(errs, 1)
+	assert.Contains(errs, "secret")
+	assert.Len(set, 1)
+	assert.True(util.IsActiveCipher(set["password"].(string)))
+	assert.Equal("old", string(util.Decipher(set["password"].(string))))
+}
+
+func TestWebhookSecrets(t *testing.T) {
+	assert := assert.New(t)
+	var project common.Project
+	project.Webhook.Secret = legacyCipher(t, "hook secret")
+
+	set, errs := recipher(webhookSecrets(project))
+	assert.Empty(errs)
+	assert.Len(set, 1)
+	assert.True(util.IsActiveCipher(set["webhook.secret"].(string)))
+	assert.Equal("hook secret", string(util.Decipher(set["webhook.secret"].(string))))
+
+	project.Webhook.Secret = util.Cipher("hook secret")
+	set, errs = recipher(webhookSecrets(project))
+	assert.Empty(errs)
+	assert.Empty(set)
+}
+
+func TestSurveySecrets(t *testing.T) {
+	assert := assert.New(t)
+	spec := common.SurveySpec{
+		{Variable: "region", Type: common.SurveyTypeText, Default: "eu"},
+		{Variable: "token", Type: common.SurveyTypePassword, Default: legacyCipher(t, "default token")},
+		{Variable: "password", Type: common.SurveyTypePassword},
+	}
+
+	set, errs := recipher(surveySecrets(spec))
+	assert.Empty(errs)
+	assert.Len(set, 1)
+	assert.Equal("default token", string(util.Decipher(set["survey_spec.1.default"].(string))))
+
+	set, errs = recipher(surveyPasswordSecrets(map[string]string{
+		"token":    legacyCipher(t, "answer"),
+		"password": util.Cipher("answer"),
+	}))
+	assert.Empty(errs)
+	assert.Len(set, 1)
+	assert.Equal("answer", string(util.Decipher(set["survey_passwords.token"].(string))))
+}
+
+func TestCredentialSecrets(t *testing.T) {
+	credential := common.Credential{
+		Password:      "password",
+		SecretInputs:  map[string]string{"token": "token"},
+		SecurityToken: util.Cipher("session"),
+	}
+	secrets := credentialSecrets(credential)
+	assert.Equal(t, "password", secrets["password"])
+	assert.Equal(t, "token", secrets["secret_inputs.token"])
+	assert.Equal(t, credential.SecurityToken, secrets["security_token"])
+
+	// plaintext security tokens are encrypted instead of reciphered
+	credential.SecurityToken = "session"
+	assert.NotContains(t, credentialSecrets(credential), "security_token")
+}
+
+// legacyCipher encrypts text the way secrets were stored before data keys
+func legacyCipher(t *testing.T, text string) string {
+	block, err := aes.NewCipher([]byte(util.Config.Salt))
+	assert.NoError(t, err)
+	ciphertext := make([]byte, aes.BlockSize+len(text))
+	iv := ciphertext[:aes.BlockSize]
+	_, err = io.ReadFull(rand.Reader, iv)
+	assert.NoError(t, err)
+	cipher.NewCFBEncrypter(block, iv).XORKeyStream(ciphertext[aes.BlockSize:], []byte(text))
+	return base64.URLEncoding.EncodeToString(ciphertext)
+}
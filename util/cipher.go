@@ -4,8 +4,11 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"io"
+	"strings"
 
 	"github.com/Sirupsen/logrus"
 )
@@ -16,60 +19,193 @@ import (
 //fmt.Println(originalText)
 //
 // encrypt value to base64
-//cryptoText := Encrypt(originalText)
+//cryptoText := Cipher(originalText)
 //fmt.Println(cryptoText)
 //
 // encrypt base64 crypto to original value
-//text := Decrypt(cryptoText)
+//text := Decipher(cryptoText)
 //fmt.Printf(text)
+//
+// Ciphertext is formatted as v2:<key id>:<base64 nonce and sealed data>.
+// Values without the prefix were encrypted with AES-CFB using the salt
+// as the key and are still readable.
+
+// cipherVersion prefixes ciphertext produced with AES-GCM
+const cipherVersion = "v2"
+
+// dataKeys holds decoded data keys by key ID
+var dataKeys map[string][]byte
+
+// saltKeyID identifies the data key derived from the salt
+const saltKeyID = "salt"
+
+// loadDataKeys decodes the configured data keys and checks the active key exists.
+// The key derived from the salt is always loaded so secrets encrypted before data_keys
+// were configured stay readable, it is the active key only when no keys are configured
+func loadDataKeys() error {
+	sum := sha256.Sum256([]byte("tensor-data-key:" + Config.Salt))
+	dataKeys = map[string][]byte{saltKeyID: sum[:]}
+
+	if len(Config.DataKeys) == 0 {
+		logrus.Warningln("data_keys is not set, deriving the data key from salt")
+		Config.DataKeyID = saltKeyID
+		return nil
+	}
+
+	for id, encoded := range Config.DataKeys {
+		if len(id) == 0 || strings.Contains(id, ":") {
+			return errors.New("Data key ID " + id + " must be non empty and cannot contain ':'")
+		}
+		if id == saltKeyID {
+			return errors.New("Data key ID " + saltKeyID + " is reserved for the key derived from salt")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return errors.New("Data key " + id + " is not valid base64: " + err.Error())
+		}
+		switch len(key) {
+		case 16, 24, 32:
+		default:
+			return errors.New("Data key " + id + " must be 16, 24 or 32 bytes long")
+		}
+		dataKeys[id] = key
+	}
+
+	if len(Config.DataKeyID) == 0 && len(Config.DataKeys) == 1 {
+		for id := range Config.DataKeys {
+			Config.DataKeyID = id
+		}
+	}
+
+	if _, ok := Config.DataKeys[Config.DataKeyID]; !ok {
+		return errors.New("Active data key " + Config.DataKeyID + " is not defined in data_keys")
+	}
+
+	return nil
+}
 
-// CipherEncrypt encrypts string to base64 crypto using AES
+// Cipher encrypts text with the active data key using AES-GCM
 func Cipher(text string) string {
 	//Return empty string if input text is empty
 	if text == "" {
 		return ""
 	}
-	// key := []byte(keyText)
-	plaintext := []byte(text)
-	block, err := aes.NewCipher([]byte(Config.Salt))
+
+	gcm, err := newGCM(dataKeys[Config.DataKeyID])
 	if err != nil {
 		panic(err)
 	}
-	// The IV needs to be unique, but not secure. Therefore it's common to
-	// include it at the beginning of the ciphertext.
-	ciphertext := make([]byte, aes.BlockSize + len(plaintext))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		logrus.Errorln("Error occurred when reading AES blocks", err.Error())
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		logrus.Errorln("Error occurred when reading nonce", err.Error())
 		return ""
 	}
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
-	// convert to base64
-	return base64.URLEncoding.EncodeToString(ciphertext)
+
+	// nonce is stored at the beginning of the sealed data, the key ID
+	// is authenticated so ciphertext cannot be moved between keys
+	sealed := gcm.Seal(nonce, nonce, []byte(text), []byte(Config.DataKeyID))
+	return cipherVersion + ":" + Config.DataKeyID + ":" + base64.URLEncoding.EncodeToString(sealed)
 }
 
-// CipherDecrypt from base64 to decrypted string
+// Decipher decrypts ciphertext produced by Cipher or by the legacy AES-CFB cipher
 func Decipher(cryptoText string) []byte {
-	ciphertext, err := base64.URLEncoding.DecodeString(cryptoText);
+	plaintext, err := DecipherErr(cryptoText)
+	if err != nil {
+		logrus.Errorln("Error occurred when decrypting cipher text", err.Error())
+	}
+	return plaintext
+}
+
+// DecipherErr is like Decipher but reports failures
+func DecipherErr(cryptoText string) ([]byte, error) {
+	if cryptoText == "" {
+		return nil, nil
+	}
+
+	parts := strings.SplitN(cryptoText, ":", 3)
+	if len(parts) != 3 {
+		return legacyDecipher(cryptoText)
+	}
+
+	if parts[0] != cipherVersion {
+		return nil, errors.New("Unknown cipher version " + parts[0])
+	}
+
+	key, ok := dataKeys[parts[1]]
+	if !ok {
+		return nil, errors.New("Unknown data key " + parts[1])
+	}
+
+	sealed, err := base64.URLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("Cipher text is too short")
+	}
+
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(parts[1]))
+}
+
+// IsCipher reports whether text was encrypted by Cipher
+func IsCipher(text string) bool {
+	return strings.HasPrefix(text, cipherVersion+":")
+}
+
+// IsActiveCipher reports whether the ciphertext is empty or
+// already encrypted with the active data key
+func IsActiveCipher(cryptoText string) bool {
+	return cryptoText == "" || strings.HasPrefix(cryptoText, cipherVersion+":"+Config.DataKeyID+":")
+}
+
+// Recipher re-encrypts ciphertext with the active data key
+func Recipher(cryptoText string) (string, error) {
+	if IsActiveCipher(cryptoText) {
+		return cryptoText, nil
+	}
+
+	plaintext, err := DecipherErr(cryptoText)
+	if err != nil {
+		return "", err
+	}
+
+	return Cipher(string(plaintext)), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// legacyDecipher decrypts base64 AES-CFB ciphertext using the salt as the key
+func legacyDecipher(cryptoText string) ([]byte, error) {
+	ciphertext, err := base64.URLEncoding.DecodeString(cryptoText)
 	if err != nil {
-		logrus.Errorln("Error occurred when generating new cipher block", err.Error())
-		return ciphertext
+		return nil, err
 	}
 	block, err := aes.NewCipher([]byte(Config.Salt))
 	if err != nil {
-		logrus.Errorln("Error occurred when generating new cipher block", err.Error())
-		return ciphertext
+		return nil, err
 	}
 	// The IV needs to be unique, but not secure. Therefore it's common to
 	// include it at the beginning of the ciphertext.
 	if len(ciphertext) < aes.BlockSize {
-		logrus.Errorln("Cipher text is too short")
+		return nil, errors.New("Cipher text is too short")
 	}
 	iv := ciphertext[:aes.BlockSize]
 	ciphertext = ciphertext[aes.BlockSize:]
 	stream := cipher.NewCFBDecrypter(block, iv)
 	// XORKeyStream can work in-place if the two arguments are the same.
 	stream.XORKeyStream(ciphertext, ciphertext)
-	return ciphertext
+	return ciphertext, nil
 }
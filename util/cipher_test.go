@@ -1,7 +1,14 @@
 package util
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
 	"testing"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -12,3 +19,94 @@ func TestDecrypt(t *testing.T) {
 
 	assert.Equal(t, expected, string(actual))
 }
+
+func TestCipherKeyID(t *testing.T) {
+	cryptvalue := Cipher("Hello World")
+	assert.True(t, strings.HasPrefix(cryptvalue, "v2:"+Config.DataKeyID+":"))
+	assert.True(t, IsActiveCipher(cryptvalue))
+	assert.Empty(t, Cipher(""))
+}
+
+func TestDecipherTampered(t *testing.T) {
+	cryptvalue := Cipher("Hello World")
+	sealed, _ := base64.URLEncoding.DecodeString(cryptvalue[strings.LastIndex(cryptvalue, ":")+1:])
+	sealed[len(sealed)-1] ^= 1
+	tampered := "v2:" + Config.DataKeyID + ":" + base64.URLEncoding.EncodeToString(sealed)
+
+	_, err := DecipherErr(tampered)
+	assert.Error(t, err)
+
+	_, err = DecipherErr("v2:unknown:" + base64.URLEncoding.EncodeToString(sealed))
+	assert.Error(t, err)
+}
+
+func TestLegacyDecrypt(t *testing.T) {
+	expected := "Hello World"
+	legacy := legacyCipher(t, expected)
+	assert.False(t, IsActiveCipher(legacy))
+	assert.Equal(t, expected, string(Decipher(legacy)))
+
+	reciphered, err := Recipher(legacy)
+	assert.NoError(t, err)
+	assert.True(t, IsActiveCipher(reciphered))
+	assert.Equal(t, expected, string(Decipher(reciphered)))
+}
+
+func TestRecipherRotatedKey(t *testing.T) {
+	keys, keyID := dataKeys, Config.DataKeyID
+	defer func() { dataKeys, Config.DataKeyID = keys, keyID }()
+
+	old := Cipher("Hello World")
+
+	dataKeys = map[string][]byte{keyID: keys[keyID], "new": make([]byte, 32)}
+	Config.DataKeyID = "new"
+	assert.False(t, IsActiveCipher(old))
+
+	reciphered, err := Recipher(old)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(reciphered, "v2:new:"))
+	assert.Equal(t, "Hello World", string(Decipher(reciphered)))
+}
+
+func TestSaltKeyWithDataKeys(t *testing.T) {
+	keys, keyID, configured := dataKeys, Config.DataKeyID, Config.DataKeys
+	defer func() { dataKeys, Config.DataKeyID, Config.DataKeys = keys, keyID, configured }()
+
+	// secrets are encrypted with the salt key while data_keys is not set
+	Config.DataKeys, Config.DataKeyID = nil, ""
+	assert.NoError(t, loadDataKeys())
+	old := Cipher("Hello World")
+	assert.True(t, strings.HasPrefix(old, "v2:salt:"))
+
+	// and stay readable once data keys are configured
+	Config.DataKeys = map[string]string{"2017-01": base64.StdEncoding.EncodeToString(make([]byte, 32))}
+	Config.DataKeyID = ""
+	assert.NoError(t, loadDataKeys())
+	assert.Equal(t, "2017-01", Config.DataKeyID)
+	assert.False(t, IsActiveCipher(old))
+	assert.Equal(t, "Hello World", string(Decipher(old)))
+
+	reciphered, err := Recipher(old)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(reciphered, "v2:2017-01:"))
+	assert.Equal(t, "Hello World", string(Decipher(reciphered)))
+
+	// the salt key is never used to encrypt when data keys are configured
+	Config.DataKeyID = "salt"
+	assert.Error(t, loadDataKeys())
+	Config.DataKeys["salt"] = Config.DataKeys["2017-01"]
+	Config.DataKeyID = "2017-01"
+	assert.Error(t, loadDataKeys())
+}
+
+// legacyCipher encrypts text the way secrets were stored before data keys
+func legacyCipher(t *testing.T, text string) string {
+	block, err := aes.NewCipher([]byte(Config.Salt))
+	assert.NoError(t, err)
+	ciphertext := make([]byte, aes.BlockSize+len(text))
+	iv := ciphertext[:aes.BlockSize]
+	_, err = io.ReadFull(rand.Reader, iv)
+	assert.NoError(t, err)
+	cipher.NewCFBEncrypter(block, iv).XORKeyStream(ciphertext[aes.BlockSize:], []byte(text))
+	return base64.URLEncoding.EncodeToString(ciphertext)
+}
@@ -19,6 +19,7 @@ import (
 
 var InteractiveSetup bool
 var Secrets bool
+var RotateKeys bool
 
 type MongoDBConfig struct {
 	Hosts      []string `yaml:"hosts"`
@@ -32,6 +33,71 @@ type RedisConfig struct {
 	Host string `yaml:"host"`
 }
 
+// PasswordPolicyConfig holds the rules a user password must satisfy
+type PasswordPolicyConfig struct {
+	MinLength     int  `yaml:"min_length"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+	// Number of previous passwords that cannot be reused, 0 disables the history
+	History int `yaml:"history"`
+}
+
+// SecretLookupConfig configures external stores credential fields can reference
+type SecretLookupConfig struct {
+	VaultAddress string `yaml:"vault_address"`
+	VaultToken   string `yaml:"vault_token"`
+	// Files referenced by credentials must be inside FileRoot,
+	// file lookups are disabled when it is empty
+	FileRoot string `yaml:"file_root"`
+	// Executables in PluginRoot can be used as exec lookups,
+	// exec lookups are disabled when it is empty
+	PluginRoot string `yaml:"plugin_root"`
+	// Timeout in seconds for a single lookup
+	Timeout int `yaml:"timeout"`
+}
+
+// ProjectArchiveConfig limits archives uploaded to manual projects
+type ProjectArchiveConfig struct {
+	// MaxSize of uploaded archives in megabytes
+	MaxSize int `yaml:"max_size"`
+	// MaxUnpackedSize of the content of an archive in megabytes
+	MaxUnpackedSize int `yaml:"max_unpacked_size"`
+	// Number of previous revisions kept for rollback
+	Revisions int `yaml:"revisions"`
+}
+
+// ToolchainConfig is an execution toolchain which projects and templates may select,
+// e.g. a terraform release or an ansible virtualenv
+type ToolchainConfig struct {
+	// Kind of jobs run by the toolchain, ansible or terraform
+	Kind string `yaml:"kind"`
+	// Path of the directory holding the binaries, it comes first on the PATH of jobs
+	Path        string `yaml:"path"`
+	Description string `yaml:"description"`
+}
+
+// IsolationConfig selects how jobs are isolated from the host
+type IsolationConfig struct {
+	// Backend is one of proot, bubblewrap, container or none.
+	// none runs jobs on the host and is meant for development only
+	Backend string `yaml:"backend"`
+	// ContainerRuntime is the docker compatible command which runs containers
+	ContainerRuntime string `yaml:"container_runtime"`
+	// DefaultImage is the execution image of templates which do not select one
+	DefaultImage string `yaml:"default_image"`
+}
+
+// TerraformConfig configures provider plugins shared by terraform jobs
+type TerraformConfig struct {
+	// PluginCacheDir is used by all jobs as TF_PLUGIN_CACHE_DIR
+	PluginCacheDir string `yaml:"plugin_cache_dir"`
+	// ProviderMirror is a directory holding provider plugins for
+	// air-gapped installations, providers are not downloaded when it is set
+	ProviderMirror string `yaml:"provider_mirror"`
+}
+
 type configType struct {
 	MongoDB MongoDBConfig `yaml:"mongodb"`
 
@@ -42,9 +108,18 @@ type configType struct {
 	// Tensor stores projects here
 	ProjectsHome string `yaml:"projects_home"`
 
-	// cookie hashing & encryption
+	// legacy key, used to read secrets encrypted before data keys were introduced
+	// and to sign tokens when jwt_key is not set
 	Salt string `yaml:"salt"`
 
+	// DataKeys maps key IDs to base64 encoded AES keys used to encrypt secrets,
+	// new secrets are encrypted with the key DataKeyID refers to
+	DataKeys  map[string]string `yaml:"data_keys"`
+	DataKeyID string            `yaml:"data_key_id"`
+
+	// JWTKey signs authentication tokens
+	JWTKey string `yaml:"jwt_key"`
+
 	AnsibleJobTimeOut   int `yaml:"ansible_job_timeout"`
 	SyncJobTimeOut      int `yaml:"sync_job_timeout"`
 	TerraformJobTimeOut int `yaml:"terraform_job_timeout"`
@@ -52,14 +127,46 @@ type configType struct {
 	JWTTimeout        int `yaml:"jwt_timeout"`
 	JWTRefreshTimeout int `yaml:"jwt_refresh_timeout"`
 
+	PasswordPolicy PasswordPolicyConfig `yaml:"password_policy"`
+
+	// Account is locked for LoginLockoutTime seconds
+	// after LoginMaxAttempts consecutive failed logins, 0 disables the lockout
+	LoginMaxAttempts int `yaml:"login_max_attempts"`
+	LoginLockoutTime int `yaml:"login_lockout_time"`
+
+	SecretLookup SecretLookupConfig `yaml:"secret_lookup"`
+
+	ProjectArchive ProjectArchiveConfig `yaml:"project_archive"`
+
+	Terraform TerraformConfig `yaml:"terraform"`
+
+	Isolation IsolationConfig `yaml:"isolation"`
+
+	// Toolchains maps names to registered execution toolchains
+	Toolchains map[string]ToolchainConfig `yaml:"toolchains"`
+
 	Debug bool `yaml:"debug"`
 }
 
 var Config *configType
 
+// defaultConfig returns the values settings take when they are not in the configuration file.
+// Defaults are set before the file is read so that settings can be turned off with 0
+func defaultConfig() *configType {
+	return &configType{
+		PasswordPolicy: PasswordPolicyConfig{
+			MinLength: 8,
+			History:   5,
+		},
+		LoginMaxAttempts: 5,
+		LoginLockoutTime: 900,
+	}
+}
+
 func init() {
 	flag.BoolVar(&InteractiveSetup, "setup", false, "perform interactive setup")
 	flag.BoolVar(&Secrets, "secrets", false, "generate salt")
+	flag.BoolVar(&RotateKeys, "rotate-keys", false, "re-encrypt stored secrets with the active data key")
 	var pwd string
 	flag.StringVar(&pwd, "hash", "", "generate hash of given password")
 
@@ -77,7 +184,7 @@ func init() {
 
 	if _, err := os.Stat("/etc/tensor.conf"); os.IsNotExist(err) {
 		logrus.Println("Configuration file does not exist")
-		Config = &configType{} // initialize empty
+		Config = defaultConfig()
 
 	} else {
 		conf, err := ioutil.ReadFile("/etc/tensor.conf")
@@ -87,7 +194,8 @@ func init() {
 			os.Exit(5)
 		}
 
-		if err := yaml.Unmarshal(conf, &Config); err != nil {
+		Config = defaultConfig()
+		if err := yaml.Unmarshal(conf, Config); err != nil {
 			logrus.Fatal("Invalid Configuration!\n\n" + err.Error())
 			os.Exit(6)
 		}
@@ -111,6 +219,29 @@ func init() {
 		Config.Salt = "8m86pie1ef8bghbq41ru!de4"
 	}
 
+	if len(os.Getenv("TENSOR_JWT_KEY")) > 0 {
+		Config.JWTKey = os.Getenv("TENSOR_JWT_KEY")
+	} else if len(Config.JWTKey) == 0 {
+		logrus.Warningln("jwt_key is not set, falling back to salt for signing tokens")
+		Config.JWTKey = Config.Salt
+	}
+
+	if len(os.Getenv("TENSOR_DATA_KEY")) > 0 {
+		if Config.DataKeys == nil {
+			Config.DataKeys = map[string]string{}
+		}
+		Config.DataKeyID = os.Getenv("TENSOR_DATA_KEY_ID")
+		if len(Config.DataKeyID) == 0 {
+			Config.DataKeyID = "env"
+		}
+		Config.DataKeys[Config.DataKeyID] = os.Getenv("TENSOR_DATA_KEY")
+	}
+
+	if err := loadDataKeys(); err != nil {
+		logrus.Fatal("Invalid Configuration!\n\n" + err.Error())
+		os.Exit(6)
+	}
+
 	if len(os.Getenv("TENSOR_ANSIBLE_JOB_TIMEOUT")) > 0 {
 		time, _ := strconv.Atoi(os.Getenv("TENSOR_ANSIBLE_JOB_TIMEOUT"))
 		Config.AnsibleJobTimeOut = time
@@ -146,6 +277,103 @@ func init() {
 		Config.JWTRefreshTimeout = 3600
 	}
 
+	if len(os.Getenv("TENSOR_PASSWORD_MIN_LENGTH")) > 0 {
+		length, _ := strconv.Atoi(os.Getenv("TENSOR_PASSWORD_MIN_LENGTH"))
+		Config.PasswordPolicy.MinLength = length
+	}
+
+	if len(os.Getenv("TENSOR_PASSWORD_HISTORY")) > 0 {
+		history, _ := strconv.Atoi(os.Getenv("TENSOR_PASSWORD_HISTORY"))
+		Config.PasswordPolicy.History = history
+	}
+
+	if os.Getenv("TENSOR_PASSWORD_COMPLEXITY") == "true" {
+		Config.PasswordPolicy.RequireUpper = true
+		Config.PasswordPolicy.RequireLower = true
+		Config.PasswordPolicy.RequireDigit = true
+		Config.PasswordPolicy.RequireSymbol = true
+	}
+
+	if len(os.Getenv("TENSOR_LOGIN_MAX_ATTEMPTS")) > 0 {
+		attempts, _ := strconv.Atoi(os.Getenv("TENSOR_LOGIN_MAX_ATTEMPTS"))
+		Config.LoginMaxAttempts = attempts
+	}
+
+	if len(os.Getenv("TENSOR_LOGIN_LOCKOUT_TIME")) > 0 {
+		time, _ := strconv.Atoi(os.Getenv("TENSOR_LOGIN_LOCKOUT_TIME"))
+		Config.LoginLockoutTime = time
+	}
+
+	if len(os.Getenv("TENSOR_VAULT_ADDR")) > 0 {
+		Config.SecretLookup.VaultAddress = os.Getenv("TENSOR_VAULT_ADDR")
+	}
+
+	if len(os.Getenv("TENSOR_VAULT_TOKEN")) > 0 {
+		Config.SecretLookup.VaultToken = os.Getenv("TENSOR_VAULT_TOKEN")
+	}
+
+	if len(os.Getenv("TENSOR_SECRET_FILE_ROOT")) > 0 {
+		Config.SecretLookup.FileRoot = os.Getenv("TENSOR_SECRET_FILE_ROOT")
+	}
+
+	if len(os.Getenv("TENSOR_SECRET_PLUGIN_ROOT")) > 0 {
+		Config.SecretLookup.PluginRoot = os.Getenv("TENSOR_SECRET_PLUGIN_ROOT")
+	}
+
+	if len(os.Getenv("TENSOR_SECRET_LOOKUP_TIMEOUT")) > 0 {
+		time, _ := strconv.Atoi(os.Getenv("TENSOR_SECRET_LOOKUP_TIMEOUT"))
+		Config.SecretLookup.Timeout = time
+	} else if Config.SecretLookup.Timeout == 0 {
+		Config.SecretLookup.Timeout = 30
+	}
+
+	if len(os.Getenv("TENSOR_PROJECT_ARCHIVE_MAX_SIZE")) > 0 {
+		size, _ := strconv.Atoi(os.Getenv("TENSOR_PROJECT_ARCHIVE_MAX_SIZE"))
+		Config.ProjectArchive.MaxSize = size
+	} else if Config.ProjectArchive.MaxSize == 0 {
+		Config.ProjectArchive.MaxSize = 100
+	}
+
+	if len(os.Getenv("TENSOR_PROJECT_ARCHIVE_MAX_UNPACKED_SIZE")) > 0 {
+		size, _ := strconv.Atoi(os.Getenv("TENSOR_PROJECT_ARCHIVE_MAX_UNPACKED_SIZE"))
+		Config.ProjectArchive.MaxUnpackedSize = size
+	} else if Config.ProjectArchive.MaxUnpackedSize == 0 {
+		Config.ProjectArchive.MaxUnpackedSize = 500
+	}
+
+	if len(os.Getenv("TENSOR_PROJECT_ARCHIVE_REVISIONS")) > 0 {
+		revisions, _ := strconv.Atoi(os.Getenv("TENSOR_PROJECT_ARCHIVE_REVISIONS"))
+		Config.ProjectArchive.Revisions = revisions
+	} else if Config.ProjectArchive.Revisions == 0 {
+		Config.ProjectArchive.Revisions = 5
+	}
+
+	if len(os.Getenv("TENSOR_TERRAFORM_PLUGIN_CACHE_DIR")) > 0 {
+		Config.Terraform.PluginCacheDir = os.Getenv("TENSOR_TERRAFORM_PLUGIN_CACHE_DIR")
+	} else if len(Config.Terraform.PluginCacheDir) == 0 {
+		Config.Terraform.PluginCacheDir = "/var/cache/tensor/terraform/plugins"
+	}
+
+	if len(os.Getenv("TENSOR_TERRAFORM_PROVIDER_MIRROR")) > 0 {
+		Config.Terraform.ProviderMirror = os.Getenv("TENSOR_TERRAFORM_PROVIDER_MIRROR")
+	}
+
+	if len(os.Getenv("TENSOR_ISOLATION_BACKEND")) > 0 {
+		Config.Isolation.Backend = os.Getenv("TENSOR_ISOLATION_BACKEND")
+	} else if len(Config.Isolation.Backend) == 0 {
+		Config.Isolation.Backend = "proot"
+	}
+
+	if len(os.Getenv("TENSOR_CONTAINER_RUNTIME")) > 0 {
+		Config.Isolation.ContainerRuntime = os.Getenv("TENSOR_CONTAINER_RUNTIME")
+	} else if len(Config.Isolation.ContainerRuntime) == 0 {
+		Config.Isolation.ContainerRuntime = "docker"
+	}
+
+	if len(os.Getenv("TENSOR_EXECUTION_IMAGE")) > 0 {
+		Config.Isolation.DefaultImage = os.Getenv("TENSOR_EXECUTION_IMAGE")
+	}
+
 	if len(os.Getenv("TENSOR_DB_USER")) > 0 {
 		Config.MongoDB.Username = os.Getenv("TENSOR_DB_USER")
 	}
@@ -187,4 +415,6 @@ func init() {
 func GenerateSalt() {
 	salt := securecookie.GenerateRandomKey(18)
 	fmt.Println("Generated Salt: ", base64.URLEncoding.EncodeToString(salt))
+	fmt.Println("Generated Data Key: ", base64.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)))
+	fmt.Println("Generated JWT Key: ", base64.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)))
 }
@@ -0,0 +1,46 @@
+package util
+
+import (
+	"strconv"
+	"unicode"
+)
+
+// CheckPasswordPolicy validates the given password against the configured
+// password policy and returns a message for each rule the password violates
+func CheckPasswordPolicy(password string) []string {
+	policy := Config.PasswordPolicy
+	var errs []string
+
+	if len([]rune(password)) < policy.MinLength {
+		errs = append(errs, "Password must be at least "+strconv.Itoa(policy.MinLength)+" characters long.")
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	if policy.RequireUpper && !upper {
+		errs = append(errs, "Password must contain at least one uppercase letter.")
+	}
+	if policy.RequireLower && !lower {
+		errs = append(errs, "Password must contain at least one lowercase letter.")
+	}
+	if policy.RequireDigit && !digit {
+		errs = append(errs, "Password must contain at least one digit.")
+	}
+	if policy.RequireSymbol && !symbol {
+		errs = append(errs, "Password must contain at least one symbol.")
+	}
+
+	return errs
+}
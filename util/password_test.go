@@ -0,0 +1,27 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	policy := Config.PasswordPolicy
+	defer func() { Config.PasswordPolicy = policy }()
+
+	Config.PasswordPolicy = PasswordPolicyConfig{MinLength: 8}
+	assert.Len(t, CheckPasswordPolicy("short"), 1)
+	assert.Empty(t, CheckPasswordPolicy("longenough"))
+
+	Config.PasswordPolicy = PasswordPolicyConfig{
+		MinLength:     8,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	}
+	assert.Len(t, CheckPasswordPolicy("alllowercase"), 3)
+	assert.Len(t, CheckPasswordPolicy("ALLUPPER1"), 2)
+	assert.Empty(t, CheckPasswordPolicy("Valid-Pass1"))
+}
@@ -0,0 +1,38 @@
+package util
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var rxTemplateVariable = regexp.MustCompile(`\{\{\s*([a-zA-Z0-9_.]+)\s*\}\}`)
+
+// TemplateVariables returns names of the variables referenced
+// by a template in {{ name }} form
+func TemplateVariables(tmpl string) []string {
+	var names []string
+	for _, match := range rxTemplateVariable.FindAllStringSubmatch(tmpl, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// RenderTemplate replaces {{ name }} references in the template by values.
+// Referencing a variable that has no value is an error
+func RenderTemplate(tmpl string, values map[string]string) (string, error) {
+	var missing []string
+	rendered := rxTemplateVariable.ReplaceAllStringFunc(tmpl, func(ref string) string {
+		name := rxTemplateVariable.FindStringSubmatch(ref)[1]
+		value, ok := values[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+
+	if len(missing) > 0 {
+		return "", errors.New("undefined variables " + strings.Join(missing, ", "))
+	}
+	return rendered, nil
+}
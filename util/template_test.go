@@ -0,0 +1,25 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateVariables(t *testing.T) {
+	assert.Equal(t, []string{"username", "tensor.filename.config"},
+		TemplateVariables("user={{username}} file={{ tensor.filename.config }}"))
+	assert.Empty(t, TemplateVariables("no variables"))
+}
+
+func TestRenderTemplate(t *testing.T) {
+	actual, err := RenderTemplate("{{ username }}:{{password}}", map[string]string{
+		"username": "admin",
+		"password": "secret",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "admin:secret", actual)
+
+	_, err = RenderTemplate("{{ username }}:{{ token }}", map[string]string{"username": "admin"})
+	assert.EqualError(t, err, "undefined variables token")
+}
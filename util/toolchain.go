@@ -0,0 +1,44 @@
+package util
+
+import (
+	"errors"
+	"sort"
+)
+
+// DefaultPath is the PATH of jobs which do not select a toolchain
+const DefaultPath = "/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// FindToolchain returns the registered toolchain name which runs jobs of kind
+func FindToolchain(name string, kind string) (ToolchainConfig, error) {
+	toolchain, ok := Config.Toolchains[name]
+	if !ok {
+		return toolchain, errors.New("Toolchain " + name + " is not registered")
+	}
+	if toolchain.Kind != kind {
+		return toolchain, errors.New("Toolchain " + name + " does not run " + kind + " jobs")
+	}
+	return toolchain, nil
+}
+
+// ToolchainPath returns the PATH of jobs of kind run by toolchain name,
+// the toolchain directory comes first. An empty name selects DefaultPath
+func ToolchainPath(name string, kind string) (string, error) {
+	if len(name) == 0 {
+		return DefaultPath, nil
+	}
+	toolchain, err := FindToolchain(name, kind)
+	if err != nil {
+		return "", err
+	}
+	return toolchain.Path + ":" + DefaultPath, nil
+}
+
+// ToolchainNames returns names of registered toolchains in lexical order
+func ToolchainNames() []string {
+	names := []string{}
+	for name := range Config.Toolchains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToolchainPath(t *testing.T) {
+	toolchains := Config.Toolchains
+	defer func() { Config.Toolchains = toolchains }()
+
+	Config.Toolchains = map[string]ToolchainConfig{
+		"terraform-0.11": {Kind: "terraform", Path: "/opt/terraform/0.11"},
+		"ansible-2.9":    {Kind: "ansible", Path: "/opt/venvs/ansible-2.9/bin"},
+	}
+
+	path, err := ToolchainPath("", "ansible")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultPath, path)
+
+	path, err = ToolchainPath("ansible-2.9", "ansible")
+	assert.NoError(t, err)
+	assert.Equal(t, "/opt/venvs/ansible-2.9/bin:"+DefaultPath, path)
+
+	_, err = ToolchainPath("ansible-2.9", "terraform")
+	assert.EqualError(t, err, "Toolchain ansible-2.9 does not run terraform jobs")
+	_, err = ToolchainPath("ansible-1.9", "ansible")
+	assert.EqualError(t, err, "Toolchain ansible-1.9 is not registered")
+
+	assert.Equal(t, []string{"ansible-2.9", "terraform-0.11"}, ToolchainNames())
+}
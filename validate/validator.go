@@ -13,6 +13,7 @@ import (
 	"github.com/go-playground/locales/en"
 	"github.com/go-playground/universal-translator"
 	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/rbac"
 	"gopkg.in/gin-gonic/gin.v1/binding"
 	"gopkg.in/go-playground/validator.v9"
 	en_translations "gopkg.in/go-playground/validator.v9/translations/en"
@@ -20,12 +21,16 @@ import (
 
 const (
 	Become           string = "^(sudo|su|pbrun|pfexec|runas|doas|dzdo)$"
-	CredentialKind   string = "^(windows|ssh|net|scm|aws|rax|vmware|satellite6|cloudforms|gce|azure|openstack)$"
+	CredentialKind   string = "^(windows|ssh|ssh_ca|net|scm|aws|rax|vmware|satellite6|cloudforms|gce|azure|openstack|vault|galaxy|custom)$"
 	ScmType          string = "^(manual|git|hg|svn)$"
 	JobType          string = "^(run|check|scan)$"
 	ProjectKind      string = "^(ansible|terraform)$"
 	TerraformJobType string = "^(plan|apply|destroy|destroy_plan)$"
 	ResourceType     string = "^(credential|organization|team|project|job_template|terraform_job_template|inventory)$"
+	SecretSource     string = "^(vault|file|exec)$"
+	Identifier       string = "^[a-zA-Z_][a-zA-Z0-9_]*$"
+	RetryOn          string = "^(any|error|unreachable)$"
+	SurveyType       string = "^(text|textarea|password|integer|float|multiplechoice|multiselect)$"
 
 	DNSName      string = `^([a-zA-Z0-9]{1}[a-zA-Z0-9_-]{1,62}){1}(\.[a-zA-Z0-9]{1}[a-zA-Z0-9_-]{1,62})*$`
 	IP           string = `(([0-9a-fA-F]{1,4}:){7,7}[0-9a-fA-F]{1,4}|([0-9a-fA-F]{1,4}:){1,7}:|([0-9a-fA-F]{1,4}:){1,6}:[0-9a-fA-F]{1,4}|([0-9a-fA-F]{1,4}:){1,5}(:[0-9a-fA-F]{1,4}){1,2}|([0-9a-fA-F]{1,4}:){1,4}(:[0-9a-fA-F]{1,4}){1,3}|([0-9a-fA-F]{1,4}:){1,3}(:[0-9a-fA-F]{1,4}){1,4}|([0-9a-fA-F]{1,4}:){1,2}(:[0-9a-fA-F]{1,4}){1,5}|[0-9a-fA-F]{1,4}:((:[0-9a-fA-F]{1,4}){1,6})|:((:[0-9a-fA-F]{1,4}){1,7}|:)|fe80:(:[0-9a-fA-F]{0,4}){0,4}%[0-9a-zA-Z]{1,}|::(ffff(:0{1,4}){0,1}:){0,1}((25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9])\.){3,3}(25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9])|([0-9a-fA-F]{1,4}:){1,4}:((25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9])\.){3,3}(25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9]))`
@@ -52,6 +57,10 @@ var (
 	rxProjectKind      = regexp.MustCompile(ProjectKind)
 	rxTerraformJobType = regexp.MustCompile(TerraformJobType)
 	rxResourceType     = regexp.MustCompile(ResourceType)
+	rxSecretSource     = regexp.MustCompile(SecretSource)
+	rxIdentifier       = regexp.MustCompile(Identifier)
+	rxRetryOn          = regexp.MustCompile(RetryOn)
+	rxSurveyType       = regexp.MustCompile(SurveyType)
 )
 
 type Validator struct {
@@ -92,10 +101,15 @@ func (v *Validator) lazyinit() {
 		v.validate.RegisterValidation("project_kind", isProjectKind)
 		v.validate.RegisterValidation("terraform_jobtype", isTerraformJobType)
 		v.validate.RegisterValidation("resource_type", isResourceType)
+		v.validate.RegisterValidation("secret_source", isSecretSource)
+		v.validate.RegisterValidation("identifier", isIdentifier)
+		v.validate.RegisterValidation("retry_on", isRetryOn)
+		v.validate.RegisterValidation("survey_type", isSurveyType)
+		v.validate.RegisterValidation("vars", isVars)
 
 		//translations
 		v.validate.RegisterTranslation("credential_kind", trans, func(ut ut.Translator) error {
-			return ut.Add("credential_kind", "{0} must have either one of windows,ssh,net,scm,aws,rax,vmware,satellite6,cloudforms,gce,azure,openstack", true)
+			return ut.Add("credential_kind", "{0} must have either one of windows,ssh,ssh_ca,net,scm,aws,rax,vmware,satellite6,cloudforms,gce,azure,openstack,vault,galaxy,custom", true)
 		}, func(ut ut.Translator, fe validator.FieldError) string {
 			t, _ := ut.T("credential_kind", fe.Field())
 
@@ -166,6 +180,70 @@ func (v *Validator) lazyinit() {
 			return t
 		})
 
+		v.validate.RegisterTranslation("secret_source", trans, func(ut ut.Translator) error {
+			return ut.Add("secret_source", "{0} must have either one of vault,file,exec", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("secret_source", fe.Field())
+
+			return t
+		})
+
+		v.validate.RegisterTranslation("identifier", trans, func(ut ut.Translator) error {
+			return ut.Add("identifier", "{0} must start with a letter or underscore and contain only letters, digits and underscores", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("identifier", fe.Field())
+
+			return t
+		})
+
+		v.validate.RegisterTranslation("retry_on", trans, func(ut ut.Translator) error {
+			return ut.Add("retry_on", "{0} must have either one of any,error,unreachable", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("retry_on", fe.Field())
+
+			return t
+		})
+
+		v.validate.RegisterTranslation("survey_type", trans, func(ut ut.Translator) error {
+			return ut.Add("survey_type", "{0} must have either one of text,textarea,password,integer,float,multiplechoice,multiselect", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("survey_type", fe.Field())
+
+			return t
+		})
+
+		v.validate.RegisterTranslation("vars", trans, func(ut ut.Translator) error {
+			return ut.Add("vars", "{0} must be a YAML or JSON mapping", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("vars", fe.Field())
+
+			return t
+		})
+
+		v.validate.RegisterTranslation("secret_field", trans, func(ut ut.Translator) error {
+			return ut.Add("secret_field", "{0} is not a secret field, lookups are supported for password,ssh_key_data,ssh_key_unlock,become_password,vault_password,authorize_password,secret,security_token", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("secret_field", fe.Field())
+
+			return t
+		})
+
+		v.validate.RegisterTranslation("git_only", trans, func(ut ut.Translator) error {
+			return ut.Add("git_only", "{0} is supported by git projects only", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("git_only", fe.Field())
+
+			return t
+		})
+
+		v.validate.RegisterTranslation("scm_option", trans, func(ut ut.Translator) error {
+			return ut.Add("scm_option", "{0} must not start with -", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("scm_option", fe.Field())
+
+			return t
+		})
+
 		//struct level validations
 		v.validate.RegisterStructValidation(credentialStructLevelValidation, common.Credential{})
 		v.validate.RegisterStructValidation(projectStructLevelValidation, common.Project{})
@@ -229,6 +307,27 @@ func isResourceType(fl validator.FieldLevel) bool {
 	return rxResourceType.MatchString(fl.Field().String())
 }
 
+func isSecretSource(fl validator.FieldLevel) bool {
+	return rxSecretSource.MatchString(fl.Field().String())
+}
+
+func isIdentifier(fl validator.FieldLevel) bool {
+	return rxIdentifier.MatchString(fl.Field().String())
+}
+
+func isRetryOn(fl validator.FieldLevel) bool {
+	return rxRetryOn.MatchString(fl.Field().String())
+}
+
+func isSurveyType(fl validator.FieldLevel) bool {
+	return rxSurveyType.MatchString(fl.Field().String())
+}
+
+func isVars(fl validator.FieldLevel) bool {
+	_, err := common.Vars(fl.Field().String()).Map()
+	return err == nil
+}
+
 // fail all
 func naProperty(fl validator.FieldLevel) bool {
 	if fl.Field().String() == "" {
@@ -271,12 +370,46 @@ func credentialStructLevelValidation(sl validator.StructLevel) {
 
 	credential := sl.Current().Interface().(common.Credential)
 
+	for name, lookup := range credential.Lookups {
+		if credential.SecretField(name) == nil {
+			sl.ReportError(lookup, name, name, "secret_field", "")
+		}
+	}
+
 	if credential.Kind == common.CredentialKindNET && len(credential.Username) == 0 {
 		sl.ReportError(credential.Username, "Username", "Username", "required", "")
 	}
 
+	if credential.Kind == common.CredentialKindCUSTOM && credential.CredentialTypeID == nil {
+		sl.ReportError(credential.CredentialTypeID, "CredentialTypeID", "Credential Type", "required", "")
+	}
+
+	if credential.Kind == common.CredentialKindSSHCA {
+		if !credential.HasSecret("ssh_key_data") {
+			sl.ReportError(credential.SSHKeyData, "SSH Key Data", "CA Key Data", "required", "")
+		}
+
+		if len(credential.Username) == 0 {
+			sl.ReportError(credential.Username, "Username", "Username", "required", "")
+		}
+	}
+
+	if credential.Kind == common.CredentialKindVAULT && !credential.HasSecret("vault_password") {
+		sl.ReportError(credential.VaultPassword, "VaultPassword", "Vault Password", "required", "")
+	}
+
+	if credential.Kind == common.CredentialKindGALAXY {
+		if len(credential.Host) == 0 {
+			sl.ReportError(credential.Host, "Host", "Galaxy Server URL", "required", "")
+		}
+
+		if len(credential.Username) > 0 && !credential.HasSecret("password") {
+			sl.ReportError(credential.Password, "Password", "Password", "required", "")
+		}
+	}
+
 	if credential.Kind == common.CredentialKindAWS {
-		if len(credential.Secret) == 0 {
+		if !credential.HasSecret("secret") {
 			sl.ReportError(credential.Secret, "Secret", "Secret Access Key", "required", "")
 		}
 
@@ -290,7 +423,7 @@ func credentialStructLevelValidation(sl validator.StructLevel) {
 			sl.ReportError(credential.Username, "Username", "Username", "required", "")
 		}
 
-		if len(credential.Secret) == 0 {
+		if !credential.HasSecret("secret") {
 			sl.ReportError(credential.Secret, "Secret", "API Key", "required", "")
 		}
 	}
@@ -304,22 +437,43 @@ func credentialStructLevelValidation(sl validator.StructLevel) {
 			sl.ReportError(credential.Project, "Project", "Project", "required", "")
 		}
 
-		if len(credential.SSHKeyData) == 0 {
+		if !credential.HasSecret("ssh_key_data") {
 			sl.ReportError(credential.SSHKeyData, "SSH Key Data", "SSH Key Data", "required", "")
 		}
 	}
 
+	if credential.Kind == common.CredentialKindOPENSTACK ||
+		credential.Kind == common.CredentialKindVMWARE ||
+		credential.Kind == common.CredentialKindSATELLITE6 ||
+		credential.Kind == common.CredentialKindCLOUDFORMS {
+		if len(credential.Host) == 0 {
+			sl.ReportError(credential.Host, "Host", "Host", "required", "")
+		}
+
+		if len(credential.Username) == 0 {
+			sl.ReportError(credential.Username, "Username", "Username", "required", "")
+		}
+
+		if !credential.HasSecret("password") {
+			sl.ReportError(credential.Password, "Password", "Password", "required", "")
+		}
+	}
+
+	if credential.Kind == common.CredentialKindOPENSTACK && len(credential.Project) == 0 {
+		sl.ReportError(credential.Project, "Project", "Project", "required", "")
+	}
+
 	if credential.Kind == common.CredentialKindAZURE {
 		if len(credential.Username) > 0 {
 			if len(credential.Username) == 0 {
 				sl.ReportError(credential.Username, "Username", "Azure AD User", "required", "")
 			}
 
-			if len(credential.Password) == 0 {
+			if !credential.HasSecret("password") {
 				sl.ReportError(credential.Password, "Password", "Azure AD Password", "required", "")
 			}
 		} else {
-			if len(credential.Secret) == 0 {
+			if !credential.HasSecret("secret") {
 				sl.ReportError(credential.Secret, "Secret", "Azure Secret", "required", "")
 			}
 
@@ -346,41 +500,36 @@ func projectStructLevelValidation(sl validator.StructLevel) {
 		}
 	}
 
+	if project.ScmType != "git" {
+		if len(project.ScmRefspec) > 0 {
+			sl.ReportError(project.ScmRefspec, "Scm Refspec", "ScmRefspec", "git_only", "")
+		}
+		if project.ScmSubmodules {
+			sl.ReportError(project.ScmSubmodules, "Scm Submodules", "ScmSubmodules", "git_only", "")
+		}
+		if project.ScmCloneDepth > 0 {
+			sl.ReportError(project.ScmCloneDepth, "Scm Clone Depth", "ScmCloneDepth", "git_only", "")
+		}
+	}
+
+	// branches and refspecs are passed to scm commands, they would be read as options
+	if strings.HasPrefix(project.ScmBranch, "-") {
+		sl.ReportError(project.ScmBranch, "Scm Branch", "ScmBranch", "scm_option", "")
+	}
+	for _, refspec := range strings.Fields(project.ScmRefspec) {
+		if strings.HasPrefix(refspec, "-") {
+			sl.ReportError(project.ScmRefspec, "Scm Refspec", "ScmRefspec", "scm_option", "")
+			break
+		}
+	}
 }
 
 func roleObjStructLevelValidation(sl validator.StructLevel) {
 	roleobj := sl.Current().Interface().(common.RoleObj)
 
-	switch roleobj.ResourceType {
-	case "credential":
-		{
-			if roleobj.Role != "admin" && roleobj.Role != "use" {
-				sl.ReportError(roleobj.Role, "Role", "Role", "Role must be either one of admin,use", "")
-			}
-		}
-	case "organization":
-		{
-			if roleobj.Role != "admin" && roleobj.Role != "auditor" && roleobj.Role != "member" {
-				sl.ReportError(roleobj.Role, "Role", "Role", "Role must be either one of admin,auditor,member", "")
-			}
-		}
-	case "team":
-		{
-			if roleobj.Role != "admin" && roleobj.Role != "member" {
-				sl.ReportError(roleobj.Role, "Role", "Role", "Role must be either one of admin,member", "")
-			}
-		}
-	case "project", "inventory":
-		{
-			if roleobj.Role != "admin" && roleobj.Role != "update" && roleobj.Role != "use" {
-				sl.ReportError(roleobj.Role, "Role", "Role", "Role must be either one of admin,update,use", "")
-			}
-		}
-	case "job_template", "terraform_job_template":
-		{
-			if roleobj.Role != "admin" && roleobj.Role != "execute" {
-				sl.ReportError(roleobj.Role, "Role", "Role", "Role must be either one of admin,execute", "")
-			}
-		}
+	// built-in roles of the resource type and custom roles can be granted
+	if !rbac.IsValidRole(roleobj.ResourceType, roleobj.Role) {
+		sl.ReportError(roleobj.Role, "Role", "Role", "Role must be either one of "+
+			strings.Join(rbac.BuiltinRoles(roleobj.ResourceType), ",")+" or a custom role", "")
 	}
 }
@@ -0,0 +1,300 @@
+// Package webhook verifies and parses push webhooks sent by SCM providers
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// Supported webhook providers
+const (
+	GitHub    = "github"
+	GitLab    = "gitlab"
+	Bitbucket = "bitbucket"
+)
+
+// Ref types of pushes
+const (
+	RefTypeBranch = "branch"
+	RefTypeTag    = "tag"
+)
+
+// zeroSHA is sent by git providers as the new revision of deleted refs
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// Push describes a push of a branch or a tag
+type Push struct {
+	Provider string
+	// Event is the event name sent by the provider
+	Event string
+	// Ref is the name of the branch or tag
+	Ref     string
+	RefType string
+	SHA     string
+	Pusher  string
+	// DefaultBranch of the repository, when sent by the provider
+	DefaultBranch string
+	Deleted       bool
+}
+
+// IsProvider reports whether webhooks of the provider are supported
+func IsProvider(provider string) bool {
+	return provider == GitHub || provider == GitLab || provider == Bitbucket
+}
+
+// Event returns the event name and the delivery identifier sent in the request headers
+func Event(provider string, header http.Header) (event string, guid string) {
+	switch provider {
+	case GitHub:
+		return header.Get("X-GitHub-Event"), header.Get("X-GitHub-Delivery")
+	case GitLab:
+		return header.Get("X-Gitlab-Event"), header.Get("X-Gitlab-Event-UUID")
+	case Bitbucket:
+		return header.Get("X-Event-Key"), header.Get("X-Request-UUID")
+	}
+	return "", ""
+}
+
+// Verify checks the signature of a delivery against the webhook secret. GitHub and Bitbucket sign
+// the body with HMAC, GitLab sends the secret token as is
+func Verify(provider string, secret []byte, header http.Header, body []byte) error {
+	if len(secret) == 0 {
+		return errors.New("Webhook secret is not configured")
+	}
+
+	if provider == GitLab {
+		token := header.Get("X-Gitlab-Token")
+		if subtle.ConstantTimeCompare([]byte(token), secret) != 1 {
+			return errors.New("Invalid webhook token")
+		}
+		return nil
+	}
+
+	signature := header.Get("X-Hub-Signature-256")
+	if len(signature) == 0 {
+		signature = header.Get("X-Hub-Signature")
+	}
+	if len(signature) == 0 {
+		return errors.New("Webhook signature is missing")
+	}
+
+	var mac hash.Hash
+	switch {
+	case strings.HasPrefix(signature, "sha256="):
+		mac = hmac.New(sha256.New, secret)
+	case strings.HasPrefix(signature, "sha1=") && provider == GitHub:
+		mac = hmac.New(sha1.New, secret)
+	default:
+		return errors.New("Unsupported webhook signature")
+	}
+
+	expected, err := hex.DecodeString(signature[strings.Index(signature, "=")+1:])
+	if err != nil {
+		return errors.New("Invalid webhook signature")
+	}
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return errors.New("Invalid webhook signature")
+	}
+	return nil
+}
+
+// Parse returns the push described by the body of an event. Events other than pushes return nil
+func Parse(provider string, event string, body []byte) (*Push, error) {
+	var push *Push
+	var err error
+	switch provider {
+	case GitHub:
+		if event != "push" {
+			return nil, nil
+		}
+		push, err = parseGitHub(body)
+	case GitLab:
+		if event != "Push Hook" && event != "Tag Push Hook" {
+			return nil, nil
+		}
+		push, err = parseGitLab(body)
+	case Bitbucket:
+		if event != "repo:push" {
+			return nil, nil
+		}
+		push, err = parseBitbucket(body)
+	default:
+		return nil, errors.New("Unsupported webhook provider " + provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	push.Provider = provider
+	push.Event = event
+	return push, nil
+}
+
+// Vars returns extra variables passed to jobs launched by the push
+func (p Push) Vars() map[string]interface{} {
+	return map[string]interface{}{
+		"tensor_webhook_provider": p.Provider,
+		"tensor_webhook_event":    p.Event,
+		"tensor_webhook_ref_type": p.RefType,
+		"tensor_webhook_branch":   p.Ref,
+		"tensor_webhook_sha":      p.SHA,
+		"tensor_webhook_pusher":   p.Pusher,
+	}
+}
+
+// Matches reports whether the push updates a project checking out branch. Pushes to other branches
+// and deleted refs never match, tags match when tags is set. Projects without a branch
+// check out the default branch of the repository
+func (p Push) Matches(branch string, tags bool) bool {
+	if p.Deleted {
+		return false
+	}
+	if p.RefType == RefTypeTag {
+		return tags
+	}
+	if len(branch) == 0 {
+		branch = p.DefaultBranch
+	}
+	return len(branch) == 0 || p.Ref == branch
+}
+
+// splitRef returns the name and type of a fully qualified git ref
+func splitRef(ref string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(ref, "refs/heads/"):
+		return strings.TrimPrefix(ref, "refs/heads/"), RefTypeBranch, nil
+	case strings.HasPrefix(ref, "refs/tags/"):
+		return strings.TrimPrefix(ref, "refs/tags/"), RefTypeTag, nil
+	}
+	return "", "", errors.New("Unsupported ref " + ref)
+}
+
+func parseGitHub(body []byte) (*Push, error) {
+	var payload struct {
+		Ref     string `json:"ref"`
+		After   string `json:"after"`
+		Deleted bool   `json:"deleted"`
+		Pusher  struct {
+			Name string `json:"name"`
+		} `json:"pusher"`
+		Repository struct {
+			DefaultBranch string `json:"default_branch"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	ref, refType, err := splitRef(payload.Ref)
+	if err != nil {
+		return nil, err
+	}
+	return &Push{
+		Ref:           ref,
+		RefType:       refType,
+		SHA:           payload.After,
+		Pusher:        payload.Pusher.Name,
+		DefaultBranch: payload.Repository.DefaultBranch,
+		Deleted:       payload.Deleted || payload.After == zeroSHA,
+	}, nil
+}
+
+func parseGitLab(body []byte) (*Push, error) {
+	var payload struct {
+		Ref          string `json:"ref"`
+		After        string `json:"after"`
+		UserUsername string `json:"user_username"`
+		UserName     string `json:"user_name"`
+		Project      struct {
+			DefaultBranch string `json:"default_branch"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	ref, refType, err := splitRef(payload.Ref)
+	if err != nil {
+		return nil, err
+	}
+	pusher := payload.UserUsername
+	if len(pusher) == 0 {
+		pusher = payload.UserName
+	}
+	return &Push{
+		Ref:           ref,
+		RefType:       refType,
+		SHA:           payload.After,
+		Pusher:        pusher,
+		DefaultBranch: payload.Project.DefaultBranch,
+		Deleted:       payload.After == zeroSHA,
+	}, nil
+}
+
+// parseBitbucket returns the first change of a push, bitbucket sends a change for each pushed ref
+func parseBitbucket(body []byte) (*Push, error) {
+	type ref struct {
+		Type   string `json:"type"`
+		Name   string `json:"name"`
+		Target struct {
+			Hash string `json:"hash"`
+		} `json:"target"`
+	}
+	var payload struct {
+		Actor struct {
+			Nickname    string `json:"nickname"`
+			DisplayName string `json:"display_name"`
+		} `json:"actor"`
+		Push struct {
+			Changes []struct {
+				New *ref `json:"new"`
+				Old *ref `json:"old"`
+			} `json:"changes"`
+		} `json:"push"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if len(payload.Push.Changes) == 0 {
+		return nil, errors.New("Push contains no changes")
+	}
+
+	pusher := payload.Actor.Nickname
+	if len(pusher) == 0 {
+		pusher = payload.Actor.DisplayName
+	}
+
+	change := payload.Push.Changes[0]
+	push := &Push{Pusher: pusher}
+	r := change.New
+	if r == nil {
+		push.Deleted = true
+		r = change.Old
+	}
+	if r == nil {
+		return nil, errors.New("Push contains no changes")
+	}
+
+	switch r.Type {
+	case "branch", "named_branch":
+		push.RefType = RefTypeBranch
+	case "tag", "annotated_tag":
+		push.RefType = RefTypeTag
+	default:
+		return nil, errors.New("Unsupported ref type " + r.Type)
+	}
+	push.Ref = r.Name
+	if !push.Deleted {
+		push.SHA = r.Target.Hash
+	}
+	return push, nil
+}
@@ -0,0 +1,178 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fixture returns a recorded webhook payload
+func fixture(t *testing.T, name string) []byte {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func sign(h func() hash.Hash, secret string, body []byte) string {
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify(t *testing.T) {
+	assert := assert.New(t)
+	body := fixture(t, "github_push.json")
+	secret := []byte("s3cret")
+
+	header := http.Header{}
+	header.Set("X-Hub-Signature-256", "sha256="+sign(sha256.New, "s3cret", body))
+	assert.NoError(Verify(GitHub, secret, header, body))
+	assert.NoError(Verify(Bitbucket, secret, header, body))
+	assert.Error(Verify(GitHub, []byte("other"), header, body), "Signature of another secret must fail")
+	assert.Error(Verify(GitHub, secret, header, append(body, ' ')), "Signature of a modified body must fail")
+	assert.Error(Verify(GitHub, nil, header, body), "Webhooks without a secret must fail")
+
+	// legacy github signatures
+	header = http.Header{}
+	header.Set("X-Hub-Signature", "sha1="+sign(sha1.New, "s3cret", body))
+	assert.NoError(Verify(GitHub, secret, header, body))
+	assert.Error(Verify(Bitbucket, secret, header, body))
+
+	assert.Error(Verify(GitHub, secret, http.Header{}, body), "Unsigned deliveries must fail")
+
+	header = http.Header{}
+	header.Set("X-Hub-Signature-256", "sha256=not-hex")
+	assert.Error(Verify(GitHub, secret, header, body))
+
+	// gitlab sends the secret token
+	header = http.Header{}
+	header.Set("X-Gitlab-Token", "s3cret")
+	assert.NoError(Verify(GitLab, secret, header, body))
+	header.Set("X-Gitlab-Token", "other")
+	assert.Error(Verify(GitLab, secret, header, body))
+}
+
+func TestParseGitHub(t *testing.T) {
+	assert := assert.New(t)
+
+	push, err := Parse(GitHub, "push", fixture(t, "github_push.json"))
+	assert.NoError(err)
+	assert.Equal(&Push{
+		Provider:      GitHub,
+		Event:         "push",
+		Ref:           "master",
+		RefType:       RefTypeBranch,
+		SHA:           "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c",
+		Pusher:        "deploy",
+		DefaultBranch: "master",
+	}, push)
+
+	push, err = Parse(GitHub, "push", fixture(t, "github_tag.json"))
+	assert.NoError(err)
+	assert.Equal("v1.2.0", push.Ref)
+	assert.Equal(RefTypeTag, push.RefType)
+	assert.Equal("release", push.Pusher)
+
+	// events other than pushes are ignored
+	push, err = Parse(GitHub, "ping", fixture(t, "github_ping.json"))
+	assert.NoError(err)
+	assert.Nil(push)
+
+	_, err = Parse(GitHub, "push", []byte("{"))
+	assert.Error(err)
+}
+
+func TestParseGitLab(t *testing.T) {
+	assert := assert.New(t)
+
+	push, err := Parse(GitLab, "Push Hook", fixture(t, "gitlab_push.json"))
+	assert.NoError(err)
+	assert.Equal("develop", push.Ref)
+	assert.Equal(RefTypeBranch, push.RefType)
+	assert.Equal("da1560886d4f094c3e6c9ef40349f7d38b5d27d7", push.SHA)
+	assert.Equal("jsmith", push.Pusher)
+	assert.Equal("master", push.DefaultBranch)
+	assert.False(push.Deleted)
+
+	push, err = Parse(GitLab, "Tag Push Hook", fixture(t, "gitlab_tag_push.json"))
+	assert.NoError(err)
+	assert.Equal("v1.0.0", push.Ref)
+	assert.Equal(RefTypeTag, push.RefType)
+}
+
+func TestParseBitbucket(t *testing.T) {
+	assert := assert.New(t)
+
+	push, err := Parse(Bitbucket, "repo:push", fixture(t, "bitbucket_push.json"))
+	assert.NoError(err)
+	assert.Equal(&Push{
+		Provider: Bitbucket,
+		Event:    "repo:push",
+		Ref:      "master",
+		RefType:  RefTypeBranch,
+		SHA:      "709d658dc5b6d6afcd46049c2f332ee3f515a67d",
+		Pusher:   "jdoe",
+	}, push)
+
+	push, err = Parse(Bitbucket, "repo:push", fixture(t, "bitbucket_delete.json"))
+	assert.NoError(err)
+	assert.True(push.Deleted)
+	assert.Equal("feature/nginx", push.Ref)
+	assert.Empty(push.SHA)
+}
+
+func TestEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	header := http.Header{}
+	header.Set("X-GitHub-Event", "push")
+	header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	event, guid := Event(GitHub, header)
+	assert.Equal("push", event)
+	assert.Equal("72d3162e-cc78-11e3-81ab-4c9367dc0958", guid)
+
+	header = http.Header{}
+	header.Set("X-Event-Key", "repo:push")
+	header.Set("X-Request-UUID", "afe3ce6f-d4ea-4f5b-b0a7-2c4fd1d8f6a1")
+	event, guid = Event(Bitbucket, header)
+	assert.Equal("repo:push", event)
+	assert.Equal("afe3ce6f-d4ea-4f5b-b0a7-2c4fd1d8f6a1", guid)
+
+	_, err := Parse("gogs", "push", fixture(t, "github_push.json"))
+	assert.Error(err)
+}
+
+func TestMatches(t *testing.T) {
+	assert := assert.New(t)
+
+	push := Push{Ref: "master", RefType: RefTypeBranch, DefaultBranch: "master"}
+	assert.True(push.Matches("master", false))
+	assert.True(push.Matches("", false), "Projects without a branch follow the default branch")
+	assert.False(push.Matches("develop", false))
+
+	push.DefaultBranch = ""
+	assert.True(push.Matches("", false))
+
+	push.Deleted = true
+	assert.False(push.Matches("master", false), "Deleted branches never match")
+
+	tag := Push{Ref: "v1.0.0", RefType: RefTypeTag}
+	assert.False(tag.Matches("master", false))
+	assert.True(tag.Matches("master", true))
+
+	vars := Push{Provider: GitHub, Event: "push", Ref: "master", RefType: RefTypeBranch,
+		SHA: "0d1a26e", Pusher: "deploy"}.Vars()
+	assert.Equal("0d1a26e", vars["tensor_webhook_sha"])
+	assert.Equal("master", vars["tensor_webhook_branch"])
+	assert.Equal("deploy", vars["tensor_webhook_pusher"])
+}